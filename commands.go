@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	"go-drive/common/event"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/drive"
+	"go-drive/server"
+	"go-drive/server/metadata"
+	"go-drive/server/search"
+	"go-drive/server/thumbnail"
+	"go-drive/storage"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+// command registers its flags to the global flag set, which is parsed by common.InitConfig,
+// and returns the function to run the command
+type command func(fs *flag.FlagSet) func(ctx context.Context, ch *registry.ComponentsHolder) error
+
+var commands = map[string]command{
+	"export":           exportSettingsCommand,
+	"import":           importSettingsCommand,
+	"useradd":          userAddCommand,
+	"passwd":           passwdCommand,
+	"drives":           drivesCommand,
+	"migrate":          migrateCommand,
+	"reindex":          reindexCommand,
+	"clear-cache":      clearCacheCommand,
+	"clear-thumbnails": clearThumbnailsCommand,
+}
+
+// runCommand runs the subcommand in the arguments without starting the server,
+// it returns false if there is no subcommand
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	run := cmd(flag.CommandLine)
+
+	ch := registry.NewComponentHolder()
+	e := run(context.Background(), ch)
+	_ = ch.Dispose()
+	if e != nil {
+		log.Fatalln(translateError(e))
+	}
+	return true
+}
+
+// translateError translates the i18n message of the error to the default language
+func translateError(e error) string {
+	if _, ue := i18n.UnmarshalT(e.Error()); ue != nil {
+		return e.Error()
+	}
+	ms, me := i18n.NewFileMessageSource(langResourceFS())
+	if me != nil {
+		return e.Error()
+	}
+	return i18n.TranslateT("en-US", ms, e.Error())
+}
+
+// initDB initializes the configuration and the database, the migrations are applied by the way
+func initDB(ch *registry.ComponentsHolder) (common.Config, *storage.DB, error) {
+	config, e := common.InitConfig(ch)
+	if e != nil {
+		return config, nil, e
+	}
+	db, e := storage.NewDB(config, ch)
+	return config, db, e
+}
+
+// initSettingsIO initializes the database and the drive types, which are required by the settings
+func initSettingsIO(ctx context.Context, ch *registry.ComponentsHolder) (*server.SettingsIO, error) {
+	config, db, e := initDB(ch)
+	if e != nil {
+		return nil, e
+	}
+	driveRegistry := driveutil.NewDriveRegistry(ch)
+	if e := drive.RegisterAllDrives(ctx, config, ch); e != nil {
+		return nil, e
+	}
+	userDAO := storage.NewUserDAO(db, ch)
+	settingsDAO := storage.NewSettingsDAO(db, storage.NewOptionsDAO(db, ch), storage.NewPathMetaDAO(db, ch),
+		storage.NewFileBucketDAO(db, ch), userDAO, ch)
+	return server.NewSettingsIO(settingsDAO, userDAO, driveRegistry), nil
+}
+
+func exportSettingsCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	output := fs.String("o", "", "output file, the standard output by default")
+	redact := fs.Bool("redact", false, "replace the secrets with placeholders")
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		sio, e := initSettingsIO(ctx, ch)
+		if e != nil {
+			return e
+		}
+		doc, e := sio.Export(*redact)
+		if e != nil {
+			return e
+		}
+		data, e := server.MarshalSettingsDocument(doc)
+		if e != nil {
+			return e
+		}
+		if *output == "" {
+			_, e = os.Stdout.Write(data)
+			return e
+		}
+		return os.WriteFile(*output, data, 0600)
+	}
+}
+
+func importSettingsCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		// the flags are parsed by common.InitConfig
+		sio, e := initSettingsIO(ctx, ch)
+		if e != nil {
+			return e
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: %s import [-c config] [-dry-run] <file|->", os.Args[0])
+		}
+		var r io.Reader = os.Stdin
+		if file := fs.Arg(0); file != "-" {
+			f, e := os.Open(file)
+			if e != nil {
+				return e
+			}
+			defer func() { _ = f.Close() }()
+			r = f
+		}
+		doc, e := server.ParseSettingsDocument(r)
+		if e != nil {
+			return e
+		}
+		diff, e := sio.Import(doc, *dryRun)
+		if e != nil {
+			return e
+		}
+		for _, w := range diff.Warnings {
+			fmt.Println("warning:", w)
+		}
+		for _, c := range diff.Changes {
+			fmt.Printf("%s %s/%s\n", map[string]string{
+				server.SettingsChangeCreate: "+",
+				server.SettingsChangeUpdate: "~",
+				server.SettingsChangeDelete: "-",
+			}[c.Action], c.Section, c.Key)
+		}
+		switch {
+		case len(diff.Changes) == 0:
+			fmt.Println("No changes.")
+		case diff.Applied:
+			fmt.Printf("%d changes applied, restart the server if it's running to load them.\n", len(diff.Changes))
+		default:
+			fmt.Printf("%d changes to apply.\n", len(diff.Changes))
+		}
+		return nil
+	}
+}
+
+// readPassword reads the password from the standard input, without echo if it is a terminal,
+// or from the first line of the piped input
+func readPassword() (string, error) {
+	_, _ = fmt.Fprint(os.Stderr, "Password: ")
+	var password string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, e := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(os.Stderr)
+		if e != nil {
+			return "", e
+		}
+		password = string(b)
+	} else {
+		line, e := bufio.NewReader(os.Stdin).ReadString('\n')
+		if e != nil && e != io.EOF {
+			return "", e
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", fmt.Errorf("the password is empty")
+	}
+	return password, nil
+}
+
+func userAddCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	admin := fs.Bool("admin", false, "add the user to the admin group")
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		_, db, e := initDB(ch)
+		if e != nil {
+			return e
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: %s useradd [-c config] [-admin] <username>", os.Args[0])
+		}
+		password, e := readPassword()
+		if e != nil {
+			return e
+		}
+		user := types.User{Username: fs.Arg(0), Password: password}
+		if *admin {
+			user.Groups = []types.Group{{Name: types.AdminUserGroup}}
+		}
+		if _, e := storage.NewUserDAO(db, ch).AddUser(user); e != nil {
+			return e
+		}
+		fmt.Printf("User %s created.\n", user.Username)
+		return nil
+	}
+}
+
+func passwdCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		_, db, e := initDB(ch)
+		if e != nil {
+			return e
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: %s passwd [-c config] <username>", os.Args[0])
+		}
+		userDAO := storage.NewUserDAO(db, ch)
+		user, e := userDAO.GetUser(fs.Arg(0))
+		if e != nil {
+			return e
+		}
+		if user.Managed {
+			return storage.NewManagedError(user.Username)
+		}
+		password, e := readPassword()
+		if e != nil {
+			return e
+		}
+		// the groups are kept when they are nil
+		if e := userDAO.UpdateUser(user.Username, types.User{
+			Password: password, RootPath: user.RootPath, SSHKeys: user.SSHKeys,
+		}); e != nil {
+			return e
+		}
+		fmt.Printf("Password of %s updated, restart the running server to apply it.\n", user.Username)
+		return nil
+	}
+}
+
+func drivesCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		_, db, e := initDB(ch)
+		if e != nil {
+			return e
+		}
+		driveDAO := storage.NewDriveDAO(db, ch)
+		switch {
+		case fs.NArg() == 0 || fs.NArg() == 1 && fs.Arg(0) == "list":
+			drives, e := driveDAO.GetDrives()
+			if e != nil {
+				return e
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "NAME\tTYPE\tENABLED\tMANAGED")
+			for _, d := range drives {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%t\t%t\n", d.Name, d.Type, d.Enabled, d.Managed)
+			}
+			return w.Flush()
+		case fs.NArg() == 2 && (fs.Arg(0) == "enable" || fs.Arg(0) == "disable"):
+			d, e := driveDAO.GetDrive(fs.Arg(1))
+			if e != nil {
+				return fmt.Errorf("drive %s not found", fs.Arg(1))
+			}
+			if d.Managed {
+				return storage.NewManagedError(d.Name)
+			}
+			d.Enabled = fs.Arg(0) == "enable"
+			if e := driveDAO.UpdateDrive(d.Name, d); e != nil {
+				return e
+			}
+			fmt.Printf("Drive %s %sd, reload the drives or restart the server if it's running.\n", d.Name, fs.Arg(0))
+			return nil
+		default:
+			return fmt.Errorf("usage: %s drives [-c config] [list | enable <name> | disable <name>]", os.Args[0])
+		}
+	}
+}
+
+func migrateCommand(*flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		// the migrations are applied when opening the database
+		_, db, e := initDB(ch)
+		if e != nil {
+			return e
+		}
+		version, e := db.SchemaVersion()
+		if e != nil {
+			return e
+		}
+		fmt.Printf("The database is up to date, schema version %d.\n", version)
+		return nil
+	}
+}
+
+func reindexCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	path := fs.String("path", "", "the path to rebuild the index of, all drives by default")
+	ignoreError := fs.Bool("ignore-error", false, "skip the folders that can't be read")
+	full := fs.Bool("full", false, "rebuild the whole index instead of updating the changed entries")
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		config, db, e := initDB(ch)
+		if e != nil {
+			return e
+		}
+		driveutil.NewDriveRegistry(ch)
+		if e := drive.RegisterAllDrives(ctx, config, ch); e != nil {
+			return e
+		}
+		bus := event.NewBus(ch)
+		rootDrive, e := drive.NewRootDrive(ctx, config, storage.NewDriveDAO(db, ch), storage.NewPathMountDAO(db, ch),
+			storage.NewDriveDataDAO(db, ch), storage.NewDriveCacheDAO(db, ch), bus, ch)
+		if e != nil {
+			return e
+		}
+		media, e := metadata.NewService(config, storage.NewMediaMetadataDAO(db, ch), bus, ch)
+		if e != nil {
+			return e
+		}
+		service, e := search.NewService(ch, config, storage.NewOptionsDAO(db, ch), rootDrive,
+			task.NewPondRunner(config, ch), bus, media)
+		if e != nil {
+			return e
+		}
+		status, e := service.IndexAll(task.NewTaskContext(ctx), *path, *ignoreError, *full)
+		if e != nil {
+			return e
+		}
+		fmt.Printf("Index of /%s updated: %s.\n", *path, status)
+		return nil
+	}
+}
+
+func clearCacheCommand(fs *flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		config, db, e := initDB(ch)
+		if e != nil {
+			return e
+		}
+		// the arguments are the drives to clear, all drives by default
+		names := fs.Args()
+		driveCacheDAO := storage.NewDriveCacheDAO(db, ch)
+		if len(names) == 0 {
+			e = driveCacheDAO.EvictAll()
+		}
+		for _, name := range names {
+			if e = driveCacheDAO.EvictCacheStore(name); e != nil {
+				break
+			}
+		}
+		if e != nil {
+			return e
+		}
+		if e := drive.RemoveContentCaches(config, names...); e != nil {
+			return e
+		}
+		fmt.Println("Drive caches cleared.")
+		return nil
+	}
+}
+
+func clearThumbnailsCommand(*flag.FlagSet) func(context.Context, *registry.ComponentsHolder) error {
+	return func(ctx context.Context, ch *registry.ComponentsHolder) error {
+		config, e := common.InitConfig(ch)
+		if e != nil {
+			return e
+		}
+		n, e := thumbnail.RemoveAll(config)
+		if e != nil {
+			return e
+		}
+		fmt.Printf("%d thumbnail files deleted.\n", n)
+		return nil
+	}
+}
@@ -53,7 +53,14 @@ const (
 	DefaultSignatureTTL        = 12 * time.Hour
 	DefaultWebDavPrefix        = "/dav"
 	DefaultWebDavMaxCacheItems = 1000
+	DefaultSFTPListen          = ":2022"
+	DefaultSFTPHostKey         = "sftp_host_key"
+	DefaultSFTPMaxCacheItems   = 1000
+	DefaultS3Prefix            = "/s3"
+	DefaultFTPListen           = ":2121"
 	DefaultSearcher            = "sqlite"
+	DefaultSearchMaxFileSize   = "20m"
+	DefaultSearchMaxTextSize   = "1m"
 
 	DefaultCacheType                      = "mem"
 	DefaultCacheCleanPeriod time.Duration = 10 * time.Minute
@@ -105,10 +112,22 @@ type Config struct {
 
 	WebDav WebDavConfig `yaml:"web-dav"`
 
+	SFTP SFTPConfig `yaml:"sftp"`
+
+	S3 S3Config `yaml:"s3"`
+
+	FTP FTPConfig `yaml:"ftp"`
+
 	Search SearchConfig `yaml:"search"`
 
+	Metadata MetadataConfig `yaml:"metadata"`
+
 	Cache CacheConfig `yaml:"cache"`
 
+	// ProvisioningFile declares the users, groups, drives, permissions and mounts,
+	// which are reconciled on startup and on SIGHUP
+	ProvisioningFile string `yaml:"provisioning-file"`
+
 	Version string
 	RevHash string
 	BuildAt string
@@ -128,6 +147,17 @@ type ThumbnailConfig struct {
 	TTL        time.Duration          `yaml:"ttl"`
 	Concurrent int                    `yaml:"concurrent"`
 	Handlers   []ThumbnailHandlerItem `yaml:"handlers"`
+	// Store is where the generated thumbnails are shared with other instances,
+	// only the local cache is used if the type is empty
+	Store ThumbnailStoreConfig `yaml:"store"`
+	// Pregenerate is the path patterns whose thumbnails are generated when the entries are updated
+	Pregenerate []string `yaml:"pregenerate"`
+}
+
+type ThumbnailStoreConfig struct {
+	// Type is the store type, available type is drive
+	Type   string   `yaml:"type"`
+	Config types.SM `yaml:"config"`
 }
 
 type ThumbnailHandlerItem struct {
@@ -162,10 +192,68 @@ type WebDavConfig struct {
 	MaxCacheItems  int    `yaml:"max-cache-items"`
 }
 
+type SFTPConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	// HostKey is the path of the server's private key, relative to DataDir.
+	// A new ed25519 key is generated if it does not exist.
+	HostKey       string `yaml:"host-key"`
+	MaxCacheItems int    `yaml:"max-cache-items"`
+}
+
+type S3Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Prefix is the path of the endpoint, clients must use path-style requests.
+	Prefix string `yaml:"prefix"`
+}
+
+type FTPConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	// PassivePorts is the port range of the passive data connections, such as "50000-50100".
+	// Any free port is used if it's empty.
+	PassivePorts string `yaml:"passive-ports"`
+	// PublicHost is the IPv4 address announced to the clients in the PASV reply,
+	// the local address of the control connection is used if it's empty.
+	PublicHost string `yaml:"public-host"`
+	// TLSCert and TLSKey are the PEM files of the certificate for explicit FTPS (AUTH TLS), relative to DataDir.
+	TLSCert string `yaml:"tls-cert"`
+	TLSKey  string `yaml:"tls-key"`
+	// TLSRequired rejects the logins over plain connections
+	TLSRequired bool `yaml:"tls-required"`
+}
+
 type SearchConfig struct {
 	Enabled bool     `yaml:"enabled"`
 	Type    string   `yaml:"type"`
 	Config  types.SM `yaml:"config"`
+	// Content is the text extraction of the file contents, which are indexed along with the file names
+	Content SearchContentConfig `yaml:"content"`
+}
+
+type SearchContentConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxFileSize is the size limit of the files to extract the text from, such as 20m
+	MaxFileSize string `yaml:"max-file-size"`
+	// MaxTextSize is the size limit of the text indexed for each file, the rest is ignored
+	MaxTextSize string `yaml:"max-text-size"`
+	// FileTypes is the file extensions separated by comma to extract the text from,
+	// all the supported types by default
+	FileTypes string `yaml:"file-types"`
+}
+
+type MetadataConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Extractors are the media metadata extractors, all the built-in extractors by default
+	Extractors []MetadataExtractorItem `yaml:"extractors"`
+}
+
+type MetadataExtractorItem struct {
+	// Type is the extractor type, available types are exif, audio and mp4
+	Type string `yaml:"type"`
+	// FileTypes is the file extensions separated by comma, all the supported types of the extractor by default
+	FileTypes string   `yaml:"file-types"`
+	Config    types.SM `yaml:"config"`
 }
 
 type CacheConfig struct {
@@ -200,8 +288,26 @@ func InitConfig(ch *registry.ComponentsHolder) (Config, error) {
 			Prefix:        DefaultWebDavPrefix,
 			MaxCacheItems: DefaultWebDavMaxCacheItems,
 		},
+		SFTP: SFTPConfig{
+			Enabled:       false,
+			Listen:        DefaultSFTPListen,
+			HostKey:       DefaultSFTPHostKey,
+			MaxCacheItems: DefaultSFTPMaxCacheItems,
+		},
+		S3: S3Config{
+			Enabled: false,
+			Prefix:  DefaultS3Prefix,
+		},
+		FTP: FTPConfig{
+			Enabled: false,
+			Listen:  DefaultFTPListen,
+		},
 		Search: SearchConfig{
 			Type: DefaultSearcher,
+			Content: SearchContentConfig{
+				MaxFileSize: DefaultSearchMaxFileSize,
+				MaxTextSize: DefaultSearchMaxTextSize,
+			},
 		},
 		Cache: CacheConfig{
 			Type:        DefaultCacheType,
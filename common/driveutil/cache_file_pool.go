@@ -91,6 +91,13 @@ func (cfp *CacheFilePool) GetReader(key string, size int64, getReader ReaderGett
 	return cf.Reader()
 }
 
+// Remove removes the cache of the key, the cache file is removed after the readers are closed
+func (cfp *CacheFilePool) Remove(key string) {
+	cfp.mu.Lock()
+	defer cfp.mu.Unlock()
+	cfp.entries.Remove(key)
+}
+
 func (cfp *CacheFilePool) onCacheEvicted(_ string, cf *cacheFile) {
 	cf.mu.Lock()
 	defer cf.mu.Unlock()
@@ -0,0 +1,444 @@
+package driveutil
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	contentCacheDataExt = ".data"
+	contentCacheMetaExt = ".meta"
+)
+
+// ContentCacheConfigForm returns the configuration form items of the local content cache.
+// Drives add these items to their ConfigForm to allow the content cache to be enabled.
+func ContentCacheConfigForm() []types.FormItem {
+	t := i18n.TPrefix("drive.content_cache.")
+	return []types.FormItem{
+		{Label: t("size.label"), Type: "text", Field: "content_cache_size", Description: t("size.description")},
+		{Label: t("max_file_size.label"), Type: "text", Field: "content_cache_max_file_size", Description: t("max_file_size.description")},
+	}
+}
+
+// ContentCacheSize returns the configured size budget of the content cache, 0 means disabled
+func ContentCacheSize(config types.SM) (maxSize, maxFileSize int64) {
+	maxSize = config.GetDataSize("content_cache_size", 0)
+	maxFileSize = config.GetDataSize("content_cache_max_file_size", maxSize)
+	if maxFileSize <= 0 || maxFileSize > maxSize {
+		maxFileSize = maxSize
+	}
+	return
+}
+
+// ContentCache caches file contents on the local disk up to a size budget.
+// Cached files are keyed by path, size and modification time, so a changed file
+// is never served from the cache. The least recently used files are evicted
+// when the budget is exceeded. The cache survives restarts.
+type ContentCache struct {
+	dir         string
+	maxSize     int64
+	maxFileSize int64
+
+	mu      sync.Mutex
+	items   map[string]*list.Element
+	lru     *list.List
+	used    int64
+	filling map[string]chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type contentCacheItem struct {
+	key  string
+	path string
+	size int64
+}
+
+func NewContentCache(dir string, maxSize, maxFileSize int64) (*ContentCache, error) {
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return nil, e
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &ContentCache{
+		dir:         dir,
+		maxSize:     maxSize,
+		maxFileSize: maxFileSize,
+		items:       make(map[string]*list.Element),
+		lru:         list.New(),
+		filling:     make(map[string]chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	if e := c.load(); e != nil {
+		cancel()
+		return nil, e
+	}
+	return c, nil
+}
+
+// load restores the cached files from dir, the last accessed time is the file's modification time.
+func (c *ContentCache) load() error {
+	files, e := os.ReadDir(c.dir)
+	if e != nil {
+		return e
+	}
+	type loaded struct {
+		item    *contentCacheItem
+		accessT time.Time
+	}
+	items := make([]loaded, 0)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+		if !strings.HasSuffix(name, contentCacheMetaExt) {
+			if !strings.HasSuffix(name, contentCacheDataExt) {
+				// incomplete files left by an interrupted fill
+				_ = os.Remove(filepath.Join(c.dir, name))
+			}
+			continue
+		}
+		key := strings.TrimSuffix(name, contentCacheMetaExt)
+		path, e := os.ReadFile(filepath.Join(c.dir, name))
+		stat, se := os.Stat(c.dataFile(key))
+		if e != nil || se != nil {
+			c.removeFiles(key)
+			continue
+		}
+		items = append(items, loaded{&contentCacheItem{key: key, path: string(path), size: stat.Size()}, stat.ModTime()})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].accessT.After(items[j].accessT) })
+	for _, it := range items {
+		c.items[it.item.key] = c.lru.PushBack(it.item)
+		c.used += it.item.size
+	}
+	c.evictLocked()
+	return nil
+}
+
+func contentCacheKey(entry types.IEntry) string {
+	h := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d\x00%d", entry.Path(), entry.Size(), entry.ModTime()))
+	return hex.EncodeToString(h[:])
+}
+
+func (c *ContentCache) dataFile(key string) string {
+	return filepath.Join(c.dir, key+contentCacheDataExt)
+}
+
+func (c *ContentCache) removeFiles(key string) {
+	_ = os.Remove(c.dataFile(key))
+	_ = os.Remove(filepath.Join(c.dir, key+contentCacheMetaExt))
+}
+
+func (c *ContentCache) evictLocked() {
+	for c.used > c.maxSize && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *ContentCache) removeLocked(el *list.Element) {
+	item := c.lru.Remove(el).(*contentCacheItem)
+	delete(c.items, item.key)
+	c.used -= item.size
+	c.removeFiles(item.key)
+}
+
+// open opens the cached file of key and marks it as recently used.
+func (c *ContentCache) open(key string) *os.File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	f, e := os.Open(c.dataFile(key))
+	if e != nil {
+		c.removeLocked(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	now := time.Now()
+	_ = os.Chtimes(f.Name(), now, now)
+	return f
+}
+
+// Cacheable reports whether the content of entry can be cached
+func (c *ContentCache) Cacheable(entry types.IEntry) bool {
+	c.mu.Lock()
+	maxFileSize := c.maxFileSize
+	c.mu.Unlock()
+	return entry.Type().IsFile() && entry.Size() > 0 && entry.Size() <= maxFileSize
+}
+
+// Resize changes the size budget, the least recently used files are evicted to fit in it
+func (c *ContentCache) Resize(maxSize, maxFileSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = maxSize
+	c.maxFileSize = maxFileSize
+	c.evictLocked()
+}
+
+// GetReader reads the content of entry from the cache.
+// On cache miss, a full read fills the cache while it is being read, and a ranged read
+// is served by the entry while the whole file is cached in background.
+func (c *ContentCache) GetReader(ctx context.Context, entry types.IEntry, start, size int64) (io.ReadCloser, error) {
+	if !c.Cacheable(entry) {
+		return GetIContentReader(ctx, entry, start, size)
+	}
+	key := contentCacheKey(entry)
+	if f := c.open(key); f != nil {
+		return sectionReadCloser(f, entry.Size(), start, size), nil
+	}
+
+	if start <= 0 && (size < 0 || size >= entry.Size()) {
+		if fill := c.beginFill(key); fill != nil {
+			r, e := GetIContentReader(ctx, entry, -1, -1)
+			if e != nil {
+				fill.abort()
+				return nil, e
+			}
+			return &fillingReader{r: r, fill: fill, path: entry.Path(), size: entry.Size()}, nil
+		}
+		return GetIContentReader(ctx, entry, start, size)
+	}
+
+	r, e := GetIContentReader(ctx, entry, start, size)
+	if e == nil || !err.IsUnsupportedError(e) {
+		if e == nil {
+			c.fillInBackground(key, entry)
+		}
+		return r, e
+	}
+	// the drive can't read ranges, the whole file has to be cached first
+	if e := c.fill(ctx, key, entry); e != nil {
+		return nil, e
+	}
+	if f := c.open(key); f != nil {
+		return sectionReadCloser(f, entry.Size(), start, size), nil
+	}
+	return nil, err.NewUnsupportedError()
+}
+
+func (c *ContentCache) fillInBackground(key string, entry types.IEntry) {
+	fill := c.beginFill(key)
+	if fill == nil {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if e := fill.copyFrom(c.ctx, entry); e != nil && !errors.Is(e, context.Canceled) {
+			log.Printf("[content cache] error caching '%s': %v", utils.LogSanitize(entry.Path()), e)
+		}
+	}()
+}
+
+// fill caches entry and waits until it is done, or another fill of the same entry is done.
+func (c *ContentCache) fill(ctx context.Context, key string, entry types.IEntry) error {
+	fill := c.beginFill(key)
+	if fill == nil {
+		c.mu.Lock()
+		done := c.filling[key]
+		c.mu.Unlock()
+		if done != nil {
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+	return fill.copyFrom(ctx, entry)
+}
+
+// beginFill returns nil if key is already cached or being filled
+func (c *ContentCache) beginFill(key string) *contentFill {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return nil
+	}
+	if _, ok := c.items[key]; ok {
+		return nil
+	}
+	if _, ok := c.filling[key]; ok {
+		return nil
+	}
+	f, e := os.CreateTemp(c.dir, "fill-")
+	if e != nil {
+		log.Printf("[content cache] error creating file: %v", e)
+		return nil
+	}
+	done := make(chan struct{})
+	c.filling[key] = done
+	return &contentFill{c: c, key: key, file: f, done: done}
+}
+
+type contentFill struct {
+	c    *ContentCache
+	key  string
+	file *os.File
+	done chan struct{}
+	once sync.Once
+}
+
+func (f *contentFill) copyFrom(ctx context.Context, entry types.IEntry) error {
+	r, e := GetIContentReader(ctx, entry, -1, -1)
+	if e != nil {
+		f.abort()
+		return e
+	}
+	defer func() { _ = r.Close() }()
+	n, e := io.Copy(f.file, r)
+	if e != nil {
+		f.abort()
+		return e
+	}
+	if n != entry.Size() {
+		f.abort()
+		return fmt.Errorf("expected %d bytes, but got %d bytes", entry.Size(), n)
+	}
+	return f.commit(entry.Path(), n)
+}
+
+func (f *contentFill) commit(path string, size int64) error {
+	var e error
+	f.once.Do(func() {
+		defer close(f.done)
+		c := f.c
+		_ = f.file.Close()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.filling, f.key)
+		// the files of a disposed cache may belong to the new cache of the drive
+		if e = c.ctx.Err(); e != nil {
+			_ = os.Remove(f.file.Name())
+			return
+		}
+		if e = os.WriteFile(filepath.Join(c.dir, f.key+contentCacheMetaExt), []byte(path), 0644); e == nil {
+			e = os.Rename(f.file.Name(), c.dataFile(f.key))
+		}
+		if e != nil {
+			_ = os.Remove(f.file.Name())
+			c.removeFiles(f.key)
+			return
+		}
+		c.items[f.key] = c.lru.PushFront(&contentCacheItem{key: f.key, path: path, size: size})
+		c.used += size
+		c.evictLocked()
+	})
+	return e
+}
+
+func (f *contentFill) abort() {
+	f.once.Do(func() {
+		defer close(f.done)
+		_ = f.file.Close()
+		_ = os.Remove(f.file.Name())
+		f.c.mu.Lock()
+		delete(f.c.filling, f.key)
+		f.c.mu.Unlock()
+	})
+}
+
+// fillingReader writes the content to the cache while it is being read.
+// The file is cached only if it has been read to the end.
+type fillingReader struct {
+	r    io.ReadCloser
+	fill *contentFill
+	path string
+	size int64
+	n    int64
+	e    error
+}
+
+func (fr *fillingReader) Read(p []byte) (int, error) {
+	n, e := fr.r.Read(p)
+	if n > 0 && fr.e == nil {
+		if _, we := fr.fill.file.Write(p[:n]); we != nil {
+			fr.e = we
+		}
+		fr.n += int64(n)
+	}
+	if e != nil && e != io.EOF {
+		fr.e = e
+	}
+	return n, e
+}
+
+func (fr *fillingReader) Close() error {
+	if fr.e == nil && fr.n == fr.size {
+		_ = fr.fill.commit(fr.path, fr.n)
+	} else {
+		fr.fill.abort()
+	}
+	return fr.r.Close()
+}
+
+func sectionReadCloser(f *os.File, fileSize, start, size int64) io.ReadCloser {
+	start = max(start, 0)
+	if size < 0 || start+size > fileSize {
+		size = fileSize - start
+	}
+	return &sectionFile{SectionReader: io.NewSectionReader(f, start, max(size, 0)), f: f}
+}
+
+type sectionFile struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s *sectionFile) Close() error {
+	return s.f.Close()
+}
+
+// Invalidate removes the cached files of path, and its descendants if descendants is true
+func (c *ContentCache) Invalidate(path string, descendants bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		item := el.Value.(*contentCacheItem)
+		if item.path == path || (descendants && utils.IsPathParent(item.path, path)) {
+			c.removeLocked(el)
+		}
+		el = next
+	}
+}
+
+// Clear removes all cached files
+func (c *ContentCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Front())
+	}
+}
+
+// Dispose stops filling, the fills in progress are discarded. Cached files are kept on disk.
+func (c *ContentCache) Dispose() error {
+	c.cancel()
+	c.wg.Wait()
+	return nil
+}
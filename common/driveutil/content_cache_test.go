@@ -0,0 +1,194 @@
+package driveutil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+)
+
+type contentTestEntry struct {
+	cacheTestEntry
+	data    []byte
+	modTime int64
+	noRange bool
+	reads   *atomic.Int32
+}
+
+func newContentTestEntry(path string, data []byte) contentTestEntry {
+	return contentTestEntry{cacheTestEntry: cacheTestEntry{path: path}, data: data, modTime: 1, reads: &atomic.Int32{}}
+}
+
+func (e contentTestEntry) Size() int64    { return int64(len(e.data)) }
+func (e contentTestEntry) ModTime() int64 { return e.modTime }
+
+func (e contentTestEntry) GetReader(_ context.Context, start, size int64) (io.ReadCloser, error) {
+	if e.noRange && (start >= 0 || size > 0) {
+		return nil, err.NewUnsupportedError()
+	}
+	e.reads.Add(1)
+	return byteReaderGetter(e.data)(start, size)
+}
+
+func readContent(t *testing.T, c *ContentCache, entry types.IEntry, start, size int64) string {
+	t.Helper()
+	r, e := c.GetReader(context.Background(), entry, start, size)
+	if e != nil {
+		t.Fatalf("GetReader: %v", e)
+	}
+	b, e := io.ReadAll(r)
+	_ = r.Close()
+	if e != nil {
+		t.Fatalf("read: %v", e)
+	}
+	return string(b)
+}
+
+func TestContentCacheFullReadFillsCache(t *testing.T) {
+	dir := t.TempDir()
+	c, e := NewContentCache(dir, 1024, 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	entry := newContentTestEntry("a/b.txt", []byte("0123456789"))
+
+	if got := readContent(t, c, entry, -1, -1); got != "0123456789" {
+		t.Fatalf("first read = %q", got)
+	}
+	if got := readContent(t, c, entry, 2, 3); got != "234" {
+		t.Fatalf("ranged read = %q", got)
+	}
+	if got := readContent(t, c, entry, 8, -1); got != "89" {
+		t.Fatalf("ranged read to the end = %q", got)
+	}
+	if n := entry.reads.Load(); n != 1 {
+		t.Fatalf("entry read %d times, want 1", n)
+	}
+
+	// a changed file is not served from the cache
+	changed := entry
+	changed.modTime = 2
+	changed.data = []byte("changed")
+	if got := readContent(t, c, changed, -1, -1); got != "changed" {
+		t.Fatalf("changed read = %q", got)
+	}
+
+	// the cache is restored after restart
+	_ = c.Dispose()
+	c, e = NewContentCache(dir, 1024, 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	before := entry.reads.Load()
+	if got := readContent(t, c, entry, 0, 4); got != "0123" {
+		t.Fatalf("read after restart = %q", got)
+	}
+	if entry.reads.Load() != before {
+		t.Fatal("cached content was not restored")
+	}
+
+	c.Invalidate("a", true)
+	_ = readContent(t, c, entry, 0, 4)
+	_ = c.Dispose()
+	if entry.reads.Load() == before {
+		t.Fatal("invalidated content was served from the cache")
+	}
+}
+
+func TestContentCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, e := NewContentCache(t.TempDir(), 20, 20)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = c.Dispose() })
+	a := newContentTestEntry("a", bytes.Repeat([]byte("a"), 8))
+	b := newContentTestEntry("b", bytes.Repeat([]byte("b"), 8))
+	large := newContentTestEntry("large", bytes.Repeat([]byte("l"), 21))
+	_ = readContent(t, c, a, -1, -1)
+	_ = readContent(t, c, b, -1, -1)
+	_ = readContent(t, c, a, -1, -1)
+	_ = readContent(t, c, large, -1, -1)
+
+	// caching c evicts b, which is the least recently used
+	cc := newContentTestEntry("c", bytes.Repeat([]byte("c"), 8))
+	_ = readContent(t, c, cc, -1, -1)
+
+	for _, tc := range []struct {
+		entry  contentTestEntry
+		reads  int32
+		cached bool
+	}{{a, 1, true}, {cc, 1, true}, {b, 1, false}} {
+		_ = readContent(t, c, tc.entry, -1, -1)
+		want := tc.reads
+		if !tc.cached {
+			want++
+		}
+		if got := tc.entry.reads.Load(); got != want {
+			t.Errorf("%s: read %d times, want %d", tc.entry.path, got, want)
+		}
+	}
+	_ = readContent(t, c, large, -1, -1)
+	if got := large.reads.Load(); got != 2 {
+		t.Errorf("file larger than the max file size was cached")
+	}
+}
+
+func TestContentCacheRangedReadFillsInBackground(t *testing.T) {
+	c, e := NewContentCache(t.TempDir(), 1024, 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = c.Dispose() })
+	entry := newContentTestEntry("video.mp4", []byte("0123456789"))
+	if got := readContent(t, c, entry, 5, 2); got != "56" {
+		t.Fatalf("ranged read = %q", got)
+	}
+	eventually(t, time.Second, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.lru.Len() == 1
+	})
+
+	noRange := newContentTestEntry("ftp.bin", []byte("abcdef"))
+	noRange.noRange = true
+	if got := readContent(t, c, noRange, 2, 2); got != "cd" {
+		t.Fatalf("ranged read of a drive without range support = %q", got)
+	}
+}
+
+func TestContentCacheDisposedDoesNotFill(t *testing.T) {
+	dir := t.TempDir()
+	c, e := NewContentCache(dir, 1024, 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	entry := newContentTestEntry("a.txt", []byte("0123456789"))
+
+	// a fill in progress is discarded if the cache is disposed before it completes
+	r, e := c.GetReader(context.Background(), entry, -1, -1)
+	if e != nil {
+		t.Fatalf("GetReader: %v", e)
+	}
+	_ = c.Dispose()
+	if _, e := io.ReadAll(r); e != nil {
+		t.Fatalf("read: %v", e)
+	}
+	_ = r.Close()
+	if got := readContent(t, c, entry, -1, -1); got != "0123456789" {
+		t.Fatalf("read of the disposed cache = %q", got)
+	}
+
+	files, e := os.ReadDir(dir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(files) != 0 {
+		t.Fatalf("disposed cache left %d files", len(files))
+	}
+}
@@ -42,6 +42,10 @@ type DriveUtils struct {
 	Data        DriveDataStore
 	CreateCache DriveCacheFactory
 	Config      common.Config
+	// Root is the virtual root drive. Drives that read from other drives
+	// (such as the archive drive) resolve their source paths through it.
+	// Other drives are not guaranteed to be available when Create is called.
+	Root types.IDrive
 }
 
 type DriveFactory struct {
@@ -15,14 +15,21 @@ var (
 	KeyRootDrive     = componentKey{k: "rootDrive"}
 	KeyDriveRegistry = componentKey{k: "driveRegistry"}
 
-	KeyUserAuth      = componentKey{k: "userAuth"}
-	KeyEventBus      = componentKey{k: "eventBus"}
-	KeyTaskRunner    = componentKey{k: "taskRunner"}
-	KeyJobExecutor   = componentKey{k: "jobExecutor"}
-	KeyFailBanGroup  = componentKey{k: "failBanGroup"}
-	KeyThumbnail     = componentKey{k: "thumbnail"}
-	KeySearchService = componentKey{k: "searchService"}
-	KeyTokenStore    = componentKey{k: "tokenStore"}
+	KeyUserAuth           = componentKey{k: "userAuth"}
+	KeyEventBus           = componentKey{k: "eventBus"}
+	KeyTaskRunner         = componentKey{k: "taskRunner"}
+	KeyJobExecutor        = componentKey{k: "jobExecutor"}
+	KeyFailBanGroup       = componentKey{k: "failBanGroup"}
+	KeyThumbnail          = componentKey{k: "thumbnail"}
+	KeyThumbnailGenerator = componentKey{k: "thumbnailGenerator"}
+	KeySearchService      = componentKey{k: "searchService"}
+	KeyMediaMetadata      = componentKey{k: "mediaMetadata"}
+	KeyPhotoService       = componentKey{k: "photoService"}
+	KeyTokenStore         = componentKey{k: "tokenStore"}
+	KeySFTPServer         = componentKey{k: "sftpServer"}
+	KeyFTPServer          = componentKey{k: "ftpServer"}
+	KeyS3Gateway          = componentKey{k: "s3Gateway"}
+	KeyProvisioner        = componentKey{k: "provisioner"}
 
 	KeyUserDAO           = componentKey{k: "userDAO"}
 	KeySessionDAO        = componentKey{k: "sessionDAO"}
@@ -36,4 +43,9 @@ var (
 	KeyPathPermissionDAO = componentKey{k: "pathPermissionDAO"}
 	KeyPathMountDAO      = componentKey{k: "pathMountDAO"}
 	KeyGroupDAO          = componentKey{k: "groupDAO"}
+	KeyAccessKeyDAO      = componentKey{k: "accessKeyDAO"}
+	KeySettingsDAO       = componentKey{k: "settingsDAO"}
+	KeyProvisioningDAO   = componentKey{k: "provisioningDAO"}
+	KeyMediaMetadataDAO  = componentKey{k: "mediaMetadataDAO"}
+	KeyPhotoIndexDAO     = componentKey{k: "photoIndexDAO"}
 )
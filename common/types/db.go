@@ -24,8 +24,21 @@ type User struct {
 	// Source is the auth provider that owns this user.
 	// An empty source means a local user managed by the local user table;
 	// external providers (e.g. "ldap") store their provider name here.
-	Source string  `gorm:"column:source;type:string;size:32" json:"source,omitempty"`
-	Groups []Group `gorm:"many2many:user_groups;joinForeignKey:username;foreignKey:username" json:"groups"`
+	Source string `gorm:"column:source;type:string;size:32" json:"source,omitempty"`
+	// SSHKeys is the user's authorized public keys in the authorized_keys format, used by SFTP.
+	SSHKeys string `gorm:"column:ssh_keys;type:text" json:"sshKeys,omitempty"`
+	// Managed is true if the user is declared in the provisioning file, it can't be changed by the admin endpoints
+	Managed bool    `gorm:"column:managed;not null;default:false" json:"managed,omitempty"`
+	Groups  []Group `gorm:"many2many:user_groups;joinForeignKey:username;foreignKey:username" json:"groups"`
+}
+
+// AccessKey is a credential of a user for the S3-compatible API
+type AccessKey struct {
+	ID       string `gorm:"column:id;primaryKey;not null;type:string;size:32" json:"id"`
+	Secret   string `gorm:"column:secret;not null;type:string;size:64" json:"secret,omitempty"`
+	Username string `gorm:"column:username;not null;type:string;size:32;index" json:"username"`
+	// CreatedAt is unix timestamp in milliseconds
+	CreatedAt int64 `gorm:"column:created_at;not null" json:"createdAt"`
 }
 
 type Group struct {
@@ -34,6 +47,8 @@ type Group struct {
 	// own root path. The user's own root path takes precedence; among groups the
 	// shallowest one wins (see resolveUserRootPath in drive/access.go).
 	RootPath string `gorm:"column:root_path;type:string;size:512" json:"rootPath,omitempty"`
+	// Managed is true if the group is declared in the provisioning file
+	Managed bool `gorm:"column:managed;not null;default:false" json:"managed,omitempty"`
 }
 
 type UserGroup struct {
@@ -46,6 +61,8 @@ type Drive struct {
 	Enabled bool   `gorm:"column:enabled;not null;type:bool" json:"enabled"`
 	Type    string `gorm:"column:type;not null;type:string;size:32" json:"type" binding:"required"`
 	Config  string `gorm:"column:config;not null;type:string;size:4096" json:"config"`
+	// Managed is true if the drive is declared in the provisioning file
+	Managed bool `gorm:"column:managed;not null;default:false" json:"managed,omitempty"`
 }
 
 type PathMount struct {
@@ -53,6 +70,8 @@ type PathMount struct {
 	Path    *string `gorm:"column:path;not null;type:string;size:512" json:"path"`
 	Name    string  `gorm:"column:name;not null;type:string;size:255" json:"name"`
 	MountAt string  `gorm:"column:mount_at;not null;type:string;size:512" json:"mountAt"`
+	// Managed is true if the mount is declared in the provisioning file
+	Managed bool `gorm:"column:managed;not null;default:false" json:"managed,omitempty"`
 }
 
 func (PathMount) TableName() string {
@@ -117,6 +136,8 @@ type PathPermission struct {
 	Permission Permission `gorm:"column:permission;not null" json:"permission"`
 	// Policy to apply to the permission when subject access this path: 0: REJECT, 1: ACCEPT
 	Policy uint8 `gorm:"column:policy;not null" json:"policy"`
+	// Managed is true if the permission is declared in the provisioning file
+	Managed bool `gorm:"column:managed;not null;default:false" json:"managed,omitempty"`
 }
 
 type PathMeta struct {
@@ -158,12 +179,40 @@ type Job struct {
 	ActionParams string `gorm:"column:action_params;not null;type:text;size:512" json:"actionParams"`
 
 	Enabled bool `gorm:"column:enabled;not null;type:bool" json:"enabled"`
+
+	// MaxRetries is the number of retries after a failed attempt
+	MaxRetries int `gorm:"column:max_retries;not null;default:0" json:"maxRetries"`
+	// RetryDelay is the delay in seconds before the first retry, it's doubled for every next retry
+	RetryDelay int `gorm:"column:retry_delay;not null;default:0" json:"retryDelay"`
+	// Timeout is the maximum duration in seconds of every attempt, 0 for unlimited
+	Timeout int `gorm:"column:timeout;not null;default:0" json:"timeout"`
+	// Concurrency is the policy when the job is triggered while it's running, see JobConcurrencyAllow
+	Concurrency string `gorm:"column:concurrency;not null;type:string;size:16;default:''" json:"concurrency"`
+	// OnSuccess is the ID of the job to run after the job succeeded, 0 for none
+	OnSuccess uint `gorm:"column:on_success;not null;default:0" json:"onSuccess"`
+	// OnFailure is the ID of the job to run after the job failed, 0 for none
+	OnFailure uint `gorm:"column:on_failure;not null;default:0" json:"onFailure"`
+	// MaxLogLines is the number of the latest log lines kept for every execution, 0 for the default
+	MaxLogLines int `gorm:"column:max_log_lines;not null;default:0" json:"maxLogLines"`
+	// KeepExecutions is the number of the latest completed executions kept, 0 for all
+	KeepExecutions int `gorm:"column:keep_executions;not null;default:0" json:"keepExecutions"`
 }
 
 const (
+	// JobConcurrencyAllow runs the executions of the same job in parallel, it's the default policy
+	JobConcurrencyAllow = "allow"
+	// JobConcurrencySkip skips the execution if the job is running
+	JobConcurrencySkip = "skip"
+	// JobConcurrencyQueue waits until the running execution of the job completed
+	JobConcurrencyQueue = "queue"
+)
+
+const (
+	JobExecutionQueued  = "queued"
 	JobExecutionRunning = "running"
 	JobExecutionSuccess = "success"
 	JobExecutionFailed  = "failed"
+	JobExecutionSkipped = "skipped"
 )
 
 type JobExecution struct {
@@ -174,6 +223,15 @@ type JobExecution struct {
 	Status      string `gorm:"column:status;not null;type:string" json:"status"`
 	Logs        string `gorm:"column:logs;type:string" json:"logs"`
 	ErrorMsg    string `gorm:"column:error_msg;type:text" json:"errorMsg"`
+
+	// TriggerType is the type of the trigger which started the execution, empty for manual executions
+	TriggerType string `gorm:"column:trigger_type;type:string;size:32" json:"triggerType"`
+	// Attempts is the number of attempts made, including retries
+	Attempts int `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	// ParentID is the ID of the execution which chained this one
+	ParentID uint `gorm:"column:parent_id;not null;default:0" json:"parentId"`
+	// Steps is the JSON encoded step results of pipeline jobs
+	Steps string `gorm:"column:steps;type:text" json:"-"`
 }
 
 func UserSubject(username string) string {
@@ -205,3 +263,37 @@ func (p PathPermission) IsAccept() bool {
 func (p PathPermission) IsReject() bool {
 	return p.Policy == PolicyReject
 }
+
+// MediaMetadata is the cache of the MediaMeta extracted from the file of the path,
+// it's valid as long as the file's ModTime and Size are unchanged
+type MediaMetadata struct {
+	Path    string `gorm:"column:path;primaryKey;not null;type:string;size:512"`
+	ModTime int64  `gorm:"column:mod_time;not null"`
+	Size    int64  `gorm:"column:size;not null"`
+	// Data is the MediaMeta in JSON, it's empty if nothing is extracted
+	Data string `gorm:"column:data;not null;type:text"`
+}
+
+func (MediaMetadata) TableName() string {
+	return "media_metadata"
+}
+
+// PhotoIndex is the index of the photos and videos with the time taken or the location,
+// for the timeline and the map views
+type PhotoIndex struct {
+	Path string `gorm:"column:path;primaryKey;not null;type:string;size:512"`
+	// TakenAt is the time taken in milliseconds, 0 if unknown
+	TakenAt int64 `gorm:"column:taken_at;not null;index"`
+	// Date is the date taken in the time zone where it was taken, like 20230501, 0 if unknown
+	Date      int      `gorm:"column:date;not null;index"`
+	Latitude  *float64 `gorm:"column:latitude;index:idx_photo_index_location,priority:1"`
+	Longitude *float64 `gorm:"column:longitude;index:idx_photo_index_location,priority:2"`
+	Width     int      `gorm:"column:width;not null"`
+	Height    int      `gorm:"column:height;not null"`
+	Size      int64    `gorm:"column:size;not null"`
+	ModTime   int64    `gorm:"column:mod_time;not null"`
+}
+
+func (PhotoIndex) TableName() string {
+	return "photo_index"
+}
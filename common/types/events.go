@@ -1,6 +1,11 @@
 package types
 
+// DriveListenerSourceJob marks the events raised by the job actions
+const DriveListenerSourceJob = "job"
+
 type DriveListenerContext struct {
 	Principal *Principal
 	Drive     IDrive
+	// Source is the component raising the events, empty for the requests of the users
+	Source string
 }
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// MediaMeta is the metadata extracted from the content of the images, audios and videos
+type MediaMeta struct {
+	// CameraMake and CameraModel are the manufacturer and the model of the camera
+	CameraMake  string `json:"cameraMake,omitempty"`
+	CameraModel string `json:"cameraModel,omitempty"`
+	// TakenAt is the time when the photo was taken or the video was recorded
+	TakenAt *time.Time `json:"takenAt,omitempty"`
+	// Latitude and Longitude are the GPS location in degrees
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// Orientation is the EXIF orientation from 1 to 8
+	Orientation int `json:"orientation,omitempty"`
+	Width       int `json:"width,omitempty"`
+	Height      int `json:"height,omitempty"`
+
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Genre  string `json:"genre,omitempty"`
+	Track  int    `json:"track,omitempty"`
+	Year   int    `json:"year,omitempty"`
+
+	// Duration is the length of the audio or video in seconds
+	Duration float64 `json:"duration,omitempty"`
+	// VideoCodec and AudioCodec are the codec identifiers, such as h264 and aac
+	VideoCodec string `json:"videoCodec,omitempty"`
+	AudioCodec string `json:"audioCodec,omitempty"`
+}
+
+// Camera returns the camera name, the make is omitted if the model starts with it
+func (m MediaMeta) Camera() string {
+	make_, model := strings.TrimSpace(m.CameraMake), strings.TrimSpace(m.CameraModel)
+	if make_ == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(make_)) {
+		return model
+	}
+	if model == "" {
+		return make_
+	}
+	return make_ + " " + model
+}
+
+// IsEmpty reports whether nothing is extracted
+func (m MediaMeta) IsEmpty() bool {
+	return m == MediaMeta{}
+}
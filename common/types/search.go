@@ -9,6 +9,12 @@ type EntrySearchItem struct {
 	Type    EntryType `json:"type"`
 	Size    int64     `json:"size"`
 	ModTime time.Time `json:"modTime"`
+	// Content is the text extracted from the file, it's only used for indexing
+	Content string `json:"-"`
+	// Camera, Artist and Album are the media metadata of the file, they're only used for indexing
+	Camera string `json:"-"`
+	Artist string `json:"-"`
+	Album  string `json:"-"`
 }
 
 type EntrySearchResultItem struct {
@@ -18,6 +18,14 @@ const (
 	// AuthTypeBasic is a session authenticated by HTTP Basic credentials (used
 	// by WebDAV).
 	AuthTypeBasic AuthType = "basic"
+	// AuthTypeSSH is a session authenticated by a password or public key over
+	// SSH (used by SFTP).
+	AuthTypeSSH AuthType = "ssh"
+	// AuthTypeAccessKey is a session authenticated by an AWS Signature Version 4
+	// signed with one of the user's access keys (used by the S3 gateway).
+	AuthTypeAccessKey AuthType = "access-key"
+	// AuthTypeFTP is a session authenticated by USER/PASS over FTP.
+	AuthTypeFTP AuthType = "ftp"
 )
 
 // Principal is the request-scoped, authenticated context of the caller. Unlike
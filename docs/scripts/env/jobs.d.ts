@@ -17,6 +17,18 @@ declare function ls(path: string): DriveEntry[];
 /** Create a directory. */
 declare function mkdir(path: string): DriveEntry;
 
+/**
+ * Set an output of this step when the script runs as a step of a flow.
+ * Later steps can reference it as `{{prev.key}}` or `{{steps.N.key}}`.
+ */
+declare function output(key: string, value: string): void;
+
+/**
+ * Outputs of the previous steps when the script runs as a step of a flow, in step order.
+ * `undefined` when the script is not a step of a flow.
+ */
+declare const $steps: Record<string, string>[] | undefined;
+
 /**
  * Trigger that started this run.
  * Manual runs are `undefined`. `entry` is a file-event trigger; `cron` is a schedule.
@@ -24,13 +36,35 @@ declare function mkdir(path: string): DriveEntry;
 declare const $event:
   | {
       type: "entry";
-      data?: {
-        eventType: "updated" | "deleted";
-        includeDescendants: boolean;
-        path: string;
-      };
+      data?:
+        | {
+            eventType: "updated" | "deleted" | "accessed";
+            includeDescendants: boolean;
+            path: string;
+          }
+        | {
+            /** The collected paths, separated by newlines, when the trigger has a quiet period. */
+            paths: string;
+            /** JSON encoded array of `{ path, eventType, includeDescendants }`. */
+            events: string;
+            count: string;
+          };
+    }
+  | {
+      type: "cron" | "interval" | "startup";
     }
   | {
-      type: "cron";
+      type: "webhook";
+      /** The JSON object posted to the webhook, non-string values are JSON encoded. */
+      data?: Record<string, string>;
+    }
+  | {
+      type: "chain";
+      data: {
+        jobId: string;
+        executionId: string;
+        status: "success" | "failed";
+        depth: string;
+      };
     }
   | undefined;
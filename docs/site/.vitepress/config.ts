@@ -91,6 +91,7 @@ const enSidebar = [
       { text: 'Local', link: '/drives/local' },
       { text: 'FTP', link: '/drives/ftp' },
       { text: 'SFTP', link: '/drives/sftp' },
+      { text: 'Archive', link: '/drives/archive' },
       { text: 'WebDAV', link: '/drives/webdav' },
       { text: 'S3', link: '/drives/s3' },
       { text: 'OneDrive', link: '/drives/onedrive' },
@@ -110,6 +111,9 @@ const enSidebar = [
     items: [
       { text: 'Search', link: '/features/search' },
       { text: 'WebDAV Access', link: '/features/webdav' },
+      { text: 'SFTP Access', link: '/features/sftp' },
+      { text: 'FTP Access', link: '/features/ftp' },
+      { text: 'S3 API', link: '/features/s3' },
       { text: 'File Buckets', link: '/features/file-buckets' },
       { text: 'Site Settings', link: '/features/site-settings' },
       { text: 'Custom Themes', link: '/features/custom-themes' },
@@ -152,6 +156,7 @@ const zhSidebar = [
       { text: '本地文件', link: '/zh-CN/drives/local' },
       { text: 'FTP', link: '/zh-CN/drives/ftp' },
       { text: 'SFTP', link: '/zh-CN/drives/sftp' },
+      { text: '压缩包', link: '/zh-CN/drives/archive' },
       { text: 'WebDAV', link: '/zh-CN/drives/webdav' },
       { text: 'S3', link: '/zh-CN/drives/s3' },
       { text: 'OneDrive', link: '/zh-CN/drives/onedrive' },
@@ -171,6 +176,9 @@ const zhSidebar = [
     items: [
       { text: '搜索与索引', link: '/zh-CN/features/search' },
       { text: 'WebDAV 访问', link: '/zh-CN/features/webdav' },
+      { text: 'SFTP 访问', link: '/zh-CN/features/sftp' },
+      { text: 'FTP 访问', link: '/zh-CN/features/ftp' },
+      { text: 'S3 API', link: '/zh-CN/features/s3' },
       { text: '文件桶', link: '/zh-CN/features/file-buckets' },
       { text: '站点设置', link: '/zh-CN/features/site-settings' },
       { text: '自定义主题', link: '/zh-CN/features/custom-themes' },
@@ -115,6 +115,14 @@ func (da *Access) GetRootDrive(session *types.Principal) types.IDrive {
 	}, da.bus)
 }
 
+// GetSourceRootDrive returns the root drive for a component, its events are marked with source
+func (da *Access) GetSourceRootDrive(source string) types.IDrive {
+	return NewListenerWrapper(da.rootDrive.Get(), types.DriveListenerContext{
+		Drive:  da.rootDrive.Get(),
+		Source: source,
+	}, da.bus)
+}
+
 func (da *Access) GetPerms() utils.PermMap {
 	da.permMux.RLock()
 	defer da.permMux.RUnlock()
@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"sort"
+	"strings"
+)
+
+type archiveIndex struct {
+	src     *source
+	size    int64
+	modTime int64
+
+	entries  map[string]*archiveEntry
+	children map[string][]*archiveEntry
+}
+
+func newArchiveIndex(d *Drive, s *source) *archiveIndex {
+	index := &archiveIndex{
+		src:      s,
+		size:     s.entry.Size(),
+		modTime:  s.entry.ModTime(),
+		entries:  make(map[string]*archiveEntry),
+		children: make(map[string][]*archiveEntry),
+	}
+	index.entries[""] = &archiveEntry{d: d, index: index, isDir: true, modTime: index.modTime}
+	return index
+}
+
+// add adds an entry and its missing parent directories. Archives are not
+// required to contain entries for directories.
+func (index *archiveIndex) add(entry *archiveEntry) {
+	if entry.path == "" {
+		return
+	}
+	if existing, ok := index.entries[entry.path]; ok {
+		if existing.isDir && entry.isDir {
+			existing.modTime = entry.modTime
+		}
+		return
+	}
+	parent := utils.PathParent(entry.path)
+	if _, ok := index.entries[parent]; !ok {
+		index.add(&archiveEntry{d: entry.d, index: index, path: parent, isDir: true, modTime: entry.modTime})
+	}
+	index.entries[entry.path] = entry
+	index.children[parent] = append(index.children[parent], entry)
+}
+
+func (index *archiveIndex) sortChildren() {
+	for _, children := range index.children {
+		sort.Slice(children, func(i, j int) bool { return children[i].path < children[j].path })
+	}
+}
+
+// cleanEntryName converts a name stored in the archive to a drive path.
+// Absolute and parent components are dropped so entries can't escape the root.
+func cleanEntryName(name string) string {
+	return utils.CleanPath(strings.ReplaceAll(name, "\\", "/"))
+}
+
+func buildZipIndex(_ context.Context, d *Drive, s *source) (*archiveIndex, error) {
+	zr, e := zip.NewReader(newBlockReaderAt(s, s.entry.Size()), s.entry.Size())
+	if e != nil {
+		return nil, e
+	}
+	index := newArchiveIndex(d, s)
+	for _, f := range zr.File {
+		isDir := f.FileInfo().IsDir()
+		index.add(&archiveEntry{
+			d:       d,
+			index:   index,
+			path:    cleanEntryName(f.Name),
+			isDir:   isDir,
+			size:    int64(f.UncompressedSize64),
+			modTime: utils.Millisecond(f.Modified),
+			zf:      f,
+		})
+	}
+	index.sortChildren()
+	return index, nil
+}
+
+func buildTarIndex(ctx context.Context, d *Drive, s *source) (*archiveIndex, error) {
+	r, e := s.open(ctx, -1, -1)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = r.Close() }()
+
+	// tar has no central directory, the headers are read in one sequential pass.
+	// After Next returns, all bytes of the header have been consumed,
+	// so the counted offset is where the file content starts.
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	index := newArchiveIndex(d, s)
+	for {
+		if e := ctx.Err(); e != nil {
+			return nil, e
+		}
+		h, e := tr.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return nil, e
+		}
+		var isDir bool
+		switch h.Typeflag {
+		case tar.TypeDir:
+			isDir = true
+		case tar.TypeReg:
+		default:
+			// links, devices and sparse files are not exposed
+			continue
+		}
+		index.add(&archiveEntry{
+			d:          d,
+			index:      index,
+			path:       cleanEntryName(h.Name),
+			isDir:      isDir,
+			size:       h.Size,
+			modTime:    utils.Millisecond(h.ModTime),
+			dataOffset: cr.n,
+		})
+	}
+	index.sortChildren()
+	return index, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, e := c.r.Read(p)
+	c.n += int64(n)
+	return n, e
+}
+
+var _ types.IEntry = (*archiveEntry)(nil)
+
+type archiveEntry struct {
+	d     *Drive
+	index *archiveIndex
+
+	path    string
+	isDir   bool
+	size    int64
+	modTime int64
+
+	// zf is the zip file header, nil for tar entries
+	zf *zip.File
+	// dataOffset is the content offset of tar entries
+	dataOffset int64
+}
+
+func (a *archiveEntry) Path() string {
+	return a.path
+}
+
+func (a *archiveEntry) Type() types.EntryType {
+	if a.isDir {
+		return types.TypeDir
+	}
+	return types.TypeFile
+}
+
+func (a *archiveEntry) Size() int64 {
+	if a.isDir {
+		return -1
+	}
+	return a.size
+}
+
+func (a *archiveEntry) Meta() types.EntryMeta {
+	return types.EntryMeta{Readable: true, Writable: false}
+}
+
+func (a *archiveEntry) ModTime() int64 {
+	return a.modTime
+}
+
+func (a *archiveEntry) Name() string {
+	return utils.PathBase(a.path)
+}
+
+func (a *archiveEntry) Drive() types.IDrive {
+	return a.d
+}
+
+func (a *archiveEntry) GetReader(ctx context.Context, start, size int64) (io.ReadCloser, error) {
+	if a.isDir {
+		return nil, err.NewNotAllowedError()
+	}
+	start = max(start, 0)
+	if start > a.size {
+		start = a.size
+	}
+	if size < 0 || start+size > a.size {
+		size = a.size - start
+	}
+	if size == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if a.zf == nil {
+		return a.index.src.open(ctx, a.dataOffset+start, size)
+	}
+	return a.getZipReader(ctx, start, size)
+}
+
+func (a *archiveEntry) getZipReader(ctx context.Context, start, size int64) (io.ReadCloser, error) {
+	offset, e := a.zf.DataOffset()
+	if e != nil {
+		return nil, e
+	}
+	switch a.zf.Method {
+	case zip.Store:
+		return a.index.src.open(ctx, offset+start, size)
+	case zip.Deflate:
+		raw, e := a.index.src.open(ctx, offset, int64(a.zf.CompressedSize64))
+		if e != nil {
+			return nil, e
+		}
+		return skipAndLimit(&deflateReader{ReadCloser: flate.NewReader(raw), raw: raw}, start, size)
+	default:
+		// other compression methods are read through archive/zip
+		r, e := a.zf.Open()
+		if e != nil {
+			return nil, e
+		}
+		return skipAndLimit(r, start, size)
+	}
+}
+
+func (a *archiveEntry) GetURL(context.Context) (*types.ContentURL, error) {
+	return nil, err.NewUnsupportedError()
+}
+
+// skipAndLimit discards the first start bytes of the stream, then limits it to size bytes.
+// Compressed streams can't be seeked, so ranged reads have to decompress the skipped part.
+func skipAndLimit(r io.ReadCloser, start, size int64) (io.ReadCloser, error) {
+	if start > 0 {
+		if _, e := io.CopyN(io.Discard, r, start); e != nil {
+			_ = r.Close()
+			return nil, e
+		}
+	}
+	return driveutil.LimitReadCloser(r, size), nil
+}
+
+type deflateReader struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (d *deflateReader) Close() error {
+	return errors.Join(d.ReadCloser.Close(), d.raw.Close())
+}
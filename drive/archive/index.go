@@ -0,0 +1,326 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"os"
+	"sync"
+)
+
+var t = i18n.TPrefix("drive.archive.")
+
+const (
+	formatAuto = "auto"
+	formatZip  = "zip"
+	formatTar  = "tar"
+)
+
+func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
+	driveRegistry.RegisterDrive(driveutil.DriveFactoryConfig{
+		Type:        "archive",
+		DisplayName: t("name"),
+		README:      t("readme"),
+		ConfigForm: []types.FormItem{
+			{Label: t("form.path.label"), Type: "path", Field: "path", Required: true, Description: t("form.path.description")},
+			{Label: t("form.format.label"), Type: "select", Field: "format", Description: t("form.format.description"),
+				Options: &[]types.FormItemOption{
+					{Name: t("form.format.auto"), Value: formatAuto},
+					{Name: "ZIP", Value: formatZip},
+					{Name: "TAR", Value: formatTar},
+				},
+				DefaultValue: formatAuto,
+			},
+		},
+		Factory: driveutil.DriveFactory{Create: NewDrive},
+	})
+}
+
+// NewDrive creates a read-only drive backed by an archive file on another drive.
+// The archive is resolved lazily because the drive holding it may not have been
+// created yet.
+func NewDrive(_ context.Context, config types.SM, driveUtils driveutil.DriveUtils) (types.IDrive, error) {
+	archivePath := utils.CleanPath(config["path"])
+	if archivePath == "" {
+		return nil, err.NewBadRequestError(t("invalid_path"))
+	}
+	format := config["format"]
+	if format == "" || format == formatAuto {
+		format = detectFormat(archivePath)
+	}
+	if format != formatZip && format != formatTar {
+		return nil, err.NewBadRequestError(t("unsupported_format", utils.PathBase(archivePath)))
+	}
+	if driveUtils.Root == nil {
+		return nil, errors.New("root drive is not available")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Drive{
+		root:    driveUtils.Root,
+		path:    archivePath,
+		format:  format,
+		tempDir: driveUtils.Config.TempDir,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+func detectFormat(path string) string {
+	switch utils.PathExt(path) {
+	case "zip", "jar", "apk", "epub", "docx", "xlsx", "pptx", "odt":
+		return formatZip
+	case "tar":
+		return formatTar
+	}
+	return ""
+}
+
+var _ types.IDrive = (*Drive)(nil)
+
+type Drive struct {
+	root    types.IDrive
+	path    string
+	format  string
+	tempDir string
+
+	// ctx bounds the range requests issued by archive/zip through io.ReaderAt,
+	// which cannot carry the request context. It is canceled on Dispose.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	index *archiveIndex
+}
+
+type loadingKey struct{ d *Drive }
+
+// getIndex returns the entries index of the archive, rebuilding it when the
+// archive file has been changed.
+func (d *Drive) getIndex(ctx context.Context) (*archiveIndex, error) {
+	if ctx.Value(loadingKey{d}) != nil {
+		// the archive path is resolved to this drive itself
+		return nil, err.NewNotAllowedMessageError(t("self_reference"))
+	}
+	ctx = context.WithValue(ctx, loadingKey{d}, true)
+
+	src, e := d.root.Get(ctx, d.path)
+	if e != nil {
+		return nil, e
+	}
+	if !src.Type().IsFile() {
+		return nil, err.NewBadRequestError(t("not_a_file", d.path))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.index != nil && d.index.size == src.Size() && d.index.modTime == src.ModTime() {
+		return d.index, nil
+	}
+
+	s, e := d.openSource(ctx, src)
+	if e != nil {
+		return nil, e
+	}
+	var index *archiveIndex
+	switch d.format {
+	case formatZip:
+		index, e = buildZipIndex(ctx, d, s)
+	case formatTar:
+		index, e = buildTarIndex(ctx, d, s)
+	}
+	if e != nil {
+		_ = s.Close()
+		return nil, err.NewBadRequestError(t("invalid_archive", e.Error()))
+	}
+	if d.index != nil {
+		_ = d.index.src.Close()
+	}
+	d.index = index
+	return index, nil
+}
+
+// openSource checks whether the drive holding the archive supports range reads.
+// If it does not, the archive is copied to a local temporary file once.
+func (d *Drive) openSource(ctx context.Context, src types.IEntry) (*source, error) {
+	probe, e := src.GetReader(ctx, 0, 1)
+	if e == nil {
+		_ = probe.Close()
+		return &source{entry: src, ctx: d.ctx}, nil
+	}
+	if !err.IsUnsupportedError(e) {
+		return nil, e
+	}
+	file, e := driveutil.CopyIContentToTempFile(task.NewContextWrapper(ctx), src, d.tempDir)
+	if e != nil {
+		return nil, e
+	}
+	return &source{entry: src, ctx: d.ctx, file: file}, nil
+}
+
+func (d *Drive) Meta(context.Context) (types.DriveMeta, error) {
+	return types.DriveMeta{Writable: false}, nil
+}
+
+func (d *Drive) Get(ctx context.Context, path string) (types.IEntry, error) {
+	index, e := d.getIndex(ctx)
+	if e != nil {
+		return nil, e
+	}
+	entry, ok := index.entries[path]
+	if !ok {
+		return nil, err.NewNotFoundError()
+	}
+	return entry, nil
+}
+
+func (d *Drive) List(ctx context.Context, path string) ([]types.IEntry, error) {
+	index, e := d.getIndex(ctx)
+	if e != nil {
+		return nil, e
+	}
+	entry, ok := index.entries[path]
+	if !ok {
+		return nil, err.NewNotFoundError()
+	}
+	if !entry.Type().IsDir() {
+		return nil, err.NewNotAllowedError()
+	}
+	children := index.children[path]
+	result := make([]types.IEntry, len(children))
+	for i, c := range children {
+		result[i] = c
+	}
+	return result, nil
+}
+
+func (d *Drive) Save(types.TaskCtx, string, int64, bool, io.Reader) (types.IEntry, error) {
+	return nil, err.NewNotAllowedError()
+}
+
+func (d *Drive) MakeDir(context.Context, string) (types.IEntry, error) {
+	return nil, err.NewNotAllowedError()
+}
+
+func (d *Drive) Copy(types.TaskCtx, types.IEntry, string, bool) (types.IEntry, error) {
+	return nil, err.NewNotAllowedError()
+}
+
+func (d *Drive) Move(types.TaskCtx, types.IEntry, string, bool) (types.IEntry, error) {
+	return nil, err.NewNotAllowedError()
+}
+
+func (d *Drive) Delete(types.TaskCtx, string) error {
+	return err.NewNotAllowedError()
+}
+
+func (d *Drive) Upload(context.Context, string, int64, bool, types.SM) (*types.DriveUploadConfig, error) {
+	return nil, err.NewNotAllowedError()
+}
+
+func (d *Drive) Dispose() error {
+	d.cancel()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.index != nil {
+		_ = d.index.src.Close()
+		d.index = nil
+	}
+	return nil
+}
+
+// source reads byte ranges of the archive file, either from the drive holding
+// it or from the local copy.
+type source struct {
+	entry types.IEntry
+	ctx   context.Context
+	file  *os.File
+}
+
+func (s *source) open(ctx context.Context, offset, size int64) (io.ReadCloser, error) {
+	if s.file != nil {
+		offset = max(offset, 0)
+		if size < 0 {
+			size = s.entry.Size() - offset
+		}
+		return io.NopCloser(io.NewSectionReader(s.file, offset, size)), nil
+	}
+	return s.entry.GetReader(ctx, offset, size)
+}
+
+func (s *source) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	_ = s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+const blockSize = 64 * 1024
+const maxCachedBlocks = 16
+
+// blockReaderAt implements io.ReaderAt over source with a small block cache,
+// so the many small reads done while parsing the zip central directory are
+// served by a few range requests.
+type blockReaderAt struct {
+	s    *source
+	size int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+func newBlockReaderAt(s *source, size int64) io.ReaderAt {
+	if s.file != nil {
+		return s.file
+	}
+	return &blockReaderAt{s: s, size: size, blocks: make(map[int64][]byte)}
+}
+
+func (b *blockReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= b.size {
+			return n, io.EOF
+		}
+		block, e := b.block(pos / blockSize)
+		if e != nil {
+			return n, e
+		}
+		n += copy(p[n:], block[pos%blockSize:])
+	}
+	return n, nil
+}
+
+func (b *blockReaderAt) block(i int64) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if block, ok := b.blocks[i]; ok {
+		return block, nil
+	}
+	start := i * blockSize
+	size := min(int64(blockSize), b.size-start)
+	r, e := b.s.open(b.s.ctx, start, size)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = r.Close() }()
+	block := make([]byte, size)
+	if _, e := io.ReadFull(r, block); e != nil {
+		return nil, e
+	}
+	if len(b.order) >= maxCachedBlocks {
+		delete(b.blocks, b.order[0])
+		b.order = b.order[1:]
+	}
+	b.blocks[i] = block
+	b.order = append(b.order, i)
+	return block, nil
+}
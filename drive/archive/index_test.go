@@ -0,0 +1,221 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/drive/fs"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rangeRecorder serves the archive from an fs drive and records every read of it.
+type rangeRecorder struct {
+	types.IDrive
+	noRange bool
+
+	mu    sync.Mutex
+	reads [][2]int64
+}
+
+func (r *rangeRecorder) Get(ctx context.Context, path string) (types.IEntry, error) {
+	entry, e := r.IDrive.Get(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	return &recordedEntry{IEntry: entry, r: r}, nil
+}
+
+func (r *rangeRecorder) totalRead(t *testing.T) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := int64(0)
+	for _, read := range r.reads {
+		if read[1] <= 0 {
+			t.Fatalf("unexpected full read of the archive: %v", read)
+		}
+		total += read[1]
+	}
+	return total
+}
+
+type recordedEntry struct {
+	types.IEntry
+	r *rangeRecorder
+}
+
+func (e *recordedEntry) GetReader(ctx context.Context, start, size int64) (io.ReadCloser, error) {
+	if e.r.noRange && (start >= 0 || size > 0) {
+		return nil, err.NewUnsupportedError()
+	}
+	e.r.mu.Lock()
+	e.r.reads = append(e.r.reads, [2]int64{start, size})
+	e.r.mu.Unlock()
+	return e.IEntry.GetReader(ctx, start, size)
+}
+
+func newTestDrive(t *testing.T, name string, content []byte, noRange bool) (*Drive, *rangeRecorder) {
+	t.Helper()
+	dir := t.TempDir()
+	if e := os.WriteFile(filepath.Join(dir, name), content, 0644); e != nil {
+		t.Fatal(e)
+	}
+	config := common.Config{FreeFs: true, TempDir: t.TempDir()}
+	fsDrive, e := fs.NewDrive(context.Background(), types.SM{"path": dir}, driveutil.DriveUtils{Config: config})
+	if e != nil {
+		t.Fatal(e)
+	}
+	root := &rangeRecorder{IDrive: fsDrive, noRange: noRange}
+	d, e := NewDrive(context.Background(), types.SM{"path": name}, driveutil.DriveUtils{Config: config, Root: root})
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = d.(*Drive).Dispose() })
+	return d.(*Drive), root
+}
+
+func readAll(t *testing.T, d types.IDrive, path string, start, size int64) string {
+	t.Helper()
+	entry, e := d.Get(context.Background(), path)
+	if e != nil {
+		t.Fatalf("Get %s: %v", path, e)
+	}
+	r, e := entry.GetReader(context.Background(), start, size)
+	if e != nil {
+		t.Fatalf("GetReader %s: %v", path, e)
+	}
+	defer func() { _ = r.Close() }()
+	b, e := io.ReadAll(r)
+	if e != nil {
+		t.Fatalf("read %s: %v", path, e)
+	}
+	return string(b)
+}
+
+func listNames(t *testing.T, d types.IDrive, path string) string {
+	t.Helper()
+	entries, e := d.List(context.Background(), path)
+	if e != nil {
+		t.Fatalf("List %s: %v", path, e)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Path()
+		if entry.Type().IsDir() {
+			names[i] += "/"
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func makeZip(t *testing.T, large []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	write := func(name string, method uint16, content []byte) {
+		w, e := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if e != nil {
+			t.Fatal(e)
+		}
+		if _, e := w.Write(content); e != nil {
+			t.Fatal(e)
+		}
+	}
+	write("readme.txt", zip.Deflate, []byte(strings.Repeat("hello archive ", 100)))
+	write("images/a/large.bin", zip.Store, large)
+	write("images/b.txt", zip.Deflate, []byte("0123456789"))
+	write("../escape.txt", zip.Store, []byte("x"))
+	if e := zw.Close(); e != nil {
+		t.Fatal(e)
+	}
+	return buf.Bytes()
+}
+
+func TestZipArchiveReadsRanges(t *testing.T) {
+	large := make([]byte, 2*1024*1024)
+	_, _ = rand.Read(large)
+	archive := makeZip(t, large)
+	d, root := newTestDrive(t, "data.zip", archive, false)
+
+	if got := listNames(t, d, ""); got != "escape.txt,images/,readme.txt" {
+		t.Errorf("List root = %s", got)
+	}
+	if got := listNames(t, d, "images"); got != "images/a/,images/b.txt" {
+		t.Errorf("List images = %s", got)
+	}
+	if got := readAll(t, d, "images/b.txt", -1, -1); got != "0123456789" {
+		t.Errorf("read b.txt = %q", got)
+	}
+	if got := readAll(t, d, "images/b.txt", 3, 4); got != "3456" {
+		t.Errorf("ranged read b.txt = %q", got)
+	}
+	if got := readAll(t, d, "images/a/large.bin", 1024*1024, 16); got != string(large[1024*1024:1024*1024+16]) {
+		t.Errorf("ranged read of stored entry mismatch")
+	}
+	if total := root.totalRead(t); total >= int64(len(large)) {
+		t.Errorf("read %d bytes of a %d bytes archive", total, len(archive))
+	}
+
+	if _, e := d.Get(context.Background(), "images/missing.txt"); !err.IsNotFoundError(e) {
+		t.Errorf("Get missing: want NotFound, got %v", e)
+	}
+	if _, e := d.Save(task.DummyContext(), "new.txt", 1, true, strings.NewReader("x")); !err.IsNotAllowedError(e) {
+		t.Errorf("Save: want NotAllowed, got %v", e)
+	}
+}
+
+func TestTarArchive(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, content := range map[string]string{
+		"logs/2024/app.log": "line1\nline2\n",
+		"logs/empty.log":    "",
+		"top.txt":           strings.Repeat("t", 1000),
+	} {
+		if e := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); e != nil {
+			t.Fatal(e)
+		}
+		if _, e := tw.Write([]byte(content)); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := tw.Close(); e != nil {
+		t.Fatal(e)
+	}
+	d, _ := newTestDrive(t, "logs.tar", buf.Bytes(), false)
+
+	if got := listNames(t, d, "logs"); got != "logs/2024/,logs/empty.log" {
+		t.Errorf("List logs = %s", got)
+	}
+	if got := readAll(t, d, "logs/2024/app.log", -1, -1); got != "line1\nline2\n" {
+		t.Errorf("read app.log = %q", got)
+	}
+	if got := readAll(t, d, "logs/2024/app.log", 6, -1); got != "line2\n" {
+		t.Errorf("ranged read app.log = %q", got)
+	}
+	if got := readAll(t, d, "logs/empty.log", -1, -1); got != "" {
+		t.Errorf("read empty.log = %q", got)
+	}
+}
+
+func TestArchiveWithoutRangeSupport(t *testing.T) {
+	d, _ := newTestDrive(t, "data.zip", makeZip(t, []byte("stored content")), true)
+
+	if got := readAll(t, d, "images/a/large.bin", 7, -1); got != "content" {
+		t.Errorf("read large.bin = %q", got)
+	}
+	if got := readAll(t, d, "readme.txt", 0, 5); got != "hello" {
+		t.Errorf("read readme.txt = %q", got)
+	}
+}
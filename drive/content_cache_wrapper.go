@@ -0,0 +1,133 @@
+package drive
+
+import (
+	"context"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+)
+
+var _ types.IDrive = (*ContentCacheWrapper)(nil)
+
+// ContentCacheWrapper serves file contents of the wrapped drive from the local content cache.
+// The cache is owned by the RootDrive, it outlives the wrapper when the drive is reloaded.
+type ContentCacheWrapper struct {
+	types.IDrive
+	cache *driveutil.ContentCache
+}
+
+func NewContentCacheWrapper(drive types.IDrive, cache *driveutil.ContentCache) *ContentCacheWrapper {
+	return &ContentCacheWrapper{IDrive: drive, cache: cache}
+}
+
+func (d *ContentCacheWrapper) Get(ctx context.Context, path string) (types.IEntry, error) {
+	entry, e := d.IDrive.Get(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	return d.wrapEntry(entry), nil
+}
+
+func (d *ContentCacheWrapper) Save(ctx types.TaskCtx, path string, size int64, override bool, reader io.Reader) (types.IEntry, error) {
+	d.cache.Invalidate(path, false)
+	entry, e := d.IDrive.Save(ctx, path, size, override, reader)
+	if e != nil {
+		return nil, e
+	}
+	return d.wrapEntry(entry), nil
+}
+
+func (d *ContentCacheWrapper) MakeDir(ctx context.Context, path string) (types.IEntry, error) {
+	entry, e := d.IDrive.MakeDir(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	return d.wrapEntry(entry), nil
+}
+
+func (d *ContentCacheWrapper) Copy(ctx types.TaskCtx, from types.IEntry, to string, override bool) (types.IEntry, error) {
+	d.cache.Invalidate(to, true)
+	entry, e := d.IDrive.Copy(ctx, from, to, override)
+	if e != nil {
+		return nil, e
+	}
+	return d.wrapEntry(entry), nil
+}
+
+func (d *ContentCacheWrapper) Move(ctx types.TaskCtx, from types.IEntry, to string, override bool) (types.IEntry, error) {
+	if self := driveutil.GetSelfEntry(d, from); self != nil {
+		d.cache.Invalidate(self.Path(), true)
+	}
+	d.cache.Invalidate(to, true)
+	entry, e := d.IDrive.Move(ctx, from, to, override)
+	if e != nil {
+		return nil, e
+	}
+	return d.wrapEntry(entry), nil
+}
+
+func (d *ContentCacheWrapper) List(ctx context.Context, path string) ([]types.IEntry, error) {
+	entries, e := d.IDrive.List(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	return utils.ArrayMap(entries, func(t *types.IEntry) types.IEntry { return d.wrapEntry(*t) }), nil
+}
+
+func (d *ContentCacheWrapper) Delete(ctx types.TaskCtx, path string) error {
+	d.cache.Invalidate(path, true)
+	return d.IDrive.Delete(ctx, path)
+}
+
+// Evict removes the cached contents of path, it's called when the path is changed outside this drive.
+func (d *ContentCacheWrapper) Evict(path string, descendants bool) {
+	d.cache.Invalidate(path, descendants)
+}
+
+// ClearContentCache removes all cached contents
+func (d *ContentCacheWrapper) ClearContentCache() {
+	d.cache.Clear()
+}
+
+func (d *ContentCacheWrapper) Dispose() error {
+	if disposable, ok := d.IDrive.(types.IDisposable); ok {
+		return disposable.Dispose()
+	}
+	return nil
+}
+
+func (d *ContentCacheWrapper) wrapEntry(entry types.IEntry) types.IEntry {
+	return &contentCacheEntry{IEntry: entry, d: d}
+}
+
+var _ types.IEntryWrapper = (*contentCacheEntry)(nil)
+
+type contentCacheEntry struct {
+	types.IEntry
+	d *ContentCacheWrapper
+}
+
+func (c *contentCacheEntry) Drive() types.IDrive {
+	return c.d
+}
+
+func (c *contentCacheEntry) GetIEntry() types.IEntry {
+	return c.IEntry
+}
+
+func (c *contentCacheEntry) GetReader(ctx context.Context, start, size int64) (io.ReadCloser, error) {
+	if !c.d.cache.Cacheable(c.IEntry) {
+		return c.IEntry.GetReader(ctx, start, size)
+	}
+	return c.d.cache.GetReader(ctx, c.IEntry, start, size)
+}
+
+// GetURL is disabled for cacheable files, so that downloads are served through GetReader and the cache.
+func (c *contentCacheEntry) GetURL(ctx context.Context) (*types.ContentURL, error) {
+	if !c.d.cache.Cacheable(c.IEntry) {
+		return c.IEntry.GetURL(ctx)
+	}
+	return nil, err.NewUnsupportedError()
+}
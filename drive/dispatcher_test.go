@@ -14,6 +14,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	// Import fs so its init() registers the "fs" drive type.
@@ -336,6 +337,35 @@ func TestDispatcher_ResolveMount_OneLevel(t *testing.T) {
 	}
 }
 
+func TestPathMountOverlay_LowerPaths(t *testing.T) {
+	d, mountDAO, _, cleanup := newTestDispatcher(t, []string{"lowerA", "lowerB"})
+	defer cleanup()
+
+	p := "lowerA/dir"
+	if e := mountDAO.SaveMounts([]types.PathMount{{Path: &p, Name: "m1", MountAt: "lowerB/sub"}}, true); e != nil {
+		t.Fatalf("SaveMounts: %v", e)
+	}
+	if e := d.reloadMounts(); e != nil {
+		t.Fatalf("reloadMounts: %v", e)
+	}
+
+	for _, c := range []struct {
+		path        string
+		descendants bool
+		want        []string
+	}{
+		{"lowerA/dir/m1/x", false, []string{"lowerB/sub/x"}},
+		{"lowerA/dir/m1", true, []string{"lowerB/sub"}},
+		{"lowerA/dir", false, []string{"lowerA/dir"}},
+		{"lowerA", true, []string{"lowerA", "lowerB/sub"}},
+		{"lowerB/other", true, []string{"lowerB/other"}},
+	} {
+		if got := d.lowerPaths(c.path, c.descendants, 0); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("lowerPaths(%q, %v) = %v, want %v", c.path, c.descendants, got, c.want)
+		}
+	}
+}
+
 func TestDispatcher_ResolveMount_MaxDepthExceeded(t *testing.T) {
 	d, mountDAO, _, cleanup := newTestDispatcher(t, []string{"d1", "d2"})
 	defer cleanup()
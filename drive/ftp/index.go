@@ -26,7 +26,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 		Type:        "ftp",
 		DisplayName: t("name"),
 		README:      t("readme"),
-		ConfigForm: []types.FormItem{
+		ConfigForm: append([]types.FormItem{
 			{Label: t("form.host.label"), Type: "text", Field: "host", Required: true, Description: t("form.host.description")},
 			{Label: t("form.port.label"), Type: "text", Field: "port", Required: true, Description: t("form.port.description"), DefaultValue: "21"},
 			{Label: t("form.user.label"), Type: "text", Field: "user", Description: t("form.user.description")},
@@ -34,7 +34,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 			{Label: t("form.concurrent.label"), Type: "text", Field: "concurrent", Description: t("form.concurrent.description")},
 			{Label: t("form.timeout.label"), Type: "text", Field: "timeout", Description: t("form.timeout.description")},
 			{Label: t("form.cache_ttl.label"), Type: "text", Field: "cache_ttl", Description: t("form.cache_ttl.description")},
-		},
+		}, driveutil.ContentCacheConfigForm()...),
 		Factory: driveutil.DriveFactory{Create: NewDrive},
 	})
 }
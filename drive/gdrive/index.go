@@ -23,12 +23,12 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 		Type:        "gdrive",
 		DisplayName: t("name"),
 		README:      t("readme"),
-		ConfigForm: []types.FormItem{
+		ConfigForm: append([]types.FormItem{
 			{Field: "client_id", Label: t("form.client_id.label"), Type: "text", Description: t("form.client_id.description"), Required: true},
 			{Field: "client_secret", Label: t("form.client_secret.label"), Type: "password", Description: t("form.client_secret.description"), Required: true},
 			{Field: "cache_ttl", Label: t("form.cache_ttl.label"), Type: "text", Description: t("form.cache_ttl.description"), DefaultValue: "4h"},
 			{Field: "proxy_thumbnail", Label: t("form.proxy_thumbnail.label"), Type: "checkbox", Description: t("form.proxy_thumbnail.description"), DefaultValue: "1"},
-		},
+		}, driveutil.ContentCacheConfigForm()...),
 		Factory: driveutil.DriveFactory{Create: NewGDrive, InitConfig: InitConfig, Init: Init},
 	})
 }
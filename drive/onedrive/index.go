@@ -21,7 +21,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 		Type:        "onedrive",
 		DisplayName: t("name"),
 		README:      t("readme"),
-		ConfigForm: []types.FormItem{
+		ConfigForm: append([]types.FormItem{
 			{
 				Field: "site", Label: t("form.site.label"), Type: "select", Description: t("form.site.description"),
 				Options: &[]types.FormItemOption{
@@ -45,7 +45,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 			{Field: "proxy_upload", Label: t("form.proxy_in.label"), Type: "checkbox", Description: t("form.proxy_in.description")},
 			{Field: "proxy_download", Label: t("form.proxy_out.label"), Type: "checkbox", Description: t("form.proxy_out.description")},
 			{Field: "cache_ttl", Label: t("form.cache_ttl.label"), Type: "text", Description: t("form.cache_ttl.description")},
-		},
+		}, driveutil.ContentCacheConfigForm()...),
 		Factory: driveutil.DriveFactory{Create: NewOneDrive, InitConfig: InitConfig, Init: Init},
 	})
 }
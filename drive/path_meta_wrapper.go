@@ -28,22 +28,14 @@ func NewPathMetaWrapper(root types.IDrive, pathMeta *storage.PathMetaDAO,
 // On mismatch it returns an error carrying the protected ancestor path so the
 // client can cache the password for the whole subtree.
 func (pm *PathMetaWrapper) checkPassword(path string) error {
-	if !pm.principal.IsAnonymous() {
-		return nil
-	}
-	// an authenticated caller (e.g. a valid signature/access key) already proves
-	// authorization for this path, so the path password is not required
-	if pm.principal.AuthType != types.AuthTypeNone {
+	if !pathPasswordRequired(pm.principal) {
 		return nil
 	}
 	meta, e := pm.pathMeta.GetMerged(path)
 	if e != nil {
 		return e
 	}
-	if meta == nil || meta.Password.V == "" {
-		return nil
-	}
-	if pm.principal.PathPassword != meta.Password.V {
+	if !pathPasswordAccepted(pm.principal, meta) {
 		return err.NewNotAllowedMessageDataError(
 			i18n.T("drive.path_meta.incorrect_password"),
 			types.M{"passwordRequired": true, "passwordPath": meta.Password.Path},
@@ -52,6 +44,18 @@ func (pm *PathMetaWrapper) checkPassword(path string) error {
 	return nil
 }
 
+// pathPasswordRequired returns whether the path passwords apply to the principal
+func pathPasswordRequired(principal types.Principal) bool {
+	// an authenticated caller (e.g. a valid signature/access key) already proves
+	// authorization for this path, so the path password is not required
+	return principal.IsAnonymous() && principal.AuthType == types.AuthTypeNone
+}
+
+// pathPasswordAccepted returns whether the principal provides the password of the path meta
+func pathPasswordAccepted(principal types.Principal, meta *types.MergedPathMeta) bool {
+	return meta == nil || meta.Password.V == "" || principal.PathPassword == meta.Password.V
+}
+
 // Get injects pathMeta into Entry's props
 func (pm *PathMetaWrapper) Get(ctx context.Context, path string) (types.IEntry, error) {
 	if e := pm.checkPassword(path); e != nil {
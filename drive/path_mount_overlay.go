@@ -146,6 +146,27 @@ func (d *PathMountOverlayDrive) resolveMountTreePath(path string, depth int) (st
 	return path, nil, false, nil
 }
 
+// lowerPaths returns the paths of the dispatcher that the path is mounted to.
+// If descendants is true, the targets of the mounts under the path are included.
+func (d *PathMountOverlayDrive) lowerPaths(path string, descendants bool, depth int) []string {
+	if checkMountDepth(depth) != nil {
+		return nil
+	}
+	if mount, target := d.matchedMount(path); mount != nil {
+		return d.lowerPaths(target, descendants, depth+1)
+	}
+	paths := []string{utils.CleanPath(path)}
+	if descendants {
+		mounts, _ := d.resolveMountedChildren(path)
+		for _, m := range mounts {
+			if m.MountAt != "" {
+				paths = append(paths, d.lowerPaths(m.MountAt, true, depth+1)...)
+			}
+		}
+	}
+	return paths
+}
+
 func isPathMountVirtualEntry(entry types.IEntry) bool {
 	return driveutil.GetIEntry(entry, func(candidate types.IEntry) bool {
 		_, ok := candidate.(*pathMountVirtualEntry)
@@ -5,6 +5,7 @@ import (
 	"go-drive/common"
 	"go-drive/common/driveutil"
 	"go-drive/common/registry"
+	"go-drive/drive/archive"
 	"go-drive/drive/fs"
 	"go-drive/drive/ftp"
 	"go-drive/drive/gdrive"
@@ -20,6 +21,7 @@ import (
 func RegisterAllDrives(ctx context.Context, config common.Config, ch *registry.ComponentsHolder) error {
 	driveRegistry := ch.Get(registry.KeyDriveRegistry).(*driveutil.DriveRegistry)
 
+	archive.RegisterDrive(driveRegistry)
 	fs.RegisterDrive(driveRegistry)
 	ftp.RegisterDrive(driveRegistry)
 	gdrive.RegisterDrive(driveRegistry)
@@ -6,14 +6,22 @@ import (
 	"go-drive/common"
 	"go-drive/common/driveutil"
 	err "go-drive/common/errors"
+	"go-drive/common/event"
 	"go-drive/common/i18n"
 	"go-drive/common/registry"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	"go-drive/storage"
 	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 )
 
+const contentCacheDir = "content-cache"
+
 type RootDrive struct {
 	root             *PathMountOverlayDrive
 	dispatcher       *DispatcherDrive
@@ -27,6 +35,10 @@ type RootDrive struct {
 	config common.Config
 
 	mux *sync.Mutex
+
+	// contentCaches are the drives with the content cache enabled
+	contentCaches    map[string]*ContentCacheWrapper
+	contentCachesMux *sync.RWMutex
 }
 
 func NewRootDrive(
@@ -36,6 +48,7 @@ func NewRootDrive(
 	mountStorage *storage.PathMountDAO,
 	dataStorage *storage.DriveDataDAO,
 	driveCacheStorage *storage.DriveCacheDAO,
+	bus event.Bus,
 	ch *registry.ComponentsHolder) (*RootDrive, error) {
 	driveRegistry := ch.Get(registry.KeyDriveRegistry).(*driveutil.DriveRegistry)
 	dispatcher := NewDispatcherDrive(config)
@@ -49,6 +62,8 @@ func NewRootDrive(
 		driveRegistry:    driveRegistry,
 		config:           config,
 		mux:              &sync.Mutex{},
+		contentCaches:    make(map[string]*ContentCacheWrapper),
+		contentCachesMux: &sync.RWMutex{},
 	}
 
 	switch config.Cache.Type {
@@ -65,6 +80,12 @@ func NewRootDrive(
 	if e := r.ReloadDrive(ctx, true); e != nil {
 		return nil, e
 	}
+	bus.SubscribeEntryUpdated(func(_ types.DriveListenerContext, path string, includeDescendants bool) {
+		r.evictContentCache(path, includeDescendants)
+	})
+	bus.SubscribeEntryDeleted(func(_ types.DriveListenerContext, path string) {
+		r.evictContentCache(path, true)
+	})
 	ch.Add(registry.KeyRootDrive, r)
 	return r, nil
 }
@@ -97,6 +118,9 @@ func (d *RootDrive) ReloadDrive(ctx context.Context, ignoreFailure bool) error {
 
 	log.Println("Reloading drives...")
 	drives := make(map[string]types.IDrive, len(drivesConfig))
+	contentCaches := make(map[string]*ContentCacheWrapper)
+	contentCacheSizes := make(map[string][2]int64)
+	createdCaches := make([]*driveutil.ContentCache, 0)
 	ok := false
 	defer func() {
 		if !ok {
@@ -105,6 +129,9 @@ func (d *RootDrive) ReloadDrive(ctx context.Context, ignoreFailure bool) error {
 					_ = disposable.Dispose()
 				}
 			}
+			for _, c := range createdCaches {
+				_ = c.Dispose()
+			}
 		}
 	}()
 	for _, dc := range drivesConfig {
@@ -128,12 +155,53 @@ func (d *RootDrive) ReloadDrive(ctx context.Context, ignoreFailure bool) error {
 			}
 			return err.NewBadRequestError(i18n.T("drive.root.error_create_drive", dc.Name, e.Error()))
 		}
+		if maxSize, maxFileSize := driveutil.ContentCacheSize(config); maxSize > 0 {
+			// two caches can't share the directory, so the cache in use is kept for the new drive
+			d.contentCachesMux.RLock()
+			old := d.contentCaches[dc.Name]
+			d.contentCachesMux.RUnlock()
+			var cache *driveutil.ContentCache
+			if old != nil {
+				cache = old.cache
+			} else {
+				cache, e = d.newContentCache(dc.Name, maxSize, maxFileSize)
+				if e != nil {
+					if disposable, ok := iDrive.(types.IDisposable); ok {
+						_ = disposable.Dispose()
+					}
+					if ignoreFailure {
+						log.Printf("[%s]: %v", dc.Name, e)
+						continue
+					}
+					return err.NewBadRequestError(i18n.T("drive.root.error_create_drive", dc.Name, e.Error()))
+				}
+				createdCaches = append(createdCaches, cache)
+			}
+			wrapper := NewContentCacheWrapper(iDrive, cache)
+			contentCaches[dc.Name] = wrapper
+			contentCacheSizes[dc.Name] = [2]int64{maxSize, maxFileSize}
+			iDrive = wrapper
+		}
 		log.Println("Created drive:", dc.Name)
 		drives[dc.Name] = iDrive
 	}
 	d.dispatcher.setDrives(drives)
+	d.contentCachesMux.Lock()
+	oldContentCaches := d.contentCaches
+	d.contentCaches = contentCaches
+	d.contentCachesMux.Unlock()
 	ok = true
 
+	for name, wrapper := range contentCaches {
+		sizes := contentCacheSizes[name]
+		wrapper.cache.Resize(sizes[0], sizes[1])
+	}
+	for name, old := range oldContentCaches {
+		if wrapper := contentCaches[name]; wrapper == nil || wrapper.cache != old.cache {
+			_ = old.cache.Dispose()
+		}
+	}
+
 	log.Println("Reloading drives done.")
 	return nil
 }
@@ -142,13 +210,65 @@ func (d *RootDrive) ReloadMounts() error {
 	return d.root.reloadMounts()
 }
 
+// RemoveContentCaches deletes the content caches of the drives from the disk,
+// or of all drives if no name is given. It must not be called while the drives are in use.
+func RemoveContentCaches(config common.Config, names ...string) error {
+	dir, e := config.GetDir(contentCacheDir, false)
+	if e != nil {
+		return e
+	}
+	if len(names) == 0 {
+		return os.RemoveAll(dir)
+	}
+	for _, name := range names {
+		if e := os.RemoveAll(filepath.Join(dir, url.PathEscape(name))); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (d *RootDrive) newContentCache(name string, maxSize, maxFileSize int64) (*driveutil.ContentCache, error) {
+	dir, e := d.config.GetDir(contentCacheDir, true)
+	if e != nil {
+		return nil, e
+	}
+	return driveutil.NewContentCache(filepath.Join(dir, url.PathEscape(name)), maxSize, maxFileSize)
+}
+
+// evictContentCache evicts the cached contents of the path in the root namespace,
+// the path is resolved through the path mounts to the paths of the drives.
+func (d *RootDrive) evictContentCache(path string, descendants bool) {
+	for _, p := range d.root.lowerPaths(path, descendants, 0) {
+		driveName, drivePath, _ := strings.Cut(utils.CleanPath(p), "/")
+		d.contentCachesMux.RLock()
+		wrapper := d.contentCaches[driveName]
+		d.contentCachesMux.RUnlock()
+		if wrapper != nil {
+			wrapper.Evict(drivePath, descendants || drivePath == "")
+		}
+	}
+}
+
 func (d *RootDrive) ClearDriveCache(ns string) error {
+	d.contentCachesMux.RLock()
+	wrapper := d.contentCaches[ns]
+	d.contentCachesMux.RUnlock()
+	if wrapper != nil {
+		wrapper.ClearContentCache()
+	}
 	return d.driveCacheMgr.EvictCacheStore(ns)
 }
 
 func (d *RootDrive) Dispose() error {
 	_ = d.driveCacheMgr.Dispose()
-	return d.dispatcher.Dispose()
+	e := d.dispatcher.Dispose()
+	d.contentCachesMux.Lock()
+	for _, wrapper := range d.contentCaches {
+		_ = wrapper.cache.Dispose()
+	}
+	d.contentCachesMux.Unlock()
+	return e
 }
 
 func (d *RootDrive) DriveInitConfig(ctx context.Context, name string) (*driveutil.DriveInitConfig, error) {
@@ -189,5 +309,6 @@ func (d *RootDrive) createDriveUtils(name string) driveutil.DriveUtils {
 			return d.driveCacheMgr.GetCacheStore(name, de)
 		},
 		Config: d.config,
+		Root:   d.root,
 	}
 }
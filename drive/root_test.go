@@ -0,0 +1,83 @@
+package drive
+
+import (
+	"context"
+	"go-drive/common/driveutil"
+	"go-drive/common/event"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootDrive_ReloadFailureKeepsContentCache(t *testing.T) {
+	config := testutil.DefaultTestConfig()
+	ch := registry.NewComponentHolder()
+	driveutil.NewDriveRegistry(ch)
+	if e := RegisterAllDrives(context.Background(), config, ch); e != nil {
+		t.Fatal(e)
+	}
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = db.Dispose() }()
+	driveDAO := storage.NewDriveDAO(db, ch)
+
+	localRoot, e := config.GetDir("local", true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := os.MkdirAll(filepath.Join(localRoot, "reloadA"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(filepath.Join(localRoot, "reloadA", "a.txt"), []byte("hello"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := driveDAO.AddDrive(types.Drive{Name: "reloadA", Enabled: true, Type: "fs",
+		Config: `{"path":"reloadA","content_cache_size":"1m"}`}); e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = driveDAO.DeleteDrive("reloadA") }()
+
+	root, e := NewRootDrive(context.Background(), config, driveDAO, storage.NewPathMountDAO(db, ch),
+		storage.NewDriveDataDAO(db, ch), storage.NewDriveCacheDAO(db, ch), event.NewBus(ch), ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = root.Dispose() }()
+
+	if _, e := driveDAO.AddDrive(types.Drive{Name: "reloadB", Enabled: true, Type: "unknown", Config: "{}"}); e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = driveDAO.DeleteDrive("reloadB") }()
+	if e := root.ReloadDrive(context.Background(), false); e == nil {
+		t.Fatal("expected error of the invalid drive")
+	}
+
+	entry, e := root.Get().Get(context.Background(), "reloadA/a.txt")
+	if e != nil {
+		t.Fatal(e)
+	}
+	r, e := entry.GetReader(context.Background(), -1, -1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := io.ReadAll(r); e != nil {
+		t.Fatal(e)
+	}
+	_ = r.Close()
+
+	cacheDir, e := config.GetDir(contentCacheDir, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cached, _ := filepath.Glob(filepath.Join(cacheDir, "reloadA", "*.data"))
+	if len(cached) != 1 {
+		t.Errorf("the content cache of reloadA is not usable after the failed reload: %v", cached)
+	}
+}
@@ -33,7 +33,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 		Type:        "s3",
 		DisplayName: s3T("name"),
 		README:      s3T("readme"),
-		ConfigForm: []types.FormItem{
+		ConfigForm: append([]types.FormItem{
 			{Field: "id", Label: s3T("form.ak.label"), Type: "text", Description: s3T("form.ak.description"), Required: true},
 			{Field: "secret", Label: s3T("form.sk.label"), Type: "password", Description: s3T("form.sk.description"), Required: true},
 			{Field: "bucket", Label: s3T("form.bucket.label"), Type: "text", Description: s3T("form.bucket.description"), Required: true},
@@ -47,7 +47,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 				s3T("form.request_headers.description"),
 			),
 			{Field: "cache_ttl", Label: s3T("form.cache_ttl.label"), Type: "text", Description: s3T("form.cache_ttl.description")},
-		},
+		}, driveutil.ContentCacheConfigForm()...),
 		Factory: driveutil.DriveFactory{Create: NewDrive},
 	})
 }
@@ -0,0 +1,100 @@
+package drive
+
+import (
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"regexp"
+	"strings"
+)
+
+// SearchFilter decides whether the search hits, which are global paths,
+// are visible to a principal as if they were found by browsing the folders.
+// A hit is visible when it and its ancestors under the principal's root are readable,
+// none of them is hidden by the hidden pattern of its parent,
+// and the principal has the passwords of the folders.
+//
+// SearchFilter caches the path meta of the folders, it should be used for one request only.
+type SearchFilter struct {
+	root      string
+	perms     utils.PermMap
+	pathMeta  *storage.PathMetaDAO
+	principal types.Principal
+
+	dirs map[string]*searchFilterDir
+}
+
+type searchFilterDir struct {
+	// visible is whether the entries in the folder can be listed
+	visible bool
+	hidden  *regexp.Regexp
+}
+
+// GetSearchFilter returns the SearchFilter of the principal
+func (da *Access) GetSearchFilter(principal types.Principal) (*SearchFilter, error) {
+	chroot, e := da.GetChroot(principal)
+	if e != nil {
+		return nil, e
+	}
+	root := ""
+	if chroot != nil {
+		root = utils.CleanPath(chroot.Root)
+	}
+	return &SearchFilter{
+		root:      root,
+		perms:     da.GetPerms().Filter(principal),
+		pathMeta:  da.pathMeta,
+		principal: principal,
+		dirs:      make(map[string]*searchFilterDir),
+	}, nil
+}
+
+// Visible returns whether the entry of the path is visible
+func (f *SearchFilter) Visible(path string) (bool, error) {
+	path = utils.CleanPath(path)
+	if path == f.root || (f.root != "" && !strings.HasPrefix(path, f.root+"/")) {
+		return false, nil
+	}
+	if !f.perms.ResolvePath(path).Readable() {
+		return false, nil
+	}
+	dir := utils.PathParent(path)
+	d, e := f.dir(dir)
+	if e != nil {
+		return false, e
+	}
+	if !d.visible {
+		return false, nil
+	}
+	return d.hidden == nil || !d.hidden.MatchString(utils.PathBase(path)), nil
+}
+
+// dir resolves the folder, which is visible only if the folder itself is visible
+func (f *SearchFilter) dir(path string) (*searchFilterDir, error) {
+	if d, ok := f.dirs[path]; ok {
+		return d, nil
+	}
+	d := &searchFilterDir{}
+	// the root path is always listable, as PermissionWrapperDrive does
+	visible := utils.IsRootPath(path) || f.perms.ResolvePath(path).Readable()
+	if path != f.root {
+		v, e := f.Visible(path)
+		if e != nil {
+			return nil, e
+		}
+		visible = v
+	}
+	if visible {
+		meta, e := f.pathMeta.GetMerged(path)
+		if e != nil {
+			return nil, e
+		}
+		d.visible = !pathPasswordRequired(f.principal) || pathPasswordAccepted(f.principal, meta)
+		if meta != nil && meta.HiddenPattern.V != "" {
+			// invalid patterns are ignored, as the web client does
+			d.hidden, _ = regexp.Compile("(?i)" + meta.HiddenPattern.V)
+		}
+	}
+	f.dirs[path] = d
+	return d, nil
+}
@@ -0,0 +1,94 @@
+package drive
+
+import (
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"testing"
+)
+
+func TestSearchFilter(t *testing.T) {
+	config := testutil.DefaultTestConfig()
+	config.DataDir = t.TempDir()
+	ch := registry.NewComponentHolder()
+	defer func() { _ = ch.Dispose() }()
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	pathMeta := storage.NewPathMetaDAO(db, ch)
+	for _, m := range []types.PathMeta{
+		{Path: strPtr("home/docs"), HiddenPattern: `^\.`, Recursive: 1 << 3},
+		{Path: strPtr("home/locked"), Password: "secret", Recursive: 1 << 0},
+		{Path: strPtr("home/open"), Password: "secret"},
+	} {
+		if e := pathMeta.Set(m); e != nil {
+			t.Fatal(e)
+		}
+	}
+	perms := utils.NewPermMap([]types.PathPermission{
+		{Path: strPtr(""), Subject: types.AnySubject, Permission: types.PermissionRead, Policy: types.PolicyAccept},
+		{Path: strPtr("home/private"), Subject: types.AnySubject, Permission: types.PermissionRead,
+			Policy: types.PolicyReject},
+		{Path: strPtr("home/private/shared"), Subject: types.AnySubject, Permission: types.PermissionRead,
+			Policy: types.PolicyAccept},
+	})
+
+	newFilter := func(principal types.Principal) *SearchFilter {
+		return &SearchFilter{
+			root:      "home",
+			perms:     perms.Filter(principal),
+			pathMeta:  pathMeta,
+			principal: principal,
+			dirs:      make(map[string]*searchFilterDir),
+		}
+	}
+	cases := map[string]bool{
+		"home":                         false,
+		"other/a.txt":                  false,
+		"homework/a.txt":               false,
+		"home/a.txt":                   true,
+		"home/docs/a.txt":              true,
+		"home/docs/.git":               false,
+		"home/docs/.git/config":        false,
+		"home/docs/sub/.env":           false,
+		"home/docs/sub/A.TXT":          true,
+		"home/private":                 false,
+		"home/private/shared/a.txt":    false,
+		"home/locked":                  true,
+		"home/locked/a.txt":            false,
+		"home/locked/sub/a.txt":        false,
+		"home/open/a.txt":              false,
+		"home/open/sub/a.txt":          false,
+		"home/private/../docs/.hidden": false,
+	}
+	filter := newFilter(types.Principal{})
+	for path, want := range cases {
+		got, e := filter.Visible(path)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got != want {
+			t.Errorf("%q: got %v, want %v", path, got, want)
+		}
+	}
+
+	filter = newFilter(types.Principal{PathPassword: "secret"})
+	for path, want := range map[string]bool{
+		"home/locked/sub/a.txt": true, "home/open/sub/a.txt": true, "home/docs/.git": false,
+	} {
+		if got, _ := filter.Visible(path); got != want {
+			t.Errorf("with password %q: got %v, want %v", path, got, want)
+		}
+	}
+	filter = newFilter(types.Principal{User: types.User{Username: "bob"}})
+	if got, _ := filter.Visible("home/locked/a.txt"); !got {
+		t.Error("path passwords do not apply to users")
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
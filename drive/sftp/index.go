@@ -28,7 +28,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 		Type:        "sftp",
 		DisplayName: t("name"),
 		README:      t("readme"),
-		ConfigForm: []types.FormItem{
+		ConfigForm: append([]types.FormItem{
 			{Label: t("form.host.label"), Type: "text", Field: "host", Required: true, Description: t("form.host.description")},
 			{Label: t("form.port.label"), Type: "text", Field: "port", Description: t("form.port.description"), DefaultValue: "22"},
 			{Label: t("form.user.label"), Type: "text", Field: "user", Required: true, Description: t("form.user.description")},
@@ -37,7 +37,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 			{Label: t("form.host_key.label"), Type: "textarea", Field: "host_key", Description: t("form.host_key.description")},
 			{Label: t("form.root_path.label"), Type: "text", Field: "root_path", Description: t("form.root_path.description")},
 			{Label: t("form.cache_ttl.label"), Type: "text", Field: "cache_ttl", Description: t("form.cache_ttl.description")},
-		},
+		}, driveutil.ContentCacheConfigForm()...),
 		Factory: driveutil.DriveFactory{Create: NewDrive},
 	})
 }
@@ -26,7 +26,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 		Type:        "webdav",
 		DisplayName: davT("name"),
 		README:      davT("readme"),
-		ConfigForm: []types.FormItem{
+		ConfigForm: append([]types.FormItem{
 			{Field: "url", Label: davT("form.url.label"), Type: "text", Required: true, Description: davT("form.url.description")},
 			{Field: "username", Label: davT("form.username.label"), Type: "text", Description: davT("form.username.description")},
 			{Field: "password", Label: davT("form.password.label"), Type: "password", Description: davT("form.password.description")},
@@ -35,7 +35,7 @@ func RegisterDrive(driveRegistry *driveutil.DriveRegistry) {
 				davT("form.request_headers.description"),
 			),
 			{Field: "cache_ttl", Label: davT("form.cache_ttl.label"), Type: "text", Description: davT("form.cache_ttl.description")},
-		},
+		}, driveutil.ContentCacheConfigForm()...),
 		Factory: driveutil.DriveFactory{Create: NewDrive},
 	})
 }
@@ -12,6 +12,8 @@ import (
 	"go-drive/drive"
 	"go-drive/server"
 	"go-drive/server/job"
+	"go-drive/server/metadata"
+	"go-drive/server/photo"
 	"go-drive/server/search"
 	"go-drive/server/thumbnail"
 	"go-drive/storage"
@@ -24,7 +26,7 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 	if err != nil {
 		return nil, err
 	}
-	driveutil.NewDriveRegistry(ch)
+	driveRegistry := driveutil.NewDriveRegistry(ch)
 	if err := drive.RegisterAllDrives(ctx, config, ch); err != nil {
 		return nil, err
 	}
@@ -37,7 +39,7 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 	pathMountDAO := storage.NewPathMountDAO(db, ch)
 	driveDataDAO := storage.NewDriveDataDAO(db, ch)
 	driveCacheDAO := storage.NewDriveCacheDAO(db, ch)
-	rootDrive, err := drive.NewRootDrive(ctx, config, driveDAO, pathMountDAO, driveDataDAO, driveCacheDAO, ch)
+	rootDrive, err := drive.NewRootDrive(ctx, config, driveDAO, pathMountDAO, driveDataDAO, driveCacheDAO, bus, ch)
 	if err != nil {
 		return nil, err
 	}
@@ -49,10 +51,18 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 		return nil, err
 	}
 	runner := task.NewPondRunner(config, ch)
-	service, err := search.NewService(ch, config, optionsDAO, rootDrive, runner, bus)
+	media, err := metadata.NewService(config, storage.NewMediaMetadataDAO(db, ch), bus, ch)
 	if err != nil {
 		return nil, err
 	}
+	photos := photo.NewService(storage.NewPhotoIndexDAO(db, ch), media, rootDrive, runner, bus, ch)
+	service, err := search.NewService(ch, config, optionsDAO, rootDrive, runner, bus, media)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.StartSchedules(); err != nil {
+		return nil, err
+	}
 	userDAO := storage.NewUserDAO(db, ch)
 	sessionDAO := storage.NewSessionDAO(db, ch)
 	dbTokenStore, err := server.NewDBTokenStore(sessionDAO, userDAO, config, ch)
@@ -63,6 +73,9 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 	if err != nil {
 		return nil, err
 	}
+	if _, err := thumbnail.NewGenerator(config, maker, rootDrive, runner, bus, ch); err != nil {
+		return nil, err
+	}
 	signer := utils.NewSigner()
 	chunkUploader, err := server.NewChunkUploader(config)
 	if err != nil {
@@ -71,6 +84,14 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 	groupDAO := storage.NewGroupDAO(db, userDAO, ch)
 	jobDAO := storage.NewJobDAO(db, ch)
 	fileBucketDAO := storage.NewFileBucketDAO(db, ch)
+	accessKeyDAO := storage.NewAccessKeyDAO(db, ch)
+	userDAO.OnUsersDeleted(accessKeyDAO.EvictCache)
+	settingsDAO := storage.NewSettingsDAO(db, optionsDAO, pathMetaDAO, fileBucketDAO, userDAO, ch)
+	provisioningDAO := storage.NewProvisioningDAO(db, userDAO, ch)
+	provisioner := server.NewProvisioner(config, driveRegistry, provisioningDAO, groupDAO, rootDrive, access, ch)
+	if err := provisioner.Reconcile(ctx); err != nil {
+		return nil, err
+	}
 	jobExecutor, err := job.NewJobExecutor(jobDAO, ch)
 	if err != nil {
 		return nil, err
@@ -80,12 +101,13 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 		return nil, err
 	}
 	engine, err := server.InitServer(config, ch, bus, rootDrive, access,
-		service, dbTokenStore, maker, signer, chunkUploader, runner,
+		service, dbTokenStore, maker, media, photos, signer, chunkUploader, runner,
 		optionsDAO, userDAO, groupDAO, driveDAO, driveDataDAO, pathPermissionDAO,
-		pathMountDAO, pathMetaDAO, jobDAO, fileBucketDAO,
+		pathMountDAO, pathMetaDAO, jobDAO, fileBucketDAO, accessKeyDAO, settingsDAO,
 		jobExecutor, fileMessageSource, webResourceFS())
 	if err != nil {
 		return nil, err
 	}
+	jobExecutor.Start()
 	return engine, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"go-drive/common"
 	"go-drive/common/registry"
+	"go-drive/server"
 	"log"
 	"net/http"
 	"os"
@@ -13,6 +14,10 @@ import (
 )
 
 func main() {
+	if runCommand() {
+		return
+	}
+
 	ch := registry.NewComponentHolder()
 
 	engine, e := Initialize(context.Background(), ch)
@@ -22,6 +27,18 @@ func main() {
 
 	dispose := func() { _ = ch.Dispose() }
 
+	provisioner := ch.Get(registry.KeyProvisioner).(*server.Provisioner)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			log.Println("SIGHUP received. Reconciling the provisioning file...")
+			if e := provisioner.Reconcile(context.Background()); e != nil {
+				log.Println("failed to reconcile the provisioning file: ", e)
+			}
+		}
+	}()
+
 	conf := ch.Get(registry.KeyConfig).(common.Config)
 	server := &http.Server{Addr: conf.Listen, Handler: engine}
 
@@ -35,11 +35,13 @@ func InitAdminRoutes(
 	pathMountDAO *storage.PathMountDAO,
 	pathMetaDAO *storage.PathMetaDAO,
 	jobDAO *storage.JobDAO,
-	fileBucketDAO *storage.FileBucketDAO) error {
+	fileBucketDAO *storage.FileBucketDAO,
+	accessKeyDAO *storage.AccessKeyDAO,
+	settingsDAO *storage.SettingsDAO) error {
 
 	r = r.Group("/admin", TokenAuth(tokenStore), AdminGroupRequired())
 
-	ur := &usersRoute{userDAO}
+	ur := &usersRoute{userDAO, accessKeyDAO}
 	// list users
 	r.GET("/users", ur.listUsers)
 	// get user by username
@@ -50,6 +52,12 @@ func InitAdminRoutes(
 	r.PUT("/users/:username", ur.updateUser)
 	// delete user
 	r.DELETE("/users/:username", ur.deleteUser)
+	// list access keys of the user
+	r.GET("/users/:username/access-keys", ur.listAccessKeys)
+	// create access key for the user
+	r.POST("/users/:username/access-keys", ur.createAccessKey)
+	// delete access key of the user
+	r.DELETE("/users/:username/access-keys/:id", ur.deleteAccessKey)
 
 	gr := &groupsRoute{groupDAO}
 	// list groups
@@ -119,6 +127,12 @@ func InitAdminRoutes(
 	mr := &miscRoute{access, permissionDAO, pathMountDAO, rootDrive, search, ch}
 	// index files
 	r.PUT("/search-indexes", mr.updateSearcherIndexes)
+	// get the schedules of indexing
+	r.GET("/search-indexes/schedules", mr.getSearchIndexSchedules)
+	// save the schedules of indexing
+	r.PUT("/search-indexes/schedules", mr.saveSearchIndexSchedules)
+	// generate thumbnails
+	r.PUT("/thumbnails", mr.generateThumbnails)
 	// clean all PathPermission and PathMount that is point to invalid path
 	r.POST("/maintenance/path-rules/cleanup", mr.cleanupInvalidPathPermissionsAndMounts)
 	// get service stats
@@ -159,6 +173,12 @@ func InitAdminRoutes(
 	r.GET("/job-executions", jr.getAllExecutions)
 	// execute a job
 	r.POST("/job-executions", jr.executeJob)
+	// get the step results of a job execution
+	r.GET("/job-executions/:id/steps", jr.getExecutionSteps)
+	// get the logs of a job execution
+	r.GET("/job-executions/:id/logs", jr.getExecutionLogs)
+	// stream the logs of a job execution as server-sent events
+	r.GET("/job-executions/:id/logs/stream", jr.streamExecutionLogs)
 	// cancel job execution
 	r.POST("/job-executions/:id/cancel", jr.cancelJobExecution)
 	// delete job execution
@@ -178,5 +198,16 @@ func InitAdminRoutes(
 	// delete file bucket
 	r.DELETE("/file-buckets/:name", fbr.deleteBucket)
 
+	sr := &settingsRoute{
+		settingsIO:  NewSettingsIO(settingsDAO, userDAO, driveRegistry),
+		access:      access,
+		rootDrive:   rootDrive,
+		jobExecutor: jobExecutor,
+	}
+	// export settings as YAML
+	r.GET("/settings/export", sr.exportSettings)
+	// import settings from YAML, or preview the changes
+	r.POST("/settings/import", sr.importSettings)
+
 	return nil
 }
@@ -54,6 +54,7 @@ func (dr *drivesRoute) createDrive(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
+	d.Managed = false
 	d, e := dr.driveDAO.AddDrive(d)
 	if e != nil {
 		_ = c.Error(e)
@@ -79,6 +80,11 @@ func (dr *drivesRoute) updateDrive(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
+	if savedDrive.Managed {
+		_ = c.Error(storage.NewManagedError(name))
+		return
+	}
+	d.Managed = false
 	d.Config = unescapeDriveConfigSecrets(f.ConfigForm, savedDrive.Config, d.Config)
 	e = dr.driveDAO.UpdateDrive(name, d)
 	if e != nil {
@@ -90,6 +96,10 @@ func (dr *drivesRoute) updateDrive(c *gin.Context) {
 
 func (dr *drivesRoute) deleteDrive(c *gin.Context) {
 	name := c.Param("name")
+	if savedDrive, e := dr.driveDAO.GetDrive(name); e == nil && savedDrive.Managed {
+		_ = c.Error(storage.NewManagedError(name))
+		return
+	}
 	e := dr.driveDAO.DeleteDrive(name)
 	_ = dr.rootDrive.ClearDriveCache(name)
 	_ = dr.driveDataDAO.Remove(name)
@@ -9,12 +9,16 @@ import (
 	"go-drive/server/job"
 	"go-drive/storage"
 	"io"
+	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const jobLogsKeepAliveInterval = 30 * time.Second
+
 type jobsRoute struct {
 	ch          *registry.ComponentsHolder
 	runner      task.Runner
@@ -57,7 +61,7 @@ func (jr *jobsRoute) createJob(c *gin.Context) {
 		return
 	}
 
-	if e := jr.jobExecutor.ValidateTriggers(job.Triggers); e != nil {
+	if e := jr.jobExecutor.ValidateJob(job); e != nil {
 		_ = c.Error(e)
 		return
 	}
@@ -86,7 +90,7 @@ func (jr *jobsRoute) updateJob(c *gin.Context) {
 		return
 	}
 
-	if e := jr.jobExecutor.ValidateTriggers(job.Triggers); e != nil {
+	if e := jr.jobExecutor.ValidateJob(job); e != nil {
 		_ = c.Error(e)
 		return
 	}
@@ -126,7 +130,17 @@ func (jr *jobsRoute) getAllExecutions(c *gin.Context) {
 		_ = c.Error(err.NewBadRequestError(""))
 		return
 	}
-	result, e := jr.jobDAO.GetJobExecutions(uint(jobId))
+	q := storage.JobExecutionQuery{
+		JobID:   uint(jobId),
+		From:    utils.ToUInt64(c.Query("from"), 0),
+		To:      utils.ToUInt64(c.Query("to"), 0),
+		Keyword: c.Query("q"),
+		Limit:   utils.ToInt(c.Query("limit"), 0),
+	}
+	if status := c.Query("status"); status != "" {
+		q.Status = strings.Split(status, ",")
+	}
+	result, e := jr.jobDAO.QueryJobExecutions(q)
 	if e != nil {
 		_ = c.Error(e)
 		return
@@ -134,6 +148,104 @@ func (jr *jobsRoute) getAllExecutions(c *gin.Context) {
 	SetResult(c, result)
 }
 
+// getExecutionLogs returns the log lines at or above the level, the logs of running executions are live
+func (jr *jobsRoute) getExecutionLogs(c *gin.Context) {
+	id := utils.ToUInt(c.Param("id"), 0)
+	level := c.Query("level")
+	if id == 0 || (level != "" && !job.IsValidJobLogLevel(level)) {
+		_ = c.Error(err.NewBadRequestError(""))
+		return
+	}
+	entries, ok := jr.jobExecutor.GetRunningExecutionLogs(id)
+	if !ok {
+		execution, e := jr.jobDAO.GetJobExecution(id)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		entries = job.ParseJobLogs(execution.Logs)
+	}
+	SetResult(c, job.FilterJobLogs(entries, level))
+}
+
+// streamExecutionLogs sends the logs as server-sent events.
+// Every line is a 'log' event, and the 'end' event with the execution is sent after the execution completed.
+func (jr *jobsRoute) streamExecutionLogs(c *gin.Context) {
+	id := utils.ToUInt(c.Param("id"), 0)
+	if id == 0 {
+		_ = c.Error(err.NewBadRequestError(""))
+		return
+	}
+	entries, logs, unsubscribe, running := jr.jobExecutor.SubscribeExecutionLogs(id)
+	if running {
+		defer unsubscribe()
+	} else {
+		execution, e := jr.jobDAO.GetJobExecution(id)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		entries = job.ParseJobLogs(execution.Logs)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	for _, entry := range entries {
+		c.SSEvent("log", entry)
+	}
+	c.Writer.Flush()
+
+	if running {
+		keepAlive := time.NewTicker(jobLogsKeepAliveInterval)
+		defer keepAlive.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case entry, ok := <-logs:
+				if !ok {
+					return false
+				}
+				c.SSEvent("log", entry)
+			case <-keepAlive.C:
+				_, _ = w.Write([]byte(": keep-alive\n\n"))
+			case <-c.Request.Context().Done():
+				return false
+			}
+			return true
+		})
+		if c.Request.Context().Err() != nil {
+			return
+		}
+	}
+
+	execution, e := jr.jobDAO.GetJobExecution(id)
+	if e != nil {
+		return
+	}
+	c.SSEvent("end", execution)
+	c.Writer.Flush()
+}
+
+func (jr *jobsRoute) getExecutionSteps(c *gin.Context) {
+	id := utils.ToUInt(c.Param("id"), 0)
+	if id == 0 {
+		_ = c.Error(err.NewBadRequestError(""))
+		return
+	}
+	execution, e := jr.jobDAO.GetJobExecution(id)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	steps, e := job.ParseJobSteps(execution.Steps)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, steps)
+}
+
 func (jr *jobsRoute) executeJob(c *gin.Context) {
 	jobId := utils.ToInt(c.Query("jobId"), -1)
 	if jobId < 0 {
@@ -149,13 +261,11 @@ func (jr *jobsRoute) executeJob(c *gin.Context) {
 	w := c.Writer
 	e = ExecuteTaskStreaming(c, jr.runner,
 		func(ctx types.TaskCtx) (any, error) {
+			// the error is written as the last log line
 			e := jr.jobExecutor.ExecuteJobSync(ctx, jobObj, job.TriggerEvent{}, func(s string) {
 				_, _ = w.Write([]byte(s + "\n"))
 				w.Flush()
 			})
-			if e != nil {
-				w.Write([]byte(e.Error()))
-			}
 			return nil, e
 		},
 		task.WithNameGroup(jobObj.Description, "job/execution"),
@@ -4,8 +4,10 @@ import (
 	err "go-drive/common/errors"
 	"go-drive/common/registry"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	"go-drive/drive"
 	"go-drive/server/search"
+	"go-drive/server/thumbnail"
 	"go-drive/storage"
 	"sort"
 
@@ -27,7 +29,7 @@ func (mr *miscRoute) updateSearcherIndexes(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
-	t, e := mr.search.TriggerIndexAll(root, true)
+	t, e := mr.search.TriggerIndexAll(root, true, utils.ToBool(c.Query("full")))
 	if e != nil {
 		_ = c.Error(e)
 		return
@@ -35,6 +37,44 @@ func (mr *miscRoute) updateSearcherIndexes(c *gin.Context) {
 	SetResult(c, t)
 }
 
+func (mr *miscRoute) generateThumbnails(c *gin.Context) {
+	root, e := getQueryPath(c, "path")
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	generator := mr.ch.Get(registry.KeyThumbnailGenerator).(*thumbnail.Generator)
+	t, e := generator.TriggerGenerate(root)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, t)
+}
+
+func (mr *miscRoute) getSearchIndexSchedules(c *gin.Context) {
+	schedules, e := mr.search.GetSchedules()
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, schedules)
+}
+
+func (mr *miscRoute) saveSearchIndexSchedules(c *gin.Context) {
+	var body struct {
+		Schedules string `json:"schedules"`
+	}
+	if e := c.Bind(&body); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if e := mr.search.SetSchedules(body.Schedules); e != nil {
+		_ = c.Error(e)
+		return
+	}
+}
+
 func (mr *miscRoute) cleanupInvalidPathPermissionsAndMounts(c *gin.Context) {
 	root := mr.rootDrive.Get()
 	pps, e := mr.permissionDAO.GetAll()
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"go-drive/server/job"
+	"io"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSettingsDocumentSize is the max size of the imported settings document
+const maxSettingsDocumentSize = 16 * 1024 * 1024
+
+type settingsRoute struct {
+	settingsIO  *SettingsIO
+	access      *drive.Access
+	rootDrive   *drive.RootDrive
+	jobExecutor *job.JobExecutor
+}
+
+func (sr *settingsRoute) exportSettings(c *gin.Context) {
+	doc, e := sr.settingsIO.Export(utils.ToBool(c.Query("redact")))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	data, e := MarshalSettingsDocument(doc)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	c.Data(200, "application/yaml; charset=utf-8", data)
+}
+
+func (sr *settingsRoute) importSettings(c *gin.Context) {
+	doc, e := ParseSettingsDocument(io.LimitReader(c.Request.Body, maxSettingsDocumentSize))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	diff, e := sr.settingsIO.Import(doc, utils.ToBool(c.Query("dryRun")))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if diff.Applied {
+		if e := sr.reload(c, diff); e != nil {
+			_ = c.Error(e)
+			return
+		}
+	}
+	SetResult(c, diff)
+}
+
+// reload reloads the components using the changed settings, the first error is returned after all reloaded
+func (sr *settingsRoute) reload(c *gin.Context, diff *SettingsDiff) error {
+	sections := make(map[string]bool)
+	for _, change := range diff.Changes {
+		sections[change.Section] = true
+		if change.Section == "drives" && change.Action != SettingsChangeCreate {
+			_ = sr.rootDrive.ClearDriveCache(change.Key)
+		}
+	}
+	var first error
+	check := func(e error) {
+		if e != nil {
+			log.Println("failed to reload after importing settings: ", e)
+			if first == nil {
+				first = e
+			}
+		}
+	}
+	if sections["drives"] {
+		check(sr.rootDrive.ReloadDrive(c.Request.Context(), true))
+	}
+	if sections["pathMounts"] {
+		check(sr.rootDrive.ReloadMounts())
+	}
+	if sections["pathPermissions"] {
+		check(sr.access.ReloadPerm())
+	}
+	if sections["jobs"] {
+		check(sr.jobExecutor.ReloadJobs())
+	}
+	return first
+}
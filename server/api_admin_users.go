@@ -1,14 +1,20 @@
 package server
 
 import (
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
 	"go-drive/common/types"
 	"go-drive/storage"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
 )
 
 type usersRoute struct {
-	userDAO *storage.UserDAO
+	userDAO      *storage.UserDAO
+	accessKeyDAO *storage.AccessKeyDAO
 }
 
 func (ar *usersRoute) listUsers(c *gin.Context) {
@@ -40,6 +46,11 @@ func (ar *usersRoute) createUser(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
+	if e := checkSSHKeys(user.SSHKeys); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	user.Managed = false
 	addUser, e := ar.userDAO.AddUser(user)
 	if e != nil {
 		_ = c.Error(e)
@@ -54,7 +65,15 @@ func (ar *usersRoute) updateUser(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
+	if e := checkSSHKeys(user.SSHKeys); e != nil {
+		_ = c.Error(e)
+		return
+	}
 	username := c.Param("username")
+	if e := ar.checkNotManaged(username); e != nil {
+		_ = c.Error(e)
+		return
+	}
 	if e := ar.userDAO.UpdateUser(username, user); e != nil {
 		_ = c.Error(e)
 		return
@@ -63,6 +82,10 @@ func (ar *usersRoute) updateUser(c *gin.Context) {
 
 func (ar *usersRoute) deleteUser(c *gin.Context) {
 	username := c.Param("username")
+	if e := ar.checkNotManaged(username); e != nil {
+		_ = c.Error(e)
+		return
+	}
 	e := ar.userDAO.DeleteUser(username)
 	if e != nil {
 		_ = c.Error(e)
@@ -70,6 +93,48 @@ func (ar *usersRoute) deleteUser(c *gin.Context) {
 	}
 }
 
+// checkNotManaged rejects changing the user declared in the provisioning file
+func (ar *usersRoute) checkNotManaged(username string) error {
+	user, e := ar.userDAO.GetUser(username)
+	if e != nil {
+		return e
+	}
+	if user.Managed {
+		return storage.NewManagedError(username)
+	}
+	return nil
+}
+
+func (ar *usersRoute) listAccessKeys(c *gin.Context) {
+	keys, e := ar.accessKeyDAO.ListAccessKeys(c.Param("username"))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, keys)
+}
+
+func (ar *usersRoute) createAccessKey(c *gin.Context) {
+	username := c.Param("username")
+	if _, e := ar.userDAO.GetUser(username); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	key, e := ar.accessKeyDAO.AddAccessKey(username)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, key)
+}
+
+func (ar *usersRoute) deleteAccessKey(c *gin.Context) {
+	if e := ar.accessKeyDAO.DeleteAccessKey(c.Param("username"), c.Param("id")); e != nil {
+		_ = c.Error(e)
+		return
+	}
+}
+
 type groupsRoute struct {
 	groupDAO *storage.GroupDAO
 }
@@ -99,6 +164,7 @@ func (gr *groupsRoute) createGroup(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
+	group.Managed = false
 	addGroup, e := gr.groupDAO.AddGroup(group)
 	if e != nil {
 		_ = c.Error(e)
@@ -114,6 +180,10 @@ func (gr *groupsRoute) updateGroup(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
+	if e := gr.checkNotManaged(name); e != nil {
+		_ = c.Error(e)
+		return
+	}
 	if e := gr.groupDAO.UpdateGroup(name, gus); e != nil {
 		_ = c.Error(e)
 		return
@@ -122,9 +192,39 @@ func (gr *groupsRoute) updateGroup(c *gin.Context) {
 
 func (gr *groupsRoute) deleteGroup(c *gin.Context) {
 	name := c.Param("name")
+	if e := gr.checkNotManaged(name); e != nil {
+		_ = c.Error(e)
+		return
+	}
 	e := gr.groupDAO.DeleteGroup(name)
 	if e != nil {
 		_ = c.Error(e)
 		return
 	}
 }
+
+// checkNotManaged rejects changing the group declared in the provisioning file
+func (gr *groupsRoute) checkNotManaged(name string) error {
+	group, e := gr.groupDAO.GetGroup(name)
+	if e != nil {
+		return e
+	}
+	if group.Managed {
+		return storage.NewManagedError(name)
+	}
+	return nil
+}
+
+// checkSSHKeys checks that every non-empty line is a valid authorized key
+func checkSSHKeys(keys string) error {
+	for i, line := range strings.Split(keys, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, e := ssh.ParseAuthorizedKey([]byte(line)); e != nil {
+			return err.NewBadRequestError(i18n.T("api.admin.invalid_ssh_key", strconv.Itoa(i+1)))
+		}
+	}
+	return nil
+}
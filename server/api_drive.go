@@ -12,9 +12,11 @@ import (
 	"go-drive/common/types"
 	"go-drive/common/utils"
 	"go-drive/drive"
+	"go-drive/server/metadata"
 	"go-drive/server/search"
 	"go-drive/server/thumbnail"
 	"go-drive/storage"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -40,6 +42,7 @@ func InitDriveRoutes(
 	searcher *search.Service,
 	config common.Config,
 	thumbnail *thumbnail.Maker,
+	media *metadata.Service,
 	signer *utils.Signer,
 	chunkUploader *ChunkUploader,
 	runner task.Runner,
@@ -48,7 +51,8 @@ func InitDriveRoutes(
 	optionsDAO *storage.OptionsDAO,
 	pathMetaDAO *storage.PathMetaDAO) error {
 
-	dr := driveRoute{config, access, searcher, tokenStore, chunkUploader, thumbnail, runner, signer, optionsDAO, pathMetaDAO}
+	dr := driveRoute{config, access, searcher, tokenStore, chunkUploader, thumbnail, media, runner, signer,
+		optionsDAO, pathMetaDAO}
 
 	router.GET("/drive-uploader/:name", dr.getDriveUploader)
 	router.HEAD("/drive-uploader/:name", dr.getDriveUploader)
@@ -59,6 +63,7 @@ func InitDriveRoutes(
 	signatureAuthRoute.HEAD("/download", dr._getDrive, dr.getContent)
 	signatureAuthRoute.GET("/download", dr._getDrive, dr.getContent)
 	signatureAuthRoute.GET("/thumbnail", dr._getDrive, dr.getThumbnail)
+	signatureAuthRoute.GET("/image", dr._getDrive, dr.getResizedImage)
 
 	tokenAuth := TokenAuth(tokenStore)
 	r := router.Group("/", tokenAuth)
@@ -105,6 +110,7 @@ type driveRoute struct {
 	tokenStore    types.TokenStore
 	chunkUploader *ChunkUploader
 	thumbnail     *thumbnail.Maker
+	media         *metadata.Service
 	runner        task.Runner
 	signer        *utils.Signer
 
@@ -190,7 +196,19 @@ func (dr *driveRoute) get(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
-	SetResult(c, dr.newEntryJson(entry, GetPrincipal(c)))
+	result := dr.newEntryJson(entry, GetPrincipal(c))
+	if dr.media != nil {
+		// the metadata not extracted yet is extracted in background, so the request is not blocked by it
+		media, e := dr.media.GetCached(entry)
+		if e != nil {
+			// the entry is still returned without the metadata
+			log.Printf("[DriveRoute] failed to get the metadata of %s: %s", utils.LogSanitize(path), e)
+		}
+		if media != nil {
+			result.Meta["media"] = media
+		}
+	}
+	SetResult(c, result)
 }
 
 func (dr *driveRoute) makeDir(c *gin.Context) {
@@ -446,6 +464,25 @@ func (dr *driveRoute) zipDownload(c *gin.Context) {
 }
 
 func (dr *driveRoute) getThumbnail(c *gin.Context) {
+	options, e := thumbnail.ParseSize(c.Query("size"))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	dr.makeThumbnail(c, options)
+}
+
+// getResizedImage resizes and converts the image, which is cached like the thumbnails
+func (dr *driveRoute) getResizedImage(c *gin.Context) {
+	options, e := thumbnail.ParseResizeOptions(c.Query("width"), c.Query("height"), c.Query("fit"), c.Query("format"))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	dr.makeThumbnail(c, options)
+}
+
+func (dr *driveRoute) makeThumbnail(c *gin.Context, options thumbnail.Options) {
 	path, e := getQueryPath(c, "path")
 	if e != nil {
 		_ = c.Error(e)
@@ -458,14 +495,15 @@ func (dr *driveRoute) getThumbnail(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
-	if entry.Meta().ThumbnailURL != "" {
+	// the thumbnails provided by the drives are in the default size only
+	if entry.Meta().ThumbnailURL != "" && options.IsDefault() {
 		c.Redirect(http.StatusFound, entry.Meta().ThumbnailURL)
 		return
 	}
 	makeCtx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 	defer cancel()
 	file, e := dr.thumbnail.Make(
-		makeCtx, dr.wrapEntryWithAccessKey(entry, c.Query(common.SignatureQueryKey)),
+		makeCtx, dr.wrapEntryWithAccessKey(entry, c.Query(common.SignatureQueryKey)), options,
 	)
 	if e != nil {
 		_ = c.Error(e)
@@ -624,10 +662,12 @@ func (dr *driveRoute) search(c *gin.Context) {
 		}
 	}
 
-	r, e := dr.searcher.Search(
-		c.Request.Context(), root, query, next,
-		dr.access.GetPerms().Filter(GetPrincipal(c)),
-	)
+	filter, e := dr.access.GetSearchFilter(GetPrincipal(c))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	r, e := dr.searcher.Search(c.Request.Context(), root, query, next, filter.Visible)
 	if e != nil {
 		_ = c.Error(e)
 		return
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/server/job"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxJobWebhookPayloadSize = 1 << 20
+
+func InitJobWebhookRoutes(router gin.IRouter, jobExecutor *job.JobExecutor, failBan *FailBanGroup) error {
+	wr := &jobWebhookRoute{jobExecutor}
+	router.POST(
+		"/job-webhooks/:id/:secret",
+		failBan.LimiterByIP("/job-webhooks", 10*time.Minute, 10),
+		wr.trigger,
+	)
+	return nil
+}
+
+type jobWebhookRoute struct {
+	jobExecutor *job.JobExecutor
+}
+
+// trigger triggers the job with the JSON object payload, which becomes the data of the trigger event.
+// String values are kept as they are, other values are JSON encoded.
+func (wr *jobWebhookRoute) trigger(c *gin.Context) {
+	id := utils.ToUInt(c.Param("id"), 0)
+	if id == 0 {
+		_ = c.Error(err.NewNotFoundError())
+		return
+	}
+	data, e := readJobWebhookPayload(c.Request)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	// the task is not returned, since the caller is not authenticated
+	if _, e := wr.jobExecutor.TriggerWebhook(id, c.Param("secret"), data); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func readJobWebhookPayload(req *http.Request) (types.SM, error) {
+	body, e := io.ReadAll(io.LimitReader(req.Body, maxJobWebhookPayloadSize+1))
+	if e != nil {
+		return nil, e
+	}
+	if len(body) > maxJobWebhookPayloadSize {
+		return nil, err.NewBadRequestError("payload is too large")
+	}
+	data := make(types.SM)
+	if len(body) == 0 {
+		return data, nil
+	}
+	payload := make(map[string]json.RawMessage)
+	if e := json.Unmarshal(body, &payload); e != nil {
+		return nil, err.NewBadRequestError("payload must be a JSON object")
+	}
+	for k, v := range payload {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			data[k] = s
+		} else {
+			data[k] = string(v)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadJobWebhookPayload(t *testing.T) {
+	req := httptest.NewRequest("POST", "/job-webhooks/1/secret",
+		strings.NewReader(`{"ref":"refs/heads/main","commits":[{"id":"a"}],"size":2,"forced":false}`))
+	data, e := readJobWebhookPayload(req)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if data["ref"] != "refs/heads/main" || data["commits"] != `[{"id":"a"}]` ||
+		data["size"] != "2" || data["forced"] != "false" {
+		t.Errorf("unexpected data: %v", data)
+	}
+
+	if data, e := readJobWebhookPayload(httptest.NewRequest("POST", "/", nil)); e != nil || len(data) != 0 {
+		t.Errorf("empty payload: %v, %v", data, e)
+	}
+	for _, body := range []string{`[1]`, `"a"`, `{`, `{"a":"` + strings.Repeat("a", maxJobWebhookPayloadSize) + `"}`} {
+		if _, e := readJobWebhookPayload(httptest.NewRequest("POST", "/", strings.NewReader(body))); e == nil {
+			t.Errorf("expected error of %.20s", body)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"go-drive/server/photo"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitPhotoRoutes(router gin.IRouter, access *drive.Access, photos *photo.Service,
+	tokenStore types.TokenStore) error {
+	pr := &photoRoute{access, photos}
+
+	r := router.Group("/photos", TokenAuth(tokenStore))
+	// list photos taken in the date
+	r.GET("", pr.list)
+	// count photos by year, month or day
+	r.GET("/timeline", pr.timeline)
+	// list geotagged photos in the bounding box
+	r.GET("/geo", pr.geo)
+
+	// rebuild the photo index of the path
+	router.PUT("/admin/photo-indexes", TokenAuth(tokenStore), AdminGroupRequired(), pr.updateIndexes)
+	return nil
+}
+
+type photoRoute struct {
+	access *drive.Access
+	photos *photo.Service
+}
+
+// prepare returns the chroot of the user, the root wrapped in the chroot and the visibility filter.
+// ok is false if the request is done, either with an error or the empty result
+func (pr *photoRoute) prepare(c *gin.Context, empty any) (*drive.Chroot, string, photo.Filter, bool) {
+	root, e := getQueryPath(c, "path")
+	if e != nil {
+		_ = c.Error(e)
+		return nil, "", nil, false
+	}
+	chroot, e := pr.access.GetChroot(GetPrincipal(c))
+	if e != nil {
+		_ = c.Error(e)
+		return nil, "", nil, false
+	}
+	if chroot != nil {
+		root, e = chroot.WrapPath(root)
+		if e != nil {
+			if err.IsNotFoundError(e) {
+				SetResult(c, empty)
+			} else {
+				_ = c.Error(e)
+			}
+			return nil, "", nil, false
+		}
+	}
+	filter, e := pr.access.GetSearchFilter(GetPrincipal(c))
+	if e != nil {
+		_ = c.Error(e)
+		return nil, "", nil, false
+	}
+	return chroot, root, filter.Visible, true
+}
+
+func (pr *photoRoute) timeline(c *gin.Context) {
+	_, root, filter, ok := pr.prepare(c, []photo.TimelineBucket{})
+	if !ok {
+		return
+	}
+	r, e := pr.photos.Timeline(c.Request.Context(), root, photo.Group(c.DefaultQuery("group", "month")), filter)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, r)
+}
+
+func (pr *photoRoute) list(c *gin.Context) {
+	chroot, root, filter, ok := pr.prepare(c, photo.Result{Items: []photo.Photo{}, Next: -1})
+	if !ok {
+		return
+	}
+	r, e := pr.photos.List(c.Request.Context(), root, c.Query("date"), utils.ToInt(c.Query("next"), 0), filter)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, unwrapPhotos(chroot, r))
+}
+
+func (pr *photoRoute) geo(c *gin.Context) {
+	box, e := photo.ParseGeoBox(c.Query("bbox"))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	chroot, root, filter, ok := pr.prepare(c, photo.Result{Items: []photo.Photo{}, Next: -1})
+	if !ok {
+		return
+	}
+	r, e := pr.photos.Geo(c.Request.Context(), root, box, utils.ToInt(c.Query("next"), 0), filter)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, unwrapPhotos(chroot, r))
+}
+
+func unwrapPhotos(chroot *drive.Chroot, r photo.Result) photo.Result {
+	if chroot != nil {
+		for i := range r.Items {
+			r.Items[i].Path = chroot.UnwrapPath(r.Items[i].Path)
+		}
+	}
+	return r
+}
+
+func (pr *photoRoute) updateIndexes(c *gin.Context) {
+	root, e := getQueryPath(c, "path")
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	t, e := pr.photos.TriggerIndexAll(root)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, t)
+}
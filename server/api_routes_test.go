@@ -113,13 +113,13 @@ func TestAdminRoutesUseNormalizedResources(t *testing.T) {
 
 	if e := InitAdminRoutes(
 		router, ch, common.Config{}, nil, nil, nil, nil, nil, nil, nil,
-		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
 	); e != nil {
 		t.Fatalf("InitAdminRoutes() error = %v", e)
 	}
 
-	if got := len(router.Routes()); got != 51 {
-		t.Fatalf("registered admin route count = %d, want 51", got)
+	if got := len(router.Routes()); got != 62 {
+		t.Fatalf("registered admin route count = %d, want 62", got)
 	}
 	assertRegisteredRoutes(t, router,
 		"GET /admin/users",
@@ -127,6 +127,9 @@ func TestAdminRoutesUseNormalizedResources(t *testing.T) {
 		"GET /admin/users/:username",
 		"PUT /admin/users/:username",
 		"DELETE /admin/users/:username",
+		"GET /admin/users/:username/access-keys",
+		"POST /admin/users/:username/access-keys",
+		"DELETE /admin/users/:username/access-keys/:id",
 		"GET /admin/groups",
 		"POST /admin/groups",
 		"GET /admin/groups/:name",
@@ -146,6 +149,9 @@ func TestAdminRoutesUseNormalizedResources(t *testing.T) {
 		"DELETE /admin/path-metadata",
 		"PUT /admin/path-mounts",
 		"PUT /admin/search-indexes",
+		"GET /admin/search-indexes/schedules",
+		"PUT /admin/search-indexes/schedules",
+		"PUT /admin/thumbnails",
 		"POST /admin/maintenance/path-rules/cleanup",
 		"DELETE /admin/drives/:name/cache",
 		"GET /admin/drive-scripts",
@@ -157,6 +163,9 @@ func TestAdminRoutesUseNormalizedResources(t *testing.T) {
 		"GET /admin/job-definitions",
 		"GET /admin/job-executions",
 		"POST /admin/job-executions",
+		"GET /admin/job-executions/:id/steps",
+		"GET /admin/job-executions/:id/logs",
+		"GET /admin/job-executions/:id/logs/stream",
 		"POST /admin/job-executions/:id/cancel",
 		"DELETE /admin/job-executions/:id",
 		"DELETE /admin/job-executions",
@@ -165,6 +174,8 @@ func TestAdminRoutesUseNormalizedResources(t *testing.T) {
 		"POST /admin/file-buckets",
 		"PUT /admin/file-buckets/:name",
 		"DELETE /admin/file-buckets/:name",
+		"GET /admin/settings/export",
+		"POST /admin/settings/import",
 	)
 	assertRoutesNotRegistered(t, router,
 		"GET /admin/user/:username",
@@ -188,13 +199,13 @@ func TestDriveRoutesUseRPCOperations(t *testing.T) {
 	router := gin.New()
 
 	if e := InitDriveRoutes(
-		router, nil, nil, common.Config{}, nil, nil, nil, nil, nil, nil, nil, nil,
+		router, nil, nil, common.Config{}, nil, nil, nil, nil, nil, nil, nil, nil, nil,
 	); e != nil {
 		t.Fatalf("InitDriveRoutes() error = %v", e)
 	}
 
-	if got := len(router.Routes()); got != 19 {
-		t.Fatalf("registered drive route count = %d, want 19", got)
+	if got := len(router.Routes()); got != 20 {
+		t.Fatalf("registered drive route count = %d, want 20", got)
 	}
 	assertRegisteredRoutes(t, router,
 		"GET /stat",
@@ -208,6 +219,7 @@ func TestDriveRoutesUseRPCOperations(t *testing.T) {
 		"GET /download",
 		"HEAD /download",
 		"GET /thumbnail",
+		"GET /image",
 		"GET /search",
 		"POST /archive",
 		"POST /chunk-uploads",
@@ -235,6 +247,25 @@ func TestDriveRoutesUseRPCOperations(t *testing.T) {
 	)
 }
 
+func TestPhotoRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	if e := InitPhotoRoutes(router, nil, nil, nil); e != nil {
+		t.Fatalf("InitPhotoRoutes() error = %v", e)
+	}
+
+	if got := len(router.Routes()); got != 4 {
+		t.Fatalf("registered photo route count = %d, want 4", got)
+	}
+	assertRegisteredRoutes(t, router,
+		"GET /photos",
+		"GET /photos/timeline",
+		"GET /photos/geo",
+		"PUT /admin/photo-indexes",
+	)
+}
+
 func TestGetQueryPathRequiresParameterAndAllowsRoot(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 
@@ -10,6 +11,8 @@ import (
 	"go-drive/common/registry"
 	"go-drive/common/types"
 	"go-drive/storage"
+
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -226,3 +229,31 @@ func (ua *UserAuth) authenticateIdentity(r *http.Request, formData types.SM) (ty
 func (ua *UserAuth) AuthByUsernamePassword(username, password string) (types.User, error) {
 	return ua.authenticateIdentity(nil, types.SM{"username": username, "password": password})
 }
+
+// AuthByPublicKey authenticates with one of the user's authorized public keys,
+// used by SFTP. The keys are stored locally for all users, including the users
+// owned by an external provider.
+func (ua *UserAuth) AuthByPublicKey(username string, key ssh.PublicKey) (types.User, error) {
+	invalid := err.NewNotAllowedMessageError(i18n.T("api.auth.invalid_username_or_password"))
+
+	user, e := ua.userDAO.GetUser(username)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return types.User{}, invalid
+		}
+		return types.User{}, e
+	}
+	keyBytes := key.Marshal()
+	rest := []byte(user.SSHKeys)
+	for len(rest) > 0 {
+		authorized, _, _, next, e := ssh.ParseAuthorizedKey(rest)
+		if e != nil {
+			break
+		}
+		if bytes.Equal(authorized.Marshal(), keyBytes) {
+			return user, nil
+		}
+		rest = next
+	}
+	return types.User{}, invalid
+}
@@ -0,0 +1,184 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *session) cmdPasv(string) {
+	local := c.raw.LocalAddr().(*net.TCPAddr)
+	ip := c.s.publicHost
+	if ip == nil {
+		ip = local.IP.To4()
+	}
+	if ip == nil {
+		c.reply(425, "PASV is not available on IPv6 connections, use EPSV")
+		return
+	}
+	port, ok := c.listenPassive(local.IP)
+	if !ok {
+		return
+	}
+	c.reply(227, "Entering Passive Mode ("+strings.ReplaceAll(ip.String(), ".", ",")+","+
+		strconv.Itoa(port>>8)+","+strconv.Itoa(port&0xff)+")")
+}
+
+func (c *session) cmdEpsv(arg string) {
+	if strings.ToUpper(arg) == "ALL" {
+		c.reply(200, "EPSV ALL ok")
+		return
+	}
+	port, ok := c.listenPassive(c.raw.LocalAddr().(*net.TCPAddr).IP)
+	if !ok {
+		return
+	}
+	c.reply(229, "Entering Extended Passive Mode (|||"+strconv.Itoa(port)+"|)")
+}
+
+func (c *session) listenPassive(ip net.IP) (int, bool) {
+	c.closeData()
+	l, e := c.s.listenPassive(ip)
+	if e != nil {
+		c.reply(425, "Can't open passive connection")
+		return 0, false
+	}
+	c.passive = l
+	return l.Addr().(*net.TCPAddr).Port, true
+}
+
+// cmdPort enters the active mode, the data connection is made to the client.
+// Only the address of the client itself is accepted, to prevent the FTP bounce attack.
+func (c *session) cmdPort(arg string) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		c.reply(501, "Invalid PORT command")
+		return
+	}
+	nums := make([]byte, 6)
+	for i, p := range parts {
+		n, e := strconv.Atoi(strings.TrimSpace(p))
+		if e != nil || n < 0 || n > 255 {
+			c.reply(501, "Invalid PORT command")
+			return
+		}
+		nums[i] = byte(n)
+	}
+	c.setActive(net.IPv4(nums[0], nums[1], nums[2], nums[3]), int(nums[4])<<8|int(nums[5]))
+}
+
+// cmdEprt handles the extended PORT command like '|1|132.235.1.2|6275|'
+func (c *session) cmdEprt(arg string) {
+	if len(arg) < 2 {
+		c.reply(501, "Invalid EPRT command")
+		return
+	}
+	parts := strings.Split(arg[1:len(arg)-1], arg[:1])
+	if len(parts) != 3 || !strings.HasSuffix(arg, arg[:1]) {
+		c.reply(501, "Invalid EPRT command")
+		return
+	}
+	ip := net.ParseIP(parts[1])
+	port, e := strconv.Atoi(parts[2])
+	if ip == nil || e != nil {
+		c.reply(501, "Invalid EPRT command")
+		return
+	}
+	c.setActive(ip, port)
+}
+
+func (c *session) setActive(ip net.IP, port int) {
+	if port <= 0 || port > 65535 || !ip.Equal(c.raw.RemoteAddr().(*net.TCPAddr).IP) {
+		c.reply(501, "Illegal data connection address")
+		return
+	}
+	c.closeData()
+	c.active = &net.TCPAddr{IP: ip, Port: port}
+	c.reply(200, "Command okay")
+}
+
+// openData opens the data connection prepared by PASV/EPSV or PORT/EPRT
+func (c *session) openData() (net.Conn, error) {
+	defer c.closeData()
+	var (
+		conn net.Conn
+		e    error
+	)
+	switch {
+	case c.passive != nil:
+		conn, e = c.acceptData()
+	case c.active != nil:
+		dialer := net.Dialer{Timeout: dataConnectTimeout}
+		conn, e = dialer.DialContext(c.ctx, "tcp", c.active.String())
+	default:
+		return nil, net.ErrClosed
+	}
+	if e != nil {
+		return nil, e
+	}
+	if c.protected {
+		tlsConn := tls.Server(conn, c.s.tlsConfig)
+		_ = tlsConn.SetDeadline(time.Now().Add(dataConnectTimeout))
+		if e := tlsConn.Handshake(); e != nil {
+			_ = conn.Close()
+			return nil, e
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// acceptData accepts the passive data connection, which must come from the same IP as the control connection
+func (c *session) acceptData() (net.Conn, error) {
+	l := c.passive
+	stop := context.AfterFunc(c.ctx, func() { _ = l.Close() })
+	defer stop()
+	_ = l.(*net.TCPListener).SetDeadline(time.Now().Add(dataConnectTimeout))
+	clientIP := c.raw.RemoteAddr().(*net.TCPAddr).IP
+	for {
+		conn, e := l.Accept()
+		if e != nil {
+			return nil, e
+		}
+		if conn.RemoteAddr().(*net.TCPAddr).IP.Equal(clientIP) {
+			return conn, nil
+		}
+		_ = conn.Close()
+	}
+}
+
+func (c *session) closeData() {
+	if c.passive != nil {
+		_ = c.passive.Close()
+		c.passive = nil
+	}
+	c.active = nil
+}
+
+// transfer runs fn with the data connection, the final reply is sent by the caller if it returns true
+func (c *session) transfer(fn func(conn net.Conn) error) bool {
+	if c.passive == nil && c.active == nil {
+		c.reply(425, "Use PASV or PORT first")
+		return false
+	}
+	c.reply(150, "Opening data connection")
+	conn, e := c.openData()
+	if e != nil {
+		c.reply(425, "Can't open data connection")
+		return false
+	}
+	// the data connection is closed if the server is stopped during the transfer
+	stop := context.AfterFunc(c.ctx, func() { _ = conn.Close() })
+	e = fn(conn)
+	stop()
+	_ = conn.Close()
+	if e != nil {
+		c.reply(426, "Connection closed, transfer aborted")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package ftp
+
+import (
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const factTimeFormat = "20060102150405"
+
+// listTarget returns the path argument of LIST and NLST, the options like '-la' sent by some clients are ignored
+func listTarget(arg string) string {
+	for strings.HasPrefix(arg, "-") {
+		_, rest, _ := strings.Cut(arg, " ")
+		arg = rest
+	}
+	return arg
+}
+
+// list returns the entries of the directory, or the file itself.
+// Entries whose names can't be sent over the control connection are skipped.
+func (c *session) list(arg string) ([]types.IEntry, bool) {
+	d, entry, e := c.get(arg)
+	if e != nil {
+		c.replyError(e)
+		return nil, false
+	}
+	if !entry.Type().IsDir() {
+		return []types.IEntry{entry}, true
+	}
+	entries, e := d.List(c.ctx, entry.Path())
+	if e != nil {
+		c.replyError(e)
+		return nil, false
+	}
+	result := make([]types.IEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.ContainsAny(entryName(entry), "\r\n") {
+			result = append(result, entry)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return entryName(result[i]) < entryName(result[j]) })
+	return result, true
+}
+
+func (c *session) sendList(arg string, format func(entry types.IEntry) string) {
+	entries, ok := c.list(listTarget(arg))
+	if !ok {
+		return
+	}
+	if c.transfer(func(conn net.Conn) error {
+		b := strings.Builder{}
+		for _, entry := range entries {
+			b.WriteString(format(entry) + "\r\n")
+		}
+		_, e := io.WriteString(conn, b.String())
+		return e
+	}) {
+		c.reply(226, "Transfer complete")
+	}
+}
+
+func (c *session) cmdList(arg string) {
+	now := time.Now()
+	c.sendList(arg, func(entry types.IEntry) string { return formatListLine(entry, now) })
+}
+
+func (c *session) cmdNlst(arg string) {
+	c.sendList(arg, entryName)
+}
+
+func (c *session) cmdMlsd(arg string) {
+	_, entry, e := c.get(arg)
+	if e == nil && !entry.Type().IsDir() {
+		e = errNotDir
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.sendList(arg, func(entry types.IEntry) string { return formatFacts(entry) + " " + entryName(entry) })
+}
+
+func (c *session) cmdMlst(arg string) {
+	_, entry, e := c.get(arg)
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.replyLines(250, "Listing "+quotePath(entry.Path()),
+		[]string{formatFacts(entry) + " /" + entry.Path()}, "End")
+}
+
+func entryName(entry types.IEntry) string {
+	return utils.PathBase(entry.Path())
+}
+
+// formatListLine formats the entry like 'ls -l', which is expected by most clients
+func formatListLine(entry types.IEntry, now time.Time) string {
+	mode := "-rw-r--r--"
+	if entry.Type().IsDir() {
+		mode = "drwxr-xr-x"
+	}
+	if !entry.Meta().Writable {
+		mode = strings.ReplaceAll(mode, "w", "-")
+	}
+	modTime := utils.Time(entry.ModTime()).UTC()
+	timeFormat := "Jan _2 15:04"
+	if now.Sub(modTime) > 180*24*time.Hour || modTime.Sub(now) > 24*time.Hour {
+		timeFormat = "Jan _2  2006"
+	}
+	size := entry.Size()
+	if size < 0 {
+		size = 0
+	}
+	return mode + " 1 ftp ftp " + padLeft(strconv.FormatInt(size, 10), 12) + " " +
+		modTime.Format(timeFormat) + " " + entryName(entry)
+}
+
+func padLeft(s string, n int) string {
+	if len(s) >= n {
+		return s
+	}
+	return strings.Repeat(" ", n-len(s)) + s
+}
+
+// formatFacts formats the facts of the entry for MLSD and MLST, see RFC 3659
+func formatFacts(entry types.IEntry) string {
+	meta := entry.Meta()
+	facts := strings.Builder{}
+	if entry.Type().IsDir() {
+		facts.WriteString("type=dir;")
+	} else {
+		facts.WriteString("type=file;size=" + strconv.FormatInt(max(entry.Size(), 0), 10) + ";")
+	}
+	if entry.ModTime() > 0 {
+		facts.WriteString("modify=" + formatFactTime(entry.ModTime()) + ";")
+	}
+	perm := ""
+	if entry.Type().IsDir() {
+		perm = "el"
+		if meta.Writable {
+			perm += "cmpdf"
+		}
+	} else {
+		if meta.Readable {
+			perm = "r"
+		}
+		if meta.Writable {
+			perm += "wadf"
+		}
+	}
+	facts.WriteString("perm=" + perm + ";")
+	return facts.String()
+}
+
+func formatFactTime(millis int64) string {
+	return utils.Time(millis).UTC().Format(factTimeFormat)
+}
@@ -0,0 +1,225 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"go-drive/common"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"log"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	idleTimeout        = 5 * time.Minute
+	dataConnectTimeout = 30 * time.Second
+
+	maxAuthFailures   = 10
+	authFailureWindow = 10 * time.Minute
+)
+
+// Authenticator authenticates the FTP users, it's implemented by auth.UserAuth
+type Authenticator interface {
+	AuthByUsernamePassword(username, password string) (types.User, error)
+}
+
+// DriveGetter returns the drive view of the principal, it's implemented by drive.Access
+type DriveGetter interface {
+	GetDrive(session types.Principal) (types.IDrive, error)
+}
+
+// Server serves the virtual tree over FTP, with optional explicit FTPS (AUTH TLS).
+// A connection works on the drive of the user logged in by USER and PASS.
+type Server struct {
+	drives  DriveGetter
+	users   Authenticator
+	tempDir string
+
+	// tlsConfig is nil if FTPS is not configured
+	tlsConfig   *tls.Config
+	tlsRequired bool
+	publicHost  net.IP
+	// passivePorts is the inclusive port range of the passive listeners, 0 means any free port
+	passivePorts [2]int
+
+	listener net.Listener
+	// failures counts the password failures by remote IP
+	failures *utils.KVCache[int]
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewServer(config common.Config, drives DriveGetter, users Authenticator) (*Server, error) {
+	c := config.FTP
+	passivePorts, e := parsePortRange(c.PassivePorts)
+	if e != nil {
+		return nil, e
+	}
+	var publicHost net.IP
+	if c.PublicHost != "" {
+		if publicHost = net.ParseIP(c.PublicHost).To4(); publicHost == nil {
+			return nil, fmt.Errorf("ftp public-host must be an IPv4 address: %s", c.PublicHost)
+		}
+	}
+	var tlsConfig *tls.Config
+	if c.TLSCert != "" || c.TLSKey != "" {
+		cert, e := tls.LoadX509KeyPair(dataFile(config, c.TLSCert), dataFile(config, c.TLSKey))
+		if e != nil {
+			return nil, fmt.Errorf("ftp tls certificate: %w", e)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if c.TLSRequired && tlsConfig == nil {
+		return nil, errors.New("ftp tls-required is set, but tls-cert and tls-key are not configured")
+	}
+	listener, e := net.Listen("tcp", c.Listen)
+	if e != nil {
+		return nil, e
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		drives:       drives,
+		users:        users,
+		tempDir:      config.TempDir,
+		tlsConfig:    tlsConfig,
+		tlsRequired:  c.TLSRequired,
+		publicHost:   publicHost,
+		passivePorts: passivePorts,
+		listener:     listener,
+		failures:     utils.NewKVCache[int](0, authFailureWindow),
+		conns:        make(map[net.Conn]struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	log.Printf("FTP server is listening on %s", listener.Addr())
+	return s, nil
+}
+
+func dataFile(config common.Config, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(config.DataDir, file)
+}
+
+// parsePortRange parses the port range like '50000-50100', a single port is also accepted
+func parsePortRange(s string) ([2]int, error) {
+	if s == "" {
+		return [2]int{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		to = from
+	}
+	lo, e1 := strconv.Atoi(strings.TrimSpace(from))
+	hi, e2 := strconv.Atoi(strings.TrimSpace(to))
+	if e1 != nil || e2 != nil || lo <= 0 || hi > 65535 || lo > hi {
+		return [2]int{}, fmt.Errorf("invalid ftp passive-ports: %s", s)
+	}
+	return [2]int{lo, hi}, nil
+}
+
+// Addr returns the listening address
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, e := s.listener.Accept()
+		if e != nil {
+			if s.ctx.Err() == nil {
+				log.Printf("[ftp] accept error: %v", e)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			newSession(s, conn).serve()
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// listenPassive listens on a free port in the passive port range, at the given local IP
+func (s *Server) listenPassive(ip net.IP) (net.Listener, error) {
+	if s.passivePorts[0] == 0 {
+		return net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	}
+	count := s.passivePorts[1] - s.passivePorts[0] + 1
+	// starts at a random port, so that concurrent sessions don't race for the same ports
+	offset := rand.Intn(count)
+	for i := 0; i < count; i++ {
+		port := s.passivePorts[0] + (offset+i)%count
+		l, e := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if e == nil {
+			return l, nil
+		}
+	}
+	return nil, errors.New("no free passive port")
+}
+
+// authenticate checks the password, remote IPs are banned for a while after too many failures
+func (s *Server) authenticate(ip, username, password string) (types.User, error) {
+	if n, _ := s.failures.Get(ip); n >= maxAuthFailures {
+		return types.User{}, errTooManyFailures
+	}
+	user, e := s.users.AuthByUsernamePassword(username, password)
+	if e != nil {
+		if err.IsNotAllowedError(e) {
+			n, _ := s.failures.Get(ip)
+			s.failures.Set(ip, n+1, authFailureWindow)
+		}
+		return types.User{}, e
+	}
+	s.failures.Remove(ip)
+	return user, nil
+}
+
+var errTooManyFailures = errors.New("too many authentication failures")
+
+func remoteIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	return addr.String()
+}
+
+// Dispose stops the server and closes all connections
+func (s *Server) Dispose() error {
+	s.cancel()
+	e := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	_ = s.failures.Dispose()
+	return e
+}
@@ -0,0 +1,290 @@
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/drive/fs"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+type testUsers struct{}
+
+func (u *testUsers) AuthByUsernamePassword(username, password string) (types.User, error) {
+	if username == "alice" && password == "secret" {
+		return types.User{Username: username}, nil
+	}
+	return types.User{}, err.NewNotAllowedMessageError(i18n.T("api.auth.invalid_username_or_password"))
+}
+
+type testDrives struct {
+	drive     types.IDrive
+	principal types.Principal
+}
+
+func (d *testDrives) GetDrive(session types.Principal) (types.IDrive, error) {
+	d.principal = session
+	return d.drive, nil
+}
+
+func newTestServer(t *testing.T, ftpConfig common.FTPConfig) (*Server, *testDrives, string) {
+	t.Helper()
+	root := t.TempDir()
+	config := common.Config{DataDir: t.TempDir(), TempDir: t.TempDir(), FreeFs: true}
+	ftpConfig.Listen = "127.0.0.1:0"
+	if ftpConfig.TLSCert != "" {
+		writeTestCert(t, filepath.Join(config.DataDir, ftpConfig.TLSCert), filepath.Join(config.DataDir, ftpConfig.TLSKey))
+	}
+	config.FTP = ftpConfig
+
+	fsDrive, e := fs.NewDrive(context.Background(), types.SM{"path": root}, driveutil.DriveUtils{Config: config})
+	if e != nil {
+		t.Fatal(e)
+	}
+	drives := &testDrives{drive: fsDrive}
+	s, e := NewServer(config, drives, &testUsers{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = s.Dispose() })
+	return s, drives, root
+}
+
+func writeTestCert(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	key, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Fatal(e)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, e := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	keyDer, e := x509.MarshalECPrivateKey(key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
+
+func dial(t *testing.T, s *Server, options ...ftp.DialOption) *ftp.ServerConn {
+	t.Helper()
+	c, e := ftp.Dial(s.Addr().String(), append(options, ftp.DialWithTimeout(5*time.Second))...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = c.Quit() })
+	if e := c.Login("alice", "secret"); e != nil {
+		t.Fatal(e)
+	}
+	return c
+}
+
+func retrieve(t *testing.T, c *ftp.ServerConn, path string, offset uint64) string {
+	t.Helper()
+	r, e := c.RetrFrom(path, offset)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = r.Close() }()
+	data, e := io.ReadAll(r)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return string(data)
+}
+
+func TestServer_FileOperations(t *testing.T) {
+	s, drives, root := newTestServer(t, common.FTPConfig{})
+	c := dial(t, s)
+
+	if e := c.MakeDir("scans"); e != nil {
+		t.Fatal(e)
+	}
+	if drives.principal.AuthType != types.AuthTypeFTP || drives.principal.User.Username != "alice" {
+		t.Errorf("unexpected principal: %+v", drives.principal)
+	}
+	if e := c.ChangeDir("scans"); e != nil {
+		t.Fatal(e)
+	}
+	if dir, _ := c.CurrentDir(); dir != "/scans" {
+		t.Errorf("current dir: %s", dir)
+	}
+	if e := c.Stor("page 1.pdf", strings.NewReader("hello world")); e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Stor("empty.txt", bytes.NewReader(nil)); e != nil {
+		t.Fatal(e)
+	}
+	data, e := os.ReadFile(filepath.Join(root, "scans", "page 1.pdf"))
+	if e != nil || string(data) != "hello world" {
+		t.Fatalf("saved content: %q, %v", data, e)
+	}
+	if _, e := os.Stat(filepath.Join(root, "scans", "empty.txt")); e != nil {
+		t.Fatal(e)
+	}
+
+	if got := retrieve(t, c, "/scans/page 1.pdf", 0); got != "hello world" {
+		t.Errorf("retrieved: %q", got)
+	}
+	if got := retrieve(t, c, "page 1.pdf", 6); got != "world" {
+		t.Errorf("retrieved from offset: %q", got)
+	}
+	if size, e := c.FileSize("page 1.pdf"); e != nil || size != 11 {
+		t.Errorf("size: %d, %v", size, e)
+	}
+
+	entries, e := c.List("/scans")
+	if e != nil {
+		t.Fatal(e)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	if strings.Join(names, ",") != "empty.txt,page 1.pdf" {
+		t.Errorf("listed: %v", names)
+	}
+	if entries[1].Type != ftp.EntryTypeFile || entries[1].Size != 11 {
+		t.Errorf("listed entry: %+v", entries[1])
+	}
+	if nameList, e := c.NameList("/scans"); e != nil || len(nameList) != 2 {
+		t.Errorf("name list: %v, %v", nameList, e)
+	}
+
+	if e := c.Rename("page 1.pdf", "/scans/page-1.pdf"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(filepath.Join(root, "scans", "page-1.pdf")); e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Delete("page-1.pdf"); e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Delete("empty.txt"); e != nil {
+		t.Fatal(e)
+	}
+	if e := c.ChangeDirToParent(); e != nil {
+		t.Fatal(e)
+	}
+	if e := c.RemoveDir("scans"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(filepath.Join(root, "scans")); !os.IsNotExist(e) {
+		t.Errorf("directory is not removed: %v", e)
+	}
+
+	if e := c.ChangeDir("not-exists"); e == nil {
+		t.Error("expected error of changing to a missing directory")
+	}
+	if _, e := c.Retr("../../etc/passwd"); e == nil {
+		t.Error("expected error of retrieving outside of the root")
+	}
+}
+
+func TestServer_LoginFailure(t *testing.T) {
+	s, _, _ := newTestServer(t, common.FTPConfig{})
+	c, e := ftp.Dial(s.Addr().String(), ftp.DialWithTimeout(5*time.Second))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = c.Quit() }()
+	if e := c.Login("alice", "wrong"); e == nil {
+		t.Fatal("expected login failure")
+	}
+	if _, e := c.List("/"); e == nil {
+		t.Error("expected error of listing without login")
+	}
+
+	for i := 0; i < maxAuthFailures; i++ {
+		_ = c.Login("alice", "wrong")
+	}
+	if e := c.Login("alice", "secret"); e == nil {
+		t.Error("expected login to be rejected after too many failures")
+	}
+}
+
+func TestServer_PassivePorts(t *testing.T) {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	s, _, root := newTestServer(t, common.FTPConfig{PassivePorts: strconv.Itoa(port) + "-" + strconv.Itoa(port)})
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644)
+	c := dial(t, s, ftp.DialWithDisabledEPSV(true))
+	for i := 0; i < 2; i++ {
+		if got := retrieve(t, c, "a.txt", 0); got != "a" {
+			t.Errorf("retrieved: %q", got)
+		}
+	}
+}
+
+func TestServer_ExplicitTLS(t *testing.T) {
+	s, _, root := newTestServer(t, common.FTPConfig{TLSCert: "cert.pem", TLSKey: "key.pem", TLSRequired: true})
+
+	plain, e := ftp.Dial(s.Addr().String(), ftp.DialWithTimeout(5*time.Second))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := plain.Login("alice", "secret"); e == nil {
+		t.Error("expected login over plain connection to be rejected")
+	}
+	_ = plain.Quit()
+
+	c := dial(t, s, ftp.DialWithExplicitTLS(&tls.Config{InsecureSkipVerify: true}))
+	if e := c.Stor("scan.pdf", strings.NewReader("secure")); e != nil {
+		t.Fatal(e)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "scan.pdf")); string(data) != "secure" {
+		t.Errorf("saved content: %q", data)
+	}
+	if got := retrieve(t, c, "scan.pdf", 0); got != "secure" {
+		t.Errorf("retrieved: %q", got)
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	if r, e := parsePortRange("50000-50100"); e != nil || r != [2]int{50000, 50100} {
+		t.Errorf("parsed: %v, %v", r, e)
+	}
+	if r, e := parsePortRange("2121"); e != nil || r != [2]int{2121, 2121} {
+		t.Errorf("parsed: %v, %v", r, e)
+	}
+	for _, s := range []string{"a-b", "100-10", "0-10", "1-70000"} {
+		if _, e := parsePortRange(s); e == nil {
+			t.Errorf("expected error of %s", s)
+		}
+	}
+}
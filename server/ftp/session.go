@@ -0,0 +1,618 @@
+package ftp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxCommandLength = 4096
+
+type command struct {
+	fn func(c *session, arg string)
+	// auth indicates the command requires a logged-in user
+	auth bool
+}
+
+var commands = map[string]command{
+	"USER": {fn: (*session).cmdUser},
+	"PASS": {fn: (*session).cmdPass},
+	"AUTH": {fn: (*session).cmdAuth},
+	"PBSZ": {fn: (*session).cmdPbsz},
+	"PROT": {fn: (*session).cmdProt},
+	"FEAT": {fn: (*session).cmdFeat},
+	"OPTS": {fn: (*session).cmdOpts},
+	"SYST": {fn: (*session).cmdSyst},
+	"NOOP": {fn: (*session).cmdNoop},
+	"QUIT": {fn: (*session).cmdQuit},
+
+	"PWD":  {fn: (*session).cmdPwd, auth: true},
+	"XPWD": {fn: (*session).cmdPwd, auth: true},
+	"CWD":  {fn: (*session).cmdCwd, auth: true},
+	"XCWD": {fn: (*session).cmdCwd, auth: true},
+	"CDUP": {fn: (*session).cmdCdup, auth: true},
+	"XCUP": {fn: (*session).cmdCdup, auth: true},
+	"TYPE": {fn: (*session).cmdType, auth: true},
+	"MODE": {fn: (*session).cmdMode, auth: true},
+	"STRU": {fn: (*session).cmdStru, auth: true},
+	"ALLO": {fn: (*session).cmdAllo, auth: true},
+	"ABOR": {fn: (*session).cmdAbor, auth: true},
+
+	"PASV": {fn: (*session).cmdPasv, auth: true},
+	"EPSV": {fn: (*session).cmdEpsv, auth: true},
+	"PORT": {fn: (*session).cmdPort, auth: true},
+	"EPRT": {fn: (*session).cmdEprt, auth: true},
+
+	"LIST": {fn: (*session).cmdList, auth: true},
+	"NLST": {fn: (*session).cmdNlst, auth: true},
+	"MLSD": {fn: (*session).cmdMlsd, auth: true},
+	"MLST": {fn: (*session).cmdMlst, auth: true},
+	"SIZE": {fn: (*session).cmdSize, auth: true},
+	"MDTM": {fn: (*session).cmdMdtm, auth: true},
+	"REST": {fn: (*session).cmdRest, auth: true},
+	"RETR": {fn: (*session).cmdRetr, auth: true},
+	"STOR": {fn: (*session).cmdStor, auth: true},
+	"DELE": {fn: (*session).cmdDele, auth: true},
+	"MKD":  {fn: (*session).cmdMkd, auth: true},
+	"XMKD": {fn: (*session).cmdMkd, auth: true},
+	"RMD":  {fn: (*session).cmdRmd, auth: true},
+	"XRMD": {fn: (*session).cmdRmd, auth: true},
+	"RNFR": {fn: (*session).cmdRnfr, auth: true},
+	"RNTO": {fn: (*session).cmdRnto, auth: true},
+}
+
+// session is a control connection. Commands are handled one by one,
+// data transfers block the control connection until they are completed.
+type session struct {
+	s      *Server
+	ctx    context.Context
+	raw    net.Conn
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// secure indicates the control connection is upgraded by AUTH TLS
+	secure bool
+	// protected indicates the data connections are protected by TLS (PROT P)
+	protected bool
+
+	username  string
+	principal *types.Principal
+	// cwd is the current directory, in the drive path form
+	cwd string
+	// prev is the previous command, for the RNFR/RNTO and REST sequences
+	prev       string
+	renameFrom string
+	restOffset int64
+
+	passive net.Listener
+	active  *net.TCPAddr
+
+	quit bool
+}
+
+func newSession(s *Server, conn net.Conn) *session {
+	return &session{
+		s:      s,
+		ctx:    s.ctx,
+		raw:    conn,
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, maxCommandLength),
+	}
+}
+
+func (c *session) serve() {
+	defer c.close()
+	c.reply(220, "go-drive FTP server ready")
+	for !c.quit {
+		_ = c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		line, e := c.readLine()
+		if e != nil {
+			var ne net.Error
+			if errors.As(e, &ne) && ne.Timeout() {
+				c.reply(421, "Idle timeout, closing control connection")
+			}
+			return
+		}
+		name, arg, _ := strings.Cut(line, " ")
+		name = strings.ToUpper(name)
+		prev := c.prev
+		c.prev = name
+
+		cmd, ok := commands[name]
+		if !ok {
+			c.reply(502, "Command not implemented")
+			continue
+		}
+		if cmd.auth && c.principal == nil {
+			c.reply(530, "Please login with USER and PASS")
+			continue
+		}
+		if name != "RNTO" || prev != "RNFR" {
+			c.renameFrom = ""
+		}
+		if (name != "RETR" && name != "STOR") || prev != "REST" {
+			c.restOffset = 0
+		}
+		cmd.fn(c, arg)
+	}
+}
+
+func (c *session) readLine() (string, error) {
+	line, e := c.reader.ReadSlice('\n')
+	if errors.Is(e, bufio.ErrBufferFull) {
+		c.reply(500, "Command line too long")
+		return "", e
+	}
+	if e != nil {
+		return "", e
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (c *session) reply(code int, msg string) {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	_, _ = fmt.Fprintf(c.conn, "%d %s\r\n", code, msg)
+}
+
+// replyLines sends a multi-line reply, lines are prefixed by a space
+func (c *session) replyLines(code int, first string, lines []string, last string) {
+	b := strings.Builder{}
+	b.WriteString(strconv.Itoa(code) + "-" + first + "\r\n")
+	for _, line := range lines {
+		b.WriteString(" " + line + "\r\n")
+	}
+	b.WriteString(strconv.Itoa(code) + " " + last + "\r\n")
+	_ = c.conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	_, _ = io.WriteString(c.conn, b.String())
+}
+
+func (c *session) replyError(e error) {
+	var permissionDenied err.PermissionDeniedError
+	switch {
+	case err.IsNotFoundError(e):
+		c.reply(550, "No such file or directory")
+	case err.IsNotAllowedError(e) || errors.As(e, &permissionDenied):
+		c.reply(550, "Permission denied")
+	case err.IsUnsupportedError(e):
+		c.reply(550, "Operation not supported")
+	case errors.Is(e, errIsDir):
+		c.reply(550, "Is a directory")
+	case errors.Is(e, errNotDir):
+		c.reply(550, "Not a directory")
+	default:
+		c.reply(451, "Action aborted: "+strings.Join(strings.Fields(e.Error()), " "))
+	}
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+func (c *session) close() {
+	c.closeData()
+	_ = c.conn.Close()
+}
+
+func (c *session) drive() (types.IDrive, error) {
+	return c.s.drives.GetDrive(*c.principal)
+}
+
+// resolve returns the drive path of the FTP path argument
+func (c *session) resolve(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = c.cwd + "/" + p
+	}
+	return utils.CleanPath(p)
+}
+
+func quotePath(p string) string {
+	return "\"" + strings.ReplaceAll("/"+p, "\"", "\"\"") + "\""
+}
+
+// get returns the drive and the entry at the FTP path
+func (c *session) get(p string) (types.IDrive, types.IEntry, error) {
+	d, e := c.drive()
+	if e != nil {
+		return nil, nil, e
+	}
+	entry, e := d.Get(c.ctx, c.resolve(p))
+	return d, entry, e
+}
+
+func (c *session) cmdUser(arg string) {
+	if c.s.tlsRequired && !c.secure {
+		c.reply(530, "TLS is required, use AUTH TLS first")
+		return
+	}
+	c.username = arg
+	c.principal = nil
+	c.reply(331, "Password required for "+utils.LogSanitize(arg))
+}
+
+func (c *session) cmdPass(arg string) {
+	if c.username == "" || c.principal != nil {
+		c.reply(503, "Login with USER first")
+		return
+	}
+	user, e := c.s.authenticate(remoteIP(c.raw.RemoteAddr()), c.username, arg)
+	if e != nil {
+		if !errors.Is(e, errTooManyFailures) && !err.IsNotAllowedError(e) {
+			log.Printf("[ftp] failed to authenticate '%s': %v", utils.LogSanitize(c.username), e)
+		}
+		c.username = ""
+		c.reply(530, "Login incorrect")
+		return
+	}
+	c.principal = &types.Principal{User: user, AuthType: types.AuthTypeFTP}
+	c.cwd = ""
+	c.reply(230, "Login successful")
+}
+
+func (c *session) cmdAuth(arg string) {
+	mechanism := strings.ToUpper(arg)
+	if mechanism != "TLS" && mechanism != "TLS-C" && mechanism != "SSL" {
+		c.reply(504, "Unsupported security mechanism")
+		return
+	}
+	if c.s.tlsConfig == nil {
+		c.reply(431, "TLS is not configured")
+		return
+	}
+	if c.secure {
+		c.reply(503, "Already using TLS")
+		return
+	}
+	c.reply(234, "AUTH TLS successful")
+
+	conn := tls.Server(c.raw, c.s.tlsConfig)
+	_ = conn.SetDeadline(time.Now().Add(dataConnectTimeout))
+	if e := conn.Handshake(); e != nil {
+		c.quit = true
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	c.conn = conn
+	c.reader = bufio.NewReaderSize(conn, maxCommandLength)
+	c.secure = true
+	// the login is reset by AUTH, see RFC 4217
+	c.username = ""
+	c.principal = nil
+}
+
+func (c *session) cmdPbsz(string) {
+	if !c.secure {
+		c.reply(503, "PBSZ requires AUTH TLS")
+		return
+	}
+	c.reply(200, "PBSZ=0")
+}
+
+func (c *session) cmdProt(arg string) {
+	if !c.secure {
+		c.reply(503, "PROT requires AUTH TLS")
+		return
+	}
+	switch strings.ToUpper(arg) {
+	case "P":
+		c.protected = true
+		c.reply(200, "Protection level set to Private")
+	case "C":
+		if c.s.tlsRequired {
+			c.reply(534, "Data connections must be protected")
+			return
+		}
+		c.protected = false
+		c.reply(200, "Protection level set to Clear")
+	default:
+		c.reply(504, "Unsupported protection level")
+	}
+}
+
+func (c *session) cmdFeat(string) {
+	features := []string{"UTF8", "SIZE", "MDTM", "REST STREAM", "PASV", "EPSV", "EPRT",
+		"MLST type*;size*;modify*;perm*;"}
+	if c.s.tlsConfig != nil {
+		features = append(features, "AUTH TLS", "PBSZ", "PROT")
+	}
+	c.replyLines(211, "Features:", features, "End")
+}
+
+func (c *session) cmdOpts(arg string) {
+	name, _, _ := strings.Cut(strings.ToUpper(arg), " ")
+	switch name {
+	case "UTF8", "UTF-8":
+		c.reply(200, "Always in UTF8 mode")
+	case "MLST":
+		c.reply(200, "MLST OPTS type;size;modify;perm;")
+	default:
+		c.reply(501, "Unsupported option")
+	}
+}
+
+func (c *session) cmdSyst(string) {
+	c.reply(215, "UNIX Type: L8")
+}
+
+func (c *session) cmdNoop(string) {
+	c.reply(200, "OK")
+}
+
+func (c *session) cmdQuit(string) {
+	c.reply(221, "Goodbye")
+	c.quit = true
+}
+
+func (c *session) cmdPwd(string) {
+	c.reply(257, quotePath(c.cwd)+" is the current directory")
+}
+
+func (c *session) cmdCwd(arg string) {
+	_, entry, e := c.get(arg)
+	if e == nil && !entry.Type().IsDir() {
+		e = errNotDir
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.cwd = c.resolve(arg)
+	c.reply(250, "Directory changed to "+quotePath(c.cwd))
+}
+
+func (c *session) cmdCdup(string) {
+	c.cmdCwd("..")
+}
+
+func (c *session) cmdType(arg string) {
+	// all transfers are binary, the ASCII type is accepted for the compatibility of old clients
+	switch strings.ToUpper(strings.Join(strings.Fields(arg), " ")) {
+	case "I", "L 8":
+		c.reply(200, "Type set to I")
+	case "A", "A N":
+		c.reply(200, "Type set to A")
+	default:
+		c.reply(504, "Unsupported type")
+	}
+}
+
+func (c *session) cmdMode(arg string) {
+	if strings.ToUpper(arg) != "S" {
+		c.reply(504, "Only stream mode is supported")
+		return
+	}
+	c.reply(200, "Mode set to S")
+}
+
+func (c *session) cmdStru(arg string) {
+	if strings.ToUpper(arg) != "F" {
+		c.reply(504, "Only file structure is supported")
+		return
+	}
+	c.reply(200, "Structure set to F")
+}
+
+func (c *session) cmdAllo(string) {
+	c.reply(202, "No storage allocation necessary")
+}
+
+func (c *session) cmdAbor(string) {
+	c.closeData()
+	c.reply(226, "No transfer to abort")
+}
+
+func (c *session) cmdSize(arg string) {
+	_, entry, e := c.get(arg)
+	if e == nil && entry.Type().IsDir() {
+		e = errIsDir
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(213, strconv.FormatInt(entry.Size(), 10))
+}
+
+func (c *session) cmdMdtm(arg string) {
+	_, entry, e := c.get(arg)
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(213, formatFactTime(entry.ModTime()))
+}
+
+func (c *session) cmdRest(arg string) {
+	offset, e := strconv.ParseInt(arg, 10, 64)
+	if e != nil || offset < 0 {
+		c.reply(501, "Invalid restart offset")
+		return
+	}
+	c.restOffset = offset
+	c.reply(350, "Restarting at "+arg+", send RETR to resume")
+}
+
+func (c *session) cmdRetr(arg string) {
+	_, entry, e := c.get(arg)
+	if e == nil && entry.Type().IsDir() {
+		e = errIsDir
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	offset := c.restOffset
+	if offset > entry.Size() {
+		c.reply(554, "Restart offset is beyond the end of file")
+		return
+	}
+	reader, e := openContent(c.ctx, entry, offset)
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	defer func() { _ = reader.Close() }()
+	if c.transfer(func(conn net.Conn) error {
+		_, e := io.Copy(conn, reader)
+		return e
+	}) {
+		c.reply(226, "Transfer complete")
+	}
+}
+
+// openContent opens the content of the file from offset.
+// If the drive does not support range reading, the content before offset is skipped.
+func openContent(ctx context.Context, entry types.IEntry, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return driveutil.GetIContentReader(ctx, entry, -1, -1)
+	}
+	reader, e := driveutil.GetIContentReader(ctx, entry, offset, entry.Size()-offset)
+	if e == nil || !err.IsUnsupportedError(e) {
+		return reader, e
+	}
+	reader, e = driveutil.GetIContentReader(ctx, entry, -1, -1)
+	if e != nil {
+		return nil, e
+	}
+	if _, e := io.CopyN(io.Discard, reader, offset); e != nil {
+		_ = reader.Close()
+		return nil, e
+	}
+	return reader, nil
+}
+
+// cmdStor saves the uploaded file. The content is spooled to a temp file before saving,
+// since drives need the size of the content.
+func (c *session) cmdStor(arg string) {
+	if c.restOffset > 0 {
+		c.reply(554, "Restarting uploads is not supported")
+		return
+	}
+	d, entry, e := c.get(arg)
+	if e == nil && entry.Type().IsDir() {
+		e = errIsDir
+	}
+	if e != nil && !err.IsNotFoundError(e) {
+		c.replyError(e)
+		return
+	}
+	path := c.resolve(arg)
+	var file *os.File
+	ok := c.transfer(func(conn net.Conn) error {
+		f, e := driveutil.CopyReaderToTempFile(task.NewContextWrapper(c.ctx), conn, c.s.tempDir)
+		file = f
+		return e
+	})
+	if !ok {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	stat, e := file.Stat()
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	if _, e := d.Save(task.NewContextWrapper(c.ctx), path, stat.Size(), true, file); e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+func (c *session) cmdDele(arg string) {
+	d, entry, e := c.get(arg)
+	if e == nil && entry.Type().IsDir() {
+		e = errIsDir
+	}
+	if e == nil {
+		e = d.Delete(task.NewContextWrapper(c.ctx), entry.Path())
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(250, "File deleted")
+}
+
+func (c *session) cmdMkd(arg string) {
+	d, e := c.drive()
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	path := c.resolve(arg)
+	if _, e := d.MakeDir(c.ctx, path); e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(257, quotePath(path)+" created")
+}
+
+func (c *session) cmdRmd(arg string) {
+	d, entry, e := c.get(arg)
+	if e == nil && !entry.Type().IsDir() {
+		e = errNotDir
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	children, e := d.List(c.ctx, entry.Path())
+	if e == nil && len(children) > 0 {
+		c.reply(550, "Directory not empty")
+		return
+	}
+	if e == nil {
+		e = d.Delete(task.NewContextWrapper(c.ctx), entry.Path())
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(250, "Directory removed")
+}
+
+func (c *session) cmdRnfr(arg string) {
+	_, entry, e := c.get(arg)
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.renameFrom = entry.Path()
+	c.reply(350, "Ready for RNTO")
+}
+
+func (c *session) cmdRnto(arg string) {
+	if c.renameFrom == "" {
+		c.reply(503, "RNFR required first")
+		return
+	}
+	d, entry, e := c.get("/" + c.renameFrom)
+	c.renameFrom = ""
+	if e == nil {
+		// the destination is replaced like rename(2), so that uploads to temporary names can be published
+		_, e = d.Move(task.NewContextWrapper(c.ctx), entry, c.resolve(arg), true)
+	}
+	if e != nil {
+		c.replyError(e)
+		return
+	}
+	c.reply(250, "Rename successful")
+}
@@ -1,6 +1,11 @@
 package job
 
-import "fmt"
+import (
+	"fmt"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/drive"
+)
 
 var registeredActionDefs = make(map[string]*JobActionDef)
 
@@ -27,3 +32,8 @@ func GetActionDefs() []JobActionDef {
 	}
 	return defs
 }
+
+// jobRootDrive returns the root drive for the actions, the events of the actions are marked as raised by jobs
+func jobRootDrive(ch *registry.ComponentsHolder) types.IDrive {
+	return ch.Get(registry.KeyDriveAccess).(*drive.Access).GetSourceRootDrive(types.DriveListenerSourceJob)
+}
@@ -0,0 +1,195 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+func init() {
+	t := i18n.TPrefix("jobs.cleanup.")
+	RegisterActionDef(JobActionDef{
+		Name:        "cleanup",
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "folder", Label: t("folder"), Description: t("folder_desc"), Type: "text", Required: true},
+			{Field: "patterns", Label: t("patterns"), Description: t("patterns_desc"), Type: "textarea"},
+			{Field: "olderThan", Label: t("older_than"), Description: t("older_than_desc"), Type: "text"},
+			{Field: "largerThan", Label: t("larger_than"), Description: t("larger_than_desc"), Type: "text"},
+			{Field: "keepNewest", Label: t("keep_newest"), Description: t("keep_newest_desc"), Type: "text"},
+			{Field: "dryRun", Label: t("dry_run"), Description: t("dry_run_desc"), Type: "checkbox"},
+		},
+		Do: func(ctx context.Context, params types.SM, ch *registry.ComponentsHolder, log func(string)) error {
+			folder := utils.CleanPath(params["folder"])
+			rules, e := parseCleanupRules(params)
+			if e != nil {
+				return e
+			}
+			dryRun := params.GetBool("dryRun")
+
+			drive := jobRootDrive(ch)
+
+			root, e := drive.Get(ctx, folder)
+			if e != nil {
+				return e
+			}
+			if !root.Type().IsDir() {
+				return err.NewBadRequestError("'" + folder + "' is not a folder")
+			}
+			tree, e := driveutil.BuildEntriesTree(task.NewContextWrapper(ctx), root, false)
+			if e != nil {
+				return e
+			}
+			files := make([]cleanupFile, 0)
+			_ = driveutil.VisitEntriesTree(tree, func(entry types.IEntry) error {
+				if !entry.Type().IsFile() {
+					return nil
+				}
+				relPath := strings.TrimPrefix(strings.TrimPrefix(entry.Path(), folder), "/")
+				if rules.match(relPath) {
+					files = append(files, cleanupFile{entry, relPath})
+				}
+				return nil
+			})
+
+			selected := rules.selectFiles(files, time.Now())
+			log(fmt.Sprintf("'%s' has %d matched files, %d to delete", folder, len(files), len(selected)))
+
+			// the deleted paths are the output for the following steps
+			deleted := make([]string, 0, len(selected))
+			defer func() { setStepOutput(ctx, "paths", strings.Join(deleted, "\n")) }()
+
+			for i, item := range selected {
+				if e := ctx.Err(); e != nil {
+					return e
+				}
+				if dryRun {
+					log(fmt.Sprintf("  [%d/%d] would delete '%s' (%s)", i+1, len(selected), item.Path(), item.reason))
+					continue
+				}
+				log(fmt.Sprintf("  [%d/%d] delete '%s' (%s)", i+1, len(selected), item.Path(), item.reason))
+				e := drive.Delete(task.NewContextWrapper(ctx), item.Path())
+				if e != nil && !err.IsNotFoundError(e) {
+					return e
+				}
+				deleted = append(deleted, item.Path())
+			}
+			return nil
+		},
+	})
+}
+
+// cleanupRules selects the files matching the patterns, which meet any of the conditions
+type cleanupRules struct {
+	patterns []string
+	// olderThan is the max age of files, 0 for no limit
+	olderThan time.Duration
+	// largerThan is the max size of files, -1 for no limit
+	largerThan int64
+	// keepNewest is the number of the newest files to keep, -1 for no limit
+	keepNewest int
+}
+
+type cleanupFile struct {
+	types.IEntry
+	// relPath is the path relative to the folder
+	relPath string
+}
+
+type cleanupSelected struct {
+	cleanupFile
+	reason string
+}
+
+func parseCleanupRules(params types.SM) (*cleanupRules, error) {
+	rules := &cleanupRules{largerThan: -1, keepNewest: -1}
+	for _, p := range utils.SplitLines(params["patterns"]) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !doublestar.ValidatePattern(p) {
+			return nil, err.NewBadRequestError("invalid pattern: " + p)
+		}
+		rules.patterns = append(rules.patterns, p)
+	}
+
+	if params["olderThan"] != "" {
+		d, ok := types.ParseDuration(params["olderThan"])
+		if !ok || d <= 0 {
+			return nil, err.NewBadRequestError("invalid olderThan: " + params["olderThan"])
+		}
+		rules.olderThan = d
+	}
+	if params["largerThan"] != "" {
+		rules.largerThan = params.GetDataSize("largerThan", -1)
+		if rules.largerThan < 0 {
+			return nil, err.NewBadRequestError("invalid largerThan: " + params["largerThan"])
+		}
+	}
+	if params["keepNewest"] != "" {
+		n, e := strconv.Atoi(params["keepNewest"])
+		if e != nil || n < 0 {
+			return nil, err.NewBadRequestError("keepNewest must be a non-negative integer")
+		}
+		rules.keepNewest = n
+	}
+	// without conditions, all matched files would be deleted
+	if rules.olderThan == 0 && rules.largerThan < 0 && rules.keepNewest < 0 {
+		return nil, err.NewBadRequestError("at least one of olderThan, largerThan and keepNewest is required")
+	}
+	return rules, nil
+}
+
+// match checks whether the path relative to the folder matches any of the patterns,
+// all files match if there are no patterns
+func (r *cleanupRules) match(relPath string) bool {
+	if len(r.patterns) == 0 {
+		return true
+	}
+	for _, p := range r.patterns {
+		if ok, _ := doublestar.Match(p, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFiles returns the files to delete, from the oldest to the newest
+func (r *cleanupRules) selectFiles(files []cleanupFile, now time.Time) []cleanupSelected {
+	sorted := make([]cleanupFile, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ModTime() > sorted[j].ModTime() })
+
+	selected := make([]cleanupSelected, 0)
+	for i, file := range sorted {
+		reason := ""
+		if r.keepNewest >= 0 && i >= r.keepNewest {
+			reason = "beyond the newest " + strconv.Itoa(r.keepNewest)
+		} else if r.olderThan > 0 && now.Sub(utils.Time(file.ModTime())) > r.olderThan {
+			reason = "older than " + r.olderThan.String()
+		} else if r.largerThan >= 0 && file.Size() > r.largerThan {
+			reason = "larger than " + utils.FormatBytes(uint64(r.largerThan), 2)
+		}
+		if reason != "" {
+			selected = append(selected, cleanupSelected{file, reason})
+		}
+	}
+	for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+		selected[i], selected[j] = selected[j], selected[i]
+	}
+	return selected
+}
@@ -0,0 +1,82 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"go-drive/common/types"
+	"go-drive/common/utils"
+)
+
+type testCleanupEntry struct {
+	types.IEntry
+	path    string
+	size    int64
+	modTime int64
+}
+
+func (e testCleanupEntry) Path() string   { return e.path }
+func (e testCleanupEntry) Size() int64    { return e.size }
+func (e testCleanupEntry) ModTime() int64 { return e.modTime }
+
+func TestCleanupRules(t *testing.T) {
+	now := time.Now()
+	daysAgo := func(days int) int64 { return utils.Millisecond(now.Add(-time.Duration(days) * 24 * time.Hour)) }
+	files := []cleanupFile{
+		{testCleanupEntry{path: "a.jpg", size: 10, modTime: daysAgo(1)}, "a.jpg"},
+		{testCleanupEntry{path: "b.jpg", size: 2048, modTime: daysAgo(2)}, "b.jpg"},
+		{testCleanupEntry{path: "c.jpg", size: 10, modTime: daysAgo(10)}, "c.jpg"},
+		{testCleanupEntry{path: "d.jpg", size: 10, modTime: daysAgo(40)}, "d.jpg"},
+	}
+	selectedPaths := func(params types.SM) []string {
+		t.Helper()
+		rules, e := parseCleanupRules(params)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return utils.ArrayMap(rules.selectFiles(files, now), func(s *cleanupSelected) string { return s.Path() })
+	}
+
+	for _, c := range []struct {
+		params types.SM
+		want   []string
+	}{
+		{types.SM{"olderThan": "30d"}, []string{"d.jpg"}},
+		{types.SM{"largerThan": "1k"}, []string{"b.jpg"}},
+		{types.SM{"keepNewest": "2"}, []string{"d.jpg", "c.jpg"}},
+		{types.SM{"keepNewest": "3", "largerThan": "1k"}, []string{"d.jpg", "b.jpg"}},
+		{types.SM{"olderThan": "5d", "keepNewest": "0"}, []string{"d.jpg", "c.jpg", "b.jpg", "a.jpg"}},
+	} {
+		got := selectedPaths(c.params)
+		if len(got) != len(c.want) {
+			t.Errorf("%v: got %v, want %v", c.params, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%v: got %v, want %v", c.params, got, c.want)
+				break
+			}
+		}
+	}
+
+	for _, params := range []types.SM{
+		{},
+		{"patterns": "*.jpg"},
+		{"olderThan": "abc"},
+		{"largerThan": "1x"},
+		{"keepNewest": "-1"},
+		{"olderThan": "1d", "patterns": "[a"},
+	} {
+		if _, e := parseCleanupRules(params); e == nil {
+			t.Errorf("expected error of params %v", params)
+		}
+	}
+
+	rules, _ := parseCleanupRules(types.SM{"olderThan": "1d", "patterns": "**/*.log\n*.tmp"})
+	for path, want := range map[string]bool{"a.tmp": true, "x/y/a.log": true, "a.log": true, "x/a.tmp": false} {
+		if rules.match(path) != want {
+			t.Errorf("match %q = %v, want %v", path, !want, want)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package job
 
 import (
+	"archive/zip"
 	"context"
 	"fmt"
+	"go-drive/common"
 	"go-drive/common/driveutil"
 	err "go-drive/common/errors"
 	"go-drive/common/i18n"
@@ -10,7 +12,8 @@ import (
 	"go-drive/common/task"
 	"go-drive/common/types"
 	"go-drive/common/utils"
-	"go-drive/drive"
+	"io"
+	"os"
 	"path"
 	"strings"
 )
@@ -33,7 +36,11 @@ func init() {
 			move := params.GetBool("move")
 			override := params.GetBool("override")
 
-			drive := ch.Get(registry.KeyDriveAccess).(*drive.Access).GetRootDrive(nil)
+			drive := jobRootDrive(ch)
+
+			// the copied paths are the output for the following steps
+			copied := make([]string, 0)
+			defer func() { setStepOutput(ctx, "paths", strings.Join(copied, "\n")) }()
 
 			for _, from := range src {
 				if from == "" {
@@ -46,30 +53,64 @@ func init() {
 				log(fmt.Sprintf("'%s' matched %d entries", from, len(fromEntries)))
 
 				for _, fromEntry := range fromEntries {
+					to := utils.CleanPath(path.Join(dest, fromEntry.Name()))
 					if move {
 						log(fmt.Sprintf("  move '%s'", fromEntry.Path()))
-						_, e = drive.Move(
-							task.NewContextWrapper(ctx),
-							fromEntry,
-							utils.CleanPath(path.Join(dest, fromEntry.Name())),
-							override)
+						_, e = drive.Move(task.NewContextWrapper(ctx), fromEntry, to, override)
 					} else {
 						log(fmt.Sprintf("  copy '%s'", fromEntry.Path()))
-						_, e = drive.Copy(
-							task.NewContextWrapper(ctx),
-							fromEntry,
-							utils.CleanPath(path.Join(dest, fromEntry.Name())),
-							override)
+						_, e = drive.Copy(task.NewContextWrapper(ctx), fromEntry, to, override)
 					}
 					if e != nil {
 						return e
 					}
+					copied = append(copied, to)
 				}
 			}
 			return nil
 		},
 	})
 
+	t = i18n.TPrefix("jobs.move.")
+	RegisterActionDef(JobActionDef{
+		Name:        "move",
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "src", Label: t("src"), Description: t("src_desc"), Type: "textarea", Required: true},
+			{Field: "dest", Label: t("dest"), Description: t("dest_desc"), Type: "text", Required: true},
+			{Field: "conflict", Label: t("conflict"), Description: t("conflict_desc"), Type: "select",
+				DefaultValue: moveConflictRename,
+				Options: &[]types.FormItemOption{
+					{Name: t("conflict_rename"), Value: moveConflictRename},
+					{Name: t("conflict_override"), Value: moveConflictOverride},
+					{Name: t("conflict_skip"), Value: moveConflictSkip},
+				}},
+		},
+		Do: func(ctx context.Context, params types.SM, ch *registry.ComponentsHolder, log func(string)) error {
+			drive := jobRootDrive(ch)
+			return moveEntries(ctx, drive, strings.Split(params["src"], "\n"), params["dest"], params["conflict"], log)
+		},
+	})
+
+	t = i18n.TPrefix("jobs.archive.")
+	RegisterActionDef(JobActionDef{
+		Name:        "archive",
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "src", Label: t("src"), Description: t("src_desc"), Type: "textarea", Required: true},
+			{Field: "dest", Label: t("dest"), Description: t("dest_desc"), Type: "text", Required: true},
+			{Field: "override", Label: t("override"), Description: t("override_desc"), Type: "checkbox"},
+		},
+		Do: func(ctx context.Context, params types.SM, ch *registry.ComponentsHolder, log func(string)) error {
+			tempDir := ch.Get(registry.KeyConfig).(common.Config).TempDir
+			drive := jobRootDrive(ch)
+			return archiveEntries(ctx, drive, strings.Split(params["src"], "\n"), params["dest"],
+				params.GetBool("override"), tempDir, log)
+		},
+	})
+
 	t = i18n.TPrefix("jobs.delete.")
 	RegisterActionDef(JobActionDef{
 		Name:        "delete",
@@ -81,7 +122,12 @@ func init() {
 		Do: func(ctx context.Context, params types.SM, ch *registry.ComponentsHolder, log func(string)) error {
 			paths := strings.Split(params["paths"], "\n")
 
-			drive := ch.Get(registry.KeyDriveAccess).(*drive.Access).GetRootDrive(nil)
+			drive := jobRootDrive(ch)
+
+			// the deleted paths are the output for the following steps
+			deleted := make([]string, 0)
+			defer func() { setStepOutput(ctx, "paths", strings.Join(deleted, "\n")) }()
+
 			for _, p := range paths {
 				if p == "" {
 					continue
@@ -97,6 +143,7 @@ func init() {
 					if e != nil && !err.IsNotFoundError(e) {
 						return e
 					}
+					deleted = append(deleted, entries[i].Path())
 				}
 			}
 			return nil
@@ -104,3 +151,178 @@ func init() {
 	})
 
 }
+
+const (
+	moveConflictRename   = "rename"
+	moveConflictOverride = "override"
+	moveConflictSkip     = "skip"
+)
+
+// moveEntries moves the entries matched by the src patterns into dest,
+// a name that exists in dest is renamed, overridden or skipped by conflict
+func moveEntries(ctx context.Context, drive types.IDrive, src []string, dest, conflict string, log func(string)) error {
+	switch conflict {
+	case "":
+		conflict = moveConflictRename
+	case moveConflictRename, moveConflictOverride, moveConflictSkip:
+	default:
+		return err.NewBadRequestError("invalid conflict option: " + conflict)
+	}
+
+	// the moved paths are the output for the following steps
+	moved := make([]string, 0)
+	defer func() { setStepOutput(ctx, "paths", strings.Join(moved, "\n")) }()
+
+	for _, from := range src {
+		if from == "" {
+			continue
+		}
+		fromEntries, e := driveutil.FindEntries(task.NewContextWrapper(ctx), drive, from, false)
+		if e != nil {
+			return e
+		}
+		log(fmt.Sprintf("'%s' matched %d entries", from, len(fromEntries)))
+
+		for i, fromEntry := range fromEntries {
+			to := utils.CleanPath(path.Join(dest, fromEntry.Name()))
+			switch conflict {
+			case moveConflictSkip:
+				_, e := drive.Get(ctx, to)
+				if e == nil {
+					log(fmt.Sprintf("  [%d/%d] skip '%s', '%s' exists", i+1, len(fromEntries), fromEntry.Path(), to))
+					continue
+				}
+				if !err.IsNotFoundError(e) {
+					return e
+				}
+			case moveConflictRename:
+				to, e = driveutil.FindNonExistsEntryName(ctx, drive, to)
+				if e != nil {
+					return e
+				}
+			}
+			log(fmt.Sprintf("  [%d/%d] move '%s'", i+1, len(fromEntries), fromEntry.Path()))
+			movedEntry, e := drive.Move(task.NewContextWrapper(ctx), fromEntry, to, conflict == moveConflictOverride)
+			if e != nil {
+				return e
+			}
+			moved = append(moved, movedEntry.Path())
+		}
+	}
+	return nil
+}
+
+// archiveEntries zips the entries matched by the src patterns and saves the zip file to dest
+func archiveEntries(ctx context.Context, drive types.IDrive, src []string, dest string, override bool,
+	tempDir string, log func(string)) error {
+	dest = utils.CleanPath(dest)
+	if dest == "" {
+		return err.NewBadRequestError("dest is required")
+	}
+
+	trees := make([]driveutil.EntryTreeNode, 0)
+	for _, from := range src {
+		if from == "" {
+			continue
+		}
+		fromEntries, e := driveutil.FindEntries(task.NewContextWrapper(ctx), drive, from, false)
+		if e != nil {
+			return e
+		}
+		log(fmt.Sprintf("'%s' matched %d entries", from, len(fromEntries)))
+		for _, fromEntry := range fromEntries {
+			tree, e := driveutil.BuildEntriesTree(task.NewContextWrapper(ctx), fromEntry, false)
+			if e != nil {
+				return e
+			}
+			trees = append(trees, tree)
+		}
+	}
+
+	file, e := os.CreateTemp(tempDir, "job-archive")
+	if e != nil {
+		return e
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	if e := writeArchive(ctx, file, trees, log); e != nil {
+		return e
+	}
+	size, e := file.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return e
+	}
+	if _, e := file.Seek(0, io.SeekStart); e != nil {
+		return e
+	}
+
+	log(fmt.Sprintf("save '%s' (%s)", dest, utils.FormatBytes(uint64(size), 2)))
+	saved, e := drive.Save(task.NewContextWrapper(ctx), dest, size, override, file)
+	if e != nil {
+		return e
+	}
+	// the archive path is the output for the following steps
+	setStepOutput(ctx, "path", saved.Path())
+	return nil
+}
+
+// writeArchive writes the entries trees to w as a zip file,
+// the entries are named relative to the parent of each tree root,
+// and the tree roots with the same name are renamed with a numeric suffix
+func writeArchive(ctx context.Context, w io.Writer, trees []driveutil.EntryTreeNode, log func(string)) error {
+	total := 0
+	for _, tree := range trees {
+		_ = driveutil.VisitEntriesTree(tree, func(types.IEntry) error {
+			total++
+			return nil
+		})
+	}
+
+	zipFile := zip.NewWriter(w)
+	i := 0
+	rootNames := make(map[string]bool, len(trees))
+	for _, tree := range trees {
+		prefix := tree.Entry.Path()
+		rootName := uniqueArchiveName(utils.PathBase(prefix), rootNames)
+		e := driveutil.VisitEntriesTree(tree, func(entry types.IEntry) error {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+			i++
+			name := path.Join(rootName, strings.TrimPrefix(strings.TrimPrefix(entry.Path(), prefix), "/"))
+			if entry.Type().IsDir() {
+				name += "/"
+			}
+			log(fmt.Sprintf("  [%d/%d] add '%s'", i, total, entry.Path()))
+			file, e := zipFile.CreateHeader(&zip.FileHeader{
+				Name:     name,
+				Method:   zip.Deflate,
+				Modified: utils.Time(entry.ModTime()),
+			})
+			if e != nil {
+				return e
+			}
+			if entry.Type().IsFile() {
+				return driveutil.CopyIContent(task.NewContextWrapper(ctx), entry, file)
+			}
+			return nil
+		})
+		if e != nil {
+			return e
+		}
+	}
+	return zipFile.Close()
+}
+
+// uniqueArchiveName returns name, or name with a numeric suffix inserted before the extension if it's used,
+// the same way as driveutil.FindNonExistsEntryName
+func uniqueArchiveName(name string, used map[string]bool) string {
+	unique := name
+	for seq := 1; used[unique]; seq++ {
+		unique = fmt.Sprintf("%s_%d%s", utils.PathName(name), seq, path.Ext(name))
+	}
+	used[unique] = true
+	return unique
+}
@@ -0,0 +1,137 @@
+package job
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/drive/fs"
+)
+
+func newActionsTestDrive(t *testing.T, files map[string]string) (types.IDrive, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if e := os.MkdirAll(filepath.Dir(p), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e := os.WriteFile(p, []byte(content), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	d, e := fs.NewDrive(context.Background(), types.SM{"path": root},
+		driveutil.DriveUtils{Config: common.Config{FreeFs: true}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	return d, root
+}
+
+func readTestFile(t *testing.T, root, name string) string {
+	t.Helper()
+	b, e := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	return string(b)
+}
+
+func isBadRequest(e error) bool {
+	_, ok := e.(err.BadRequestError)
+	return ok
+}
+
+func TestMoveEntries(t *testing.T) {
+	files := map[string]string{"src/a.txt": "new a", "src/b.txt": "new b", "dest/a.txt": "old a"}
+	noLog := func(string) {}
+
+	for _, c := range []struct {
+		conflict string
+		want     map[string]string
+	}{
+		{"", map[string]string{"dest/a.txt": "old a", "dest/a_1.txt": "new a", "dest/b.txt": "new b"}},
+		{moveConflictOverride, map[string]string{"dest/a.txt": "new a", "dest/b.txt": "new b"}},
+		{moveConflictSkip, map[string]string{"dest/a.txt": "old a", "dest/b.txt": "new b", "src/a.txt": "new a"}},
+	} {
+		d, root := newActionsTestDrive(t, files)
+		if e := moveEntries(context.Background(), d, []string{"src/*.txt"}, "dest", c.conflict, noLog); e != nil {
+			t.Fatalf("conflict %q: %v", c.conflict, e)
+		}
+		for name, content := range c.want {
+			if got := readTestFile(t, root, name); got != content {
+				t.Errorf("conflict %q: %s = %q, want %q", c.conflict, name, got, content)
+			}
+		}
+		if _, e := os.Stat(filepath.Join(root, "src", "b.txt")); !os.IsNotExist(e) {
+			t.Errorf("conflict %q: src/b.txt is not moved", c.conflict)
+		}
+	}
+
+	d, _ := newActionsTestDrive(t, files)
+	if e := moveEntries(context.Background(), d, []string{"src/*.txt"}, "dest", "foo", noLog); !isBadRequest(e) {
+		t.Errorf("invalid conflict option: %v", e)
+	}
+	if e := moveEntries(context.Background(), d, []string{"missing/*.txt"}, "dest", "", noLog); e != nil {
+		t.Errorf("moving a pattern matching nothing: %v", e)
+	}
+	if e := moveEntries(context.Background(), d, []string{"src/a.txt"}, "missing", "", noLog); e == nil {
+		t.Error("expected error of the missing destination folder")
+	}
+}
+
+func TestArchiveEntries(t *testing.T) {
+	d, root := newActionsTestDrive(t, map[string]string{"docs/a.txt": "a", "docs/sub/b.txt": "b", "more/docs/c.txt": "c"})
+	noLog := func(string) {}
+	tempDir := t.TempDir()
+	archiveNames := func(name string) []string {
+		t.Helper()
+		r, e := zip.OpenReader(filepath.Join(root, name))
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer func() { _ = r.Close() }()
+		names := make([]string, 0)
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	if e := archiveEntries(context.Background(), d, []string{"docs"}, "docs.zip", false, tempDir, noLog); e != nil {
+		t.Fatal(e)
+	}
+	want := []string{"docs/", "docs/a.txt", "docs/sub/", "docs/sub/b.txt"}
+	if names := archiveNames("docs.zip"); !slices.Equal(names, want) {
+		t.Errorf("archive entries = %v, want %v", names, want)
+	}
+
+	if e := archiveEntries(context.Background(), d, []string{"docs/a.txt", "docs", "more/docs"}, "all.zip", false, tempDir, noLog); e != nil {
+		t.Fatal(e)
+	}
+	want = []string{"a.txt", "docs/", "docs/a.txt", "docs/sub/", "docs/sub/b.txt", "docs_1/", "docs_1/c.txt"}
+	if names := archiveNames("all.zip"); !slices.Equal(names, want) {
+		t.Errorf("archive entries of the same names = %v, want %v", names, want)
+	}
+
+	if e := archiveEntries(context.Background(), d, []string{"docs"}, "docs.zip", false, tempDir, noLog); e == nil {
+		t.Error("expected error of the existing archive")
+	}
+	if e := archiveEntries(context.Background(), d, []string{"docs"}, "docs.zip", true, tempDir, noLog); e != nil {
+		t.Errorf("overriding the archive: %v", e)
+	}
+	if e := archiveEntries(context.Background(), d, []string{"docs"}, "", false, tempDir, noLog); !isBadRequest(e) {
+		t.Errorf("empty dest: %v", e)
+	}
+	if e := archiveEntries(context.Background(), d, []string{"docs"}, "missing/docs.zip", false, tempDir, noLog); e == nil {
+		t.Error("expected error of the missing destination folder")
+	}
+}
@@ -0,0 +1,176 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	t := i18n.TPrefix("jobs.rename.")
+	RegisterActionDef(JobActionDef{
+		Name:        "rename",
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "folder", Label: t("folder"), Description: t("folder_desc"), Type: "text", Required: true},
+			{Field: "pattern", Label: t("pattern"), Description: t("pattern_desc"), Type: "text"},
+			{Field: "template", Label: t("template"), Description: t("template_desc"), Type: "text", Required: true},
+		},
+		Do: func(ctx context.Context, params types.SM, ch *registry.ComponentsHolder, log func(string)) error {
+			folder := utils.CleanPath(params["folder"])
+			tpl, e := parseRenameTemplate(params["template"])
+			if e != nil {
+				return e
+			}
+			var pattern *regexp.Regexp
+			if params["pattern"] != "" {
+				pattern, e = regexp.Compile(params["pattern"])
+				if e != nil {
+					return err.NewBadRequestError("invalid pattern: " + e.Error())
+				}
+			}
+
+			drive := jobRootDrive(ch)
+
+			entries, e := drive.List(ctx, folder)
+			if e != nil {
+				return e
+			}
+			// counters follow the name order
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+			type renameItem struct {
+				entry  types.IEntry
+				groups []string
+			}
+			items := make([]renameItem, 0, len(entries))
+			for _, entry := range entries {
+				if !entry.Type().IsFile() {
+					continue
+				}
+				var groups []string
+				if pattern != nil {
+					groups = pattern.FindStringSubmatch(entry.Name())
+					if groups == nil {
+						continue
+					}
+				}
+				items = append(items, renameItem{entry, groups})
+			}
+			log(fmt.Sprintf("'%s' has %d files to rename", folder, len(items)))
+
+			// the renamed paths are the output for the following steps
+			renamed := make([]string, 0, len(items))
+			defer func() { setStepOutput(ctx, "paths", strings.Join(renamed, "\n")) }()
+
+			for i, item := range items {
+				if e := ctx.Err(); e != nil {
+					return e
+				}
+				name, e := tpl.render(item.entry.Name(), item.entry.ModTime(), i+1, item.groups)
+				if e != nil {
+					return e
+				}
+				if name == item.entry.Name() {
+					continue
+				}
+				to := utils.CleanPath(path.Join(folder, name))
+				_, e = drive.Get(ctx, to)
+				if e == nil {
+					log(fmt.Sprintf("  [%d/%d] skip '%s', '%s' exists", i+1, len(items), item.entry.Name(), name))
+					continue
+				}
+				if !err.IsNotFoundError(e) {
+					return e
+				}
+				log(fmt.Sprintf("  [%d/%d] rename '%s' to '%s'", i+1, len(items), item.entry.Name(), name))
+				movedEntry, e := drive.Move(task.NewContextWrapper(ctx), item.entry, to, false)
+				if e != nil {
+					return e
+				}
+				renamed = append(renamed, movedEntry.Path())
+			}
+			return nil
+		},
+	})
+}
+
+var renameTemplatePlaceholder = regexp.MustCompile(`\{(\w+)(?::([^{}]*))?}`)
+
+// renameTemplate is the new name of files, the placeholders are:
+//
+//	{name} the name without extension, {ext} the extension with the leading dot,
+//	{date} or {date:<Go time layout>} the modification time, '2006-01-02' by default,
+//	{n} or {n:<width>} the counter starting from 1, zero-padded to the width,
+//	{0}, {1}... the whole match and the capture groups of the pattern
+type renameTemplate struct {
+	template string
+}
+
+func parseRenameTemplate(template string) (*renameTemplate, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, err.NewBadRequestError("template is required")
+	}
+	for _, m := range renameTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch m[1] {
+		case "name", "ext", "date":
+		case "n":
+			if m[2] != "" {
+				if width, e := strconv.Atoi(m[2]); e != nil || width < 1 || width > 20 {
+					return nil, err.NewBadRequestError("invalid counter width: " + m[2])
+				}
+			}
+		default:
+			if _, e := strconv.Atoi(m[1]); e != nil {
+				return nil, err.NewBadRequestError("unknown placeholder: " + m[0])
+			}
+		}
+	}
+	return &renameTemplate{template}, nil
+}
+
+// render returns the new name of the file named oldName
+func (rt *renameTemplate) render(oldName string, modTime int64, counter int, groups []string) (string, error) {
+	var renderErr error
+	name := renameTemplatePlaceholder.ReplaceAllStringFunc(rt.template, func(s string) string {
+		m := renameTemplatePlaceholder.FindStringSubmatch(s)
+		switch m[1] {
+		case "name":
+			return strings.TrimSuffix(oldName, path.Ext(oldName))
+		case "ext":
+			return path.Ext(oldName)
+		case "date":
+			layout := m[2]
+			if layout == "" {
+				layout = "2006-01-02"
+			}
+			return utils.Time(modTime).Format(layout)
+		case "n":
+			return fmt.Sprintf("%0*d", utils.ToInt(m[2], 1), counter)
+		}
+		i, _ := strconv.Atoi(m[1])
+		if i >= len(groups) {
+			renderErr = err.NewBadRequestError("no capture group for " + s)
+			return s
+		}
+		return groups[i]
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return "", err.NewBadRequestError("invalid new name of '" + oldName + "': '" + name + "'")
+	}
+	return name, nil
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"go-drive/common/utils"
+)
+
+func TestRenameTemplate(t *testing.T) {
+	modTime := utils.Millisecond(time.Date(2024, 3, 5, 10, 20, 30, 0, time.Local))
+	pattern := regexp.MustCompile(`^IMG_(\d+)`)
+	groups := pattern.FindStringSubmatch("IMG_0042.JPG")
+
+	for _, c := range []struct {
+		template string
+		want     string
+	}{
+		{"{name}{ext}", "IMG_0042.JPG"},
+		{"{date}_{n}{ext}", "2024-03-05_7.JPG"},
+		{"{date:20060102-150405}_{n:3}{ext}", "20240305-102030_007.JPG"},
+		{"photo-{1}{ext}", "photo-0042.JPG"},
+		{"{0}.jpg", "IMG_0042.jpg"},
+	} {
+		tpl, e := parseRenameTemplate(c.template)
+		if e != nil {
+			t.Fatal(e)
+		}
+		got, e := tpl.render("IMG_0042.JPG", modTime, 7, groups)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got != c.want {
+			t.Errorf("render %q = %q, want %q", c.template, got, c.want)
+		}
+	}
+
+	for _, template := range []string{"", "{foo}", "{n:x}"} {
+		if _, e := parseRenameTemplate(template); e == nil {
+			t.Errorf("expected error of template %q", template)
+		}
+	}
+
+	tpl, _ := parseRenameTemplate("{2}{ext}")
+	if _, e := tpl.render("IMG_0042.JPG", modTime, 1, groups); e == nil {
+		t.Error("expected error of the missing capture group")
+	}
+	tpl, _ = parseRenameTemplate("{date:2006/01}{ext}")
+	if _, e := tpl.render("IMG_0042.JPG", modTime, 1, groups); e == nil {
+		t.Error("expected error of the name with path separator")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"go-drive/common/i18n"
 	"go-drive/common/registry"
 	"go-drive/common/types"
-	"go-drive/drive"
 	s "go-drive/script"
 	"strings"
 )
@@ -55,7 +54,15 @@ func init() {
 			if e != nil {
 				return fmt.Errorf("failed to parse event: %s", e.Error())
 			}
-			return ExecuteJobCode(ctx, code, types.M{jobEventName: event}, ch, onLog)
+			globals := types.M{jobEventName: event}
+			if stepsJson, ok := params[jobStepsName]; ok {
+				steps := make([]types.M, 0)
+				if e := json.Unmarshal([]byte(stepsJson), &steps); e != nil {
+					return fmt.Errorf("failed to parse steps: %s", e.Error())
+				}
+				globals[jobStepsName] = steps
+			}
+			return ExecuteJobCode(ctx, code, globals, ch, onLog)
 		},
 	})
 }
@@ -65,8 +72,9 @@ func ExecuteJobCode(ctx context.Context, code any, globals types.M, ch *registry
 	vm := baseVM.Fork()
 	defer func() { _ = vm.Dispose() }()
 
-	vm.Set("drive", s.NewDrive(ch.Get(registry.KeyDriveAccess).(*drive.Access).GetRootDrive(nil)))
+	vm.Set("drive", s.NewDrive(jobRootDrive(ch)))
 	bindJobLog(vm, onLog)
+	bindJobOutput(ctx, vm)
 	setJobGlobals(vm, globals)
 
 	_, e := vm.RunNamed(ctx, "job.js", code)
@@ -82,16 +90,22 @@ func bindJobLog(vm *s.VM, onLog func(string)) {
 	}))
 }
 
+// bindJobOutput binds 'output(key, value)', which sets the output of the step when the script runs in a flow
+func bindJobOutput(ctx context.Context, vm *s.VM) {
+	vm.Set("output", s.WrapVmCall(vm, func(_ *s.VM, args s.Values) any {
+		setStepOutput(ctx, args.Get(0).String(), args.Get(1).String())
+		return nil
+	}))
+}
+
 func setJobGlobals(vm *s.VM, globals types.M) {
-	hasEvent := false
 	for k, v := range globals {
 		vm.Set(k, v)
-		if k == jobEventName {
-			hasEvent = true
-		}
 	}
-	if !hasEvent {
-		vm.SetUndefined(jobEventName)
+	for _, k := range []string{jobEventName, jobStepsName} {
+		if _, ok := globals[k]; !ok {
+			vm.SetUndefined(k)
+		}
 	}
 }
 
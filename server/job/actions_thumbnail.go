@@ -0,0 +1,39 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/server/thumbnail"
+)
+
+func init() {
+	t := i18n.TPrefix("jobs.thumbnails.")
+	RegisterActionDef(JobActionDef{
+		Name:        "thumbnails",
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "paths", Label: t("paths"), Description: t("paths_desc"), Type: "textarea", Required: true},
+		},
+		Do: func(ctx context.Context, params types.SM, ch *registry.ComponentsHolder, log func(string)) error {
+			generator := ch.Get(registry.KeyThumbnailGenerator).(*thumbnail.Generator)
+			for _, p := range utils.SplitLines(params["paths"]) {
+				if p == "" {
+					continue
+				}
+				p = utils.CleanPath(p)
+				r, e := generator.Generate(task.NewContextWrapper(ctx), p, nil)
+				if e != nil {
+					return e
+				}
+				log(fmt.Sprintf("'%s': %s", p, r))
+			}
+			return nil
+		},
+	})
+}
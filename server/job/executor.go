@@ -9,13 +9,24 @@ import (
 	"go-drive/common/registry"
 	"go-drive/common/task"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	"go-drive/storage"
 	"log"
-	"strings"
+	"strconv"
 	"sync"
 	"time"
 )
 
+const (
+	defaultRetryDelay = 10 * time.Second
+	maxRetryDelay     = time.Hour
+	maxRetries        = 100
+	// maxChainDepth limits the number of chained executions, so that a cycle of jobs won't run forever
+	maxChainDepth = 10
+)
+
+var errExecutionSkipped = errors.New("skipped since the job is running")
+
 type JobExecutor struct {
 	ch     *registry.ComponentsHolder
 	runner task.Runner
@@ -23,6 +34,8 @@ type JobExecutor struct {
 
 	triggers   map[JobTriggerType]IJobTriggerInstance
 	executions map[uint]*jobExecutionItem
+	// locks holds the running execution of the jobs with the skip or queue concurrency policy
+	locks map[uint]*jobConcurrencyLock
 
 	mu sync.Mutex
 }
@@ -35,6 +48,7 @@ func NewJobExecutor(jobDAO *storage.JobDAO, ch *registry.ComponentsHolder) (*Job
 		runner:     runner,
 		jobDAO:     jobDAO,
 		executions: make(map[uint]*jobExecutionItem),
+		locks:      make(map[uint]*jobConcurrencyLock),
 		triggers:   make(map[JobTriggerType]IJobTriggerInstance),
 	}
 
@@ -53,6 +67,15 @@ func NewJobExecutor(jobDAO *storage.JobDAO, ch *registry.ComponentsHolder) (*Job
 	return executor, nil
 }
 
+// Start fires the startup triggers, it should be called once the server is initialized
+func (je *JobExecutor) Start() {
+	for _, trigger := range je.triggers {
+		if starter, ok := trigger.(IJobTriggerStarter); ok {
+			starter.Start()
+		}
+	}
+}
+
 func (je *JobExecutor) ReloadJobs() error {
 	je.mu.Lock()
 	defer je.mu.Unlock()
@@ -112,12 +135,22 @@ func (je *JobExecutor) TriggerExecution(jobID uint, event TriggerEvent) (task.Ta
 	}, task.WithNameGroup(job.Description, "job/execution"))
 }
 
+// TriggerWebhook triggers the job if the secret matches one of its webhook triggers.
+// The data becomes the TriggerEvent.Data of the execution.
+func (je *JobExecutor) TriggerWebhook(jobID uint, secret string, data types.SM) (task.Task, error) {
+	webhook, _ := je.triggers[JobTriggerTypeWebhook].(*webhookTrigger)
+	if webhook == nil || !webhook.match(jobID, secret) {
+		return task.Task{}, err.NewNotFoundError()
+	}
+	return je.TriggerExecution(jobID, TriggerEvent{Type: JobTriggerTypeWebhook, Data: data})
+}
+
 func (je *JobExecutor) ExecuteJobSync(ctx context.Context, job types.Job, event TriggerEvent, onLog func(string)) error {
-	jobExecution, e := je.newJobExecution(job)
+	jobExecution, e := je.newJobExecution(job, event)
 	if e != nil {
 		return e
 	}
-	logger := newJobExecutionLogger(jobExecution.ID, onLog)
+	logger := newJobExecutionLogger(jobExecution.ID, job.MaxLogLines, onLog)
 	return je.executeJob(ctx, job, jobExecution, logger, &event)
 }
 
@@ -128,9 +161,27 @@ func (je *JobExecutor) executeJob(ctx context.Context, job types.Job,
 	je.addJobExecution(item)
 
 	defer func() {
+		aborted := errors.Is(executionCtx.Err(), context.Canceled)
 		je.updateJobExecutionResult(item, e)
+		je.pruneJobExecutions(job)
+		// aborted and skipped executions don't trigger the chained jobs
+		if !aborted && !errors.Is(e, errExecutionSkipped) {
+			je.chainExecution(job, item.JobExecution, event)
+		}
 	}()
 
+	release, e := je.acquire(executionCtx, job, logger)
+	if e != nil {
+		return
+	}
+	defer release()
+
+	item.Status = types.JobExecutionRunning
+	item.StartedAt = uint64(time.Now().UnixMilli())
+	if e := je.jobDAO.UpdateJobExecution(item.JobExecution); e != nil {
+		log.Printf("failed to update job execution: %v", e)
+	}
+
 	actionDef := GetActionDef(job.Action)
 	if actionDef == nil {
 		e = errors.New("job not found")
@@ -152,15 +203,157 @@ func (je *JobExecutor) executeJob(ctx context.Context, job types.Job,
 		}
 	}
 
-	e = actionDef.Do(executionCtx, params, je.ch, item.logger.Log)
-	return
+	for attempt := 0; ; attempt++ {
+		item.Attempts = attempt + 1
+		e = je.runAttempt(executionCtx, job, actionDef, params, item)
+		if e == nil || attempt >= job.MaxRetries || executionCtx.Err() != nil {
+			return
+		}
+		delay := retryDelay(job, attempt)
+		item.logger.Warn(fmt.Sprintf("attempt %d failed: %s, retrying in %s", attempt+1, e.Error(), delay))
+		select {
+		case <-time.After(delay):
+		case <-executionCtx.Done():
+			return
+		}
+	}
+}
+
+// runAttempt runs the action once, the context is canceled after the timeout of the job.
+// Actions are expected to return when the context is done.
+func (je *JobExecutor) runAttempt(ctx context.Context, job types.Job, actionDef *JobActionDef,
+	params types.SM, item *jobExecutionItem) error {
+	// steps of the last attempt are kept
+	ctx = withStepRecorder(ctx, &stepRecorder{item: item, save: je.jobDAO.UpdateJobExecutionSteps})
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(job.Timeout)*time.Second)
+		defer cancel()
+	}
+	attemptParams := make(types.SM, len(params))
+	for k, v := range params {
+		attemptParams[k] = v
+	}
+	e := actionDef.Do(ctx, attemptParams, je.ch, item.logger.Log)
+	if e != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %ds: %w", job.Timeout, e)
+	}
+	return e
+}
+
+// retryDelay returns the delay before the retry after the attempt, it's doubled for every retry
+func retryDelay(job types.Job, attempt int) time.Duration {
+	delay := defaultRetryDelay
+	if job.RetryDelay > 0 {
+		delay = time.Duration(job.RetryDelay) * time.Second
+	}
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// acquire applies the concurrency policy of the job, the returned function must be called after the execution
+func (je *JobExecutor) acquire(ctx context.Context, job types.Job, logger *jobExecutionLogger) (func(), error) {
+	if job.Concurrency != types.JobConcurrencySkip && job.Concurrency != types.JobConcurrencyQueue {
+		return func() {}, nil
+	}
+	lock, unref := je.jobLock(job.ID)
+	release := func() {
+		<-lock
+		unref()
+	}
+	select {
+	case lock <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if job.Concurrency == types.JobConcurrencySkip {
+		unref()
+		return nil, errExecutionSkipped
+	}
+	logger.Log("waiting for the running execution to complete")
+	select {
+	case lock <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		unref()
+		return nil, ctx.Err()
+	}
+}
+
+type jobConcurrencyLock struct {
+	ch chan struct{}
+	// refs is the count of the executions holding or waiting for the lock
+	refs int
+}
+
+// jobLock returns the lock of the job, unref must be called once the lock is not used.
+// The lock is removed when no execution uses it, so deleted jobs leave nothing behind.
+func (je *JobExecutor) jobLock(jobID uint) (chan struct{}, func()) {
+	je.mu.Lock()
+	defer je.mu.Unlock()
+	lock, ok := je.locks[jobID]
+	if !ok {
+		lock = &jobConcurrencyLock{ch: make(chan struct{}, 1)}
+		je.locks[jobID] = lock
+	}
+	lock.refs++
+	return lock.ch, func() {
+		je.mu.Lock()
+		defer je.mu.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(je.locks, jobID)
+		}
+	}
+}
+
+// chainExecution triggers the OnSuccess or OnFailure job of the completed execution
+func (je *JobExecutor) chainExecution(job types.Job, execution *types.JobExecution, event *TriggerEvent) {
+	next := job.OnSuccess
+	if execution.Status == types.JobExecutionFailed {
+		next = job.OnFailure
+	}
+	if next == 0 {
+		return
+	}
+	depth := 0
+	if event != nil && event.Type == JobTriggerTypeChain {
+		depth = utils.ToInt(event.Data["depth"], 0)
+	}
+	if depth >= maxChainDepth {
+		log.Printf("[JobExecutor] chain of job %d is too deep, job %d is not triggered", job.ID, next)
+		return
+	}
+	nextJob, e := je.jobDAO.GetJob(next)
+	if e != nil {
+		log.Printf("[JobExecutor] failed to get chained job %d of job %d: %v", next, job.ID, e)
+		return
+	}
+	if !nextJob.Enabled {
+		return
+	}
+	_, e = je.TriggerExecution(next, TriggerEvent{Type: JobTriggerTypeChain, Data: types.SM{
+		"jobId":       strconv.FormatUint(uint64(job.ID), 10),
+		"executionId": strconv.FormatUint(uint64(execution.ID), 10),
+		"status":      execution.Status,
+		"depth":       strconv.Itoa(depth + 1),
+	}})
+	if e != nil {
+		log.Printf("[JobExecutor] failed to trigger chained job %d of job %d: %v", next, job.ID, e)
+	}
 }
 
-func (je *JobExecutor) newJobExecution(job types.Job) (*types.JobExecution, error) {
+func (je *JobExecutor) newJobExecution(job types.Job, event TriggerEvent) (*types.JobExecution, error) {
 	jobExecution := &types.JobExecution{
-		JobId:     job.ID,
-		StartedAt: uint64(time.Now().UnixMilli()),
-		Status:    types.JobExecutionRunning,
+		JobId:       job.ID,
+		StartedAt:   uint64(time.Now().UnixMilli()),
+		Status:      types.JobExecutionQueued,
+		TriggerType: string(event.Type),
+	}
+	if event.Type == JobTriggerTypeChain {
+		jobExecution.ParentID = utils.ToUInt(event.Data["executionId"], 0)
 	}
 	e := je.jobDAO.AddJobExecution(jobExecution)
 	return jobExecution, e
@@ -168,9 +361,14 @@ func (je *JobExecutor) newJobExecution(job types.Job) (*types.JobExecution, erro
 
 func (je *JobExecutor) updateJobExecutionResult(item *jobExecutionItem, e error) {
 	item.CompletedAt = uint64(time.Now().UnixMilli())
-	if e != nil {
+	if errors.Is(e, errExecutionSkipped) {
+		item.Status = types.JobExecutionSkipped
+		item.ErrorMsg = e.Error()
+		item.logger.Warn(e.Error())
+	} else if e != nil {
 		item.Status = types.JobExecutionFailed
 		item.ErrorMsg = e.Error()
+		item.logger.Error(e.Error())
 	} else {
 		item.Status = types.JobExecutionSuccess
 	}
@@ -178,12 +376,99 @@ func (je *JobExecutor) updateJobExecutionResult(item *jobExecutionItem, e error)
 	if e := je.jobDAO.UpdateJobExecution(item.JobExecution); e != nil {
 		log.Printf("failed to update job execution: %v", e)
 	}
+	// the subscribers read the result after the logs are closed
+	item.logger.Close()
 	item.cancel()
 	je.removeJobExecution(item.ID)
 }
 
+// pruneJobExecutions deletes the completed executions of the job beyond the newest KeepExecutions
+func (je *JobExecutor) pruneJobExecutions(job types.Job) {
+	if job.KeepExecutions <= 0 {
+		return
+	}
+	if e := je.jobDAO.PruneJobExecutions(job.ID, job.KeepExecutions); e != nil {
+		log.Printf("[JobExecutor] failed to prune executions of job %d: %v", job.ID, e)
+	}
+}
+
+// SubscribeExecutionLogs returns the current logs and the channel of the following logs of the running execution.
+// The channel is closed when the execution completes. ok is false if the execution is not running.
+func (je *JobExecutor) SubscribeExecutionLogs(id uint) (entries []JobLogEntry, ch <-chan JobLogEntry, unsubscribe func(), ok bool) {
+	je.mu.Lock()
+	item := je.executions[id]
+	je.mu.Unlock()
+	if item == nil {
+		return nil, nil, nil, false
+	}
+	entries, ch, unsubscribe = item.logger.Subscribe()
+	return entries, ch, unsubscribe, true
+}
+
+// GetRunningExecutionLogs returns the current logs of the running execution, ok is false if it's not running
+func (je *JobExecutor) GetRunningExecutionLogs(id uint) ([]JobLogEntry, bool) {
+	je.mu.Lock()
+	item := je.executions[id]
+	je.mu.Unlock()
+	if item == nil {
+		return nil, false
+	}
+	return item.logger.Entries(), true
+}
+
+// ValidateJob validates the triggers, retry, timeout, concurrency, chaining and logs options of the job
+func (je *JobExecutor) ValidateJob(job types.Job) error {
+	if e := ValidateJobConfig(job); e != nil {
+		return e
+	}
+	for _, id := range []uint{job.OnSuccess, job.OnFailure} {
+		if id == 0 {
+			continue
+		}
+		if _, e := je.jobDAO.GetJob(id); e != nil {
+			if err.IsNotFoundError(e) {
+				return err.NewBadRequestError(fmt.Sprintf("chained job %d not found", id))
+			}
+			return e
+		}
+	}
+	return nil
+}
+
+// ValidateJobConfig validates the job without checking whether the chained jobs exist
+func ValidateJobConfig(job types.Job) error {
+	if e := validateTriggers(job.Triggers); e != nil {
+		return e
+	}
+	if job.MaxRetries < 0 || job.MaxRetries > maxRetries {
+		return err.NewBadRequestError(fmt.Sprintf("maxRetries must be between 0 and %d", maxRetries))
+	}
+	if job.RetryDelay < 0 {
+		return err.NewBadRequestError("retryDelay must not be negative")
+	}
+	if job.Timeout < 0 {
+		return err.NewBadRequestError("timeout must not be negative")
+	}
+	if job.MaxLogLines < 0 {
+		return err.NewBadRequestError("maxLogLines must not be negative")
+	}
+	if job.KeepExecutions < 0 {
+		return err.NewBadRequestError("keepExecutions must not be negative")
+	}
+	switch job.Concurrency {
+	case "", types.JobConcurrencyAllow, types.JobConcurrencySkip, types.JobConcurrencyQueue:
+	default:
+		return err.NewBadRequestError("unknown concurrency policy: " + job.Concurrency)
+	}
+	return nil
+}
+
 // ValidateTriggers validates all triggers in a job
 func (je *JobExecutor) ValidateTriggers(triggersJSON string) error {
+	return validateTriggers(triggersJSON)
+}
+
+func validateTriggers(triggersJSON string) error {
 	if triggersJSON == "" {
 		return err.NewBadRequestError("triggers are required")
 	}
@@ -238,7 +523,7 @@ func (je *JobExecutor) IsJobExecutionRunning(id uint) bool {
 	if item == nil {
 		return false
 	}
-	return item.Status == types.JobExecutionRunning
+	return item.Status == types.JobExecutionRunning || item.Status == types.JobExecutionQueued
 }
 
 func (je *JobExecutor) addJobExecution(exec *jobExecutionItem) {
@@ -273,31 +558,3 @@ type jobExecutionItem struct {
 	cancel func()
 	logger *jobExecutionLogger
 }
-
-func newJobExecutionLogger(jid uint, onLog func(string)) *jobExecutionLogger {
-	return &jobExecutionLogger{jid: jid, onLog: onLog}
-}
-
-type jobExecutionLogger struct {
-	jid   uint
-	onLog func(string)
-	logs  strings.Builder
-	mu    sync.RWMutex
-}
-
-func (jel *jobExecutionLogger) Log(s string) {
-	log.Printf("[JobExecutor] [%d] %s\n", jel.jid, s)
-	if jel.onLog != nil {
-		jel.onLog(s)
-	}
-	jel.mu.Lock()
-	defer jel.mu.Unlock()
-	jel.logs.WriteString(s)
-	jel.logs.WriteRune('\n')
-}
-
-func (jel *jobExecutionLogger) String() string {
-	jel.mu.RLock()
-	defer jel.mu.RUnlock()
-	return jel.logs.String()
-}
@@ -0,0 +1,280 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	registerTestActionOnce sync.Once
+	testActions            sync.Map
+)
+
+// registerTestAction registers the 'test' action, which runs the function stored for its 'id' param
+func registerTestAction() {
+	registerTestActionOnce.Do(func() {
+		RegisterActionDef(JobActionDef{
+			Name: "test",
+			Do: func(ctx context.Context, params types.SM, _ *registry.ComponentsHolder, logFn func(string)) error {
+				fn, _ := testActions.Load(params["id"])
+				if fn, ok := fn.(func(context.Context, types.SM, func(string)) error); ok {
+					return fn(ctx, params, logFn)
+				}
+				return fn.(func(context.Context) error)(ctx)
+			},
+		})
+	})
+}
+
+func newTestExecutor(t *testing.T) *JobExecutor {
+	t.Helper()
+	registerTestAction()
+	config := testutil.DefaultTestConfig()
+	config.DataDir = t.TempDir()
+	ch := registry.NewComponentHolder()
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	runner := task.NewPondRunner(config, ch)
+	t.Cleanup(func() {
+		_ = runner.Dispose()
+		_ = db.Dispose()
+	})
+	return &JobExecutor{
+		ch:         ch,
+		runner:     runner,
+		jobDAO:     storage.NewJobDAO(db, ch),
+		triggers:   make(map[JobTriggerType]IJobTriggerInstance),
+		executions: make(map[uint]*jobExecutionItem),
+		locks:      make(map[uint]*jobConcurrencyLock),
+	}
+}
+
+// addTestJob adds a job running fn, which is func(context.Context) error or
+// func(context.Context, types.SM, func(string)) error
+func addTestJob(t *testing.T, je *JobExecutor, job types.Job, fn any) types.Job {
+	t.Helper()
+	id := t.Name() + "/" + job.Description
+	testActions.Store(id, fn)
+	job.Action = "test"
+	job.ActionParams = `{"id":"` + id + `"}`
+	job.Triggers = `[{"type":"cron","config":{"schedule":"0 0 1 1 *"}}]`
+	job.Enabled = true
+	job, e := je.jobDAO.AddJob(job)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return job
+}
+
+func getExecutions(t *testing.T, je *JobExecutor, jobID uint) []types.JobExecution {
+	t.Helper()
+	executions, e := je.jobDAO.GetJobExecutions(jobID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return executions
+}
+
+func TestJobExecutor_Retry(t *testing.T) {
+	je := newTestExecutor(t)
+	calls := 0
+	job := addTestJob(t, je, types.Job{Description: "a", MaxRetries: 2, RetryDelay: 1}, func(context.Context) error {
+		calls++
+		if calls < 2 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if e := je.ExecuteJobSync(context.Background(), job, TriggerEvent{}, nil); e != nil {
+		t.Fatal(e)
+	}
+	executions := getExecutions(t, je, job.ID)
+	if len(executions) != 1 || executions[0].Status != types.JobExecutionSuccess || executions[0].Attempts != 2 {
+		t.Errorf("unexpected executions: %+v", executions)
+	}
+	if !strings.Contains(executions[0].Logs, "attempt 1 failed") {
+		t.Errorf("unexpected logs: %s", executions[0].Logs)
+	}
+}
+
+func TestJobExecutor_Timeout(t *testing.T) {
+	je := newTestExecutor(t)
+	job := addTestJob(t, je, types.Job{Description: "a", Timeout: 1}, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	e := je.ExecuteJobSync(context.Background(), job, TriggerEvent{}, nil)
+	if e == nil || !strings.Contains(e.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", e)
+	}
+	if executions := getExecutions(t, je, job.ID); executions[0].Status != types.JobExecutionFailed {
+		t.Errorf("unexpected executions: %+v", executions)
+	}
+}
+
+func TestJobExecutor_Concurrency(t *testing.T) {
+	for _, policy := range []string{types.JobConcurrencySkip, types.JobConcurrencyQueue} {
+		t.Run(policy, func(t *testing.T) {
+			je := newTestExecutor(t)
+			started := make(chan struct{}, 2)
+			release := make(chan struct{})
+			var running, maxRunning int32
+			job := addTestJob(t, je, types.Job{Description: "a", Concurrency: policy}, func(context.Context) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				if n > atomic.LoadInt32(&maxRunning) {
+					atomic.StoreInt32(&maxRunning, n)
+				}
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = je.ExecuteJobSync(context.Background(), job, TriggerEvent{}, nil)
+			}()
+			<-started
+
+			var second error
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				second = je.ExecuteJobSync(context.Background(), job, TriggerEvent{}, nil)
+			}()
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if maxRunning != 1 {
+				t.Errorf("expected executions not to overlap, got %d", maxRunning)
+			}
+			statuses := make([]string, 0, 2)
+			for _, execution := range getExecutions(t, je, job.ID) {
+				statuses = append(statuses, execution.Status)
+			}
+			if policy == types.JobConcurrencySkip {
+				if !errors.Is(second, errExecutionSkipped) || !strings.Contains(strings.Join(statuses, ","), types.JobExecutionSkipped) {
+					t.Errorf("expected the second execution to be skipped: %v, %v", second, statuses)
+				}
+			} else if second != nil || strings.Join(statuses, ",") != "success,success" {
+				t.Errorf("expected the second execution to be queued: %v, %v", second, statuses)
+			}
+			if len(je.locks) != 0 {
+				t.Errorf("expected the lock to be removed after the executions, got %d", len(je.locks))
+			}
+		})
+	}
+}
+
+func TestJobExecutor_Chain(t *testing.T) {
+	je := newTestExecutor(t)
+	done := make(chan struct{})
+	next := addTestJob(t, je, types.Job{Description: "next"}, func(context.Context) error {
+		close(done)
+		return nil
+	})
+	job := addTestJob(t, je, types.Job{Description: "a", OnFailure: next.ID}, func(context.Context) error {
+		return errors.New("failed")
+	})
+	if e := je.ValidateJob(job); e != nil {
+		t.Fatal(e)
+	}
+	_ = je.ExecuteJobSync(context.Background(), job, TriggerEvent{}, nil)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("chained job is not executed")
+	}
+	parent := getExecutions(t, je, job.ID)[0]
+	var chained types.JobExecution
+	for i := 0; i < 50; i++ {
+		executions := getExecutions(t, je, next.ID)
+		if len(executions) == 1 && executions[0].Status == types.JobExecutionSuccess {
+			chained = executions[0]
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if chained.ParentID != parent.ID || chained.TriggerType != string(JobTriggerTypeChain) {
+		t.Errorf("unexpected chained execution: %+v", chained)
+	}
+
+	job.OnSuccess = 99999
+	if e := je.ValidateJob(job); e == nil {
+		t.Error("expected error of missing chained job")
+	}
+}
+
+func TestJobExecutor_FlowSteps(t *testing.T) {
+	je := newTestExecutor(t)
+	var received string
+	steps := []func(context.Context, types.SM, func(string)) error{
+		func(ctx context.Context, _ types.SM, logFn func(string)) error {
+			logFn("copied")
+			setStepOutput(ctx, "paths", "a/1.jpg")
+			return nil
+		},
+		func(_ context.Context, params types.SM, _ func(string)) error {
+			received = params["src"]
+			return errors.New("ignored")
+		},
+		func(context.Context, types.SM, func(string)) error {
+			return errors.New("failed")
+		},
+	}
+	ops := make([]types.SM, 0, len(steps))
+	for i, fn := range steps {
+		id := t.Name() + "/" + strconv.Itoa(i)
+		testActions.Store(id, fn)
+		ops = append(ops, types.SM{"$key": "test", "id": id, "src": "{{prev.paths}},{{steps.1.paths}},{{steps.5.paths}}"})
+	}
+	ops[1]["_ignoreErr"] = "1"
+	opsJson, _ := json.Marshal(ops)
+	actionParams, _ := json.Marshal(types.SM{"ops": string(opsJson)})
+	job, e := je.jobDAO.AddJob(types.Job{Description: "flow", Action: "flow", ActionParams: string(actionParams), Enabled: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if e := je.ExecuteJobSync(context.Background(), job, TriggerEvent{}, nil); e == nil || !strings.Contains(e.Error(), "step 3") {
+		t.Fatalf("expected error at step 3, got %v", e)
+	}
+	if received != "a/1.jpg,a/1.jpg," {
+		t.Errorf("unexpected expanded params: %q", received)
+	}
+	execution := getExecutions(t, je, job.ID)[0]
+	results, e := ParseJobSteps(execution.Steps)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(results) != 3 {
+		t.Fatalf("unexpected steps: %+v", results)
+	}
+	if results[0].Status != types.JobExecutionSuccess || results[0].Output["paths"] != "a/1.jpg" || results[0].Logs != "copied\n" {
+		t.Errorf("unexpected step 1: %+v", results[0])
+	}
+	if results[1].Status != types.JobExecutionFailed || results[2].ErrorMsg != "failed" {
+		t.Errorf("unexpected steps: %+v", results)
+	}
+	if !strings.Contains(execution.Logs, "[1] copied") {
+		t.Errorf("unexpected logs: %s", execution.Logs)
+	}
+}
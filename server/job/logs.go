@@ -0,0 +1,200 @@
+package job
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JobLogInfo  = "info"
+	JobLogWarn  = "warn"
+	JobLogError = "error"
+
+	// defaultMaxLogLines is the number of log lines kept for an execution if the job doesn't specify it
+	defaultMaxLogLines = 5000
+	// logSubscriberBuffer is the number of log lines buffered for a subscriber,
+	// slow subscribers are dropped when the buffer is full
+	logSubscriberBuffer = 256
+)
+
+var jobLogLevels = map[string]int{JobLogInfo: 0, JobLogWarn: 1, JobLogError: 2}
+
+// JobLogEntry is a line of the execution logs, the logs are stored as JSON lines
+type JobLogEntry struct {
+	// Time is the unix timestamp in milliseconds, 0 for the logs stored before the logs were structured
+	Time    int64  `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// ParseJobLogs parses the stored logs, plain text lines are parsed as info logs
+func ParseJobLogs(s string) []JobLogEntry {
+	entries := make([]JobLogEntry, 0)
+	for _, line := range strings.Split(s, "\n") {
+		if line == "" {
+			continue
+		}
+		entry := JobLogEntry{}
+		if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &entry) == nil && entry.Level != "" {
+			entries = append(entries, entry)
+			continue
+		}
+		entries = append(entries, JobLogEntry{Level: JobLogInfo, Message: line})
+	}
+	return entries
+}
+
+// FilterJobLogs returns the logs at or above the level, all logs are returned if the level is empty
+func FilterJobLogs(entries []JobLogEntry, level string) []JobLogEntry {
+	minLevel, ok := jobLogLevels[level]
+	if !ok || minLevel == 0 {
+		return entries
+	}
+	result := make([]JobLogEntry, 0)
+	for _, entry := range entries {
+		if jobLogLevels[entry.Level] >= minLevel {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// IsValidJobLogLevel checks whether the level is a valid log level
+func IsValidJobLogLevel(level string) bool {
+	_, ok := jobLogLevels[level]
+	return ok
+}
+
+func newJobExecutionLogger(jid uint, maxLines int, onLog func(string)) *jobExecutionLogger {
+	if maxLines <= 0 {
+		maxLines = defaultMaxLogLines
+	}
+	return &jobExecutionLogger{
+		jid:         jid,
+		maxLines:    maxLines,
+		onLog:       onLog,
+		subscribers: make(map[int]chan JobLogEntry),
+	}
+}
+
+// jobExecutionLogger keeps the latest maxLines lines of the execution logs,
+// and sends the new lines to the subscribers until it's closed
+type jobExecutionLogger struct {
+	jid      uint
+	maxLines int
+	onLog    func(string)
+
+	entries []JobLogEntry
+	// truncated is the number of the dropped lines
+	truncated int
+
+	subscribers      map[int]chan JobLogEntry
+	nextSubscriberID int
+	closed           bool
+
+	mu sync.RWMutex
+}
+
+func (jel *jobExecutionLogger) Log(s string) {
+	jel.log(JobLogInfo, s)
+}
+
+func (jel *jobExecutionLogger) Warn(s string) {
+	jel.log(JobLogWarn, s)
+}
+
+func (jel *jobExecutionLogger) Error(s string) {
+	jel.log(JobLogError, s)
+}
+
+func (jel *jobExecutionLogger) log(level, s string) {
+	log.Printf("[JobExecutor] [%d] %s\n", jel.jid, s)
+	if jel.onLog != nil {
+		jel.onLog(s)
+	}
+	entry := JobLogEntry{Time: time.Now().UnixMilli(), Level: level, Message: s}
+
+	jel.mu.Lock()
+	defer jel.mu.Unlock()
+	jel.entries = append(jel.entries, entry)
+	if len(jel.entries) > jel.maxLines {
+		jel.entries = jel.entries[len(jel.entries)-jel.maxLines:]
+		jel.truncated++
+	}
+	for id, ch := range jel.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			delete(jel.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// Entries returns the kept lines, with a line of the truncated count at the beginning if there are dropped lines
+func (jel *jobExecutionLogger) Entries() []JobLogEntry {
+	jel.mu.RLock()
+	defer jel.mu.RUnlock()
+	return jel.entriesLocked()
+}
+
+func (jel *jobExecutionLogger) entriesLocked() []JobLogEntry {
+	entries := make([]JobLogEntry, 0, len(jel.entries)+1)
+	if jel.truncated > 0 {
+		entries = append(entries, JobLogEntry{
+			Time:    jel.entries[0].Time,
+			Level:   JobLogWarn,
+			Message: strconv.Itoa(jel.truncated) + " earlier lines are truncated",
+		})
+	}
+	return append(entries, jel.entries...)
+}
+
+// String returns the logs as JSON lines
+func (jel *jobExecutionLogger) String() string {
+	sb := strings.Builder{}
+	for _, entry := range jel.Entries() {
+		line, _ := json.Marshal(entry)
+		sb.Write(line)
+		sb.WriteRune('\n')
+	}
+	return sb.String()
+}
+
+// Subscribe returns the current lines and the channel of the following lines.
+// The channel is closed when the logger is closed, or the subscriber can't keep up.
+func (jel *jobExecutionLogger) Subscribe() ([]JobLogEntry, <-chan JobLogEntry, func()) {
+	jel.mu.Lock()
+	defer jel.mu.Unlock()
+	ch := make(chan JobLogEntry, logSubscriberBuffer)
+	if jel.closed {
+		close(ch)
+		return jel.entriesLocked(), ch, func() {}
+	}
+	id := jel.nextSubscriberID
+	jel.nextSubscriberID++
+	jel.subscribers[id] = ch
+	return jel.entriesLocked(), ch, func() {
+		jel.mu.Lock()
+		defer jel.mu.Unlock()
+		if ch, ok := jel.subscribers[id]; ok {
+			delete(jel.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// Close closes the channels of the subscribers
+func (jel *jobExecutionLogger) Close() {
+	jel.mu.Lock()
+	defer jel.mu.Unlock()
+	jel.closed = true
+	for id, ch := range jel.subscribers {
+		delete(jel.subscribers, id)
+		close(ch)
+	}
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestJobExecutionLogger(t *testing.T) {
+	logger := newJobExecutionLogger(1, 3, nil)
+	logger.Log("a")
+	entries, ch, unsubscribe := logger.Subscribe()
+	defer unsubscribe()
+	if len(entries) != 1 || entries[0].Message != "a" || entries[0].Level != JobLogInfo || entries[0].Time == 0 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	logger.Warn("b")
+	logger.Log("c")
+	logger.Error("d")
+	for _, want := range []string{"b", "c", "d"} {
+		if entry := <-ch; entry.Message != want {
+			t.Errorf("received %q, want %q", entry.Message, want)
+		}
+	}
+	logger.Close()
+	if _, ok := <-ch; ok {
+		t.Error("expected the channel to be closed")
+	}
+
+	// the earliest line is truncated
+	entries = ParseJobLogs(logger.String())
+	if len(entries) != 4 || entries[0].Level != JobLogWarn || entries[1].Message != "b" || entries[3].Level != JobLogError {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if warns := FilterJobLogs(entries[1:], JobLogWarn); len(warns) != 2 {
+		t.Errorf("unexpected warn entries: %+v", warns)
+	}
+
+	// the channel of subscribing after closed is closed
+	_, ch, _ = logger.Subscribe()
+	if _, ok := <-ch; ok {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestParseJobLogs_plainText(t *testing.T) {
+	entries := ParseJobLogs("line 1\n{not json}\n\n")
+	if len(entries) != 2 || entries[0].Message != "line 1" || entries[1].Message != "{not json}" ||
+		entries[1].Level != JobLogInfo || entries[1].Time != 0 {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
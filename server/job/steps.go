@@ -0,0 +1,171 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"log"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobStepsName is the param passed to every step of a flow, it's the JSON encoded outputs of the previous steps
+const jobStepsName = "$steps"
+
+// JobStepResult is the result of a step of the flow action, saved in JobExecution.Steps
+type JobStepResult struct {
+	Action      string   `json:"action"`
+	Status      string   `json:"status"`
+	StartedAt   uint64   `json:"startedAt"`
+	CompletedAt uint64   `json:"completedAt"`
+	Logs        string   `json:"logs"`
+	ErrorMsg    string   `json:"errorMsg"`
+	Output      types.SM `json:"output"`
+}
+
+// ParseJobSteps parses the step results saved in JobExecution.Steps
+func ParseJobSteps(steps string) ([]JobStepResult, error) {
+	result := make([]JobStepResult, 0)
+	if steps == "" {
+		return result, nil
+	}
+	return result, json.Unmarshal([]byte(steps), &result)
+}
+
+type stepRecorderKey struct{}
+type stepOutputKey struct{}
+
+// stepRecorder saves the step results of an attempt to the execution as they change
+type stepRecorder struct {
+	item  *jobExecutionItem
+	save  func(id uint, steps string) error
+	steps []*JobStepResult
+	mu    sync.Mutex
+}
+
+func withStepRecorder(ctx context.Context, r *stepRecorder) context.Context {
+	return context.WithValue(ctx, stepRecorderKey{}, r)
+}
+
+func getStepRecorder(ctx context.Context) *stepRecorder {
+	r, _ := ctx.Value(stepRecorderKey{}).(*stepRecorder)
+	return r
+}
+
+// begin adds a running step, the recorder can be nil when the action is not executed by JobExecutor
+func (r *stepRecorder) begin(action string) *JobStepResult {
+	if r == nil {
+		return nil
+	}
+	step := &JobStepResult{
+		Action:    action,
+		Status:    types.JobExecutionRunning,
+		StartedAt: uint64(time.Now().UnixMilli()),
+	}
+	r.mu.Lock()
+	r.steps = append(r.steps, step)
+	r.mu.Unlock()
+	r.flush()
+	return step
+}
+
+func (r *stepRecorder) log(step *JobStepResult, s string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	step.Logs += s + "\n"
+}
+
+func (r *stepRecorder) end(step *JobStepResult, output types.SM, e error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	step.CompletedAt = uint64(time.Now().UnixMilli())
+	step.Output = output
+	if e != nil {
+		step.Status = types.JobExecutionFailed
+		step.ErrorMsg = e.Error()
+	} else {
+		step.Status = types.JobExecutionSuccess
+	}
+	r.mu.Unlock()
+	r.flush()
+}
+
+func (r *stepRecorder) flush() {
+	r.mu.Lock()
+	data, e := json.Marshal(r.steps)
+	if e == nil {
+		r.item.Steps = string(data)
+	}
+	r.mu.Unlock()
+	if e != nil {
+		log.Printf("failed to encode job steps: %v", e)
+		return
+	}
+	if e := r.save(r.item.ID, string(data)); e != nil {
+		log.Printf("failed to update job execution: %v", e)
+	}
+}
+
+// stepOutput collects the output values set by the action of a step
+type stepOutput struct {
+	values types.SM
+	mu     sync.Mutex
+}
+
+func withStepOutput(ctx context.Context) (context.Context, *stepOutput) {
+	o := &stepOutput{values: make(types.SM)}
+	return context.WithValue(ctx, stepOutputKey{}, o), o
+}
+
+// setStepOutput sets an output value of the running step, which can be referenced by the following steps.
+// It does nothing if the action is not running as a step of a flow.
+func setStepOutput(ctx context.Context, key, value string) {
+	o, _ := ctx.Value(stepOutputKey{}).(*stepOutput)
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.values[key] = value
+}
+
+func (o *stepOutput) get() types.SM {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return maps.Clone(o.values)
+}
+
+var stepRefPattern = regexp.MustCompile(`\{\{\s*(prev|steps\.(\d+))\.([\w-]+)\s*}}`)
+
+// expandStepParams replaces '{{prev.key}}' and '{{steps.N.key}}' (N starts from 1) in the params
+// with the outputs of the previous steps. References to missing outputs are replaced with empty strings.
+func expandStepParams(params types.SM, outputs []types.SM) types.SM {
+	result := make(types.SM, len(params))
+	for k, v := range params {
+		if !strings.Contains(v, "{{") {
+			result[k] = v
+			continue
+		}
+		result[k] = stepRefPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			m := stepRefPattern.FindStringSubmatch(ref)
+			i := len(outputs) - 1
+			if m[1] != "prev" {
+				i = utils.ToInt(m[2], 0) - 1
+			}
+			if i < 0 || i >= len(outputs) {
+				return ""
+			}
+			return outputs[i][m[3]]
+		})
+	}
+	return result
+}
@@ -77,38 +77,46 @@ func (ct *cronTrigger) Register(jobID uint, config types.SM) error {
 		return err.NewBadRequestError("cron schedule is required")
 	}
 
-	tag := strconv.FormatUint(uint64(jobID), 10)
-	for _, scheduledJob := range ct.s.Jobs() {
-		for _, jobTag := range scheduledJob.Tags() {
-			if jobTag == tag {
-				return fmt.Errorf("cron job %d is already registered", jobID)
-			}
-		}
+	if len(findScheduledJobs(ct.s, jobID)) > 0 {
+		return fmt.Errorf("cron job %d is already registered", jobID)
 	}
 
 	_, e := ct.s.NewJob(
 		gocron.CronJob(schedule, false),
 		gocron.NewTask(ct.triggerAction, jobID),
-		gocron.WithTags(tag),
+		gocron.WithTags(scheduledJobTag(jobID)),
 		gocron.WithSingletonMode(gocron.LimitModeReschedule),
 	)
 	return e
 }
 
 func (ct *cronTrigger) GetInfo(jobID uint) ([]types.SM, error) {
-	tag := strconv.FormatUint(uint64(jobID), 10)
-	stats := make([]types.SM, 0, 1)
-	for _, scheduledJob := range ct.s.Jobs() {
-		matched := false
+	return getScheduledJobsInfo(ct.s, jobID)
+}
+
+func scheduledJobTag(jobID uint) string {
+	return strconv.FormatUint(uint64(jobID), 10)
+}
+
+// findScheduledJobs returns the jobs of the scheduler tagged with the job ID
+func findScheduledJobs(s gocron.Scheduler, jobID uint) []gocron.Job {
+	tag := scheduledJobTag(jobID)
+	result := make([]gocron.Job, 0, 1)
+	for _, scheduledJob := range s.Jobs() {
 		for _, jobTag := range scheduledJob.Tags() {
 			if jobTag == tag {
-				matched = true
+				result = append(result, scheduledJob)
 				break
 			}
 		}
-		if !matched {
-			continue
-		}
+	}
+	return result
+}
+
+// getScheduledJobsInfo returns the next run time of the jobs of the scheduler tagged with the job ID
+func getScheduledJobsInfo(s gocron.Scheduler, jobID uint) ([]types.SM, error) {
+	stats := make([]types.SM, 0, 1)
+	for _, scheduledJob := range findScheduledJobs(s, jobID) {
 		nextRun, e := scheduledJob.NextRun()
 		if e != nil {
 			return nil, e
@@ -1,15 +1,18 @@
 package job
 
 import (
+	"encoding/json"
 	err "go-drive/common/errors"
 	"go-drive/common/event"
 	"go-drive/common/i18n"
 	"go-drive/common/registry"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	"log"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
@@ -23,11 +26,16 @@ func init() {
 		Description: t("desc"),
 		ParamsForm: []types.FormItem{
 			{Field: "pathPattern", Label: t("path_pattern"), Description: t("path_pattern_desc"), Type: "text", Required: true},
+			{Field: "namePattern", Label: t("name_pattern"), Description: t("name_pattern_desc"), Type: "text"},
 			{Field: "eventTypes", Label: t("event_types"), Type: "checkboxes", Required: true,
 				Options: &[]types.FormItemOption{
 					{Name: t("event_entry_updated"), Value: string(EntryEventTypeUpdated)},
 					{Name: t("event_entry_deleted"), Value: string(EntryEventTypeDeleted)},
+					{Name: t("event_entry_accessed"), Value: string(EntryEventTypeAccessed)},
 				}},
+			{Field: "quietPeriod", Label: t("quiet_period"), Description: t("quiet_period_desc"), Type: "text"},
+			{Field: "maxWait", Label: t("max_wait"), Description: t("max_wait_desc"), Type: "text"},
+			{Field: "maxBatchSize", Label: t("max_batch_size"), Description: t("max_batch_size_desc"), Type: "text"},
 		},
 		Validate: validateEntryTriggerConfig,
 		Factory: func(executor *JobExecutor, ch *registry.ComponentsHolder) IJobTriggerInstance {
@@ -36,7 +44,7 @@ func init() {
 	})
 }
 
-// entryEventTrigger handles entry event-based job triggering (created/updated/deleted)
+// entryEventTrigger handles entry event-based job triggering (created/updated/deleted/accessed)
 type entryEventTrigger struct {
 	executor *JobExecutor
 	triggers []entryEventTriggerConfig
@@ -51,7 +59,35 @@ var _ IJobTriggerInstance = (*entryEventTrigger)(nil)
 type entryEventTriggerConfig struct {
 	jobID       uint
 	pathPattern string
+	namePattern string
 	eventTypes  map[EntryEventType]struct{}
+
+	// batch collects the events when quietPeriod is set, nil for triggering on every event
+	batch *entryEventBatch
+}
+
+// entryEventBatch collects the events until no more events come in the quiet period,
+// or the first collected event has waited for maxWait, or maxSize events are collected.
+type entryEventBatch struct {
+	jobID       uint
+	quietPeriod time.Duration
+	maxWait     time.Duration
+	maxSize     int
+	trigger     func(jobID uint, event TriggerEvent)
+
+	events  []entryEventItem
+	indexes map[string]int
+	firstAt time.Time
+	timer   *time.Timer
+	// timerGen is increased when the timer is replaced or stopped, so a timer firing while it's being stopped does nothing
+	timerGen uint64
+	mu       sync.Mutex
+}
+
+type entryEventItem struct {
+	Path               string         `json:"path"`
+	EventType          EntryEventType `json:"eventType"`
+	IncludeDescendants bool           `json:"includeDescendants"`
 }
 
 func newEntryEventTrigger(executor *JobExecutor, bus event.Bus) *entryEventTrigger {
@@ -65,34 +101,42 @@ func newEntryEventTrigger(executor *JobExecutor, bus event.Bus) *entryEventTrigg
 }
 
 func validateEntryTriggerConfig(config types.SM) error {
-	if config["pathPattern"] == "" {
-		return err.NewBadRequestError("path pattern is required")
-	}
-	_, e := doublestar.Match(config["pathPattern"], "/test")
-	if e != nil {
-		return err.NewBadRequestError("invalid path pattern: " + e.Error())
-	}
-	eventTypes, e := parseEventTypes(config["eventTypes"])
-	if e != nil || len(eventTypes) == 0 {
-		return err.NewBadRequestError("eventTypes must be a non-empty JSON array of \"updated\" and/or \"deleted\"")
-	}
-	return nil
+	_, e := parseConfig(config)
+	return e
 }
 
 func parseEventTypes(s string) (map[EntryEventType]struct{}, error) {
 	if s == "" {
 		return nil, err.NewBadRequestError("eventTypes is required")
 	}
-	result := make(map[EntryEventType]struct{}, 2)
+	result := make(map[EntryEventType]struct{}, 3)
 	for _, v := range strings.Split(s, ",") {
-		result[EntryEventType(strings.TrimSpace(v))] = struct{}{}
-	}
-	if len(result) == 0 {
-		return nil, err.NewBadRequestError("eventTypes cannot be empty")
+		eventType := EntryEventType(strings.TrimSpace(v))
+		switch eventType {
+		case EntryEventTypeUpdated, EntryEventTypeDeleted, EntryEventTypeAccessed:
+		default:
+			return nil, err.NewBadRequestError("eventTypes must be \"updated\", \"deleted\" and/or \"accessed\"")
+		}
+		result[eventType] = struct{}{}
 	}
 	return result, nil
 }
 
+// parseOptionalDuration parses the duration like '10s', it's 0 if empty
+func parseOptionalDuration(config types.SM, key string) (time.Duration, error) {
+	if config[key] == "" {
+		return 0, nil
+	}
+	d, e := time.ParseDuration(config[key])
+	if e != nil {
+		return 0, err.NewBadRequestError("invalid " + key + ": " + e.Error())
+	}
+	if d < 0 {
+		return 0, err.NewBadRequestError(key + " must not be negative")
+	}
+	return d, nil
+}
+
 func parseConfig(config types.SM) (*entryEventTriggerConfig, error) {
 	pathPattern := config["pathPattern"]
 	if pathPattern == "" {
@@ -102,11 +146,46 @@ func parseConfig(config types.SM) (*entryEventTriggerConfig, error) {
 	if e != nil {
 		return nil, err.NewBadRequestError("invalid path pattern: " + e.Error())
 	}
+	namePattern := config["namePattern"]
+	if namePattern != "" {
+		if _, e := doublestar.Match(namePattern, "test"); e != nil {
+			return nil, err.NewBadRequestError("invalid name pattern: " + e.Error())
+		}
+	}
 	eventTypes, e := parseEventTypes(config["eventTypes"])
 	if e != nil {
 		return nil, e
 	}
-	return &entryEventTriggerConfig{pathPattern: pathPattern, eventTypes: eventTypes}, nil
+	result := &entryEventTriggerConfig{pathPattern: pathPattern, namePattern: namePattern, eventTypes: eventTypes}
+
+	quietPeriod, e := parseOptionalDuration(config, "quietPeriod")
+	if e != nil {
+		return nil, e
+	}
+	maxWait, e := parseOptionalDuration(config, "maxWait")
+	if e != nil {
+		return nil, e
+	}
+	maxSize := 0
+	if config["maxBatchSize"] != "" {
+		maxSize, e = strconv.Atoi(config["maxBatchSize"])
+		if e != nil || maxSize < 0 {
+			return nil, err.NewBadRequestError("maxBatchSize must be a non-negative integer")
+		}
+	}
+	if quietPeriod == 0 {
+		if maxWait > 0 || maxSize > 0 {
+			return nil, err.NewBadRequestError("quietPeriod is required when maxWait or maxBatchSize is set")
+		}
+		return result, nil
+	}
+	result.batch = &entryEventBatch{
+		quietPeriod: quietPeriod,
+		maxWait:     maxWait,
+		maxSize:     maxSize,
+		indexes:     make(map[string]int),
+	}
+	return result, nil
 }
 
 func (eet *entryEventTrigger) Register(jobID uint, config types.SM) error {
@@ -118,6 +197,10 @@ func (eet *entryEventTrigger) Register(jobID uint, config types.SM) error {
 		return e
 	}
 	triggerConfig.jobID = jobID
+	if triggerConfig.batch != nil {
+		triggerConfig.batch.jobID = jobID
+		triggerConfig.batch.trigger = eet.trigger
+	}
 	eet.triggers = append(eet.triggers, *triggerConfig)
 	return nil
 }
@@ -126,14 +209,26 @@ func (eet *entryEventTrigger) GetInfo(jobID uint) ([]types.SM, error) {
 	return nil, nil
 }
 
+// Clear removes all triggers, the collected events are flushed so that they are not lost when jobs are reloaded
 func (eet *entryEventTrigger) Clear() {
 	eet.mu.Lock()
-	defer eet.mu.Unlock()
+	triggers := eet.triggers
 	eet.triggers = make([]entryEventTriggerConfig, 0, 2)
+	eet.mu.Unlock()
+
+	for _, config := range triggers {
+		if config.batch != nil {
+			config.batch.flush()
+		}
+	}
 }
 
-// checkAndTrigger checks if the event matches any registered triggers and triggers the job.
-// entryEventType is "updated" or "deleted".
+func (eet *entryEventTrigger) trigger(jobID uint, event TriggerEvent) {
+	eet.executor.TriggerExecution(jobID, event)
+}
+
+// checkAndTrigger checks if the event matches any registered triggers and triggers the job,
+// or adds the event to the batch of the trigger.
 func (eet *entryEventTrigger) checkAndTrigger(path string, entryEventType EntryEventType, includeDescendants bool) {
 	eet.mu.RLock()
 	triggers := make([]entryEventTriggerConfig, len(eet.triggers))
@@ -153,6 +248,15 @@ func (eet *entryEventTrigger) checkAndTrigger(path string, entryEventType EntryE
 		if !pathMatched {
 			continue
 		}
+		if config.namePattern != "" {
+			if nameMatched, _ := doublestar.Match(config.namePattern, utils.PathBase(path)); !nameMatched {
+				continue
+			}
+		}
+		if config.batch != nil {
+			config.batch.add(entryEventItem{Path: path, EventType: entryEventType, IncludeDescendants: includeDescendants})
+			continue
+		}
 		event := TriggerEvent{
 			Type: JobTriggerTypeEntry,
 			Data: types.SM{
@@ -161,22 +265,117 @@ func (eet *entryEventTrigger) checkAndTrigger(path string, entryEventType EntryE
 				"includeDescendants": strconv.FormatBool(includeDescendants),
 			},
 		}
-		eet.executor.TriggerExecution(config.jobID, event)
+		eet.trigger(config.jobID, event)
+	}
+}
+
+// add adds the event to the batch, an event of the same path replaces the previous one
+func (b *entryEventBatch) add(item entryEventItem) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if i, ok := b.indexes[item.Path]; ok {
+		b.events[i] = item
+	} else {
+		b.indexes[item.Path] = len(b.events)
+		b.events = append(b.events, item)
+	}
+	now := time.Now()
+	if len(b.events) == 1 {
+		b.firstAt = now
+	}
+	if b.maxSize > 0 && len(b.events) >= b.maxSize {
+		b.flushLocked()
+		return
+	}
+
+	delay := b.quietPeriod
+	if b.maxWait > 0 {
+		delay = min(delay, b.firstAt.Add(b.maxWait).Sub(now))
 	}
+	b.stopTimerLocked()
+	gen := b.timerGen
+	b.timer = time.AfterFunc(delay, func() { b.flushByTimer(gen) })
+}
+
+func (b *entryEventBatch) stopTimerLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.timerGen++
+}
+
+func (b *entryEventBatch) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+// flushByTimer does nothing if the timer of gen has been replaced or stopped
+func (b *entryEventBatch) flushByTimer(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.timerGen {
+		return
+	}
+	b.flushLocked()
+}
+
+// flushLocked triggers the job with all collected events
+func (b *entryEventBatch) flushLocked() {
+	b.stopTimerLocked()
+	if len(b.events) == 0 {
+		return
+	}
+	events := b.events
+	b.events = nil
+	b.indexes = make(map[string]int)
+
+	paths := make([]string, len(events))
+	for i, item := range events {
+		paths[i] = item.Path
+	}
+	eventsJson, _ := json.Marshal(events)
+	go b.trigger(b.jobID, TriggerEvent{
+		Type: JobTriggerTypeEntry,
+		Data: types.SM{
+			"paths":  strings.Join(paths, "\n"),
+			"events": string(eventsJson),
+			"count":  strconv.Itoa(len(events)),
+		},
+	})
+}
+
+// stop drops the collected events
+func (b *entryEventBatch) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopTimerLocked()
+	b.events = nil
 }
 
 func (eet *entryEventTrigger) onEntryUpdated(dc types.DriveListenerContext, path string, includeDescendants bool) {
-	eet.checkAndTrigger(path, "updated", includeDescendants)
+	eet.checkAndTrigger(path, EntryEventTypeUpdated, includeDescendants)
 }
 
 func (eet *entryEventTrigger) onEntryDeleted(dc types.DriveListenerContext, path string) {
-	eet.checkAndTrigger(path, "deleted", false)
+	eet.checkAndTrigger(path, EntryEventTypeDeleted, false)
+}
+
+func (eet *entryEventTrigger) onEntryAccessed(dc types.DriveListenerContext, path string) {
+	// a job reading the paths it watches would trigger itself again
+	if dc.Source == types.DriveListenerSourceJob {
+		return
+	}
+	eet.checkAndTrigger(path, EntryEventTypeAccessed, false)
 }
 
 func (eet *entryEventTrigger) subscribeBusEvents() {
 	eet.unsubscribe = []event.Unsubscribe{
 		eet.bus.SubscribeEntryUpdated(eet.onEntryUpdated),
 		eet.bus.SubscribeEntryDeleted(eet.onEntryDeleted),
+		eet.bus.SubscribeEntryAccessed(eet.onEntryAccessed),
 	}
 }
 
@@ -184,5 +383,12 @@ func (eet *entryEventTrigger) Dispose() error {
 	for _, unsubscribe := range eet.unsubscribe {
 		unsubscribe()
 	}
+	eet.mu.Lock()
+	defer eet.mu.Unlock()
+	for _, config := range eet.triggers {
+		if config.batch != nil {
+			config.batch.stop()
+		}
+	}
 	return nil
 }
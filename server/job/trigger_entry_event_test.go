@@ -0,0 +1,203 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go-drive/common/types"
+)
+
+func newTestEntryEventTrigger(t *testing.T) (*entryEventTrigger, types.Job, chan TriggerEvent) {
+	t.Helper()
+	je := newTestExecutor(t)
+	trigger := &entryEventTrigger{executor: je}
+	je.triggers[JobTriggerTypeEntry] = trigger
+	t.Cleanup(func() { _ = trigger.Dispose() })
+
+	events := make(chan TriggerEvent, 8)
+	job := addTestJob(t, je, types.Job{Description: "a"}, func(_ context.Context, params types.SM, _ func(string)) error {
+		event := TriggerEvent{}
+		e := json.Unmarshal([]byte(params[jobEventName]), &event)
+		events <- event
+		return e
+	})
+	return trigger, job, events
+}
+
+func receiveTriggerEvent(t *testing.T, events chan TriggerEvent) TriggerEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("job is not triggered")
+	}
+	return TriggerEvent{}
+}
+
+func TestEntryEventTrigger_Filters(t *testing.T) {
+	trigger, job, events := newTestEntryEventTrigger(t)
+	e := trigger.Register(job.ID, types.SM{
+		"pathPattern": "photos/**",
+		"namePattern": "*.{jpg,png}",
+		"eventTypes":  "deleted,accessed",
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	trigger.checkAndTrigger("photos/a.jpg", EntryEventTypeUpdated, false)
+	trigger.checkAndTrigger("photos/a.txt", EntryEventTypeAccessed, false)
+	trigger.checkAndTrigger("docs/a.jpg", EntryEventTypeAccessed, false)
+	trigger.onEntryAccessed(types.DriveListenerContext{Source: types.DriveListenerSourceJob}, "photos/b.jpg")
+	trigger.onEntryAccessed(types.DriveListenerContext{}, "photos/2024/a.png")
+
+	event := receiveTriggerEvent(t, events)
+	if event.Data["path"] != "photos/2024/a.png" || event.Data["eventType"] != string(EntryEventTypeAccessed) {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event: %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEntryEventTrigger_Batch(t *testing.T) {
+	trigger, job, events := newTestEntryEventTrigger(t)
+	e := trigger.Register(job.ID, types.SM{
+		"pathPattern":  "**",
+		"eventTypes":   "updated,deleted",
+		"quietPeriod":  "100ms",
+		"maxBatchSize": "3",
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	trigger.checkAndTrigger("a", EntryEventTypeUpdated, false)
+	trigger.checkAndTrigger("b", EntryEventTypeUpdated, true)
+	trigger.checkAndTrigger("a", EntryEventTypeDeleted, false)
+	event := receiveTriggerEvent(t, events)
+	if event.Data["paths"] != "a\nb" || event.Data["count"] != "2" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	var items []entryEventItem
+	if e := json.Unmarshal([]byte(event.Data["events"]), &items); e != nil {
+		t.Fatal(e)
+	}
+	if len(items) != 2 || items[0].EventType != EntryEventTypeDeleted || !items[1].IncludeDescendants {
+		t.Errorf("unexpected events: %+v", items)
+	}
+
+	// the batch is flushed without waiting for the quiet period when it's full
+	trigger.checkAndTrigger("c", EntryEventTypeUpdated, false)
+	trigger.checkAndTrigger("d", EntryEventTypeUpdated, false)
+	trigger.checkAndTrigger("e", EntryEventTypeUpdated, false)
+	trigger.checkAndTrigger("f", EntryEventTypeUpdated, false)
+	event = receiveTriggerEvent(t, events)
+	if event.Data["paths"] != "c\nd\ne" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	// pending events are flushed on clear
+	trigger.Clear()
+	event = receiveTriggerEvent(t, events)
+	if event.Data["paths"] != "f" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestEntryEventTrigger_MaxWait(t *testing.T) {
+	config, e := parseConfig(types.SM{
+		"pathPattern": "**",
+		"eventTypes":  "updated",
+		"quietPeriod": "200ms",
+		"maxWait":     "300ms",
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	flushed := make(chan string, 2)
+	batch := config.batch
+	batch.trigger = func(_ uint, event TriggerEvent) { flushed <- event.Data["count"] }
+	defer batch.stop()
+
+	// events keep coming within the quiet period, but the batch is flushed after maxWait
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		batch.add(entryEventItem{Path: string(rune('a' + i)), EventType: EntryEventTypeUpdated})
+		select {
+		case count := <-flushed:
+			if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+				t.Errorf("flushed after %v, before maxWait", elapsed)
+			}
+			if count == "10" {
+				t.Errorf("expected to be flushed before all events are added")
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch is not flushed")
+	}
+}
+
+func TestEntryEventTrigger_StaleTimer(t *testing.T) {
+	config, e := parseConfig(types.SM{"pathPattern": "**", "eventTypes": "updated", "quietPeriod": "1h"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	flushed := make(chan string, 1)
+	batch := config.batch
+	batch.trigger = func(_ uint, event TriggerEvent) { flushed <- event.Data["count"] }
+	defer batch.stop()
+
+	batch.add(entryEventItem{Path: "a", EventType: EntryEventTypeUpdated})
+	stale := batch.timerGen
+	batch.add(entryEventItem{Path: "b", EventType: EntryEventTypeUpdated})
+	// the replaced timer fires while it's being stopped
+	batch.flushByTimer(stale)
+	select {
+	case <-flushed:
+		t.Fatal("flushed by the replaced timer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	batch.flushByTimer(batch.timerGen)
+	select {
+	case count := <-flushed:
+		if count != "2" {
+			t.Errorf("flushed %s events, want 2", count)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch is not flushed")
+	}
+}
+
+func TestParseEntryTriggerConfig(t *testing.T) {
+	for _, config := range []types.SM{
+		{"pathPattern": "**", "eventTypes": "created"},
+		{"pathPattern": "**", "eventTypes": "updated", "namePattern": "[a"},
+		{"pathPattern": "**", "eventTypes": "updated", "quietPeriod": "abc"},
+		{"pathPattern": "**", "eventTypes": "updated", "quietPeriod": "-1s"},
+		{"pathPattern": "**", "eventTypes": "updated", "maxBatchSize": "10"},
+		{"pathPattern": "**", "eventTypes": "updated", "quietPeriod": "1s", "maxBatchSize": "x"},
+	} {
+		if _, e := parseConfig(config); e == nil {
+			t.Errorf("expected error of config %v", config)
+		}
+	}
+	config, e := parseConfig(types.SM{"pathPattern": "**", "eventTypes": "updated, accessed"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, ok := config.eventTypes[EntryEventTypeAccessed]; !ok || config.batch != nil {
+		t.Errorf("unexpected config: %+v", config)
+	}
+}
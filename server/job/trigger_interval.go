@@ -0,0 +1,116 @@
+package job
+
+import (
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+)
+
+const minTriggerInterval = time.Second
+
+func init() {
+	t := i18n.TPrefix("jobs.trigger.interval.")
+	RegisterTriggerDef(JobTriggerTypeInterval, JobTriggerDef{
+		Name:        string(JobTriggerTypeInterval),
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "interval", Label: t("interval"), Description: t("interval_desc"), Type: "text", Required: true},
+			{Field: "jitter", Label: t("jitter"), Description: t("jitter_desc"), Type: "text"},
+		},
+		Validate: func(config types.SM) error {
+			_, _, e := parseIntervalConfig(config)
+			return e
+		},
+		Factory: func(executor *JobExecutor, ch *registry.ComponentsHolder) IJobTriggerInstance {
+			return newIntervalTrigger(executor)
+		},
+	})
+}
+
+var _ IJobTriggerInstance = (*intervalTrigger)(nil)
+
+// intervalTrigger runs the jobs every interval, plus a random jitter
+type intervalTrigger struct {
+	executor *JobExecutor
+	s        gocron.Scheduler
+}
+
+func newIntervalTrigger(executor *JobExecutor) *intervalTrigger {
+	s, e := gocron.NewScheduler(gocron.WithLocation(time.Local))
+	if e != nil {
+		panic(e)
+	}
+	s.Start()
+
+	return &intervalTrigger{executor: executor, s: s}
+}
+
+// parseIntervalConfig parses the interval and jitter, which are durations like '30m' or '1h30m'
+func parseIntervalConfig(config types.SM) (time.Duration, time.Duration, error) {
+	if config["interval"] == "" {
+		return 0, 0, err.NewBadRequestError("interval is required")
+	}
+	interval, e := time.ParseDuration(config["interval"])
+	if e != nil {
+		return 0, 0, err.NewBadRequestError("invalid interval: " + e.Error())
+	}
+	if interval < minTriggerInterval {
+		return 0, 0, err.NewBadRequestError("interval must be at least " + minTriggerInterval.String())
+	}
+	jitter := time.Duration(0)
+	if config["jitter"] != "" {
+		jitter, e = time.ParseDuration(config["jitter"])
+		if e != nil {
+			return 0, 0, err.NewBadRequestError("invalid jitter: " + e.Error())
+		}
+		if jitter < 0 {
+			return 0, 0, err.NewBadRequestError("jitter must not be negative")
+		}
+	}
+	return interval, jitter, nil
+}
+
+func (it *intervalTrigger) Register(jobID uint, config types.SM) error {
+	interval, jitter, e := parseIntervalConfig(config)
+	if e != nil {
+		return e
+	}
+	if len(findScheduledJobs(it.s, jobID)) > 0 {
+		return fmt.Errorf("interval job %d is already registered", jobID)
+	}
+	definition := gocron.DurationJob(interval)
+	if jitter > 0 {
+		definition = gocron.DurationRandomJob(interval, interval+jitter)
+	}
+	_, e = it.s.NewJob(
+		definition,
+		gocron.NewTask(it.triggerAction, jobID),
+		gocron.WithTags(scheduledJobTag(jobID)),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	return e
+}
+
+func (it *intervalTrigger) GetInfo(jobID uint) ([]types.SM, error) {
+	return getScheduledJobsInfo(it.s, jobID)
+}
+
+func (it *intervalTrigger) triggerAction(jobID uint) {
+	it.executor.TriggerExecution(jobID, TriggerEvent{Type: JobTriggerTypeInterval})
+}
+
+func (it *intervalTrigger) Clear() {
+	for _, scheduledJob := range it.s.Jobs() {
+		_ = it.s.RemoveJob(scheduledJob.ID())
+	}
+}
+
+func (it *intervalTrigger) Dispose() error {
+	return it.s.Shutdown()
+}
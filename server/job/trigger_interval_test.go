@@ -0,0 +1,60 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"go-drive/common/types"
+)
+
+func TestIntervalTriggerRegisterAndGetInfo(t *testing.T) {
+	trigger := newIntervalTrigger(nil)
+	t.Cleanup(func() {
+		if e := trigger.Dispose(); e != nil {
+			t.Errorf("dispose scheduler: %v", e)
+		}
+	})
+
+	if e := trigger.Register(42, types.SM{"interval": "1h", "jitter": "10m"}); e != nil {
+		t.Fatalf("register interval job: %v", e)
+	}
+	if e := trigger.Register(42, types.SM{"interval": "1h"}); e == nil {
+		t.Fatal("expected error of registering the job again")
+	}
+	info, e := trigger.GetInfo(42)
+	if e != nil {
+		t.Fatalf("get interval job info: %v", e)
+	}
+	if len(info) != 1 {
+		t.Fatalf("unexpected interval job info: %#v", info)
+	}
+	nextRun, e := time.Parse(time.RFC3339, info[0]["nextRun"])
+	if e != nil {
+		t.Fatalf("parse next run: %v", e)
+	}
+	if d := time.Until(nextRun); d < 59*time.Minute || d > 71*time.Minute {
+		t.Errorf("unexpected next run: %s", nextRun)
+	}
+
+	trigger.Clear()
+	if info, _ := trigger.GetInfo(42); len(info) != 0 {
+		t.Fatalf("expected cleared scheduler, got %#v", info)
+	}
+}
+
+func TestParseIntervalConfig(t *testing.T) {
+	interval, jitter, e := parseIntervalConfig(types.SM{"interval": "1h30m", "jitter": "5m"})
+	if e != nil || interval != 90*time.Minute || jitter != 5*time.Minute {
+		t.Errorf("parsed: %s, %s, %v", interval, jitter, e)
+	}
+	for _, config := range []types.SM{
+		{},
+		{"interval": "10"},
+		{"interval": "100ms"},
+		{"interval": "1m", "jitter": "-1s"},
+	} {
+		if _, _, e := parseIntervalConfig(config); e == nil {
+			t.Errorf("expected error of %v", config)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package job
+
+import (
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"sync"
+)
+
+func init() {
+	t := i18n.TPrefix("jobs.trigger.startup.")
+	RegisterTriggerDef(JobTriggerTypeStartup, JobTriggerDef{
+		Name:        string(JobTriggerTypeStartup),
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm:  []types.FormItem{},
+		Validate:    func(config types.SM) error { return nil },
+		Factory: func(executor *JobExecutor, ch *registry.ComponentsHolder) IJobTriggerInstance {
+			return &startupTrigger{executor: executor}
+		},
+	})
+}
+
+var (
+	_ IJobTriggerInstance = (*startupTrigger)(nil)
+	_ IJobTriggerStarter  = (*startupTrigger)(nil)
+)
+
+// startupTrigger runs the jobs once when the server is started, after the drives are loaded.
+// Jobs registered by later reloads are not triggered.
+type startupTrigger struct {
+	executor *JobExecutor
+	jobs     []uint
+	started  bool
+	mu       sync.Mutex
+}
+
+func (st *startupTrigger) Register(jobID uint, config types.SM) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.jobs = append(st.jobs, jobID)
+	return nil
+}
+
+func (st *startupTrigger) Start() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.started {
+		return
+	}
+	st.started = true
+	for _, jobID := range st.jobs {
+		st.executor.TriggerExecution(jobID, TriggerEvent{Type: JobTriggerTypeStartup})
+	}
+}
+
+func (st *startupTrigger) GetInfo(jobID uint) ([]types.SM, error) {
+	return nil, nil
+}
+
+func (st *startupTrigger) Clear() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.jobs = nil
+}
+
+func (st *startupTrigger) Dispose() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-drive/common/types"
+)
+
+func TestStartupTrigger(t *testing.T) {
+	je := newTestExecutor(t)
+	trigger := &startupTrigger{executor: je}
+	je.triggers[JobTriggerTypeStartup] = trigger
+
+	executed := make(chan struct{}, 2)
+	job := addTestJob(t, je, types.Job{Description: "a"}, func(context.Context) error {
+		executed <- struct{}{}
+		return nil
+	})
+	_ = trigger.Register(job.ID, nil)
+	trigger.Start()
+	select {
+	case <-executed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job is not triggered at startup")
+	}
+
+	// jobs registered after reloading are not triggered again
+	trigger.Clear()
+	_ = trigger.Register(job.ID, nil)
+	trigger.Start()
+	select {
+	case <-executed:
+		t.Fatal("job is triggered twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,104 @@
+package job
+
+import (
+	"crypto/subtle"
+	"go-drive/common"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+const minWebhookSecretLength = 16
+
+// the secret is a part of the webhook URL
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+func init() {
+	t := i18n.TPrefix("jobs.trigger.webhook.")
+	RegisterTriggerDef(JobTriggerTypeWebhook, JobTriggerDef{
+		Name:        string(JobTriggerTypeWebhook),
+		DisplayName: t("name"),
+		Description: t("desc"),
+		ParamsForm: []types.FormItem{
+			{Field: "secret", Label: t("secret"), Description: t("secret_desc"), Type: "text", Required: true},
+		},
+		Validate: validateWebhookConfig,
+		Factory: func(executor *JobExecutor, ch *registry.ComponentsHolder) IJobTriggerInstance {
+			return newWebhookTrigger(ch.Get(registry.KeyConfig).(common.Config).APIPath)
+		},
+	})
+}
+
+var _ IJobTriggerInstance = (*webhookTrigger)(nil)
+
+// webhookTrigger holds the secrets of the webhooks, the webhooks are triggered by JobExecutor.TriggerWebhook
+type webhookTrigger struct {
+	apiPath string
+	secrets map[uint][]string
+	mu      sync.RWMutex
+}
+
+func newWebhookTrigger(apiPath string) *webhookTrigger {
+	return &webhookTrigger{apiPath: apiPath, secrets: make(map[uint][]string)}
+}
+
+func validateWebhookConfig(config types.SM) error {
+	if len(config["secret"]) < minWebhookSecretLength {
+		return err.NewBadRequestError("webhook secret must be at least " +
+			strconv.Itoa(minWebhookSecretLength) + " characters")
+	}
+	if !webhookSecretPattern.MatchString(config["secret"]) {
+		return err.NewBadRequestError("webhook secret can only contain letters, digits and '._~-'")
+	}
+	return nil
+}
+
+func (wt *webhookTrigger) Register(jobID uint, config types.SM) error {
+	if e := validateWebhookConfig(config); e != nil {
+		return e
+	}
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	wt.secrets[jobID] = append(wt.secrets[jobID], config["secret"])
+	return nil
+}
+
+// match checks whether the secret belongs to a webhook of the job
+func (wt *webhookTrigger) match(jobID uint, secret string) bool {
+	wt.mu.RLock()
+	defer wt.mu.RUnlock()
+	matched := false
+	for _, s := range wt.secrets[jobID] {
+		if subtle.ConstantTimeCompare([]byte(s), []byte(secret)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// GetInfo returns the URL path of the webhooks
+func (wt *webhookTrigger) GetInfo(jobID uint) ([]types.SM, error) {
+	wt.mu.RLock()
+	defer wt.mu.RUnlock()
+	stats := make([]types.SM, 0, len(wt.secrets[jobID]))
+	for _, secret := range wt.secrets[jobID] {
+		stats = append(stats, types.SM{
+			"url": wt.apiPath + "/job-webhooks/" + strconv.FormatUint(uint64(jobID), 10) + "/" + secret,
+		})
+	}
+	return stats, nil
+}
+
+func (wt *webhookTrigger) Clear() {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	wt.secrets = make(map[uint][]string)
+}
+
+func (wt *webhookTrigger) Dispose() error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+)
+
+func TestJobExecutor_TriggerWebhook(t *testing.T) {
+	je := newTestExecutor(t)
+	webhook := newWebhookTrigger("/api")
+	je.triggers[JobTriggerTypeWebhook] = webhook
+
+	events := make(chan TriggerEvent, 1)
+	job := addTestJob(t, je, types.Job{Description: "a"}, func(_ context.Context, params types.SM, _ func(string)) error {
+		event := TriggerEvent{}
+		e := json.Unmarshal([]byte(params[jobEventName]), &event)
+		events <- event
+		return e
+	})
+
+	const secret = "0123456789abcdef"
+	if e := webhook.Register(job.ID, types.SM{"secret": secret}); e != nil {
+		t.Fatal(e)
+	}
+	info, _ := webhook.GetInfo(job.ID)
+	if len(info) != 1 || info[0]["url"] != "/api/job-webhooks/"+strconv.FormatUint(uint64(job.ID), 10)+"/"+secret {
+		t.Errorf("unexpected webhook info: %v", info)
+	}
+
+	if _, e := je.TriggerWebhook(job.ID, "0123456789abcdeX", nil); !err.IsNotFoundError(e) {
+		t.Errorf("expected not found error of wrong secret, got %v", e)
+	}
+	if _, e := je.TriggerWebhook(job.ID+1, secret, nil); !err.IsNotFoundError(e) {
+		t.Errorf("expected not found error of wrong job, got %v", e)
+	}
+	if _, e := je.TriggerWebhook(job.ID, secret, types.SM{"ref": "main"}); e != nil {
+		t.Fatal(e)
+	}
+	select {
+	case event := <-events:
+		if event.Type != JobTriggerTypeWebhook || event.Data["ref"] != "main" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job is not triggered")
+	}
+}
+
+func TestValidateWebhookConfig(t *testing.T) {
+	if e := validateWebhookConfig(types.SM{"secret": "0123456789abcdef"}); e != nil {
+		t.Error(e)
+	}
+	for _, secret := range []string{"", "short", "0123456789abcdef/"} {
+		if e := validateWebhookConfig(types.SM{"secret": secret}); e == nil {
+			t.Errorf("expected error of %q", secret)
+		}
+	}
+}
@@ -35,30 +35,42 @@ type IJobTriggerInstance interface {
 	Clear()
 }
 
+// IJobTriggerStarter is implemented by the triggers that fire once when JobExecutor.Start is called
+type IJobTriggerStarter interface {
+	Start()
+}
+
 // JobTriggerType represents the type of a job trigger
 type JobTriggerType string
 
 const (
-	JobTriggerTypeCron  JobTriggerType = "cron"
-	JobTriggerTypeEntry JobTriggerType = "entry"
+	JobTriggerTypeCron     JobTriggerType = "cron"
+	JobTriggerTypeEntry    JobTriggerType = "entry"
+	JobTriggerTypeInterval JobTriggerType = "interval"
+	JobTriggerTypeStartup  JobTriggerType = "startup"
+	JobTriggerTypeWebhook  JobTriggerType = "webhook"
+	// JobTriggerTypeChain is the type of the executions triggered by the OnSuccess or OnFailure of another job.
+	// It's not a trigger that can be configured.
+	JobTriggerTypeChain JobTriggerType = "chain"
 )
 
 // EntryEventType is the type of entry event (used in entry trigger's eventTypes)
 type EntryEventType string
 
 const (
-	EntryEventTypeUpdated EntryEventType = "updated"
-	EntryEventTypeDeleted EntryEventType = "deleted"
+	EntryEventTypeUpdated  EntryEventType = "updated"
+	EntryEventTypeDeleted  EntryEventType = "deleted"
+	EntryEventTypeAccessed EntryEventType = "accessed"
 )
 
 // ParsedJobTrigger represents a trigger configuration for a job
 type ParsedJobTrigger struct {
-	Type   JobTriggerType `json:"type"`   // cron, entry
+	Type   JobTriggerType `json:"type"`   // cron, entry, interval, startup, webhook
 	Config types.SM       `json:"config"` // Trigger-specific configuration
 }
 
 // TriggerEvent represents an event that triggered a job
 type TriggerEvent struct {
-	Type JobTriggerType `json:"type,omitempty"` // cron or entry
-	Data types.SM       `json:"data,omitempty"` // Trigger-specific data (e.g. path, eventType for entry)
+	Type JobTriggerType `json:"type,omitempty"` // cron, entry, interval, startup, webhook or chain
+	Data types.SM       `json:"data,omitempty"` // Trigger-specific data (e.g. path, eventType for entry, payload of webhook)
 }
@@ -2,6 +2,7 @@ package job
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go-drive/common/i18n"
@@ -47,13 +48,32 @@ func init() {
 			if len(ops) == 0 {
 				return errors.New("empty ops")
 			}
+			recorder := getStepRecorder(ctx)
+			outputs := make([]types.SM, 0, len(ops))
 			for i, op := range ops {
 				actionKey := op["$key"]
 				ignoreError := op.GetBool("_ignoreErr")
 				actionDef := GetActionDef(actionKey)
+				if actionDef == nil {
+					return fmt.Errorf("flow execution error at step %d: unknown action '%s'", i+1, actionKey)
+				}
 				delete(op, "$key")
 				delete(op, "_ignoreErr")
-				e := actionDef.Do(ctx, op, ch, logFn)
+				op = expandStepParams(op, outputs)
+				op[jobEventName] = params[jobEventName]
+				if stepsJson, e := json.Marshal(outputs); e == nil {
+					op[jobStepsName] = string(stepsJson)
+				}
+
+				step := recorder.begin(actionKey)
+				stepCtx, output := withStepOutput(ctx)
+				e := actionDef.Do(stepCtx, op, ch, func(s string) {
+					recorder.log(step, s)
+					logFn(fmt.Sprintf("[%d] %s", i+1, s))
+				})
+				recorder.end(step, output.get(), e)
+				outputs = append(outputs, output.get())
+
 				if e != nil && !ignoreError {
 					return fmt.Errorf("flow execution error at step %d: %s", i+1, e.Error())
 				}
@@ -0,0 +1,516 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+func init() {
+	RegisterExtractor("audio", newAudioExtractor)
+}
+
+const (
+	// id3MaxFrameSize limits the size of the text frames
+	id3MaxFrameSize = 64 * 1024
+	// mp3SyncSearchSize is the size to search for the first MPEG frame after the tag
+	mp3SyncSearchSize = 64 * 1024
+)
+
+// the types of the FLAC metadata blocks
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+var errInvalidAudio = errors.New("invalid audio data")
+
+// audioExtractor reads the tags and the duration of MP3 and FLAC files
+type audioExtractor struct {
+}
+
+func newAudioExtractor(types.SM) (Extractor, error) {
+	return &audioExtractor{}, nil
+}
+
+func (a *audioExtractor) FileTypes() []string {
+	return []string{"mp3", "flac"}
+}
+
+func (a *audioExtractor) Extract(_ context.Context, r *io.SectionReader, meta *types.MediaMeta) error {
+	header := make([]byte, 4)
+	if _, e := r.ReadAt(header, 0); e != nil {
+		return err.NewUnsupportedError()
+	}
+	if bytes.Equal(header, []byte("fLaC")) {
+		return readFLAC(r, meta)
+	}
+	tagSize, e := readID3v2(r, meta)
+	if e != nil {
+		return e
+	}
+	if e := readID3v1(r, meta); e != nil {
+		return e
+	}
+	found, e := readMP3Duration(r, tagSize, meta)
+	if e != nil {
+		return e
+	}
+	if !found && tagSize == 0 && meta.IsEmpty() {
+		return err.NewUnsupportedError()
+	}
+	return nil
+}
+
+var id3Frames = map[string]func(meta *types.MediaMeta, value string){
+	"TIT2": func(m *types.MediaMeta, v string) { m.Title = v },
+	"TPE1": func(m *types.MediaMeta, v string) { m.Artist = v },
+	"TALB": func(m *types.MediaMeta, v string) { m.Album = v },
+	"TCON": func(m *types.MediaMeta, v string) { m.Genre = id3Genre(v) },
+	"TRCK": func(m *types.MediaMeta, v string) { m.Track = parseLeadingInt(v) },
+	"TYER": func(m *types.MediaMeta, v string) { m.Year = parseLeadingInt(v) },
+	"TDRC": func(m *types.MediaMeta, v string) { m.Year = parseLeadingInt(v) },
+}
+
+// id3v22Frames maps the frame ids of ID3v2.2 to the ones of ID3v2.3
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2", "TP1": "TPE1", "TAL": "TALB", "TCO": "TCON", "TRK": "TRCK", "TYE": "TYER",
+	// the layout of PIC differs from APIC
+	"PIC": "PIC",
+}
+
+// readID3v2 reads the text frames of the ID3v2 tag, and returns the size of the tag
+func readID3v2(r *io.SectionReader, meta *types.MediaMeta) (int64, error) {
+	return walkID3v2(r, func(id string, pos, size int64) error {
+		set, ok := id3Frames[id]
+		if !ok || size > id3MaxFrameSize {
+			return nil
+		}
+		data := make([]byte, size)
+		if _, e := r.ReadAt(data, pos); e != nil {
+			return e
+		}
+		if v := id3Text(data); v != "" {
+			set(meta, v)
+		}
+		return nil
+	})
+}
+
+// walkID3v2 calls fn with the id and the payload range of the frames of the ID3v2 tag,
+// and returns the size of the tag. The ids of ID3v2.2 are converted to the ones of ID3v2.3,
+// the compressed and encrypted frames are skipped.
+func walkID3v2(r *io.SectionReader, fn func(id string, pos, size int64) error) (int64, error) {
+	header := make([]byte, 10)
+	if _, e := r.ReadAt(header, 0); e != nil || !bytes.Equal(header[:3], []byte("ID3")) {
+		return 0, nil
+	}
+	version := header[3]
+	flags := header[5]
+	size := int64(syncsafe(header[6:10])) + 10
+	if flags&0x10 != 0 {
+		// footer
+		size += 10
+	}
+	if version < 2 || version > 4 {
+		return size, nil
+	}
+	// the unsynchronisation of the whole tag is not supported
+	if flags&0x80 != 0 && version < 4 {
+		return size, nil
+	}
+
+	pos := int64(10)
+	if flags&0x40 != 0 && version > 2 {
+		ext := make([]byte, 4)
+		if _, e := r.ReadAt(ext, pos); e != nil {
+			return size, e
+		}
+		if version == 4 {
+			pos += int64(syncsafe(ext))
+		} else {
+			pos += int64(binary.BigEndian.Uint32(ext)) + 4
+		}
+	}
+
+	headerSize := int64(10)
+	if version == 2 {
+		headerSize = 6
+	}
+	frameHeader := make([]byte, headerSize)
+	for pos+headerSize <= size {
+		if _, e := r.ReadAt(frameHeader, pos); e != nil {
+			return size, e
+		}
+		// padding
+		if frameHeader[0] == 0 {
+			break
+		}
+		var id string
+		var frameSize int64
+		switch version {
+		case 2:
+			id = id3v22Frames[string(frameHeader[:3])]
+			frameSize = int64(frameHeader[3])<<16 | int64(frameHeader[4])<<8 | int64(frameHeader[5])
+		case 3:
+			id = string(frameHeader[:4])
+			frameSize = int64(binary.BigEndian.Uint32(frameHeader[4:8]))
+		default:
+			id = string(frameHeader[:4])
+			frameSize = int64(syncsafe(frameHeader[4:8]))
+		}
+		pos += headerSize
+		if frameSize <= 0 || pos+frameSize > size {
+			break
+		}
+		encoded := version > 2 && frameHeader[9]&0xcf != 0
+		if !encoded {
+			if e := fn(id, pos, frameSize); e != nil {
+				return size, e
+			}
+		}
+		pos += frameSize
+	}
+	return size, nil
+}
+
+// readID3v1 reads the ID3v1 tag at the end of the file, which only fills the missing values
+func readID3v1(r *io.SectionReader, meta *types.MediaMeta) error {
+	if r.Size() < 128 {
+		return nil
+	}
+	tag := make([]byte, 128)
+	if _, e := r.ReadAt(tag, r.Size()-128); e != nil {
+		return e
+	}
+	if !bytes.Equal(tag[:3], []byte("TAG")) {
+		return nil
+	}
+	text := func(b []byte) string {
+		b, _, _ = bytes.Cut(b, []byte{0})
+		return strings.TrimSpace(latin1(b))
+	}
+	if meta.Title == "" {
+		meta.Title = text(tag[3:33])
+	}
+	if meta.Artist == "" {
+		meta.Artist = text(tag[33:63])
+	}
+	if meta.Album == "" {
+		meta.Album = text(tag[63:93])
+	}
+	if meta.Year == 0 {
+		meta.Year = parseLeadingInt(text(tag[93:97]))
+	}
+	// ID3v1.1 stores the track in the last byte of the comment
+	if meta.Track == 0 && tag[125] == 0 {
+		meta.Track = int(tag[126])
+	}
+	return nil
+}
+
+var (
+	mp3Bitrates = [2][3][15]int{
+		// MPEG-1, layer I, II, III
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		// MPEG-2 and MPEG-2.5, layer I, II, III
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// readMP3Duration reads the duration from the Xing or VBRI header of the first frame,
+// or estimates it by the bitrate of the first frame if the file is CBR.
+func readMP3Duration(r *io.SectionReader, start int64, meta *types.MediaMeta) (bool, error) {
+	data := make([]byte, min(mp3SyncSearchSize, max(r.Size()-start, 0)))
+	n, e := r.ReadAt(data, start)
+	if e != nil && e != io.EOF {
+		return false, e
+	}
+	data = data[:n]
+	for i := 0; i+4 <= len(data); i++ {
+		if data[i] != 0xff || data[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		versionBits := (data[i+1] >> 3) & 3
+		layerBits := (data[i+1] >> 1) & 3
+		bitrateIndex := data[i+2] >> 4
+		sampleRateIndex := (data[i+2] >> 2) & 3
+		if versionBits == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+			continue
+		}
+		mpeg1 := versionBits == 3
+		layer := 3 - int(layerBits)
+		table := 1
+		if mpeg1 {
+			table = 0
+		}
+		bitrate := mp3Bitrates[table][layer][bitrateIndex] * 1000
+		sampleRate := mp3SampleRates[sampleRateIndex]
+		switch versionBits {
+		case 2:
+			sampleRate /= 2
+		case 0:
+			sampleRate /= 4
+		}
+		samples := 1152
+		if layer == 0 {
+			samples = 384
+		} else if layer == 2 && !mpeg1 {
+			samples = 576
+		}
+		mono := data[i+3]>>6 == 3
+
+		sideInfo := 32
+		if mpeg1 && mono || !mpeg1 && !mono {
+			sideInfo = 17
+		} else if !mpeg1 && mono {
+			sideInfo = 9
+		}
+		frames := uint32(0)
+		if x := i + 4 + sideInfo; x+12 <= len(data) &&
+			(bytes.Equal(data[x:x+4], []byte("Xing")) || bytes.Equal(data[x:x+4], []byte("Info"))) &&
+			data[x+7]&1 != 0 {
+			frames = binary.BigEndian.Uint32(data[x+8:])
+		} else if v := i + 36; v+18 <= len(data) && bytes.Equal(data[v:v+4], []byte("VBRI")) {
+			frames = binary.BigEndian.Uint32(data[v+14:])
+		}
+
+		meta.AudioCodec = "mp3"
+		if frames > 0 {
+			meta.Duration = float64(frames) * float64(samples) / float64(sampleRate)
+		} else {
+			audioSize := r.Size() - start - int64(i)
+			meta.Duration = float64(audioSize) * 8 / float64(bitrate)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// readFLAC reads the STREAMINFO and VORBIS_COMMENT metadata blocks
+func readFLAC(r *io.SectionReader, meta *types.MediaMeta) error {
+	meta.AudioCodec = "flac"
+	return walkFLAC(r, func(blockType byte, pos, size int64) error {
+		switch blockType {
+		case flacStreamInfo:
+			if size < 18 {
+				return errInvalidAudio
+			}
+			info := make([]byte, 18)
+			if _, e := r.ReadAt(info, pos); e != nil {
+				return e
+			}
+			sampleRate := int64(info[10])<<12 | int64(info[11])<<4 | int64(info[12])>>4
+			totalSamples := int64(info[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(info[14:]))
+			if sampleRate > 0 {
+				meta.Duration = float64(totalSamples) / float64(sampleRate)
+			}
+		case flacVorbisComment:
+			if size > id3MaxFrameSize {
+				break
+			}
+			data := make([]byte, size)
+			if _, e := r.ReadAt(data, pos); e != nil {
+				return e
+			}
+			readVorbisComment(data, meta)
+		}
+		return nil
+	})
+}
+
+// walkFLAC calls fn with the type and the payload range of the metadata blocks
+func walkFLAC(r *io.SectionReader, fn func(blockType byte, pos, size int64) error) error {
+	pos := int64(4)
+	header := make([]byte, 4)
+	for {
+		if _, e := r.ReadAt(header, pos); e != nil {
+			return e
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+		if blockType == 127 {
+			return errInvalidAudio
+		}
+		if e := fn(blockType, pos, size); e != nil {
+			return e
+		}
+		pos += size
+		if last {
+			return nil
+		}
+	}
+}
+
+// readVorbisComment reads the tags of the Vorbis comment, which is used by FLAC and Ogg
+func readVorbisComment(data []byte, meta *types.MediaMeta) {
+	walkVorbisComment(data, func(key, value string) bool {
+		value = strings.TrimSpace(value)
+		switch key {
+		case "TITLE":
+			meta.Title = value
+		case "ARTIST":
+			meta.Artist = value
+		case "ALBUM":
+			meta.Album = value
+		case "GENRE":
+			meta.Genre = value
+		case "TRACKNUMBER":
+			meta.Track = parseLeadingInt(value)
+		case "DATE", "YEAR":
+			meta.Year = parseLeadingInt(value)
+		}
+		return true
+	})
+}
+
+// walkVorbisComment calls fn with the upper-case keys and the values of the comments until fn returns false
+func walkVorbisComment(data []byte, fn func(key, value string) bool) {
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if n < 0 || n > len(data)-4 {
+			return nil, false
+		}
+		v := data[4 : 4+n]
+		data = data[4+n:]
+		return v, true
+	}
+	// vendor
+	if _, ok := next(); !ok {
+		return
+	}
+	if len(data) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return
+		}
+		key, value, ok := strings.Cut(string(comment), "=")
+		if !ok {
+			continue
+		}
+		if !fn(strings.ToUpper(key), value) {
+			return
+		}
+	}
+}
+
+// id3Text decodes the text frame, only the first value is returned if there are multiple ones
+func id3Text(data []byte) string {
+	if len(data) < 2 {
+		return ""
+	}
+	encoding, data := data[0], data[1:]
+	var s string
+	switch encoding {
+	case 0:
+		data, _, _ = bytes.Cut(data, []byte{0})
+		s = latin1(data)
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == 1 && len(data) >= 2 {
+			if data[0] == 0xff && data[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			if (data[0] == 0xff && data[1] == 0xfe) || (data[0] == 0xfe && data[1] == 0xff) {
+				data = data[2:]
+			}
+		}
+		u := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			c := order.Uint16(data[i:])
+			if c == 0 {
+				break
+			}
+			u = append(u, c)
+		}
+		s = string(utf16.Decode(u))
+	case 3:
+		data, _, _ = bytes.Cut(data, []byte{0})
+		s = string(data)
+	}
+	return strings.TrimSpace(s)
+}
+
+// id3Genre converts the genres like "(17)" to the names of the ID3v1 genres
+func id3Genre(v string) string {
+	if !strings.HasPrefix(v, "(") {
+		if i, e := strconv.Atoi(v); e == nil && i >= 0 && i < len(id3v1Genres) {
+			return id3v1Genres[i]
+		}
+		return v
+	}
+	end := strings.IndexByte(v, ')')
+	if end < 0 {
+		return v
+	}
+	if rest := strings.TrimSpace(v[end+1:]); rest != "" {
+		return rest
+	}
+	if i, e := strconv.Atoi(v[1:end]); e == nil && i >= 0 && i < len(id3v1Genres) {
+		return id3v1Genres[i]
+	}
+	return v
+}
+
+// id3v1Genres are the standard genres of ID3v1
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal",
+	"Jazz+Funk", "Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip",
+	"Gospel", "Noise", "AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop",
+	"Instrumental Rock", "Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk",
+	"Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk",
+	"Jungle", "Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer",
+	"Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// parseLeadingInt parses the leading digits like "3/12" or "2004-05-06"
+func parseLeadingInt(v string) int {
+	v = strings.TrimSpace(v)
+	end := 0
+	for end < len(v) && v[end] >= '0' && v[end] <= '9' {
+		end++
+	}
+	i, _ := strconv.Atoi(v[:end])
+	return i
+}
@@ -0,0 +1,377 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"sort"
+)
+
+const (
+	// coverMaxSize limits the size of the cover images read into memory
+	coverMaxSize = 16 * 1024 * 1024
+	// oggMaxHeaderSize limits the size of the Ogg comment header, which contains the base64 encoded pictures
+	oggMaxHeaderSize = coverMaxSize/3*4 + 64*1024
+	// id3PictureHeaderSize is the size read to parse the header of the picture frames
+	id3PictureHeaderSize = 1024
+	// pictureTypeFront is the picture type of the front cover in ID3 and FLAC
+	pictureTypeFront = 3
+)
+
+// errCoverFound stops walking when the front cover is found
+var errCoverFound = errors.New("cover found")
+
+// coverReaders is map[extension]reader, the readers return nil if there is no cover
+var coverReaders = map[string]func(r *io.SectionReader) ([]byte, error){
+	"mp3":  readID3Cover,
+	"flac": readFLACCover,
+	"ogg":  readOggCover,
+	"oga":  readOggCover,
+	"opus": readOggCover,
+	"mp4":  readMP4Cover,
+	"m4v":  readMP4Cover,
+	"m4a":  readMP4Cover,
+	"m4b":  readMP4Cover,
+	"mov":  readMP4Cover,
+	"3gp":  readMP4Cover,
+}
+
+// CoverFileTypes returns the file extensions supported by ReadCover
+func CoverFileTypes() []string {
+	fileTypes := utils.MapKeys(coverReaders)
+	sort.Strings(fileTypes)
+	return fileTypes
+}
+
+// ReadCover reads the embedded cover image of the audio or video file by range reads,
+// so only the headers and the image are downloaded even if they are at the end of the file.
+// Returns err.UnsupportedError if the file type is not supported, and err.NotFoundError if there is no cover.
+func ReadCover(ctx context.Context, entry types.IEntry) ([]byte, error) {
+	read, ok := coverReaders[utils.PathExt(entry.Path())]
+	if !ok || !entry.Type().IsFile() {
+		return nil, err.NewUnsupportedError()
+	}
+	data, e := read(io.NewSectionReader(newEntryReaderAt(ctx, entry), 0, entry.Size()))
+	if e != nil {
+		return nil, e
+	}
+	if data == nil {
+		return nil, err.NewNotFoundError()
+	}
+	return data, nil
+}
+
+// coverPicker keeps the front cover, or the first picture if there is no front cover
+type coverPicker struct {
+	data  []byte
+	front bool
+}
+
+// read reads the picture in the range if it is preferred, and returns errCoverFound when the front cover is read
+func (p *coverPicker) read(r io.ReaderAt, front bool, pos, size int64) error {
+	if (p.data != nil && !front) || size <= 0 || size > coverMaxSize {
+		return nil
+	}
+	data := make([]byte, size)
+	if _, e := r.ReadAt(data, pos); e != nil {
+		return e
+	}
+	p.data, p.front = data, front
+	if front {
+		return errCoverFound
+	}
+	return nil
+}
+
+func (p *coverPicker) result(e error) ([]byte, error) {
+	if e != nil && !errors.Is(e, errCoverFound) {
+		return nil, e
+	}
+	return p.data, nil
+}
+
+// readID3Cover reads the APIC frames of the ID3v2 tag
+func readID3Cover(r *io.SectionReader) ([]byte, error) {
+	p := &coverPicker{}
+	_, e := walkID3v2(r, func(id string, pos, size int64) error {
+		if id != "APIC" && id != "PIC" {
+			return nil
+		}
+		header := make([]byte, min(size, id3PictureHeaderSize))
+		if _, e := r.ReadAt(header, pos); e != nil {
+			return e
+		}
+		pictureType, offset, ok := id3PictureHeader(id, header)
+		if !ok {
+			return nil
+		}
+		return p.read(r, pictureType == pictureTypeFront, pos+offset, size-offset)
+	})
+	return p.result(e)
+}
+
+// id3PictureHeader returns the picture type and the offset of the image data of the APIC or PIC frame
+func id3PictureHeader(id string, data []byte) (byte, int64, bool) {
+	if len(data) < 1 {
+		return 0, 0, false
+	}
+	encoding := data[0]
+	pos := 1
+	if id == "PIC" {
+		// 3 bytes of the image format
+		pos += 3
+	} else {
+		// the null-terminated mime-type
+		i := bytes.IndexByte(data[pos:], 0)
+		if i < 0 {
+			return 0, 0, false
+		}
+		pos += i + 1
+	}
+	if pos >= len(data) {
+		return 0, 0, false
+	}
+	pictureType := data[pos]
+	pos++
+	// the description is terminated by 2 zero bytes in UTF-16
+	if encoding == 1 || encoding == 2 {
+		for ; pos+1 < len(data); pos += 2 {
+			if data[pos] == 0 && data[pos+1] == 0 {
+				return pictureType, int64(pos + 2), true
+			}
+		}
+		return 0, 0, false
+	}
+	i := bytes.IndexByte(data[pos:], 0)
+	if i < 0 {
+		return 0, 0, false
+	}
+	return pictureType, int64(pos + i + 1), true
+}
+
+// readFLACCover reads the PICTURE metadata blocks
+func readFLACCover(r *io.SectionReader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, e := r.ReadAt(header, 0); e != nil || !bytes.Equal(header, []byte("fLaC")) {
+		return nil, nil
+	}
+	p := &coverPicker{}
+	e := walkFLAC(r, func(blockType byte, pos, size int64) error {
+		if blockType != flacPicture {
+			return nil
+		}
+		pictureType, start, size, e := readFLACPicture(r, pos, size)
+		if e != nil {
+			return nil
+		}
+		return p.read(r, pictureType == pictureTypeFront, start, size)
+	})
+	return p.result(e)
+}
+
+// readFLACPicture returns the picture type and the range of the image data of the FLAC picture block,
+// which is also used by METADATA_BLOCK_PICTURE of the Vorbis comment
+func readFLACPicture(r io.ReaderAt, pos, size int64) (uint32, int64, int64, error) {
+	end := pos + size
+	buf := make([]byte, 4)
+	uint32At := func(at int64) (uint32, error) {
+		if at+4 > end {
+			return 0, errInvalidAudio
+		}
+		if _, e := r.ReadAt(buf, at); e != nil {
+			return 0, e
+		}
+		return binary.BigEndian.Uint32(buf), nil
+	}
+	pictureType, e := uint32At(pos)
+	if e != nil {
+		return 0, 0, 0, e
+	}
+	mimeLen, e := uint32At(pos + 4)
+	if e != nil {
+		return 0, 0, 0, e
+	}
+	at := pos + 8 + int64(mimeLen)
+	descLen, e := uint32At(at)
+	if e != nil {
+		return 0, 0, 0, e
+	}
+	// width, height, color depth and the number of colors
+	at += 4 + int64(descLen) + 16
+	dataLen, e := uint32At(at)
+	if e != nil {
+		return 0, 0, 0, e
+	}
+	at += 4
+	if at+int64(dataLen) > end {
+		return 0, 0, 0, errInvalidAudio
+	}
+	return pictureType, at, int64(dataLen), nil
+}
+
+// readOggCover reads METADATA_BLOCK_PICTURE and the legacy COVERART of the Vorbis comment
+// in the Vorbis and Opus streams
+func readOggCover(r *io.SectionReader) ([]byte, error) {
+	packet, e := readOggPacket(r, 1, oggMaxHeaderSize)
+	if e != nil || packet == nil {
+		return nil, e
+	}
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		packet = packet[7:]
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		packet = packet[8:]
+	default:
+		return nil, nil
+	}
+	p := &coverPicker{}
+	walkVorbisComment(packet, func(key, value string) bool {
+		if key != "METADATA_BLOCK_PICTURE" && key != "COVERART" {
+			return true
+		}
+		data, e := base64.StdEncoding.DecodeString(value)
+		if e != nil {
+			return true
+		}
+		br := bytes.NewReader(data)
+		if key == "COVERART" {
+			return p.read(br, false, 0, int64(len(data))) == nil
+		}
+		pictureType, start, size, e := readFLACPicture(br, 0, int64(len(data)))
+		if e != nil {
+			return true
+		}
+		return p.read(br, pictureType == pictureTypeFront, start, size) == nil
+	})
+	return p.data, nil
+}
+
+// readOggPacket reads the packet of the index in the first logical stream of the Ogg file,
+// it returns nil if the stream ends before the packet.
+func readOggPacket(r *io.SectionReader, index int, maxSize int64) ([]byte, error) {
+	header := make([]byte, 27)
+	var serial uint32
+	var packet []byte
+	n := 0
+	for pos := int64(0); pos+27 <= r.Size(); {
+		if _, e := r.ReadAt(header, pos); e != nil {
+			return nil, e
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, errInvalidAudio
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:18])
+		if pos == 0 {
+			serial = pageSerial
+		}
+		segments := make([]byte, header[26])
+		if _, e := r.ReadAt(segments, pos+27); e != nil {
+			return nil, e
+		}
+		pos += 27 + int64(len(segments))
+		if pageSerial != serial {
+			for _, l := range segments {
+				pos += int64(l)
+			}
+			continue
+		}
+
+		start, size := pos, int64(0)
+		done := false
+		for _, l := range segments {
+			if n < index {
+				start += int64(l)
+			} else {
+				size += int64(l)
+			}
+			pos += int64(l)
+			// the packet ends with a segment shorter than 255
+			if l < 255 {
+				if n == index {
+					done = true
+					break
+				}
+				n++
+			}
+		}
+		if size > 0 {
+			if int64(len(packet))+size > maxSize {
+				return nil, errInvalidAudio
+			}
+			data := make([]byte, size)
+			if _, e := r.ReadAt(data, start); e != nil {
+				return nil, e
+			}
+			packet = append(packet, data...)
+		}
+		if done {
+			return packet, nil
+		}
+	}
+	return nil, nil
+}
+
+// readMP4Cover reads the covr item of the iTunes metadata
+func readMP4Cover(r *io.SectionReader) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, e := r.ReadAt(header, 0); e != nil {
+		return nil, nil
+	}
+	switch string(header[4:]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+	default:
+		return nil, nil
+	}
+	m := &mp4Reader{r: r}
+	p := &coverPicker{}
+	e := m.walk(0, r.Size(), func(typ string, start, end int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		return m.walk(start, end, func(typ string, start, end int64) error {
+			switch typ {
+			case "udta":
+				return m.walk(start, end, func(typ string, start, end int64) error {
+					if typ != "meta" {
+						return nil
+					}
+					return m.readMetaCover(start, end, p)
+				})
+			case "meta":
+				return m.readMetaCover(start, end, p)
+			}
+			return nil
+		})
+	})
+	return p.result(e)
+}
+
+func (m *mp4Reader) readMetaCover(start, end int64, p *coverPicker) error {
+	start, e := m.metaChildren(start)
+	if e != nil {
+		return e
+	}
+	return m.walk(start, end, func(typ string, start, end int64) error {
+		if typ != "ilst" {
+			return nil
+		}
+		return m.walk(start, end, func(typ string, start, end int64) error {
+			if typ != "covr" {
+				return nil
+			}
+			return m.walk(start, end, func(typ string, start, end int64) error {
+				// 4 bytes of the data type and 4 bytes of the locale
+				if typ != "data" || end-start <= 8 {
+					return nil
+				}
+				return p.read(m.r, true, start+8, end-start-8)
+			})
+		})
+	})
+}
@@ -0,0 +1,285 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterExtractor("exif", newExifExtractor)
+}
+
+const (
+	tagImageWidth     = 0x0100
+	tagImageLength    = 0x0101
+	tagMake           = 0x010f
+	tagModel          = 0x0110
+	tagOrientation    = 0x0112
+	tagDateTime       = 0x0132
+	tagExifIFD        = 0x8769
+	tagGPSIFD         = 0x8825
+	tagDateTimeOrig   = 0x9003
+	tagOffsetTimeOrig = 0x9011
+	tagPixelXDim      = 0xa002
+	tagPixelYDim      = 0xa003
+
+	tagGPSLatitudeRef  = 1
+	tagGPSLatitude     = 2
+	tagGPSLongitudeRef = 3
+	tagGPSLongitude    = 4
+
+	// exifMaxEntries limits the entries of an IFD, the larger ones are broken
+	exifMaxEntries = 1024
+	exifDateFormat = "2006:01:02 15:04:05"
+)
+
+var errInvalidExif = errors.New("invalid EXIF data")
+
+// exifExtractor reads the camera, the time taken, the GPS location, the orientation and the size
+// from the EXIF data of JPEG and TIFF images
+type exifExtractor struct {
+}
+
+func newExifExtractor(types.SM) (Extractor, error) {
+	return &exifExtractor{}, nil
+}
+
+func (x *exifExtractor) FileTypes() []string {
+	return []string{"jpg", "jpeg", "jpe", "tif", "tiff", "dng", "nef", "cr2", "arw"}
+}
+
+func (x *exifExtractor) Extract(_ context.Context, r *io.SectionReader, meta *types.MediaMeta) error {
+	header := make([]byte, 4)
+	if _, e := r.ReadAt(header, 0); e != nil {
+		return err.NewUnsupportedError()
+	}
+	switch {
+	case header[0] == 0xff && header[1] == 0xd8:
+		return readJPEG(r, meta)
+	case bytes.Equal(header, []byte("II*\x00")) || bytes.Equal(header, []byte("MM\x00*")):
+		return readTIFF(r, meta)
+	}
+	return err.NewUnsupportedError()
+}
+
+// readJPEG reads the EXIF segment and the frame size from the markers before the image data
+func readJPEG(r *io.SectionReader, meta *types.MediaMeta) error {
+	pos := int64(2)
+	header := make([]byte, 4)
+	for {
+		if _, e := r.ReadAt(header, pos); e != nil {
+			return e
+		}
+		if header[0] != 0xff {
+			return errInvalidExif
+		}
+		marker := header[1]
+		if marker == 0xff {
+			// fill bytes
+			pos++
+			continue
+		}
+		// start of scan or end of image
+		if marker == 0xda || marker == 0xd9 {
+			return nil
+		}
+		length := int64(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return errInvalidExif
+		}
+		switch {
+		case marker == 0xe1 && length > 8:
+			id := make([]byte, 6)
+			if _, e := r.ReadAt(id, pos+4); e != nil {
+				return e
+			}
+			if bytes.Equal(id, []byte("Exif\x00\x00")) {
+				if e := readTIFF(io.NewSectionReader(r, pos+10, length-8), meta); e != nil {
+					return e
+				}
+			}
+		// the start of frame markers, except DHT, JPG and DAC
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			sof := make([]byte, 5)
+			if _, e := r.ReadAt(sof, pos+4); e != nil {
+				return e
+			}
+			// the frame size is more reliable than the one in EXIF
+			meta.Height = int(binary.BigEndian.Uint16(sof[1:]))
+			meta.Width = int(binary.BigEndian.Uint16(sof[3:]))
+		}
+		pos += 2 + length
+	}
+}
+
+// readTIFF reads the tags of the TIFF structure, which is also the format of the EXIF segment of JPEG
+func readTIFF(r *io.SectionReader, meta *types.MediaMeta) error {
+	t := &tiffReader{r: r}
+	header := make([]byte, 8)
+	if _, e := r.ReadAt(header, 0); e != nil {
+		return e
+	}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errInvalidExif
+	}
+	ifd0, e := t.readIFD(int64(t.order.Uint32(header[4:])))
+	if e != nil {
+		return e
+	}
+	meta.CameraMake = t.string(ifd0[tagMake])
+	meta.CameraModel = t.string(ifd0[tagModel])
+	meta.Orientation = int(t.uint(ifd0[tagOrientation]))
+	if w, h := t.uint(ifd0[tagImageWidth]), t.uint(ifd0[tagImageLength]); w > 0 && h > 0 {
+		meta.Width, meta.Height = int(w), int(h)
+	}
+	takenAt := t.string(ifd0[tagDateTime])
+	offset := ""
+
+	if exifIFD, ok := ifd0[tagExifIFD]; ok {
+		tags, e := t.readIFD(int64(t.uint(exifIFD)))
+		if e != nil {
+			return e
+		}
+		if v := t.string(tags[tagDateTimeOrig]); v != "" {
+			takenAt = v
+			offset = t.string(tags[tagOffsetTimeOrig])
+		}
+		if w, h := t.uint(tags[tagPixelXDim]), t.uint(tags[tagPixelYDim]); w > 0 && h > 0 {
+			meta.Width, meta.Height = int(w), int(h)
+		}
+	}
+	if v, ok := parseExifTime(takenAt, offset); ok {
+		meta.TakenAt = &v
+	}
+
+	if gpsIFD, ok := ifd0[tagGPSIFD]; ok {
+		tags, e := t.readIFD(int64(t.uint(gpsIFD)))
+		if e != nil {
+			return e
+		}
+		lat, latOk := t.degrees(tags[tagGPSLatitude], t.string(tags[tagGPSLatitudeRef]), "S")
+		lng, lngOk := t.degrees(tags[tagGPSLongitude], t.string(tags[tagGPSLongitudeRef]), "W")
+		if latOk && lngOk && math.Abs(lat) <= 90 && math.Abs(lng) <= 180 && (lat != 0 || lng != 0) {
+			meta.Latitude, meta.Longitude = &lat, &lng
+		}
+	}
+	return nil
+}
+
+// parseExifTime parses the EXIF date time, in the local time zone if the offset is unknown
+func parseExifTime(value, offset string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if offset = strings.TrimSpace(offset); offset != "" {
+		if t, e := time.Parse(exifDateFormat+"-07:00", value+offset); e == nil {
+			return t, true
+		}
+	}
+	t, e := time.ParseInLocation(exifDateFormat, value, time.Local)
+	if e != nil || t.Year() < 1900 {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+type tiffReader struct {
+	r     *io.SectionReader
+	order binary.ByteOrder
+}
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	// value is the value of the entry, it's read from the offset if larger than 4 bytes
+	value []byte
+}
+
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t *tiffReader) readIFD(offset int64) (map[uint16]tiffEntry, error) {
+	n := make([]byte, 2)
+	if _, e := t.r.ReadAt(n, offset); e != nil {
+		return nil, e
+	}
+	count := int(t.order.Uint16(n))
+	if count > exifMaxEntries {
+		return nil, errInvalidExif
+	}
+	data := make([]byte, count*12)
+	if _, e := t.r.ReadAt(data, offset+2); e != nil {
+		return nil, e
+	}
+	entries := make(map[uint16]tiffEntry, count)
+	for i := 0; i < count; i++ {
+		d := data[i*12 : i*12+12]
+		entry := tiffEntry{typ: t.order.Uint16(d[2:]), count: t.order.Uint32(d[4:])}
+		size, ok := tiffTypeSizes[entry.typ]
+		if !ok || entry.count == 0 || entry.count > 1<<16 {
+			continue
+		}
+		size *= entry.count
+		if size <= 4 {
+			entry.value = d[8 : 8+size]
+		} else {
+			entry.value = make([]byte, size)
+			if _, e := t.r.ReadAt(entry.value, int64(t.order.Uint32(d[8:]))); e != nil {
+				continue
+			}
+		}
+		entries[t.order.Uint16(d)] = entry
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) string(entry tiffEntry) string {
+	if entry.typ != 2 {
+		return ""
+	}
+	s, _, _ := bytes.Cut(entry.value, []byte{0})
+	return strings.TrimSpace(string(s))
+}
+
+func (t *tiffReader) uint(entry tiffEntry) uint32 {
+	switch entry.typ {
+	case 3:
+		return uint32(t.order.Uint16(entry.value))
+	case 4:
+		return t.order.Uint32(entry.value)
+	}
+	return 0
+}
+
+func (t *tiffReader) rational(data []byte) float64 {
+	denominator := t.order.Uint32(data[4:])
+	if denominator == 0 {
+		return 0
+	}
+	return float64(t.order.Uint32(data)) / float64(denominator)
+}
+
+// degrees converts the degrees, minutes and seconds to degrees, which is negative for the negative ref
+func (t *tiffReader) degrees(entry tiffEntry, ref, negativeRef string) (float64, bool) {
+	if entry.typ != 5 || entry.count < 3 {
+		return 0, false
+	}
+	v := t.rational(entry.value) + t.rational(entry.value[8:])/60 + t.rational(entry.value[16:])/3600
+	if strings.EqualFold(ref, negativeRef) {
+		v = -v
+	}
+	return v, true
+}
@@ -0,0 +1,276 @@
+package metadata
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/event"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	extractTimeout = 30 * time.Second
+	// maxBackgroundExtractions limits the extractions started by GetCached
+	maxBackgroundExtractions = 4
+)
+
+var extractorFactories = make(map[string]ExtractorFactory)
+
+func RegisterExtractor(name string, factory ExtractorFactory) {
+	if _, ok := extractorFactories[name]; ok {
+		panic("ExtractorFactory " + name + " already registered")
+	}
+	extractorFactories[name] = factory
+}
+
+type ExtractorFactory = func(config types.SM) (Extractor, error)
+
+type Extractor interface {
+	// Extract reads the metadata from the content of the file, and fills meta.
+	// Returns err.UnsupportedError if the content is not supported by this Extractor
+	Extract(ctx context.Context, r *io.SectionReader, meta *types.MediaMeta) error
+	// FileTypes returns the file extensions supported by default
+	FileTypes() []string
+}
+
+// Service extracts the media metadata of the files and caches it by the path, modification time and size
+type Service struct {
+	// extractors is map[extension][]Extractor
+	extractors map[string][]Extractor
+	dao        *storage.MediaMetadataDAO
+
+	// pending is the paths being extracted in background
+	pending map[string]struct{}
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	unsubscribe event.Unsubscribe
+}
+
+func NewService(config common.Config, dao *storage.MediaMetadataDAO, bus event.Bus,
+	ch *registry.ComponentsHolder) (*Service, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Service{pending: make(map[string]struct{}), ctx: ctx, cancel: cancel}
+	if config.Metadata.Enabled {
+		extractors, e := createExtractors(config.Metadata.Extractors)
+		if e != nil {
+			return nil, e
+		}
+		s.extractors = extractors
+		s.dao = dao
+		s.unsubscribe = bus.SubscribeEntryDeleted(s.onDeleted)
+	}
+	ch.Add(registry.KeyMediaMetadata, s)
+	return s, nil
+}
+
+func createExtractors(items []common.MetadataExtractorItem) (map[string][]Extractor, error) {
+	if len(items) == 0 {
+		names := utils.MapKeys(extractorFactories)
+		sort.Strings(names)
+		for _, name := range names {
+			items = append(items, common.MetadataExtractorItem{Type: name})
+		}
+	}
+	extractors := make(map[string][]Extractor)
+	for _, item := range items {
+		factory, ok := extractorFactories[item.Type]
+		if !ok {
+			availableTypes := utils.MapKeys(extractorFactories)
+			sort.Strings(availableTypes)
+			return nil, fmt.Errorf("unknown metadata extractor type: %s. Available types are %v",
+				item.Type, availableTypes)
+		}
+		extractor, e := factory(item.Config)
+		if e != nil {
+			return nil, errors.New("failed to create metadata extractor " + item.Type + ": " + e.Error())
+		}
+		fileTypes := extractor.FileTypes()
+		if item.FileTypes != "" {
+			fileTypes = strings.Split(item.FileTypes, ",")
+		}
+		for _, ext := range fileTypes {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext != "" {
+				extractors[ext] = append(extractors[ext], extractor)
+			}
+		}
+	}
+	return extractors, nil
+}
+
+// Enabled reports whether the metadata extraction is enabled
+func (s *Service) Enabled() bool {
+	return s.extractors != nil
+}
+
+// Supports reports whether the metadata of the entry can be extracted
+func (s *Service) Supports(entry types.IEntry) bool {
+	if !s.Enabled() || !entry.Type().IsFile() {
+		return false
+	}
+	_, ok := s.extractors[utils.PathExt(entry.Path())]
+	return ok
+}
+
+// Get returns the metadata of the entry, from the cache if the file is not changed.
+// It returns nil if the entry is not supported or nothing is extracted.
+func (s *Service) Get(ctx context.Context, entry types.IEntry) (*types.MediaMeta, error) {
+	if !s.Supports(entry) {
+		return nil, nil
+	}
+	meta, ok, e := s.getCached(entry)
+	if e != nil || ok {
+		return meta, e
+	}
+	return s.extractAndSave(ctx, entry)
+}
+
+// GetCached returns the cached metadata of the entry without reading the file.
+// If the metadata is not cached, nil is returned and the metadata is extracted in background.
+func (s *Service) GetCached(entry types.IEntry) (*types.MediaMeta, error) {
+	if !s.Supports(entry) {
+		return nil, nil
+	}
+	meta, ok, e := s.getCached(entry)
+	if e != nil || ok {
+		return meta, e
+	}
+	s.extractInBackground(entry)
+	return nil, nil
+}
+
+// getCached returns the cached metadata, ok is false if it's not cached or the file is changed
+func (s *Service) getCached(entry types.IEntry) (meta *types.MediaMeta, ok bool, e error) {
+	cached, e := s.dao.Get(globalPath(entry))
+	if e != nil || cached == nil || cached.ModTime != entry.ModTime() || cached.Size != entry.Size() {
+		return nil, false, e
+	}
+	meta, e = decodeMeta(cached.Data)
+	return meta, true, e
+}
+
+func (s *Service) extractInBackground(entry types.IEntry) {
+	path := globalPath(entry)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the skipped entries are extracted next time
+	if _, ok := s.pending[path]; ok || len(s.pending) >= maxBackgroundExtractions || s.ctx.Err() != nil {
+		return
+	}
+	s.pending[path] = struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.pending, path)
+			s.mu.Unlock()
+		}()
+		if _, e := s.extractAndSave(s.ctx, entry); e != nil && s.ctx.Err() == nil {
+			log.Printf("[Metadata] failed to extract the metadata of %s: %s", utils.LogSanitize(path), e)
+		}
+	}()
+}
+
+func (s *Service) extractAndSave(ctx context.Context, entry types.IEntry) (*types.MediaMeta, error) {
+	path := globalPath(entry)
+	meta, cacheable, e := s.extract(ctx, entry)
+	if !cacheable {
+		return nil, e
+	}
+	if e != nil {
+		// the unsupported or invalid files are cached as nothing extracted, they are retried when the file changes
+		log.Printf("[Metadata] failed to extract the metadata of %s: %s", utils.LogSanitize(path), e)
+	}
+	data := ""
+	if !meta.IsEmpty() {
+		v, e := json.Marshal(meta)
+		if e != nil {
+			return nil, e
+		}
+		data = string(v)
+	}
+	if e := s.dao.Set(types.MediaMetadata{
+		Path: path, ModTime: entry.ModTime(), Size: entry.Size(), Data: data,
+	}); e != nil {
+		return nil, e
+	}
+	if meta.IsEmpty() {
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+// extract reads the metadata of the entry. The result is not cacheable if the content can't be read,
+// or the extraction is timed out or canceled.
+func (s *Service) extract(ctx context.Context, entry types.IEntry) (meta types.MediaMeta, cacheable bool, e error) {
+	ctx, cancel := context.WithTimeout(ctx, extractTimeout)
+	defer cancel()
+	ra := newEntryReaderAt(ctx, entry)
+	r := io.NewSectionReader(ra, 0, entry.Size())
+	for _, extractor := range s.extractors[utils.PathExt(entry.Path())] {
+		e = extractor.Extract(ctx, r, &meta)
+		if !err.IsUnsupportedError(e) {
+			break
+		}
+		e = nil
+	}
+	if re := cmp.Or(ctx.Err(), ra.e); re != nil {
+		return meta, false, cmp.Or(e, re)
+	}
+	return meta, true, e
+}
+
+func decodeMeta(data string) (*types.MediaMeta, error) {
+	if data == "" {
+		return nil, nil
+	}
+	meta := types.MediaMeta{}
+	if e := json.Unmarshal([]byte(data), &meta); e != nil {
+		return nil, e
+	}
+	return &meta, nil
+}
+
+// globalPath returns the path of the entry in the root drive, which is the cache key
+func globalPath(entry types.IEntry) string {
+	if de := driveutil.GetIEntry(entry, func(e types.IEntry) bool {
+		_, ok := e.(types.IDispatcherEntry)
+		return ok
+	}); de != nil {
+		return de.Path()
+	}
+	return entry.Path()
+}
+
+func (s *Service) onDeleted(_ types.DriveListenerContext, path string) {
+	if e := s.dao.Delete(path); e != nil {
+		log.Printf("[Metadata] failed to delete the metadata of %s: %s", utils.LogSanitize(path), e)
+	}
+}
+
+func (s *Service) Dispose() error {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
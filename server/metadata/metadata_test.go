@@ -0,0 +1,505 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	err "go-drive/common/errors"
+	"go-drive/common/event"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"io"
+	"math"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func extract(t *testing.T, x Extractor, data []byte) types.MediaMeta {
+	t.Helper()
+	meta := types.MediaMeta{}
+	if e := x.Extract(context.Background(), io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), &meta); e != nil {
+		t.Fatal(e)
+	}
+	return meta
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+type testTag struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// appendIFD appends the IFD and the values larger than 4 bytes after it
+func appendIFD(buf []byte, tags []testTag) []byte {
+	o := binary.BigEndian
+	dataOffset := len(buf) + 2 + 12*len(tags) + 4
+	var data []byte
+	buf = o.AppendUint16(buf, uint16(len(tags)))
+	for _, tag := range tags {
+		buf = o.AppendUint16(buf, tag.tag)
+		buf = o.AppendUint16(buf, tag.typ)
+		buf = o.AppendUint32(buf, tag.count)
+		if len(tag.value) <= 4 {
+			buf = append(buf, append(tag.value, make([]byte, 4-len(tag.value))...)...)
+		} else {
+			buf = o.AppendUint32(buf, uint32(dataOffset+len(data)))
+			data = append(data, tag.value...)
+		}
+	}
+	buf = o.AppendUint32(buf, 0)
+	return append(buf, data...)
+}
+
+func asciiTag(tag uint16, v string) testTag {
+	return testTag{tag, 2, uint32(len(v) + 1), append([]byte(v), 0)}
+}
+
+func longTag(tag uint16, v uint32) testTag {
+	return testTag{tag, 4, 1, binary.BigEndian.AppendUint32(nil, v)}
+}
+
+func rationalTag(tag uint16, values ...uint32) testTag {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return testTag{tag, 5, uint32(len(values) / 2), b}
+}
+
+func buildExifJPEG() []byte {
+	tiff := []byte("MM\x00*\x00\x00\x00\x00")
+	exifOffset := len(tiff)
+	tiff = appendIFD(tiff, []testTag{
+		asciiTag(tagDateTimeOrig, "2023:05:01 10:20:30"),
+		asciiTag(tagOffsetTimeOrig, "+08:00"),
+	})
+	gpsOffset := len(tiff)
+	tiff = appendIFD(tiff, []testTag{
+		asciiTag(tagGPSLatitudeRef, "N"),
+		rationalTag(tagGPSLatitude, 35, 1, 41, 1, 2235, 100),
+		asciiTag(tagGPSLongitudeRef, "W"),
+		rationalTag(tagGPSLongitude, 139, 1, 41, 1, 3054, 100),
+	})
+	binary.BigEndian.PutUint32(tiff[4:], uint32(len(tiff)))
+	tiff = appendIFD(tiff, []testTag{
+		asciiTag(tagMake, "FUJIFILM"),
+		asciiTag(tagModel, "X100V"),
+		{tagOrientation, 3, 1, []byte{0, 6}},
+		asciiTag(tagDateTime, "2024:01:01 00:00:00"),
+		longTag(tagExifIFD, uint32(exifOffset)),
+		longTag(tagGPSIFD, uint32(gpsOffset)),
+	})
+
+	jpeg := []byte{0xff, 0xd8}
+	jpeg = append(jpeg, 0xff, 0xe1)
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(2+6+len(tiff)))
+	jpeg = append(jpeg, "Exif\x00\x00"...)
+	jpeg = append(jpeg, tiff...)
+	// SOF0 of 6000x4000
+	jpeg = append(jpeg, 0xff, 0xc0, 0, 17, 8, 0x0f, 0xa0, 0x17, 0x70)
+	jpeg = append(jpeg, make([]byte, 10)...)
+	jpeg = append(jpeg, 0xff, 0xda, 0, 2)
+	return jpeg
+}
+
+func TestExifExtractor(t *testing.T) {
+	x, _ := newExifExtractor(nil)
+	meta := extract(t, x, buildExifJPEG())
+	if meta.Camera() != "FUJIFILM X100V" || meta.Orientation != 6 || meta.Width != 6000 || meta.Height != 4000 {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if want := time.Date(2023, 5, 1, 2, 20, 30, 0, time.UTC); meta.TakenAt == nil || !meta.TakenAt.Equal(want) {
+		t.Errorf("takenAt: got %v, want %v", meta.TakenAt, want)
+	}
+	if meta.Latitude == nil || !approx(*meta.Latitude, 35+41.0/60+22.35/3600) ||
+		meta.Longitude == nil || !approx(*meta.Longitude, -(139+41.0/60+30.54/3600)) {
+		t.Errorf("unexpected location: %v, %v", meta.Latitude, meta.Longitude)
+	}
+
+	meta = types.MediaMeta{}
+	e := x.Extract(context.Background(), io.NewSectionReader(bytes.NewReader([]byte("\x89PNG")), 0, 4), &meta)
+	if !err.IsUnsupportedError(e) {
+		t.Errorf("expected unsupported error, got %v", e)
+	}
+}
+
+func id3Frame(id string, encoding byte, text []byte) []byte {
+	b := []byte(id)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(text)+1))
+	b = append(b, 0, 0, encoding)
+	return append(b, text...)
+}
+
+func utf16LE(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+// mp3Frame returns a MPEG-1 layer III frame of 128kbps and 44100Hz, with the Xing header if frames > 0
+func mp3Frame(frames uint32) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	if frames > 0 {
+		copy(frame[36:], "Xing\x00\x00\x00\x01")
+		binary.BigEndian.PutUint32(frame[44:], frames)
+	}
+	return frame
+}
+
+func TestAudioExtractor_MP3(t *testing.T) {
+	var frames []byte
+	frames = append(frames, id3Frame("TIT2", 0, []byte("Song"))...)
+	frames = append(frames, id3Frame("TPE1", 1, utf16LE("Artiste é"))...)
+	frames = append(frames, id3Frame("TALB", 3, []byte("专辑"))...)
+	frames = append(frames, id3Frame("TCON", 0, []byte("(17)"))...)
+	frames = append(frames, id3Frame("TRCK", 0, []byte("3/12"))...)
+	frames = append(frames, id3Frame("TYER", 0, []byte("2004"))...)
+	frames = append(frames, make([]byte, 32)...)
+	size := len(frames)
+	data := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f),
+		byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	data = append(data, frames...)
+	data = append(data, mp3Frame(100)...)
+
+	x, _ := newAudioExtractor(nil)
+	meta := extract(t, x, data)
+	want := types.MediaMeta{Title: "Song", Artist: "Artiste é", Album: "专辑", Genre: "Rock", Track: 3, Year: 2004,
+		AudioCodec: "mp3"}
+	duration := meta.Duration
+	meta.Duration = 0
+	if meta != want {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+	if !approx(duration, 100*1152/44100.0) {
+		t.Errorf("duration: got %v", duration)
+	}
+
+	// CBR with ID3v1
+	data = nil
+	for i := 0; i < 10; i++ {
+		data = append(data, mp3Frame(0)...)
+	}
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], "Old Song")
+	copy(tag[93:], "1999")
+	tag[126] = 7
+	meta = extract(t, x, append(data, tag...))
+	if meta.Title != "Old Song" || meta.Year != 1999 || meta.Track != 7 ||
+		!approx(meta.Duration, float64(len(data)+128)*8/128000) {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+}
+
+func TestAudioExtractor_FLAC(t *testing.T) {
+	data := []byte("fLaC")
+	data = append(data, 0, 0, 0, 34)
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint64(info[10:], uint64(44100)<<44|uint64(1)<<41|uint64(15)<<36|441000)
+	data = append(data, info...)
+
+	var comment []byte
+	comment = binary.LittleEndian.AppendUint32(comment, 6)
+	comment = append(comment, "vendor"...)
+	tags := []string{"TITLE=Song", "artist=Artist", "ALBUM=Album", "TRACKNUMBER=5", "DATE=2010-01-02"}
+	comment = binary.LittleEndian.AppendUint32(comment, uint32(len(tags)))
+	for _, tag := range tags {
+		comment = binary.LittleEndian.AppendUint32(comment, uint32(len(tag)))
+		comment = append(comment, tag...)
+	}
+	data = append(data, 0x84, 0, byte(len(comment)>>8), byte(len(comment)))
+	data = append(data, comment...)
+
+	x, _ := newAudioExtractor(nil)
+	meta := extract(t, x, data)
+	want := types.MediaMeta{Title: "Song", Artist: "Artist", Album: "Album", Track: 5, Year: 2010,
+		Duration: 10, AudioCodec: "flac"}
+	if meta != want {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)+8))
+	b = append(b, typ...)
+	return append(b, data...)
+}
+
+func dataBox(dataType uint32, value []byte) []byte {
+	return box("data", binary.BigEndian.AppendUint32(nil, dataType), make([]byte, 4), value)
+}
+
+func buildMP4() []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 5500)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+	hdlr := func(handler string) []byte {
+		return box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 12))
+	}
+	stsd := func(codec string) []byte {
+		return box("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 1}, box(codec, make([]byte, 8)))
+	}
+	keys := []byte{0, 0, 0, 0, 0, 0, 0, 4}
+	for _, key := range []string{"com.apple.quicktime.make", "com.apple.quicktime.model",
+		"com.apple.quicktime.location.ISO6709", "com.apple.quicktime.creationdate"} {
+		keys = binary.BigEndian.AppendUint32(keys, uint32(len(key)+8))
+		keys = append(keys, "mdta"...)
+		keys = append(keys, key...)
+	}
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("qt  \x00\x00\x00\x00")),
+		box("mdat", make([]byte, 64)),
+		box("moov",
+			box("mvhd", mvhd),
+			box("trak", box("tkhd", tkhd), box("mdia", hdlr("vide"), box("minf", box("stbl", stsd("hvc1"))))),
+			box("trak", box("mdia", hdlr("soun"), box("minf", box("stbl", stsd("mp4a"))))),
+			box("meta", hdlr("mdta"), box("keys", keys), box("ilst",
+				box("\x00\x00\x00\x01", dataBox(1, []byte("Apple"))),
+				box("\x00\x00\x00\x02", dataBox(1, []byte("iPhone 15"))),
+				box("\x00\x00\x00\x03", dataBox(1, []byte("+35.6895-139.6917+040.000/"))),
+				box("\x00\x00\x00\x04", dataBox(1, []byte("2023-05-01T10:20:30+0800"))),
+			)),
+			box("udta", box("meta", make([]byte, 4), hdlr("mdir"), box("ilst",
+				box("\xa9nam", dataBox(1, []byte("Clip"))),
+				box("trkn", dataBox(0, []byte{0, 0, 0, 2, 0, 9, 0, 0})),
+			))),
+		),
+	}, nil)
+}
+
+func TestMP4Extractor(t *testing.T) {
+	x, _ := newMP4Extractor(nil)
+	meta := extract(t, x, buildMP4())
+	if meta.Camera() != "Apple iPhone 15" || meta.Width != 1920 || meta.Height != 1080 ||
+		meta.VideoCodec != "hevc" || meta.AudioCodec != "aac" || meta.Duration != 5.5 ||
+		meta.Title != "Clip" || meta.Track != 2 {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if want := time.Date(2023, 5, 1, 2, 20, 30, 0, time.UTC); meta.TakenAt == nil || !meta.TakenAt.Equal(want) {
+		t.Errorf("takenAt: got %v, want %v", meta.TakenAt, want)
+	}
+	if meta.Latitude == nil || *meta.Latitude != 35.6895 || meta.Longitude == nil || *meta.Longitude != -139.6917 {
+		t.Errorf("unexpected location: %v, %v", meta.Latitude, meta.Longitude)
+	}
+}
+
+type testEntry struct {
+	types.IEntry
+	path    string
+	modTime int64
+	data    []byte
+	reads   int
+	readErr error
+}
+
+func (e *testEntry) Path() string          { return e.path }
+func (e *testEntry) Type() types.EntryType { return types.TypeFile }
+func (e *testEntry) Size() int64           { return int64(len(e.data)) }
+func (e *testEntry) ModTime() int64        { return e.modTime }
+
+func (e *testEntry) GetURL(context.Context) (*types.ContentURL, error) {
+	return nil, err.NewUnsupportedError()
+}
+
+func (e *testEntry) GetReader(_ context.Context, start, size int64) (io.ReadCloser, error) {
+	e.reads++
+	if e.readErr != nil {
+		return nil, e.readErr
+	}
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(e.data), start, size)), nil
+}
+
+func TestService_Get(t *testing.T) {
+	config := testutil.DefaultTestConfig()
+	config.DataDir = t.TempDir()
+	config.Metadata.Enabled = true
+	ch := registry.NewComponentHolder()
+	defer func() { _ = ch.Dispose() }()
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	s, e := NewService(config, storage.NewMediaMetadataDAO(db, ch), event.NewBus(ch), ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ctx := context.Background()
+
+	entry := &testEntry{path: "photos/a.JPG", modTime: 1, data: buildExifJPEG()}
+	for i := 0; i < 2; i++ {
+		meta, e := s.Get(ctx, entry)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if meta == nil || meta.CameraModel != "X100V" {
+			t.Fatalf("unexpected metadata: %+v", meta)
+		}
+	}
+	if entry.reads != 1 {
+		t.Errorf("the cached metadata is not used, %d reads", entry.reads)
+	}
+
+	// the file is changed
+	entry.modTime = 2
+	entry.data = []byte("not a jpeg")
+	for i := 0; i < 2; i++ {
+		if meta, e := s.Get(ctx, entry); e != nil || meta != nil {
+			t.Fatalf("got %+v, %v", meta, e)
+		}
+	}
+	if entry.reads != 2 {
+		t.Errorf("the empty result is not cached, %d reads", entry.reads)
+	}
+
+	// the read failures are not cached
+	failed := &testEntry{path: "photos/b.jpg", modTime: 1, data: buildExifJPEG(), readErr: errors.New("network error")}
+	if meta, e := s.Get(ctx, failed); e == nil || meta != nil {
+		t.Fatalf("got %+v, %v", meta, e)
+	}
+	if cached, _ := s.dao.Get("photos/b.jpg"); cached != nil {
+		t.Error("the read failure is cached")
+	}
+
+	// GetCached returns nothing until the metadata is extracted in background
+	failed.readErr = nil
+	if meta, e := s.GetCached(failed); e != nil || meta != nil {
+		t.Fatalf("got %+v, %v", meta, e)
+	}
+	s.wg.Wait()
+	if meta, e := s.GetCached(failed); e != nil || meta == nil || meta.CameraModel != "X100V" {
+		t.Fatalf("got %+v, %v", meta, e)
+	}
+
+	s.onDeleted(types.DriveListenerContext{}, "photos")
+	if cached, _ := s.dao.Get("photos/a.JPG"); cached != nil {
+		t.Error("the metadata of the deleted entry is not removed")
+	}
+
+	if s.Supports(&testEntry{path: "a.txt"}) {
+		t.Error("a.txt should not be supported")
+	}
+}
+
+func flacPictureBlock(pictureType uint32, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, pictureType)
+	b = binary.BigEndian.AppendUint32(b, 10)
+	b = append(b, "image/jpeg"...)
+	b = binary.BigEndian.AppendUint32(b, 5)
+	b = append(b, "cover"...)
+	b = append(b, make([]byte, 16)...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// oggStream returns the pages of a logical stream containing the packets
+func oggStream(packets ...[]byte) []byte {
+	var segments [][]byte
+	for _, p := range packets {
+		for {
+			n := min(len(p), 255)
+			segments = append(segments, p[:n])
+			p = p[n:]
+			if n < 255 {
+				break
+			}
+		}
+	}
+	var out []byte
+	for len(segments) > 0 {
+		page := segments[:min(len(segments), 255)]
+		segments = segments[len(page):]
+		out = append(out, "OggS"...)
+		// version, header type and granule position
+		out = append(out, make([]byte, 10)...)
+		out = binary.LittleEndian.AppendUint32(out, 1)
+		// sequence number and checksum
+		out = append(out, make([]byte, 8)...)
+		out = append(out, byte(len(page)))
+		for _, s := range page {
+			out = append(out, byte(len(s)))
+		}
+		for _, s := range page {
+			out = append(out, s...)
+		}
+	}
+	return out
+}
+
+func TestReadCover(t *testing.T) {
+	front := bytes.Repeat([]byte("front"), 20000)
+	back := []byte("back")
+
+	id3 := id3Frame("APIC", 1, bytes.Join([][]byte{[]byte("image/png\x00\x04"), utf16LE("back\x00"), back}, nil))
+	id3 = append(id3, id3Frame("APIC", 0, append([]byte("image/jpeg\x00\x03desc\x00"), front...))...)
+	size := len(id3)
+	mp3 := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f),
+		byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	mp3 = append(append(mp3, id3...), mp3Frame(0)...)
+
+	picture := flacPictureBlock(3, front)
+	flac := append([]byte("fLaC\x00\x00\x00\x22"), make([]byte, 34)...)
+	flac = append(flac, 0x86, byte(len(picture)>>16), byte(len(picture)>>8), byte(len(picture)))
+	flac = append(flac, picture...)
+
+	tag := "METADATA_BLOCK_PICTURE=" + base64.StdEncoding.EncodeToString(flacPictureBlock(3, front))
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, 6)
+	tags = append(tags, "vendor"...)
+	tags = binary.LittleEndian.AppendUint32(tags, 2)
+	for _, v := range []string{"TITLE=Song", tag} {
+		tags = binary.LittleEndian.AppendUint32(tags, uint32(len(v)))
+		tags = append(tags, v...)
+	}
+	ogg := oggStream([]byte("OpusHead\x01\x02"), tags, make([]byte, 100))
+
+	mp4 := bytes.Join([][]byte{
+		box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		box("mdat", make([]byte, 1024*1024)),
+		box("moov", box("udta", box("meta", make([]byte, 4), box("ilst",
+			box("\xa9nam", dataBox(1, []byte("Song"))),
+			box("covr", dataBox(13, front), dataBox(14, back)),
+		)))),
+	}, nil)
+
+	for name, data := range map[string][]byte{"a.mp3": mp3, "a.flac": flac, "a.opus": ogg, "a.m4a": mp4} {
+		entry := &testEntry{path: name, data: data}
+		got, e := ReadCover(context.Background(), entry)
+		if e != nil {
+			t.Errorf("%s: %v", name, e)
+			continue
+		}
+		if !bytes.Equal(got, front) {
+			t.Errorf("%s: unexpected cover of %d bytes", name, len(got))
+		}
+	}
+
+	// the metadata at the end of the file is read by ranges
+	entry := &testEntry{path: "a.m4a", data: mp4}
+	if _, e := ReadCover(context.Background(), entry); e != nil || entry.reads > 3 {
+		t.Errorf("unexpected reads: %d, %v", entry.reads, e)
+	}
+
+	if _, e := ReadCover(context.Background(), &testEntry{path: "a.mp3", data: mp3Frame(0)}); !err.IsNotFoundError(e) {
+		t.Errorf("expected not found error, got %v", e)
+	}
+	if _, e := ReadCover(context.Background(), &testEntry{path: "a.wav"}); !err.IsUnsupportedError(e) {
+		t.Errorf("expected unsupported error, got %v", e)
+	}
+}
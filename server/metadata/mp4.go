@@ -0,0 +1,379 @@
+package metadata
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterExtractor("mp4", newMP4Extractor)
+}
+
+const (
+	// mp4MaxBoxSize limits the size of the boxes read into memory
+	mp4MaxBoxSize = 1024 * 1024
+	// mp4Epoch is the epoch of the times in the boxes, seconds since 1904-01-01
+	mp4Epoch = -2082844800
+)
+
+var (
+	errInvalidMP4 = errors.New("invalid MP4 data")
+
+	iso6709Pattern = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)`)
+
+	mp4Codecs = map[string]string{
+		"avc1": "h264", "avc3": "h264", "hvc1": "hevc", "hev1": "hevc", "mp4v": "mpeg4", "av01": "av1",
+		"vp08": "vp8", "vp09": "vp9", "mp4a": "aac", "ac-3": "ac3", "ec-3": "eac3", "Opus": "opus",
+		"alac": "alac", "fLaC": "flac", ".mp3": "mp3",
+	}
+)
+
+// mp4Extractor reads the duration, the codecs, the video size, the tags and the QuickTime metadata
+// of the ISO base media files, including MP4, M4A and MOV
+type mp4Extractor struct {
+}
+
+func newMP4Extractor(types.SM) (Extractor, error) {
+	return &mp4Extractor{}, nil
+}
+
+func (x *mp4Extractor) FileTypes() []string {
+	return []string{"mp4", "m4v", "m4a", "m4b", "mov", "3gp"}
+}
+
+func (x *mp4Extractor) Extract(_ context.Context, r *io.SectionReader, meta *types.MediaMeta) error {
+	header := make([]byte, 8)
+	if _, e := r.ReadAt(header, 0); e != nil {
+		return err.NewUnsupportedError()
+	}
+	switch string(header[4:]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+	default:
+		return err.NewUnsupportedError()
+	}
+	m := &mp4Reader{r: r, meta: meta}
+	return m.walk(0, r.Size(), func(typ string, start, end int64) error {
+		if typ == "moov" {
+			return m.readMoov(start, end)
+		}
+		return nil
+	})
+}
+
+type mp4Reader struct {
+	r    *io.SectionReader
+	meta *types.MediaMeta
+	// keys are the keys of the QuickTime metadata, the items of ilst refer to them by the 1-based index
+	keys []string
+}
+
+// walk calls fn with the type and the payload range of the boxes between start and end
+func (m *mp4Reader) walk(start, end int64, fn func(typ string, start, end int64) error) error {
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, e := m.r.ReadAt(header[:8], pos); e != nil {
+			return e
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, e := m.r.ReadAt(header[8:], pos+8); e != nil {
+				return e
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if size < headerSize || pos+size > end {
+			return errInvalidMP4
+		}
+		if e := fn(typ, pos+headerSize, pos+size); e != nil {
+			return e
+		}
+		pos += size
+	}
+	return nil
+}
+
+func (m *mp4Reader) read(start, end int64) ([]byte, error) {
+	if end-start > mp4MaxBoxSize {
+		return nil, errInvalidMP4
+	}
+	data := make([]byte, end-start)
+	if _, e := m.r.ReadAt(data, start); e != nil {
+		return nil, e
+	}
+	return data, nil
+}
+
+func (m *mp4Reader) readMoov(start, end int64) error {
+	return m.walk(start, end, func(typ string, start, end int64) error {
+		switch typ {
+		case "mvhd":
+			return m.readMvhd(start, end)
+		case "trak":
+			return m.readTrak(start, end)
+		case "udta":
+			return m.readUdta(start, end)
+		case "meta":
+			return m.readMeta(start, end)
+		}
+		return nil
+	})
+}
+
+func (m *mp4Reader) readMvhd(start, end int64) error {
+	data, e := m.read(start, end)
+	if e != nil {
+		return e
+	}
+	var created, timescale, duration uint64
+	if len(data) >= 32 && data[0] == 1 {
+		created = binary.BigEndian.Uint64(data[4:])
+		timescale = uint64(binary.BigEndian.Uint32(data[20:]))
+		duration = binary.BigEndian.Uint64(data[24:])
+	} else if len(data) >= 20 {
+		created = uint64(binary.BigEndian.Uint32(data[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(data[12:]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	} else {
+		return errInvalidMP4
+	}
+	if timescale > 0 {
+		m.meta.Duration = float64(duration) / float64(timescale)
+	}
+	// some encoders write zero or the time since 1970
+	if created > -mp4Epoch && m.meta.TakenAt == nil {
+		t := time.Unix(int64(created)+mp4Epoch, 0)
+		m.meta.TakenAt = &t
+	}
+	return nil
+}
+
+func (m *mp4Reader) readTrak(start, end int64) error {
+	var width, height int
+	handler, codec := "", ""
+	var walkTrak func(start, end int64) error
+	walkTrak = func(start, end int64) error {
+		return m.walk(start, end, func(typ string, start, end int64) error {
+			switch typ {
+			case "mdia", "minf", "stbl":
+				return walkTrak(start, end)
+			case "tkhd":
+				data, e := m.read(start, end)
+				if e != nil {
+					return e
+				}
+				offset := 76
+				if len(data) > 0 && data[0] == 1 {
+					offset = 88
+				}
+				if len(data) >= offset+8 {
+					width = int(binary.BigEndian.Uint32(data[offset:]) >> 16)
+					height = int(binary.BigEndian.Uint32(data[offset+4:]) >> 16)
+				}
+			case "hdlr":
+				data, e := m.read(start, min(end, start+12))
+				if e != nil {
+					return e
+				}
+				if len(data) == 12 {
+					handler = string(data[8:12])
+				}
+			case "stsd":
+				data, e := m.read(start, min(end, start+16))
+				if e != nil {
+					return e
+				}
+				if len(data) == 16 {
+					codec = string(data[12:16])
+				}
+			}
+			return nil
+		})
+	}
+	if e := walkTrak(start, end); e != nil {
+		return e
+	}
+	if c, ok := mp4Codecs[codec]; ok {
+		codec = c
+	}
+	codec = strings.TrimSpace(codec)
+	switch handler {
+	case "vide":
+		if m.meta.VideoCodec == "" {
+			m.meta.VideoCodec = codec
+			m.meta.Width, m.meta.Height = width, height
+		}
+	case "soun":
+		if m.meta.AudioCodec == "" {
+			m.meta.AudioCodec = codec
+		}
+	}
+	return nil
+}
+
+func (m *mp4Reader) readUdta(start, end int64) error {
+	return m.walk(start, end, func(typ string, start, end int64) error {
+		switch typ {
+		case "meta":
+			return m.readMeta(start, end)
+		case "\xa9xyz":
+			// 2 bytes of the size and 2 bytes of the language
+			data, e := m.read(start, end)
+			if e != nil {
+				return e
+			}
+			if len(data) > 4 {
+				m.setLocation(string(data[4:]))
+			}
+		}
+		return nil
+	})
+}
+
+func (m *mp4Reader) readMeta(start, end int64) error {
+	start, e := m.metaChildren(start)
+	if e != nil {
+		return e
+	}
+	return m.walk(start, end, func(typ string, start, end int64) error {
+		switch typ {
+		case "keys":
+			return m.readKeys(start, end)
+		case "ilst":
+			return m.readIlst(start, end)
+		}
+		return nil
+	})
+}
+
+// metaChildren returns the start of the children of the meta box,
+// which is a full box in MP4 but not in QuickTime
+func (m *mp4Reader) metaChildren(start int64) (int64, error) {
+	header := make([]byte, 8)
+	if _, e := m.r.ReadAt(header, start); e != nil {
+		return 0, e
+	}
+	if string(header[4:]) != "hdlr" {
+		start += 4
+	}
+	return start, nil
+}
+
+func (m *mp4Reader) readKeys(start, end int64) error {
+	data, e := m.read(start, end)
+	if e != nil {
+		return e
+	}
+	if len(data) < 8 {
+		return errInvalidMP4
+	}
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	data = data[8:]
+	m.keys = nil
+	for i := 0; i < count && len(data) >= 8; i++ {
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			break
+		}
+		m.keys = append(m.keys, string(data[8:size]))
+		data = data[size:]
+	}
+	return nil
+}
+
+func (m *mp4Reader) readIlst(start, end int64) error {
+	return m.walk(start, end, func(typ string, start, end int64) error {
+		var value []byte
+		var dataType uint32
+		e := m.walk(start, end, func(t string, start, end int64) error {
+			if t != "data" || value != nil {
+				return nil
+			}
+			data, e := m.read(start, end)
+			if e != nil {
+				return e
+			}
+			if len(data) >= 8 {
+				dataType = binary.BigEndian.Uint32(data) & 0xffffff
+				value = data[8:]
+			}
+			return nil
+		})
+		if e != nil || value == nil {
+			return e
+		}
+		text := ""
+		// UTF-8
+		if dataType == 1 {
+			text = strings.TrimSpace(string(value))
+		}
+
+		key := typ
+		if index := binary.BigEndian.Uint32([]byte(typ)); len(m.keys) > 0 && index >= 1 && int(index) <= len(m.keys) {
+			key = m.keys[index-1]
+		}
+		switch key {
+		case "\xa9nam":
+			m.meta.Title = text
+		case "\xa9ART":
+			m.meta.Artist = text
+		case "\xa9alb":
+			m.meta.Album = text
+		case "\xa9gen":
+			m.meta.Genre = text
+		case "gnre":
+			if len(value) >= 2 {
+				if i := int(binary.BigEndian.Uint16(value)) - 1; i >= 0 && i < len(id3v1Genres) {
+					m.meta.Genre = id3v1Genres[i]
+				}
+			}
+		case "\xa9day":
+			m.meta.Year = parseLeadingInt(text)
+		case "trkn":
+			if len(value) >= 4 {
+				m.meta.Track = int(binary.BigEndian.Uint16(value[2:]))
+			}
+		case "com.apple.quicktime.make":
+			m.meta.CameraMake = text
+		case "com.apple.quicktime.model":
+			m.meta.CameraModel = text
+		case "com.apple.quicktime.location.ISO6709":
+			m.setLocation(text)
+		case "com.apple.quicktime.creationdate":
+			if t, e := time.Parse("2006-01-02T15:04:05-0700", text); e == nil {
+				m.meta.TakenAt = &t
+			} else if t, e := time.Parse(time.RFC3339, text); e == nil {
+				m.meta.TakenAt = &t
+			}
+		}
+		return nil
+	})
+}
+
+// setLocation sets the location in the ISO 6709 format like "+35.6895+139.6917+040.000/"
+func (m *mp4Reader) setLocation(v string) {
+	matches := iso6709Pattern.FindStringSubmatch(strings.TrimSpace(v))
+	if matches == nil {
+		return
+	}
+	lat, e1 := strconv.ParseFloat(matches[1], 64)
+	lng, e2 := strconv.ParseFloat(matches[2], 64)
+	if e1 != nil || e2 != nil || math.Abs(lat) > 90 || math.Abs(lng) > 180 || (lat == 0 && lng == 0) {
+		return
+	}
+	m.meta.Latitude, m.meta.Longitude = &lat, &lng
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"cmp"
+	"context"
+	"go-drive/common/driveutil"
+	"go-drive/common/types"
+	"io"
+)
+
+const (
+	readerBlockSize = 64 * 1024
+	// readerMaxBlocks limits the memory of the cached blocks
+	readerMaxBlocks = 64
+)
+
+// entryReaderAt reads the content of the entry by ranges,
+// so the metadata at the end of the large files can be read without downloading the whole file.
+// The blocks read are cached since the parsers read the small headers one by one.
+type entryReaderAt struct {
+	ctx     context.Context
+	content types.IContentReader
+	size    int64
+	blocks  map[int64][]byte
+	// e is the first failure of reading the content
+	e error
+}
+
+func newEntryReaderAt(ctx context.Context, entry types.IEntry) *entryReaderAt {
+	return &entryReaderAt{ctx: ctx, content: entry, size: entry.Size(), blocks: make(map[int64][]byte)}
+}
+
+func (r *entryReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		block, e := r.block(pos/readerBlockSize, off+int64(len(p)))
+		if e != nil {
+			return n, e
+		}
+		n += copy(p[n:], block[pos%readerBlockSize:])
+	}
+	return n, nil
+}
+
+// block returns the block of the index, the missing blocks until the end are read by one request
+func (r *entryReaderAt) block(index int64, end int64) ([]byte, error) {
+	if b, ok := r.blocks[index]; ok {
+		return b, nil
+	}
+	last := index
+	for (last+1)*readerBlockSize < min(end, r.size) {
+		if _, ok := r.blocks[last+1]; ok {
+			break
+		}
+		last++
+	}
+	start := index * readerBlockSize
+	size := min((last+1)*readerBlockSize, r.size) - start
+	reader, e := driveutil.GetIContentReader(r.ctx, r.content, start, size)
+	if e != nil {
+		r.e = cmp.Or(r.e, e)
+		return nil, e
+	}
+	defer func() { _ = reader.Close() }()
+	data := make([]byte, size)
+	if _, e := io.ReadFull(reader, data); e != nil {
+		r.e = cmp.Or(r.e, e)
+		return nil, e
+	}
+
+	if len(r.blocks)+int(last-index+1) > readerMaxBlocks {
+		clear(r.blocks)
+	}
+	for i := index; i <= last; i++ {
+		from := (i - index) * readerBlockSize
+		r.blocks[i] = data[from:min(from+readerBlockSize, size)]
+	}
+	return r.blocks[index], nil
+}
@@ -0,0 +1,125 @@
+package photo
+
+import (
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"log"
+)
+
+// TriggerIndexAll rebuilds the index of the photos in the path in the background
+func (s *Service) TriggerIndexAll(path string) (task.Task, error) {
+	if e := s.checkEnabled(); e != nil {
+		return task.Task{}, e
+	}
+	return s.runner.Execute(func(ctx types.TaskCtx) (any, error) {
+		e := s.IndexAll(ctx, path)
+		if e != nil {
+			log.Printf("Error indexing photos in %s: %s", utils.LogSanitize(path), e)
+		}
+		return nil, e
+	}, task.WithNameGroup(path, "photo/index"))
+}
+
+// IndexAll rebuilds the index of the photos in the path and waits for it to be done
+func (s *Service) IndexAll(ctx types.TaskCtx, path string) error {
+	if e := s.checkEnabled(); e != nil {
+		return e
+	}
+	if e := s.dao.Delete(path); e != nil {
+		return e
+	}
+	return s.walk(ctx, s.drive.Get(), path)
+}
+
+// walk indexes the files in the path recursively, the errors of the entries are logged and skipped
+func (s *Service) walk(ctx types.TaskCtx, d types.IDrive, path string) error {
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+	entry, e := d.Get(ctx, path)
+	if e != nil {
+		log.Printf("failed to index photo %s: %s", utils.LogSanitize(path), e)
+		return nil
+	}
+	if entry.Type() == types.TypeFile {
+		ctx.Total(1, false)
+		if e := s.index(ctx, entry); e != nil {
+			log.Printf("failed to index photo %s: %s", utils.LogSanitize(path), e)
+		}
+		ctx.Progress(1, false)
+		return nil
+	}
+	entries, e := d.List(ctx, path)
+	if e != nil {
+		log.Printf("failed to index photos in %s: %s", utils.LogSanitize(path), e)
+		return nil
+	}
+	for _, entry := range entries {
+		if e := s.walk(ctx, d, entry.Path()); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// index adds the file to the index if it is a photo or a video with the time taken or the location,
+// otherwise removes it from the index
+func (s *Service) index(ctx types.TaskCtx, entry types.IEntry) error {
+	if entry.Type() != types.TypeFile || !s.media.Supports(entry) {
+		return nil
+	}
+	meta, e := s.media.Get(ctx, entry)
+	if e != nil {
+		return e
+	}
+	photo, ok := newPhotoIndex(entry, meta)
+	if !ok {
+		return s.dao.Delete(entry.Path())
+	}
+	return s.dao.Set(photo)
+}
+
+func newPhotoIndex(entry types.IEntry, meta *types.MediaMeta) (types.PhotoIndex, bool) {
+	if meta == nil || (meta.TakenAt == nil && (meta.Latitude == nil || meta.Longitude == nil)) ||
+		// audios may have the recording time
+		(meta.VideoCodec == "" && meta.AudioCodec != "") {
+		return types.PhotoIndex{}, false
+	}
+	p := types.PhotoIndex{
+		Path: entry.Path(), Width: meta.Width, Height: meta.Height,
+		Size: entry.Size(), ModTime: entry.ModTime(),
+	}
+	if meta.TakenAt != nil {
+		p.TakenAt = meta.TakenAt.UnixMilli()
+		p.Date = dateOf(*meta.TakenAt)
+	}
+	if meta.Latitude != nil && meta.Longitude != nil {
+		p.Latitude, p.Longitude = meta.Latitude, meta.Longitude
+	}
+	return p, true
+}
+
+func (s *Service) onUpdated(dc types.DriveListenerContext, path string, includeDescendants bool) {
+	if includeDescendants {
+		_, _ = s.TriggerIndexAll(path)
+		return
+	}
+	_, _ = s.runner.Execute(func(ctx types.TaskCtx) (any, error) {
+		entry, e := dc.Drive.Get(ctx, path)
+		if e != nil {
+			return nil, e
+		}
+		e = s.index(ctx, entry)
+		if e != nil {
+			log.Printf("Error indexing photo %s: %s", utils.LogSanitize(path), e)
+		}
+		return nil, e
+	})
+}
+
+func (s *Service) onDeleted(_ types.DriveListenerContext, path string) {
+	if e := s.dao.Delete(path); e != nil {
+		log.Printf("Error deleting photo index %s: %s", utils.LogSanitize(path), e)
+	}
+}
@@ -0,0 +1,293 @@
+package photo
+
+import (
+	"context"
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/event"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"go-drive/server/metadata"
+	"go-drive/storage"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter returns whether the photo of the path is visible
+type Filter = func(path string) (bool, error)
+
+const (
+	pageSize = 100
+	// maxScanSize is the maximum number of the photos scanned for a page
+	maxScanSize = 1000
+)
+
+// Group is the granularity of the timeline buckets
+type Group string
+
+const (
+	GroupYear  Group = "year"
+	GroupMonth Group = "month"
+	GroupDay   Group = "day"
+)
+
+// TimelineBucket is the number of the photos taken in a year, month or day
+type TimelineBucket struct {
+	// Date is like 2023, 2023-05 or 2023-05-01
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type Photo struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	// TakenAt is the time taken in milliseconds, 0 if unknown
+	TakenAt   int64    `json:"takenAt"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	Size      int64    `json:"size"`
+	ModTime   int64    `json:"modTime"`
+}
+
+type Result struct {
+	Items []Photo `json:"items"`
+	// Next is the offset of the next page, -1 if there are no more photos
+	Next int `json:"next"`
+}
+
+// Service maintains the index of the photos with the time taken or the location from the event bus,
+// and queries the timeline and the map views from the index
+type Service struct {
+	dao    *storage.PhotoIndexDAO
+	media  *metadata.Service
+	drive  *drive.RootDrive
+	runner task.Runner
+
+	unsubscribe []event.Unsubscribe
+}
+
+func NewService(dao *storage.PhotoIndexDAO, media *metadata.Service, rootDrive *drive.RootDrive,
+	runner task.Runner, bus event.Bus, ch *registry.ComponentsHolder) *Service {
+	s := &Service{}
+	// the index is built from the extracted metadata
+	if media.Enabled() {
+		s.dao = dao
+		s.media = media
+		s.drive = rootDrive
+		s.runner = runner
+		s.unsubscribe = []event.Unsubscribe{
+			bus.SubscribeEntryUpdated(s.onUpdated),
+			bus.SubscribeEntryDeleted(s.onDeleted),
+		}
+	}
+	ch.Add(registry.KeyPhotoService, s)
+	return s
+}
+
+func (s *Service) checkEnabled() error {
+	if s.dao == nil {
+		return err.NewNotAllowedMessageError("photo index is not enabled")
+	}
+	return nil
+}
+
+// Timeline returns the number of the photos in the root grouped by the date taken, the latest first
+func (s *Service) Timeline(ctx context.Context, root string, group Group, filter Filter) ([]TimelineBucket, error) {
+	if e := s.checkEnabled(); e != nil {
+		return nil, e
+	}
+	var divisor int
+	switch group {
+	case GroupYear:
+		divisor = 10000
+	case GroupMonth:
+		divisor = 100
+	case GroupDay:
+		divisor = 1
+	default:
+		return nil, err.NewBadRequestError(i18n.T("api.photo.invalid_group", string(group)))
+	}
+	photos, e := s.dao.ListDates(root)
+	if e != nil {
+		return nil, e
+	}
+	counts := make(map[int]int)
+	for _, p := range photos {
+		if e := ctx.Err(); e != nil {
+			return nil, e
+		}
+		visible, e := filter(p.Path)
+		if e != nil {
+			return nil, e
+		}
+		if visible {
+			counts[p.Date/divisor]++
+		}
+	}
+	keys := utils.MapKeys(counts)
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	return utils.ArrayMap(keys, func(t *int) TimelineBucket {
+		return TimelineBucket{Date: formatDate(*t, group), Count: counts[*t]}
+	}), nil
+}
+
+// List returns the photos in the root taken in the date, which is YYYY, YYYY-MM, YYYY-MM-DD or empty for all
+func (s *Service) List(ctx context.Context, root, date string, next int, filter Filter) (Result, error) {
+	if e := s.checkEnabled(); e != nil {
+		return Result{}, e
+	}
+	from, to, ok := parseDateRange(date)
+	if !ok {
+		return Result{}, err.NewBadRequestError(i18n.T("api.photo.invalid_date", date))
+	}
+	return s.query(ctx, storage.PhotoIndexQuery{Root: root, FromDate: from, ToDate: to}, next, filter)
+}
+
+// Geo returns the geotagged photos in the root within the bounding box
+func (s *Service) Geo(ctx context.Context, root string, box storage.GeoBox, next int, filter Filter) (Result, error) {
+	if e := s.checkEnabled(); e != nil {
+		return Result{}, e
+	}
+	return s.query(ctx, storage.PhotoIndexQuery{Root: root, Box: &box}, next, filter)
+}
+
+// query scans the photos from next until a page is filled or maxScanSize photos are scanned,
+// so a page may have fewer photos than pageSize if many are not visible
+func (s *Service) query(ctx context.Context, q storage.PhotoIndexQuery, next int, filter Filter) (Result, error) {
+	if next < 0 {
+		next = 0
+	}
+	from := next
+	more := true
+	items := make([]Photo, 0)
+	for len(items) < pageSize && from-next < maxScanSize {
+		if e := ctx.Err(); e != nil {
+			return Result{}, e
+		}
+		q.Offset, q.Limit = from, pageSize
+		photos, e := s.dao.Query(q)
+		if e != nil {
+			return Result{}, e
+		}
+		from += len(photos)
+		for _, p := range photos {
+			visible, e := filter(p.Path)
+			if e != nil {
+				return Result{}, e
+			}
+			if visible {
+				items = append(items, newPhoto(p))
+			}
+		}
+		if len(photos) < pageSize {
+			more = false
+			break
+		}
+	}
+	if !more {
+		from = -1
+	}
+	return Result{Items: items, Next: from}, nil
+}
+
+func newPhoto(p types.PhotoIndex) Photo {
+	return Photo{
+		Path: p.Path, Name: utils.PathBase(p.Path), TakenAt: p.TakenAt,
+		Latitude: p.Latitude, Longitude: p.Longitude, Width: p.Width, Height: p.Height,
+		Size: p.Size, ModTime: p.ModTime,
+	}
+}
+
+// ParseGeoBox parses the bounding box of minLng,minLat,maxLng,maxLat
+func ParseGeoBox(s string) (storage.GeoBox, error) {
+	invalid := err.NewBadRequestError(i18n.T("api.photo.invalid_box", s))
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return storage.GeoBox{}, invalid
+	}
+	values := make([]float64, 4)
+	for i, p := range parts {
+		v, e := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if e != nil {
+			return storage.GeoBox{}, invalid
+		}
+		values[i] = v
+	}
+	box := storage.GeoBox{
+		MinLongitude: values[0], MinLatitude: values[1], MaxLongitude: values[2], MaxLatitude: values[3],
+	}
+	if box.MinLatitude > box.MaxLatitude || box.MinLatitude < -90 || box.MaxLatitude > 90 ||
+		box.MinLongitude < -180 || box.MinLongitude > 180 || box.MaxLongitude < -180 || box.MaxLongitude > 180 {
+		return storage.GeoBox{}, invalid
+	}
+	return box, nil
+}
+
+// parseDateRange returns the range of the dates like 20230501 of YYYY, YYYY-MM or YYYY-MM-DD
+func parseDateRange(date string) (int, int, bool) {
+	if date == "" {
+		return 0, 0, true
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if len(date) != len(layout) {
+			continue
+		}
+		t, e := time.Parse(layout, date)
+		if e != nil {
+			return 0, 0, false
+		}
+		d := dateOf(t)
+		switch layout {
+		case "2006":
+			return d, d + 1231, true
+		case "2006-01":
+			return d, d + 31, true
+		}
+		return d, d, true
+	}
+	return 0, 0, false
+}
+
+// dateOf returns the date like 20230501 in the time zone of t
+func dateOf(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func formatDate(v int, group Group) string {
+	switch group {
+	case GroupYear:
+		return strconv.Itoa(v)
+	case GroupMonth:
+		return fmt.Sprintf("%04d-%02d", v/100, v%100)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", v/10000, v/100%100, v%100)
+}
+
+func (s *Service) Status() (string, types.SM, error) {
+	if s.checkEnabled() != nil {
+		return "Photos", types.SM{}, nil
+	}
+	total, geotagged, e := s.dao.Count()
+	if e != nil {
+		return "", nil, e
+	}
+	return "Photos", types.SM{
+		"Total":     strconv.FormatInt(total, 10),
+		"Geotagged": strconv.FormatInt(geotagged, 10),
+	}, nil
+}
+
+func (s *Service) Dispose() error {
+	for _, unsubscribe := range s.unsubscribe {
+		unsubscribe()
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package photo
+
+import (
+	"context"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	config := testutil.DefaultTestConfig()
+	config.DataDir = t.TempDir()
+	ch := registry.NewComponentHolder()
+	t.Cleanup(func() { _ = ch.Dispose() })
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return &Service{dao: storage.NewPhotoIndexDAO(db, ch)}
+}
+
+func float(v float64) *float64 { return &v }
+
+func TestService(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	photos := []types.PhotoIndex{
+		{Path: "photos/2023/a.jpg", TakenAt: 3, Date: 20230501, Latitude: float(35.6), Longitude: float(139.7)},
+		{Path: "photos/2023/b.jpg", TakenAt: 2, Date: 20230501},
+		{Path: "photos/2023/c.jpg", TakenAt: 1, Date: 20230612, Latitude: float(48.8), Longitude: float(2.3)},
+		{Path: "photos/2022/d.jpg", TakenAt: 0, Date: 20221231, Latitude: float(-33.9), Longitude: float(151.2)},
+		{Path: "photos/secret/e.jpg", TakenAt: 4, Date: 20230501},
+		{Path: "photos/f.jpg", Latitude: float(21.3), Longitude: float(-157.8)},
+		{Path: "photos2/g.jpg", TakenAt: 5, Date: 20230501},
+	}
+	for _, p := range photos {
+		if e := s.dao.Set(p); e != nil {
+			t.Fatal(e)
+		}
+	}
+	filter := func(path string) (bool, error) { return !strings.Contains(path, "secret"), nil }
+
+	timeline := map[Group][]TimelineBucket{
+		GroupYear:  {{"2023", 3}, {"2022", 1}},
+		GroupMonth: {{"2023-06", 1}, {"2023-05", 2}, {"2022-12", 1}},
+		GroupDay:   {{"2023-06-12", 1}, {"2023-05-01", 2}, {"2022-12-31", 1}},
+	}
+	for group, want := range timeline {
+		got, e := s.Timeline(ctx, "photos", group, filter)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", group, got, want)
+		}
+	}
+	if _, e := s.Timeline(ctx, "photos", "week", filter); e == nil {
+		t.Error("expected error of invalid group")
+	}
+
+	paths := func(r Result) []string {
+		result := make([]string, 0, len(r.Items))
+		for _, p := range r.Items {
+			result = append(result, p.Path)
+		}
+		return result
+	}
+	lists := map[string][]string{
+		"":           {"photos/2023/a.jpg", "photos/2023/b.jpg", "photos/2023/c.jpg", "photos/2022/d.jpg", "photos/f.jpg"},
+		"2023":       {"photos/2023/a.jpg", "photos/2023/b.jpg", "photos/2023/c.jpg"},
+		"2023-05":    {"photos/2023/a.jpg", "photos/2023/b.jpg"},
+		"2022-12-31": {"photos/2022/d.jpg"},
+		"2021":       {},
+	}
+	for date, want := range lists {
+		r, e := s.List(ctx, "photos", date, 0, filter)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got := paths(r); !reflect.DeepEqual(got, want) || r.Next != -1 {
+			t.Errorf("%q: got %v %d, want %v", date, got, r.Next, want)
+		}
+	}
+	for _, date := range []string{"2023-5", "2023-13", "abc", "2023-05-01T00"} {
+		if _, e := s.List(ctx, "photos", date, 0, filter); e == nil {
+			t.Errorf("%q: expected error of invalid date", date)
+		}
+	}
+
+	geo := map[string][]string{
+		"100,0,180,60":      {"photos/2023/a.jpg"},
+		"-180,-90,180,90":   {"photos/2023/a.jpg", "photos/2023/c.jpg", "photos/2022/d.jpg", "photos/f.jpg"},
+		"150,-40,-150,40":   {"photos/2022/d.jpg", "photos/f.jpg"},
+		"-10,40,10,50":      {"photos/2023/c.jpg"},
+		" -10, 60, 10, 70 ": {},
+	}
+	for bbox, want := range geo {
+		box, e := ParseGeoBox(bbox)
+		if e != nil {
+			t.Fatalf("%q: %v", bbox, e)
+		}
+		r, e := s.Geo(ctx, "photos", box, 0, filter)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got := paths(r); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %v, want %v", bbox, got, want)
+		}
+	}
+	for _, bbox := range []string{"", "1,2,3", "a,b,c,d", "0,50,10,40", "0,-91,10,0", "-181,0,0,10"} {
+		if _, e := ParseGeoBox(bbox); e == nil {
+			t.Errorf("%q: expected error of invalid box", bbox)
+		}
+	}
+
+	s.onDeleted(types.DriveListenerContext{}, "photos/2023")
+	if total, geotagged, e := s.dao.Count(); e != nil || total != 4 || geotagged != 2 {
+		t.Errorf("unexpected count after deleting: %d, %d, %v", total, geotagged, e)
+	}
+}
+
+func TestService_Paging(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	for i := 0; i < pageSize*2+10; i++ {
+		p := types.PhotoIndex{Path: "p/" + strings.Repeat("a", i+1), TakenAt: int64(i + 1), Date: 20230501}
+		if e := s.dao.Set(p); e != nil {
+			t.Fatal(e)
+		}
+	}
+	// the odd ones are hidden
+	filter := func(path string) (bool, error) { return (len(path)-2)%2 == 0, nil }
+	count, next := 0, 0
+	for next >= 0 {
+		r, e := s.List(ctx, "p", "", next, filter)
+		if e != nil {
+			t.Fatal(e)
+		}
+		count += len(r.Items)
+		next = r.Next
+	}
+	if count != pageSize+5 {
+		t.Errorf("unexpected number of photos: %d", count)
+	}
+}
+
+func TestNewPhotoIndex(t *testing.T) {
+	taken := time.Date(2023, 5, 1, 23, 30, 0, 0, time.FixedZone("", 9*3600))
+	entry := &testEntry{path: "a.jpg", size: 10, modTime: 20}
+	p, ok := newPhotoIndex(entry, &types.MediaMeta{TakenAt: &taken, Width: 4, Height: 3})
+	if !ok || p.TakenAt != taken.UnixMilli() || p.Date != 20230501 || p.Latitude != nil ||
+		p.Width != 4 || p.Size != 10 || p.ModTime != 20 {
+		t.Errorf("unexpected index: %+v", p)
+	}
+	if _, ok := newPhotoIndex(entry, &types.MediaMeta{Latitude: float(1), Longitude: float(2)}); !ok {
+		t.Error("geotagged photos without the time taken should be indexed")
+	}
+	if _, ok := newPhotoIndex(entry, &types.MediaMeta{Width: 4, Height: 3}); ok {
+		t.Error("photos without the time taken and the location should not be indexed")
+	}
+	if _, ok := newPhotoIndex(entry, &types.MediaMeta{TakenAt: &taken, AudioCodec: "aac"}); ok {
+		t.Error("audios should not be indexed")
+	}
+	if _, ok := newPhotoIndex(entry, nil); ok {
+		t.Error("unsupported files should not be indexed")
+	}
+}
+
+type testEntry struct {
+	types.IEntry
+	path    string
+	size    int64
+	modTime int64
+}
+
+func (e *testEntry) Path() string   { return e.path }
+func (e *testEntry) Size() int64    { return e.size }
+func (e *testEntry) ModTime() int64 { return e.modTime }
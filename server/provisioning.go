@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"go-drive/storage"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ProvisioningDocument is the provisioning file, the declared resources are managed by it
+type ProvisioningDocument struct {
+	Groups          []ProvisioningGroup      `yaml:"groups"`
+	Users           []ProvisioningUser       `yaml:"users"`
+	Drives          []SettingsDrive          `yaml:"drives"`
+	PathPermissions []SettingsPathPermission `yaml:"pathPermissions"`
+	PathMounts      []SettingsPathMount      `yaml:"pathMounts"`
+}
+
+type ProvisioningGroup struct {
+	Name     string `yaml:"name"`
+	RootPath string `yaml:"rootPath"`
+}
+
+type ProvisioningUser struct {
+	Username string `yaml:"username"`
+	// Password is the plain password or a bcrypt hash, it's only required when creating the user
+	Password string   `yaml:"password"`
+	RootPath string   `yaml:"rootPath"`
+	SSHKeys  string   `yaml:"sshKeys"`
+	Groups   []string `yaml:"groups"`
+}
+
+var provisioningEnvPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)}`)
+
+// ParseProvisioningDocument parses the YAML document, ${NAME} in the string values is replaced with
+// the environment variable. The values are replaced after parsing, so they can't change the structure.
+func ParseProvisioningDocument(data []byte) (*ProvisioningDocument, error) {
+	doc := &ProvisioningDocument{}
+	root := &yaml.Node{}
+	if e := yaml.Unmarshal(data, root); e != nil {
+		return nil, fmt.Errorf("invalid provisioning file: %w", e)
+	}
+	if root.Kind == 0 {
+		return doc, nil
+	}
+	var missing []string
+	expandProvisioningEnv(root, func(s string) string {
+		return provisioningEnvPattern.ReplaceAllStringFunc(s, func(m string) string {
+			name := provisioningEnvPattern.FindStringSubmatch(m)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variable %s is not set", missing[0])
+	}
+	// the node is encoded again since decoding a node doesn't check the unknown fields
+	data, e := yaml.Marshal(root)
+	if e != nil {
+		return nil, e
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if e := decoder.Decode(doc); e != nil && !errors.Is(e, io.EOF) {
+		return nil, fmt.Errorf("invalid provisioning file: %w", e)
+	}
+	return doc, nil
+}
+
+// expandProvisioningEnv replaces the string values of the node, the mapping keys are kept
+func expandProvisioningEnv(node *yaml.Node, expand func(string) string) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!str" {
+			node.Value = expand(node.Value)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			expandProvisioningEnv(node.Content[i], expand)
+		}
+	default:
+		for _, n := range node.Content {
+			expandProvisioningEnv(n, expand)
+		}
+	}
+}
+
+// Provisioner reconciles the resources declared in the provisioning file
+type Provisioner struct {
+	file            string
+	settingsIO      *SettingsIO
+	provisioningDAO *storage.ProvisioningDAO
+	groupDAO        *storage.GroupDAO
+	rootDrive       *drive.RootDrive
+	access          *drive.Access
+	mux             sync.Mutex
+}
+
+func NewProvisioner(config common.Config, driveRegistry *driveutil.DriveRegistry,
+	provisioningDAO *storage.ProvisioningDAO, groupDAO *storage.GroupDAO,
+	rootDrive *drive.RootDrive, access *drive.Access, ch *registry.ComponentsHolder) *Provisioner {
+	p := &Provisioner{
+		file:            config.ProvisioningFile,
+		settingsIO:      &SettingsIO{driveRegistry: driveRegistry},
+		provisioningDAO: provisioningDAO,
+		groupDAO:        groupDAO,
+		rootDrive:       rootDrive,
+		access:          access,
+	}
+	ch.Add(registry.KeyProvisioner, p)
+	return p
+}
+
+// Reconcile applies the provisioning file, it does nothing if the file is not configured
+func (p *Provisioner) Reconcile(ctx context.Context) error {
+	if p.file == "" {
+		return nil
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	data, e := os.ReadFile(p.file)
+	if e != nil {
+		return e
+	}
+	doc, e := ParseProvisioningDocument(data)
+	if e != nil {
+		return e
+	}
+	provisioning, e := p.toProvisioning(doc)
+	if e != nil {
+		return fmt.Errorf("invalid provisioning file: %w", e)
+	}
+	changes, e := p.provisioningDAO.Reconcile(provisioning)
+	if e != nil {
+		return e
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	kinds := make(map[string]bool)
+	for _, c := range changes {
+		log.Printf("provisioning: %s %s/%s", c.Action, c.Kind, c.Key)
+		kinds[c.Kind] = true
+		if c.Kind == "drives" && c.Action != storage.ProvisioningChangeCreate {
+			_ = p.rootDrive.ClearDriveCache(c.Key)
+		}
+	}
+	if kinds["drives"] {
+		if e := p.rootDrive.ReloadDrive(ctx, true); e != nil {
+			return e
+		}
+	}
+	if kinds["pathMounts"] {
+		if e := p.rootDrive.ReloadMounts(); e != nil {
+			return e
+		}
+	}
+	if kinds["pathPermissions"] || kinds["users"] || kinds["groups"] {
+		return p.access.ReloadPerm()
+	}
+	return nil
+}
+
+func (p *Provisioner) toProvisioning(doc *ProvisioningDocument) (storage.Provisioning, error) {
+	r := storage.Provisioning{
+		Groups: make([]types.Group, 0, len(doc.Groups)),
+		Users:  make([]types.User, 0, len(doc.Users)),
+	}
+	invalid := func(section string, i int, format string, a ...any) error {
+		return fmt.Errorf("%s[%d]: %s", section, i, fmt.Sprintf(format, a...))
+	}
+
+	groups := make(map[string]bool, len(doc.Groups))
+	for i, g := range doc.Groups {
+		if g.Name == "" {
+			return r, invalid("groups", i, "name is required")
+		}
+		if groups[g.Name] {
+			return r, invalid("groups", i, "duplicate group '%s'", g.Name)
+		}
+		groups[g.Name] = true
+		if g.RootPath != "" {
+			g.RootPath = utils.CleanPath(g.RootPath)
+		}
+		r.Groups = append(r.Groups, types.Group{Name: g.Name, RootPath: g.RootPath})
+	}
+	saved, e := p.groupDAO.ListGroup()
+	if e != nil {
+		return r, e
+	}
+	existingGroups := make(map[string]bool, len(saved))
+	for _, g := range saved {
+		// the managed groups which are no longer declared will be deleted
+		existingGroups[g.Name] = !g.Managed
+	}
+
+	usernames := make(map[string]bool, len(doc.Users))
+	for i, u := range doc.Users {
+		if u.Username == "" {
+			return r, invalid("users", i, "username is required")
+		}
+		if usernames[u.Username] {
+			return r, invalid("users", i, "duplicate user '%s'", u.Username)
+		}
+		usernames[u.Username] = true
+		if e := checkSSHKeys(u.SSHKeys); e != nil {
+			return r, invalid("users", i, "%s", e.Error())
+		}
+		if u.RootPath != "" {
+			u.RootPath = utils.CleanPath(u.RootPath)
+		}
+		user := types.User{
+			Username: u.Username, Password: u.Password, RootPath: u.RootPath, SSHKeys: u.SSHKeys,
+			Groups: make([]types.Group, 0, len(u.Groups)),
+		}
+		for _, g := range u.Groups {
+			if !groups[g] && !existingGroups[g] {
+				return r, invalid("users", i, "group '%s' not found", g)
+			}
+			user.Groups = append(user.Groups, types.Group{Name: g})
+		}
+		r.Users = append(r.Users, user)
+	}
+
+	settings, e := p.settingsIO.toSettings(&SettingsDocument{
+		Drives:          nonNil(doc.Drives),
+		PathPermissions: nonNil(doc.PathPermissions),
+		PathMounts:      nonNil(doc.PathMounts),
+	}, storage.Settings{}, &SettingsDiff{})
+	if e != nil {
+		return r, e
+	}
+	r.Drives = settings.Drives
+	r.PathPermissions = settings.PathPermissions
+	r.PathMounts = settings.PathMounts
+	return r, nil
+}
+
+// nonNil makes the absent sections empty, so that all the managed resources of them are deleted
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return make([]T, 0)
+	}
+	return items
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestParseProvisioningDocument(t *testing.T) {
+	t.Setenv("PROVISIONING_TEST_PASSWORD", "secret")
+	doc, e := ParseProvisioningDocument([]byte(`
+users:
+  - username: u1
+    password: ${PROVISIONING_TEST_PASSWORD}
+  - username: u2
+    password: $2a$10$abcdefghijklmnopqrstuu
+`))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(doc.Users) != 2 || doc.Users[0].Password != "secret" ||
+		doc.Users[1].Password != "$2a$10$abcdefghijklmnopqrstuu" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+
+	// the values of the variables can't change the structure of the document
+	t.Setenv("PROVISIONING_TEST_PASSWORD", "x\ngroups: [admin]")
+	t.Setenv("PROVISIONING_TEST_NAME", "u1', rootPath: '/")
+	doc, e = ParseProvisioningDocument([]byte(`
+users:
+  - username: '${PROVISIONING_TEST_NAME}'
+    password: ${PROVISIONING_TEST_PASSWORD}
+    rootPath: home
+drives:
+  - name: d1
+    type: fs
+    config: {path: "${PROVISIONING_TEST_NAME}"}
+`))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if u := doc.Users[0]; u.Username != "u1', rootPath: '/" || u.Password != "x\ngroups: [admin]" ||
+		u.RootPath != "home" || u.Groups != nil {
+		t.Errorf("unexpected user: %+v", u)
+	}
+	if v := doc.Drives[0].Config["path"]; v != "u1', rootPath: '/" {
+		t.Errorf("unexpected drive config: %q", v)
+	}
+
+	if doc, e := ParseProvisioningDocument(nil); e != nil || doc.Users != nil {
+		t.Errorf("unexpected document of empty file: %+v, %v", doc, e)
+	}
+
+	for _, invalid := range []string{
+		"users: [{username: u1, password: '${PROVISIONING_TEST_UNDEFINED}'}]",
+		"unknown: 1",
+		"users: [{name: u1}]",
+	} {
+		if _, e := ParseProvisioningDocument([]byte(invalid)); e == nil {
+			t.Errorf("expected error of %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	err "go-drive/common/errors"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	s3XMLNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	maxListKeys    = 1000
+)
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucketInfo struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Owner   owner        `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+func (g *Gateway) listBuckets(req *request) error {
+	entries, e := req.drive.List(req.ctx, "")
+	if e != nil {
+		return e
+	}
+	result := listAllMyBucketsResult{
+		Xmlns:   s3XMLNamespace,
+		Owner:   owner{ID: req.sig.user.Username, DisplayName: req.sig.user.Username},
+		Buckets: make([]bucketInfo, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsDir() {
+			continue
+		}
+		result.Buckets = append(result.Buckets, bucketInfo{
+			Name:         utils.PathBase(entry.Path()),
+			CreationDate: formatTime(entry.ModTime()),
+		})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Name < result.Buckets[j].Name })
+	writeXML(req.w, http.StatusOK, result)
+	return nil
+}
+
+// checkBucket checks that the bucket exists and is a directory
+func checkBucket(req *request) error {
+	entry, e := req.drive.Get(req.ctx, req.bucket)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return errNoSuchBucket
+		}
+		return e
+	}
+	if !entry.Type().IsDir() {
+		return errNoSuchBucket
+	}
+	return nil
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Value   string   `xml:",chardata"`
+}
+
+func (g *Gateway) getBucketLocation(req *request) error {
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	// an empty location constraint means the default region
+	writeXML(req.w, http.StatusOK, locationConstraint{Xmlns: s3XMLNamespace})
+	return nil
+}
+
+func (g *Gateway) headBucket(req *request) error {
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) createBucket(req *request) error {
+	if _, e := req.drive.Get(req.ctx, req.bucket); e == nil {
+		return errBucketAlreadyExists
+	} else if !err.IsNotFoundError(e) {
+		return e
+	}
+	if _, e := req.drive.MakeDir(req.ctx, req.bucket); e != nil {
+		return e
+	}
+	req.w.Header().Set("Location", "/"+req.bucket)
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) deleteBucket(req *request) error {
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	children, e := req.drive.List(req.ctx, req.bucket)
+	if e != nil {
+		return e
+	}
+	if len(children) > 0 {
+		return errBucketNotEmpty
+	}
+	if e := req.drive.Delete(task.NewContextWrapper(req.ctx), req.bucket); e != nil {
+		return e
+	}
+	req.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type objectInfo struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Xmlns          string         `xml:"xmlns,attr"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	Delimiter      string         `xml:"Delimiter,omitempty"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	EncodingType   string         `xml:"EncodingType,omitempty"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []objectInfo   `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+
+	// V1
+	Marker     *string `xml:"Marker"`
+	NextMarker string  `xml:"NextMarker,omitempty"`
+
+	// V2
+	KeyCount              *int   `xml:"KeyCount"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+}
+
+// listObjects implements both ListObjects and ListObjectsV2
+func (g *Gateway) listObjects(req *request) error {
+	q := req.query
+	v2 := q.Get("list-type") == "2"
+	delimiter := q.Get("delimiter")
+	if delimiter != "" && delimiter != "/" {
+		return errInvalidArgument("Only '/' is supported as the delimiter.")
+	}
+	encodingType := q.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		return errInvalidArgument("Invalid Encoding Method specified in Request")
+	}
+	maxKeys := maxListKeys
+	if s := q.Get("max-keys"); s != "" {
+		n, e := strconv.Atoi(s)
+		if e != nil || n < 0 {
+			return errInvalidArgument("max-keys must be a non-negative integer.")
+		}
+		maxKeys = min(n, maxListKeys)
+	}
+
+	l := &lister{
+		req:       req,
+		prefix:    q.Get("prefix"),
+		delimiter: delimiter,
+		max:       maxKeys,
+	}
+	result := listBucketResult{
+		Xmlns:        s3XMLNamespace,
+		Name:         req.bucket,
+		Prefix:       l.prefix,
+		Delimiter:    delimiter,
+		MaxKeys:      maxKeys,
+		EncodingType: encodingType,
+	}
+	if v2 {
+		token := q.Get("continuation-token")
+		l.after = q.Get("start-after")
+		result.StartAfter = l.after
+		result.ContinuationToken = token
+		if token != "" {
+			after, e := base64.RawURLEncoding.DecodeString(token)
+			if e != nil {
+				return errInvalidArgument("The continuation token provided is incorrect")
+			}
+			l.after = string(after)
+		}
+	} else {
+		l.after = q.Get("marker")
+		result.Marker = &l.after
+	}
+
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	if e := l.list(); e != nil {
+		return e
+	}
+
+	result.IsTruncated = l.truncated
+	result.Contents = l.contents
+	result.CommonPrefixes = l.prefixes
+	if l.truncated {
+		if v2 {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(l.last))
+		} else {
+			result.NextMarker = l.last
+		}
+	}
+	if v2 {
+		count := len(l.contents) + len(l.prefixes)
+		result.KeyCount = &count
+	}
+	if encodingType == "url" {
+		encodeListResult(&result)
+	}
+	writeXML(req.w, http.StatusOK, result)
+	return nil
+}
+
+func encodeListResult(result *listBucketResult) {
+	encode := func(s string) string { return uriEncode(s, false) }
+	result.Prefix = encode(result.Prefix)
+	result.Delimiter = encode(result.Delimiter)
+	result.StartAfter = encode(result.StartAfter)
+	result.NextMarker = encode(result.NextMarker)
+	if result.Marker != nil {
+		marker := encode(*result.Marker)
+		result.Marker = &marker
+	}
+	for i := range result.Contents {
+		result.Contents[i].Key = encode(result.Contents[i].Key)
+	}
+	for i := range result.CommonPrefixes {
+		result.CommonPrefixes[i].Prefix = encode(result.CommonPrefixes[i].Prefix)
+	}
+}
+
+var errListFull = errors.New("list is full")
+
+// lister walks the bucket in the lexicographical order of the keys.
+// Children of a directory are visited by their names, with '/' appended to the directories,
+// since no name contains '/', it's exactly the order of the keys.
+type lister struct {
+	req       *request
+	prefix    string
+	delimiter string
+	after     string
+	max       int
+
+	contents  []objectInfo
+	prefixes  []commonPrefix
+	last      string
+	truncated bool
+}
+
+func (l *lister) list() error {
+	l.contents = make([]objectInfo, 0)
+	l.prefixes = make([]commonPrefix, 0)
+	if l.max == 0 {
+		return nil
+	}
+	e := l.walk(l.req.bucket, "")
+	if errors.Is(e, errListFull) {
+		return nil
+	}
+	if err.IsNotFoundError(e) {
+		return nil
+	}
+	return e
+}
+
+func (l *lister) add(key string, entry types.IEntry) error {
+	if len(l.contents)+len(l.prefixes) >= l.max {
+		l.truncated = true
+		return errListFull
+	}
+	if entry == nil {
+		l.prefixes = append(l.prefixes, commonPrefix{Prefix: key})
+	} else {
+		l.contents = append(l.contents, objectInfo{
+			Key:          key,
+			LastModified: formatTime(entry.ModTime()),
+			ETag:         entryETag(entry),
+			Size:         entry.Size(),
+			StorageClass: "STANDARD",
+		})
+	}
+	l.last = key
+	return nil
+}
+
+// walk lists the directory at path, whose key prefix is dirKey
+func (l *lister) walk(path, dirKey string) error {
+	if e := l.req.ctx.Err(); e != nil {
+		return e
+	}
+	entries, e := l.req.drive.List(l.req.ctx, path)
+	if e != nil {
+		return e
+	}
+	type child struct {
+		key   string
+		entry types.IEntry
+	}
+	children := make([]child, 0, len(entries))
+	for _, entry := range entries {
+		key := dirKey + utils.PathBase(entry.Path())
+		if entry.Type().IsDir() {
+			key += "/"
+		}
+		children = append(children, child{key, entry})
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].key < children[j].key })
+
+	for _, c := range children {
+		if !c.entry.Type().IsDir() {
+			if strings.HasPrefix(c.key, l.prefix) && c.key > l.after {
+				if e := l.add(c.key, c.entry); e != nil {
+					return e
+				}
+			}
+			continue
+		}
+		// the directory is on the way to the prefix
+		if strings.HasPrefix(l.prefix, c.key) {
+			if e := l.walk(c.entry.Path(), c.key); e != nil {
+				return e
+			}
+			continue
+		}
+		if !strings.HasPrefix(c.key, l.prefix) {
+			continue
+		}
+		// all keys in the directory are not greater than the marker
+		if c.key <= l.after && !strings.HasPrefix(l.after, c.key) {
+			continue
+		}
+		if l.delimiter != "" {
+			// the directory is rolled up as a common prefix
+			if c.key > l.after && !strings.HasPrefix(l.after, c.key) {
+				if e := l.add(c.key, nil); e != nil {
+					return e
+				}
+			}
+			continue
+		}
+		if e := l.walk(c.entry.Path(), c.key); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func formatTime(millis int64) string {
+	return utils.Time(millis).UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func formatHTTPTime(millis int64) string {
+	return utils.Time(millis).UTC().Format(http.TimeFormat)
+}
+
+// entryETag returns a stable ETag of the entry.
+// The MD5 of the content is not known, the ETag is derived from the path, size and modification time
+// and has the form of multipart ETags, so that clients don't take it as the MD5 of the content.
+func entryETag(entry types.IEntry) string {
+	return "\"" + hexMD5(entry.Path()+"\x00"+strconv.FormatInt(entry.Size(), 10)+"\x00"+
+		strconv.FormatInt(entry.ModTime(), 10)) + "-1\""
+}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	err "go-drive/common/errors"
+	"log"
+	"net/http"
+)
+
+// apiError is an error in the S3 error response format
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (a *apiError) Error() string {
+	return a.Code + ": " + a.Message
+}
+
+func newError(code string, status int, message string) *apiError {
+	return &apiError{Code: code, Message: message, StatusCode: status}
+}
+
+var (
+	errAccessDenied          = newError("AccessDenied", http.StatusForbidden, "Access Denied")
+	errInvalidAccessKeyID    = newError("InvalidAccessKeyId", http.StatusForbidden, "The access key Id you provided does not exist in our records.")
+	errSignatureDoesNotMatch = newError("SignatureDoesNotMatch", http.StatusForbidden, "The request signature we calculated does not match the signature you provided.")
+	errRequestTimeTooSkewed  = newError("RequestTimeTooSkewed", http.StatusForbidden, "The difference between the request time and the server's time is too large.")
+	errExpiredRequest        = newError("AccessDenied", http.StatusForbidden, "Request has expired")
+	errContentSHA256Mismatch = newError("XAmzContentSHA256Mismatch", http.StatusBadRequest, "The provided 'x-amz-content-sha256' header does not match what was computed.")
+	errBadDigest             = newError("BadDigest", http.StatusBadRequest, "The Content-MD5 you specified did not match what we received.")
+	errInvalidDigest         = newError("InvalidDigest", http.StatusBadRequest, "The Content-MD5 you specified is not valid.")
+	errIncompleteBody        = newError("IncompleteBody", http.StatusBadRequest, "You did not provide the number of bytes specified by the Content-Length HTTP header.")
+	errMalformedXML          = newError("MalformedXML", http.StatusBadRequest, "The XML you provided was not well-formed or did not validate against our published schema.")
+	errInvalidRange          = newError("InvalidRange", http.StatusRequestedRangeNotSatisfiable, "The requested range is not satisfiable")
+	errNoSuchBucket          = newError("NoSuchBucket", http.StatusNotFound, "The specified bucket does not exist")
+	errNoSuchKey             = newError("NoSuchKey", http.StatusNotFound, "The specified key does not exist.")
+	errNoSuchUpload          = newError("NoSuchUpload", http.StatusNotFound, "The specified multipart upload does not exist.")
+	errInvalidPart           = newError("InvalidPart", http.StatusBadRequest, "One or more of the specified parts could not be found or the ETag did not match.")
+	errInvalidPartOrder      = newError("InvalidPartOrder", http.StatusBadRequest, "The list of parts was not in ascending order.")
+	errBucketNotEmpty        = newError("BucketNotEmpty", http.StatusConflict, "The bucket you tried to delete is not empty")
+	errBucketAlreadyExists   = newError("BucketAlreadyOwnedByYou", http.StatusConflict, "Your previous request to create the named bucket succeeded and you already own it.")
+	errInvalidBucketName     = newError("InvalidBucketName", http.StatusBadRequest, "The specified bucket is not valid.")
+	errMethodNotAllowed      = newError("MethodNotAllowed", http.StatusMethodNotAllowed, "The specified method is not allowed against this resource.")
+	errNotImplemented        = newError("NotImplemented", http.StatusNotImplemented, "A header or query you provided implies functionality that is not implemented.")
+	errPreconditionFailed    = newError("PreconditionFailed", http.StatusPreconditionFailed, "At least one of the preconditions you specified did not hold.")
+	errInternalError         = newError("InternalError", http.StatusInternalServerError, "We encountered an internal error. Please try again.")
+)
+
+func errInvalidArgument(message string) *apiError {
+	return newError("InvalidArgument", http.StatusBadRequest, message)
+}
+
+func errInvalidRequest(message string) *apiError {
+	return newError("InvalidRequest", http.StatusBadRequest, message)
+}
+
+// toAPIError maps the errors of drives to S3 errors
+func toAPIError(e error) *apiError {
+	var ae *apiError
+	if errors.As(e, &ae) {
+		return ae
+	}
+	if err.IsNotFoundError(e) {
+		return errNoSuchKey
+	}
+	var permissionDenied err.PermissionDeniedError
+	if err.IsNotAllowedError(e) || err.IsUnauthorizedError(e) || errors.As(e, &permissionDenied) {
+		return errAccessDenied
+	}
+	if err.IsUnsupportedError(e) {
+		return errNotImplemented
+	}
+	var badRequest err.BadRequestError
+	if errors.As(e, &badRequest) {
+		return errInvalidRequest(badRequest.Error())
+	}
+	log.Printf("[s3] internal error: %v", e)
+	return errInternalError
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e error) {
+	ae := toAPIError(e)
+	if r.Method == http.MethodHead {
+		// HEAD responses have no body, the error code is only visible by the status code
+		w.WriteHeader(ae.StatusCode)
+		return
+	}
+	writeXML(w, ae.StatusCode, errorResponse{
+		Code:      ae.Code,
+		Message:   ae.Message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get(headerRequestID),
+	})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	data, e := xml.Marshal(v)
+	if e != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,198 @@
+package s3
+
+import (
+	"context"
+	"go-drive/common"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const headerRequestID = "X-Amz-Request-Id"
+
+// unsupportedSubresources are the subresources of buckets and objects that are not implemented,
+// requests on them are rejected instead of being treated as plain object requests.
+var unsupportedSubresources = []string{
+	"acl", "policy", "cors", "lifecycle", "versioning", "versions", "tagging", "website",
+	"logging", "notification", "replication", "encryption", "object-lock", "retention",
+	"legal-hold", "torrent", "attributes", "restore", "select", "accelerate", "requestPayment",
+	"analytics", "inventory", "metrics", "ownershipControls", "publicAccessBlock", "intelligent-tiering",
+}
+
+// AccessKeyStore looks up the access keys, it's implemented by storage.AccessKeyDAO
+type AccessKeyStore interface {
+	GetAccessKey(id string) (types.AccessKey, error)
+}
+
+// UserStore looks up the owner of the access keys, it's implemented by storage.UserDAO
+type UserStore interface {
+	GetUser(username string) (types.User, error)
+}
+
+// DriveGetter returns the drive view of the principal, it's implemented by drive.Access
+type DriveGetter interface {
+	GetDrive(session types.Principal) (types.IDrive, error)
+}
+
+// Gateway serves the virtual tree over a subset of the S3 API.
+// The first path segment is the bucket, which is a top-level directory of the user's drive,
+// and the rest is the object key. A request is served by the drive of the owner of its access key.
+type Gateway struct {
+	prefix  string
+	tempDir string
+
+	drives DriveGetter
+	keys   AccessKeyStore
+	users  UserStore
+
+	uploads *multipartStore
+	now     func() time.Time
+}
+
+func NewGateway(config common.Config, drives DriveGetter, keys AccessKeyStore, users UserStore) (*Gateway, error) {
+	uploads, e := newMultipartStore(config.TempDir)
+	if e != nil {
+		return nil, e
+	}
+	return &Gateway{
+		prefix:  strings.TrimSuffix(config.S3.Prefix, "/"),
+		tempDir: config.TempDir,
+		drives:  drives,
+		keys:    keys,
+		users:   users,
+		uploads: uploads,
+		now:     time.Now,
+	}, nil
+}
+
+// request is an authenticated request on a bucket or an object
+type request struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	ctx    context.Context
+	sig    *signature
+	drive  types.IDrive
+	query  url.Values
+	bucket string
+	key    string
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(headerRequestID, strings.ToUpper(utils.RandString(16)))
+	sig, e := g.authenticate(r)
+	if e != nil {
+		writeError(w, r, e)
+		return
+	}
+	d, e := g.drives.GetDrive(types.Principal{User: sig.user, AuthType: types.AuthTypeAccessKey})
+	if e != nil {
+		writeError(w, r, e)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, g.prefix), "/"), "/")
+	req := &request{
+		w: w, r: r, ctx: r.Context(), sig: sig, drive: d,
+		query: r.URL.Query(), bucket: bucket, key: key,
+	}
+	if e := g.route(req); e != nil {
+		writeError(w, r, e)
+	}
+}
+
+func (g *Gateway) route(req *request) error {
+	for _, name := range unsupportedSubresources {
+		if req.query.Has(name) {
+			return errNotImplemented
+		}
+	}
+	method := req.r.Method
+	if req.bucket == "" {
+		if method == http.MethodGet {
+			return g.listBuckets(req)
+		}
+		return errMethodNotAllowed
+	}
+	if req.bucket != utils.CleanPath(req.bucket) {
+		return errInvalidBucketName
+	}
+
+	if req.key == "" {
+		switch method {
+		case http.MethodGet:
+			if req.query.Has("location") {
+				return g.getBucketLocation(req)
+			}
+			if req.query.Has("uploads") {
+				return errNotImplemented
+			}
+			return g.listObjects(req)
+		case http.MethodHead:
+			return g.headBucket(req)
+		case http.MethodPut:
+			return g.createBucket(req)
+		case http.MethodDelete:
+			return g.deleteBucket(req)
+		case http.MethodPost:
+			if req.query.Has("delete") {
+				return g.deleteObjects(req)
+			}
+		}
+		return errMethodNotAllowed
+	}
+
+	copySource := req.r.Header.Get("X-Amz-Copy-Source")
+	uploadID := req.query.Get("uploadId")
+	switch method {
+	case http.MethodGet:
+		if uploadID != "" {
+			return errNotImplemented
+		}
+		return g.getObject(req, true)
+	case http.MethodHead:
+		return g.getObject(req, false)
+	case http.MethodPut:
+		if uploadID != "" {
+			if copySource != "" {
+				return errNotImplemented
+			}
+			return g.uploadPart(req, uploadID)
+		}
+		if copySource != "" {
+			return g.copyObject(req, copySource)
+		}
+		return g.putObject(req)
+	case http.MethodPost:
+		if req.query.Has("uploads") {
+			return g.createMultipartUpload(req)
+		}
+		if uploadID != "" {
+			return g.completeMultipartUpload(req, uploadID)
+		}
+	case http.MethodDelete:
+		if uploadID != "" {
+			return g.abortMultipartUpload(req, uploadID)
+		}
+		return g.deleteObject(req)
+	}
+	return errMethodNotAllowed
+}
+
+// objectPath returns the path of the key in the drive.
+// Keys that are changed by cleaning, such as the ones with '..' segments, are rejected,
+// so that a key can never point outside its bucket.
+func objectPath(bucket, key string) (string, error) {
+	want := bucket + "/" + strings.TrimSuffix(key, "/")
+	p := utils.CleanPath(want)
+	if p != want {
+		return "", errInvalidArgument("The specified key is not valid.")
+	}
+	return p, nil
+}
+
+// Dispose removes the expired multipart uploads and stops the cleaner
+func (g *Gateway) Dispose() error {
+	return g.uploads.Dispose()
+}
@@ -0,0 +1,422 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/drive/fs"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testAccessKey = "GDTESTKEY"
+	testSecret    = "test-secret"
+)
+
+type testKeys struct{}
+
+func (testKeys) GetAccessKey(id string) (types.AccessKey, error) {
+	if id == testAccessKey {
+		return types.AccessKey{ID: id, Secret: testSecret, Username: "alice"}, nil
+	}
+	return types.AccessKey{}, err.NewNotFoundError()
+}
+
+type testUsers struct{}
+
+func (testUsers) GetUser(username string) (types.User, error) {
+	if username == "alice" {
+		return types.User{Username: username}, nil
+	}
+	return types.User{}, err.NewNotFoundError()
+}
+
+type testDrives struct {
+	drive     types.IDrive
+	principal types.Principal
+}
+
+func (d *testDrives) GetDrive(session types.Principal) (types.IDrive, error) {
+	d.principal = session
+	return d.drive, nil
+}
+
+func newTestGateway(t *testing.T) (*httptest.Server, *testDrives, string) {
+	t.Helper()
+	root := t.TempDir()
+	config := common.Config{DataDir: t.TempDir(), TempDir: t.TempDir(), FreeFs: true}
+	config.S3 = common.S3Config{Enabled: true, Prefix: "/s3"}
+
+	fsDrive, e := fs.NewDrive(context.Background(), types.SM{"path": root}, driveutil.DriveUtils{Config: config})
+	if e != nil {
+		t.Fatal(e)
+	}
+	drives := &testDrives{drive: fsDrive}
+	g, e := NewGateway(config, drives, testKeys{}, testUsers{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = g.Dispose() })
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Any("/s3", gin.WrapH(g))
+	engine.Any("/s3/*path", gin.WrapH(g))
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	return server, drives, root
+}
+
+func newClient(server *httptest.Server, accessKey, secret string) *s3.Client {
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL + "/s3"),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider(accessKey, secret, ""),
+	})
+}
+
+func errorCode(e error) string {
+	var apiErr smithy.APIError
+	if errors.As(e, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func getString(t *testing.T, client *s3.Client, bucket, key string, rng *string) string {
+	t.Helper()
+	out, e := client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket), Key: aws.String(key), Range: rng,
+	})
+	if e != nil {
+		t.Fatalf("GetObject %s: %v", key, e)
+	}
+	defer func() { _ = out.Body.Close() }()
+	b, e := io.ReadAll(out.Body)
+	if e != nil {
+		t.Fatalf("GetObject %s: %v", key, e)
+	}
+	return string(b)
+}
+
+func putString(t *testing.T, client *s3.Client, bucket, key, content string) {
+	t.Helper()
+	if _, e := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket), Key: aws.String(key), Body: strings.NewReader(content),
+	}); e != nil {
+		t.Fatalf("PutObject %s: %v", key, e)
+	}
+}
+
+func listKeys(t *testing.T, client *s3.Client, input *s3.ListObjectsV2Input) ([]string, []string, *s3.ListObjectsV2Output) {
+	t.Helper()
+	out, e := client.ListObjectsV2(context.Background(), input)
+	if e != nil {
+		t.Fatalf("ListObjectsV2: %v", e)
+	}
+	keys := make([]string, 0)
+	for _, o := range out.Contents {
+		keys = append(keys, *o.Key)
+	}
+	prefixes := make([]string, 0)
+	for _, p := range out.CommonPrefixes {
+		prefixes = append(prefixes, *p.Prefix)
+	}
+	return keys, prefixes, out
+}
+
+func TestS3Authentication(t *testing.T) {
+	server, drives, _ := newTestGateway(t)
+	ctx := context.Background()
+
+	if _, e := newClient(server, testAccessKey, "wrong").ListBuckets(ctx, &s3.ListBucketsInput{}); errorCode(e) != "SignatureDoesNotMatch" {
+		t.Fatalf("wrong secret: %v", e)
+	}
+	if _, e := newClient(server, "UNKNOWN", testSecret).ListBuckets(ctx, &s3.ListBucketsInput{}); errorCode(e) != "InvalidAccessKeyId" {
+		t.Fatalf("unknown access key: %v", e)
+	}
+	resp, e := http.Get(server.URL + "/s3/")
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("anonymous request status = %d", resp.StatusCode)
+	}
+
+	client := newClient(server, testAccessKey, testSecret)
+	if _, e := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("docs")}); e != nil {
+		t.Fatalf("CreateBucket: %v", e)
+	}
+	if drives.principal.User.Username != "alice" || drives.principal.AuthType != types.AuthTypeAccessKey {
+		t.Fatalf("unexpected principal: %+v", drives.principal)
+	}
+	out, e := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if e != nil || len(out.Buckets) != 1 || *out.Buckets[0].Name != "docs" {
+		t.Fatalf("ListBuckets = %+v, %v", out, e)
+	}
+
+	putString(t, client, "docs", "a b+c.txt", "presigned")
+	presigned, e := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("docs"), Key: aws.String("a b+c.txt"),
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	resp, e = http.Get(presigned.URL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "presigned" {
+		t.Fatalf("presigned GET = %d %q", resp.StatusCode, body)
+	}
+	resp, e = http.Get(strings.Replace(presigned.URL, "X-Amz-Signature=", "X-Amz-Signature=0", 1))
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("tampered presigned GET status = %d", resp.StatusCode)
+	}
+}
+
+func TestS3Objects(t *testing.T) {
+	server, _, root := newTestGateway(t)
+	ctx := context.Background()
+	client := newClient(server, testAccessKey, testSecret)
+	if e := os.Mkdir(filepath.Join(root, "docs"), 0755); e != nil {
+		t.Fatal(e)
+	}
+
+	putString(t, client, "docs", "notes/2024/a.txt", "hello s3")
+	if b, e := os.ReadFile(filepath.Join(root, "docs", "notes", "2024", "a.txt")); e != nil || string(b) != "hello s3" {
+		t.Fatalf("uploaded content = %q, %v", b, e)
+	}
+	if got := getString(t, client, "docs", "notes/2024/a.txt", nil); got != "hello s3" {
+		t.Fatalf("GetObject = %q", got)
+	}
+	if got := getString(t, client, "docs", "notes/2024/a.txt", aws.String("bytes=6-")); got != "s3" {
+		t.Fatalf("GetObject with range = %q", got)
+	}
+	if got := getString(t, client, "docs", "notes/2024/a.txt", aws.String("bytes=-5")); got != "lo s3" {
+		t.Fatalf("GetObject with suffix range = %q", got)
+	}
+	head, e := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("docs"), Key: aws.String("notes/2024/a.txt")})
+	if e != nil || *head.ContentLength != 8 {
+		t.Fatalf("HeadObject = %+v, %v", head, e)
+	}
+	if _, e := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("docs"), Key: aws.String("missing")}); errorCode(e) != "NotFound" {
+		t.Fatalf("HeadObject of a missing key: %v", e)
+	}
+	if _, e := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("nope"), Key: aws.String("a")}); errorCode(e) != "NoSuchBucket" {
+		t.Fatalf("GetObject in a missing bucket: %v", e)
+	}
+	if _, e := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("docs"), Key: aws.String("notes")}); errorCode(e) != "NoSuchKey" {
+		t.Fatalf("GetObject of a directory: %v", e)
+	}
+
+	if _, e := client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket: aws.String("docs"), Key: aws.String("copy/a.txt"), CopySource: aws.String("docs/notes/2024/a.txt"),
+	}); e != nil {
+		t.Fatalf("CopyObject: %v", e)
+	}
+	if got := getString(t, client, "docs", "copy/a.txt", nil); got != "hello s3" {
+		t.Fatalf("copied content = %q", got)
+	}
+
+	if _, e := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("docs"), Key: aws.String("empty/"), Body: bytes.NewReader(nil),
+	}); e != nil {
+		t.Fatalf("PutObject of a directory: %v", e)
+	}
+	if stat, e := os.Stat(filepath.Join(root, "docs", "empty")); e != nil || !stat.IsDir() {
+		t.Fatalf("directory was not created: %v", e)
+	}
+
+	if _, e := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("docs"), Key: aws.String("copy/a.txt")}); e != nil {
+		t.Fatalf("DeleteObject: %v", e)
+	}
+	if _, e := os.Stat(filepath.Join(root, "docs", "copy", "a.txt")); !os.IsNotExist(e) {
+		t.Fatalf("deleted object still exists: %v", e)
+	}
+	deleted, e := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String("docs"),
+		Delete: &s3types.Delete{Objects: []s3types.ObjectIdentifier{{Key: aws.String("empty/")}, {Key: aws.String("missing")}}},
+	})
+	if e != nil || len(deleted.Deleted) != 2 || len(deleted.Errors) != 0 {
+		t.Fatalf("DeleteObjects = %+v, %v", deleted, e)
+	}
+	if _, e := os.Stat(filepath.Join(root, "docs", "empty")); !os.IsNotExist(e) {
+		t.Fatalf("deleted directory still exists: %v", e)
+	}
+
+	if _, e := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("docs"), Key: aws.String("../outside.txt"), Body: strings.NewReader("x"),
+	}); e == nil {
+		t.Fatal("keys escaping the bucket should be rejected")
+	}
+}
+
+func TestS3ListObjects(t *testing.T) {
+	server, _, root := newTestGateway(t)
+	client := newClient(server, testAccessKey, testSecret)
+	if e := os.Mkdir(filepath.Join(root, "b"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	for _, key := range []string{"a.txt", "a/1.txt", "a/2/x.txt", "a-b.txt", "c.txt"} {
+		putString(t, client, "b", key, key)
+	}
+
+	keys, _, _ := listKeys(t, client, &s3.ListObjectsV2Input{Bucket: aws.String("b")})
+	if got := strings.Join(keys, ","); got != "a-b.txt,a.txt,a/1.txt,a/2/x.txt,c.txt" {
+		t.Fatalf("keys = %s", got)
+	}
+
+	keys, prefixes, _ := listKeys(t, client, &s3.ListObjectsV2Input{Bucket: aws.String("b"), Delimiter: aws.String("/")})
+	if strings.Join(keys, ",") != "a-b.txt,a.txt,c.txt" || strings.Join(prefixes, ",") != "a/" {
+		t.Fatalf("keys = %v, prefixes = %v", keys, prefixes)
+	}
+
+	keys, prefixes, _ = listKeys(t, client, &s3.ListObjectsV2Input{
+		Bucket: aws.String("b"), Prefix: aws.String("a/"), Delimiter: aws.String("/"),
+	})
+	if strings.Join(keys, ",") != "a/1.txt" || strings.Join(prefixes, ",") != "a/2/" {
+		t.Fatalf("keys = %v, prefixes = %v", keys, prefixes)
+	}
+
+	all := make([]string, 0)
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String("b"), MaxKeys: aws.Int32(2)})
+	pages := 0
+	for paginator.HasMorePages() {
+		out, e := paginator.NextPage(context.Background())
+		if e != nil {
+			t.Fatal(e)
+		}
+		pages++
+		for _, o := range out.Contents {
+			all = append(all, *o.Key)
+		}
+	}
+	if pages != 3 || strings.Join(all, ",") != "a-b.txt,a.txt,a/1.txt,a/2/x.txt,c.txt" {
+		t.Fatalf("paginated %d pages: %v", pages, all)
+	}
+
+	v1, e := client.ListObjects(context.Background(), &s3.ListObjectsInput{Bucket: aws.String("b"), Marker: aws.String("a/1.txt")})
+	if e != nil || len(v1.Contents) != 2 || *v1.Contents[0].Key != "a/2/x.txt" {
+		t.Fatalf("ListObjects = %+v, %v", v1, e)
+	}
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	server, _, root := newTestGateway(t)
+	ctx := context.Background()
+	client := newClient(server, testAccessKey, testSecret)
+	if e := os.Mkdir(filepath.Join(root, "b"), 0755); e != nil {
+		t.Fatal(e)
+	}
+
+	created, e := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("big.bin")})
+	if e != nil {
+		t.Fatalf("CreateMultipartUpload: %v", e)
+	}
+	parts := []string{strings.Repeat("a", 1024), strings.Repeat("b", 512)}
+	completed := make([]s3types.CompletedPart, 0)
+	for i, content := range parts {
+		out, e := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket: aws.String("b"), Key: aws.String("big.bin"), UploadId: created.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)), Body: strings.NewReader(content),
+		})
+		if e != nil {
+			t.Fatalf("UploadPart %d: %v", i+1, e)
+		}
+		completed = append(completed, s3types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(int32(i + 1))})
+	}
+
+	if _, e := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("b"), Key: aws.String("big.bin"), UploadId: created.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: []s3types.CompletedPart{
+			{ETag: aws.String("\"0\""), PartNumber: aws.Int32(1)},
+		}},
+	}); errorCode(e) != "InvalidPart" {
+		t.Fatalf("completing with a wrong ETag: %v", e)
+	}
+
+	out, e := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("b"), Key: aws.String("big.bin"), UploadId: created.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if e != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", e)
+	}
+	if !strings.HasSuffix(strings.Trim(*out.ETag, "\""), "-2") {
+		t.Fatalf("multipart ETag = %s", *out.ETag)
+	}
+	if b, e := os.ReadFile(filepath.Join(root, "b", "big.bin")); e != nil || string(b) != parts[0]+parts[1] {
+		t.Fatalf("completed content length = %d, %v", len(b), e)
+	}
+
+	aborted, e := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("x")})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket: aws.String("b"), Key: aws.String("x"), UploadId: aborted.UploadId,
+	}); e != nil {
+		t.Fatalf("AbortMultipartUpload: %v", e)
+	}
+	if _, e := client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket: aws.String("b"), Key: aws.String("x"), UploadId: aborted.UploadId,
+		PartNumber: aws.Int32(1), Body: strings.NewReader("x"),
+	}); errorCode(e) != "NoSuchUpload" {
+		t.Fatalf("UploadPart after abort: %v", e)
+	}
+}
+
+func TestS3PutObjectWithTrailingChecksum(t *testing.T) {
+	server, _, root := newTestGateway(t)
+	tlsServer := httptest.NewUnstartedServer(server.Config.Handler)
+	tlsServer.StartTLS()
+	t.Cleanup(tlsServer.Close)
+	if e := os.Mkdir(filepath.Join(root, "b"), 0755); e != nil {
+		t.Fatal(e)
+	}
+
+	// over HTTPS, the SDK sends the payload unsigned with a trailing checksum
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(tlsServer.URL + "/s3"),
+		UsePathStyle: true,
+		HTTPClient:   tlsServer.Client(),
+		Credentials:  credentials.NewStaticCredentialsProvider(testAccessKey, testSecret, ""),
+	})
+	content := strings.Repeat("0123456789", 10000)
+	if _, e := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("b"), Key: aws.String("k.txt"), Body: strings.NewReader(content),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+	}); e != nil {
+		t.Fatalf("PutObject: %v", e)
+	}
+	if b, e := os.ReadFile(filepath.Join(root, "b", "k.txt")); e != nil || string(b) != content {
+		t.Fatalf("uploaded %d bytes, %v", len(b), e)
+	}
+}
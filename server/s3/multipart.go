@@ -0,0 +1,300 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"go-drive/common/driveutil"
+	"go-drive/common/task"
+	"go-drive/common/utils"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	multipartDirName  = "s3-multipart"
+	multipartExpiry   = 24 * time.Hour
+	multipartCleanup  = time.Hour
+	maxPartNumber     = 10000
+	uploadMetaFile    = "upload.json"
+	uploadIDBytes     = 16
+	partFileExtension = ".part"
+)
+
+// multipartStore keeps the parts of the multipart uploads in the temp directory until they are completed.
+// Uploads that are neither completed nor aborted are removed after multipartExpiry.
+type multipartStore struct {
+	dir  string
+	stop func()
+}
+
+type multipartUpload struct {
+	Username  string `json:"username"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+func newMultipartStore(tempDir string) (*multipartStore, error) {
+	dir := filepath.Join(tempDir, multipartDirName)
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return nil, e
+	}
+	s := &multipartStore{dir: dir}
+	s.stop = utils.TimeTick(s.clean, multipartCleanup)
+	return s, nil
+}
+
+func (s *multipartStore) uploadDir(id string) (string, bool) {
+	if len(id) != uploadIDBytes*2 {
+		return "", false
+	}
+	if _, e := hex.DecodeString(id); e != nil {
+		return "", false
+	}
+	return filepath.Join(s.dir, id), true
+}
+
+func (s *multipartStore) create(upload multipartUpload) (string, error) {
+	id := hex.EncodeToString(utils.RandSecret(uploadIDBytes))
+	dir, _ := s.uploadDir(id)
+	if e := os.Mkdir(dir, 0755); e != nil {
+		return "", e
+	}
+	data, e := json.Marshal(upload)
+	if e != nil {
+		return "", e
+	}
+	if e := os.WriteFile(filepath.Join(dir, uploadMetaFile), data, 0644); e != nil {
+		_ = os.RemoveAll(dir)
+		return "", e
+	}
+	return id, nil
+}
+
+// get returns the directory of the upload, which must be created by the user for the same object
+func (s *multipartStore) get(id string, upload multipartUpload) (string, error) {
+	dir, ok := s.uploadDir(id)
+	if !ok {
+		return "", errNoSuchUpload
+	}
+	data, e := os.ReadFile(filepath.Join(dir, uploadMetaFile))
+	if e != nil {
+		if os.IsNotExist(e) {
+			return "", errNoSuchUpload
+		}
+		return "", e
+	}
+	saved := multipartUpload{}
+	if e := json.Unmarshal(data, &saved); e != nil {
+		return "", e
+	}
+	if saved.Username != upload.Username || saved.Bucket != upload.Bucket || saved.Key != upload.Key {
+		return "", errNoSuchUpload
+	}
+	return dir, nil
+}
+
+func (s *multipartStore) clean() {
+	entries, e := os.ReadDir(s.dir)
+	if e != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, e := entry.Info()
+		if e != nil || time.Since(info.ModTime()) < multipartExpiry {
+			continue
+		}
+		if e := os.RemoveAll(filepath.Join(s.dir, entry.Name())); e != nil {
+			log.Printf("[s3] failed to remove expired multipart upload %s: %v", entry.Name(), e)
+		}
+	}
+}
+
+func (s *multipartStore) Dispose() error {
+	s.stop()
+	return nil
+}
+
+func requestUpload(req *request) multipartUpload {
+	return multipartUpload{Username: req.sig.user.Username, Bucket: req.bucket, Key: req.key}
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (g *Gateway) createMultipartUpload(req *request) error {
+	if strings.HasSuffix(req.key, "/") {
+		return errInvalidArgument("Objects with keys ending with '/' must be empty.")
+	}
+	if _, e := objectPath(req.bucket, req.key); e != nil {
+		return e
+	}
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	upload := requestUpload(req)
+	upload.CreatedAt = time.Now().UnixMilli()
+	id, e := g.uploads.create(upload)
+	if e != nil {
+		return e
+	}
+	writeXML(req.w, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    s3XMLNamespace,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		UploadID: id,
+	})
+	return nil
+}
+
+func (g *Gateway) uploadPart(req *request, uploadID string) error {
+	partNumber, e := strconv.Atoi(req.query.Get("partNumber"))
+	if e != nil || partNumber < 1 || partNumber > maxPartNumber {
+		return errInvalidArgument("Part number must be an integer between 1 and 10000, inclusive")
+	}
+	dir, e := g.uploads.get(uploadID, requestUpload(req))
+	if e != nil {
+		return e
+	}
+	reader, _, e := payloadReader(req.r, req.sig)
+	if e != nil {
+		return e
+	}
+	h := md5.New()
+	file, e := driveutil.CopyReaderToTempFile(task.NewContextWrapper(req.ctx), io.TeeReader(reader, h), dir)
+	if e != nil {
+		return e
+	}
+	_ = file.Close()
+	etag := hex.EncodeToString(h.Sum(nil))
+	partFile := filepath.Join(dir, strconv.Itoa(partNumber)+partFileExtension)
+	// the stale ETag is removed first, so that a failed upload never leaves a part with a wrong ETag
+	_ = os.Remove(partFile + ".etag")
+	if e := os.Rename(file.Name(), partFile); e != nil {
+		_ = os.Remove(file.Name())
+		return e
+	}
+	if e := os.WriteFile(partFile+".etag", []byte(etag), 0644); e != nil {
+		return e
+	}
+	req.w.Header().Set("ETag", "\""+etag+"\"")
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (g *Gateway) completeMultipartUpload(req *request, uploadID string) error {
+	path, e := objectPath(req.bucket, req.key)
+	if e != nil {
+		return e
+	}
+	dir, e := g.uploads.get(uploadID, requestUpload(req))
+	if e != nil {
+		return e
+	}
+	reader, _, e := payloadReader(req.r, req.sig)
+	if e != nil {
+		return e
+	}
+	body := completeMultipartUpload{}
+	if e := xml.NewDecoder(io.LimitReader(reader, 2<<20)).Decode(&body); e != nil {
+		var ae *apiError
+		if errors.As(e, &ae) {
+			return ae
+		}
+		return errMalformedXML
+	}
+	if len(body.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	readers := make([]io.Reader, 0, len(body.Parts))
+	etags := md5.New()
+	size := int64(0)
+	defer func() {
+		for _, r := range readers {
+			_ = r.(*os.File).Close()
+		}
+	}()
+	for i, part := range body.Parts {
+		if i > 0 && part.PartNumber <= body.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		partFile := filepath.Join(dir, strconv.Itoa(part.PartNumber)+partFileExtension)
+		etag, e := os.ReadFile(partFile + ".etag")
+		if e != nil || string(etag) != strings.Trim(part.ETag, "\"") {
+			return errInvalidPart
+		}
+		f, e := os.Open(partFile)
+		if e != nil {
+			return errInvalidPart
+		}
+		readers = append(readers, f)
+		stat, e := f.Stat()
+		if e != nil {
+			return e
+		}
+		size += stat.Size()
+		sum, _ := hex.DecodeString(string(etag))
+		etags.Write(sum)
+	}
+
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	if e := saveFile(req, path, io.MultiReader(readers...), size); e != nil {
+		return e
+	}
+	_ = os.RemoveAll(dir)
+
+	writeXML(req.w, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    s3XMLNamespace,
+		Location: req.r.URL.Path,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		ETag:     "\"" + hex.EncodeToString(etags.Sum(nil)) + "-" + strconv.Itoa(len(body.Parts)) + "\"",
+	})
+	return nil
+}
+
+func (g *Gateway) abortMultipartUpload(req *request, uploadID string) error {
+	dir, e := g.uploads.get(uploadID, requestUpload(req))
+	if e != nil {
+		return e
+	}
+	if e := os.RemoveAll(dir); e != nil {
+		return e
+	}
+	req.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
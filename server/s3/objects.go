@@ -0,0 +1,452 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// responseHeaderOverrides are the query parameters that override the headers of GetObject responses
+var responseHeaderOverrides = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-language":    "Content-Language",
+	"response-expires":             "Expires",
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+}
+
+// getEntry returns the entry of the object.
+// Directories are objects only when the key ends with '/', which are empty objects.
+func getEntry(req *request, key string) (types.IEntry, error) {
+	path, e := objectPath(req.bucket, key)
+	if e != nil {
+		return nil, e
+	}
+	entry, e := req.drive.Get(req.ctx, path)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			if be := checkBucket(req); be != nil {
+				return nil, be
+			}
+			return nil, errNoSuchKey
+		}
+		return nil, e
+	}
+	if entry.Type().IsDir() != strings.HasSuffix(key, "/") {
+		return nil, errNoSuchKey
+	}
+	return entry, nil
+}
+
+// getObject implements GetObject, and HeadObject if withBody is false
+func (g *Gateway) getObject(req *request, withBody bool) error {
+	entry, e := getEntry(req, req.key)
+	if e != nil {
+		return e
+	}
+	size := entry.Size()
+	if entry.Type().IsDir() || size < 0 {
+		size = 0
+	}
+	etag := entryETag(entry)
+	h := req.w.Header()
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", formatHTTPTime(entry.ModTime()))
+	h.Set("Accept-Ranges", "bytes")
+	contentType := mime.TypeByExtension("." + utils.PathExt(req.key))
+	if contentType == "" || entry.Type().IsDir() {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	for param, header := range responseHeaderOverrides {
+		if v := req.query.Get(param); v != "" {
+			h.Set(header, v)
+		}
+	}
+
+	if status := checkPreconditions(req.r, etag, entry.ModTime()); status != 0 {
+		if status == http.StatusPreconditionFailed {
+			return errPreconditionFailed
+		}
+		req.w.WriteHeader(status)
+		return nil
+	}
+
+	start, length := int64(0), size
+	status := http.StatusOK
+	if rangeHeader := req.r.Header.Get("Range"); rangeHeader != "" && !entry.Type().IsDir() {
+		rangeStart, rangeLength, ok, e := parseRange(rangeHeader, size)
+		if e != nil {
+			h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+			return e
+		}
+		if ok {
+			start, length = rangeStart, rangeLength
+			status = http.StatusPartialContent
+			h.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+
+				strconv.FormatInt(start+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+		}
+	}
+
+	if !withBody || length == 0 {
+		h.Set("Content-Length", strconv.FormatInt(length, 10))
+		req.w.WriteHeader(status)
+		return nil
+	}
+	reader, e := openRange(req, entry, start, length, status == http.StatusPartialContent)
+	if e != nil {
+		return e
+	}
+	defer func() { _ = reader.Close() }()
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	req.w.WriteHeader(status)
+	_, _ = io.CopyN(req.w, reader, length)
+	return nil
+}
+
+// openRange opens the reader of the range.
+// If the drive does not support range reading, the content before the range is skipped.
+func openRange(req *request, entry types.IEntry, start, length int64, partial bool) (io.ReadCloser, error) {
+	if !partial {
+		return driveutil.GetIContentReader(req.ctx, entry, -1, -1)
+	}
+	reader, e := driveutil.GetIContentReader(req.ctx, entry, start, length)
+	if e == nil || !err.IsUnsupportedError(e) {
+		return reader, e
+	}
+	reader, e = driveutil.GetIContentReader(req.ctx, entry, -1, -1)
+	if e != nil {
+		return nil, e
+	}
+	if _, e := io.CopyN(io.Discard, reader, start); e != nil {
+		_ = reader.Close()
+		return nil, e
+	}
+	return reader, nil
+}
+
+// parseRange parses the single byte range of the Range header.
+// ok is false if the header should be ignored, such as multiple ranges.
+func parseRange(header string, size int64) (start, length int64, ok bool, e error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+	if first == "" {
+		// the last n bytes
+		n, pe := strconv.ParseInt(last, 10, 64)
+		if pe != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+	start, pe := strconv.ParseInt(first, 10, 64)
+	if pe != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	end := size - 1
+	if last != "" {
+		end, pe = strconv.ParseInt(last, 10, 64)
+		if pe != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true, nil
+}
+
+// checkPreconditions evaluates the conditional headers,
+// it returns 0 if the request should be served, or the status code to respond.
+func checkPreconditions(r *http.Request, etag string, modTime int64) int {
+	lastModified := utils.Time(modTime).Truncate(1e9)
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !matchETag(ifMatch, etag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t, e := http.ParseTime(r.Header.Get("If-Unmodified-Since")); e == nil && lastModified.After(t) {
+		return http.StatusPreconditionFailed
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, etag) {
+			return http.StatusNotModified
+		}
+	} else if t, e := http.ParseTime(r.Header.Get("If-Modified-Since")); e == nil && !lastModified.After(t) {
+		return http.StatusNotModified
+	}
+	return 0
+}
+
+func matchETag(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.Trim(v, "\"") == strings.Trim(etag, "\"") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Gateway) putObject(req *request) error {
+	path, e := objectPath(req.bucket, req.key)
+	if e != nil {
+		return e
+	}
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	reader, _, e := payloadReader(req.r, req.sig)
+	if e != nil {
+		return e
+	}
+	h := md5.New()
+	file, e := driveutil.CopyReaderToTempFile(task.NewContextWrapper(req.ctx), io.TeeReader(reader, h), g.tempDir)
+	if e != nil {
+		return e
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	etag := "\"" + hex.EncodeToString(h.Sum(nil)) + "\""
+
+	if strings.HasSuffix(req.key, "/") {
+		// a key ending with '/' with no content is a directory, as created by most S3 clients
+		if stat, e := file.Stat(); e != nil || stat.Size() > 0 {
+			return errInvalidArgument("Objects with keys ending with '/' must be empty.")
+		}
+		if e := makeDirs(req, path); e != nil {
+			return e
+		}
+		req.w.Header().Set("ETag", etag)
+		req.w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	stat, e := file.Stat()
+	if e != nil {
+		return e
+	}
+	if e := saveFile(req, path, file, stat.Size()); e != nil {
+		return e
+	}
+	req.w.Header().Set("ETag", etag)
+	req.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// saveFile saves the content to path, the missing parent directories are created
+func saveFile(req *request, path string, reader io.Reader, size int64) error {
+	if e := makeDirs(req, utils.PathParent(path)); e != nil {
+		return e
+	}
+	existing, e := req.drive.Get(req.ctx, path)
+	if e == nil && existing.Type().IsDir() {
+		return errInvalidRequest("A directory exists at the key.")
+	}
+	_, e = req.drive.Save(task.NewContextWrapper(req.ctx), path, size, true, reader)
+	return e
+}
+
+// makeDirs creates the directory and its missing parents inside the bucket
+func makeDirs(req *request, path string) error {
+	if path == req.bucket {
+		return nil
+	}
+	entry, e := req.drive.Get(req.ctx, path)
+	if e == nil {
+		if !entry.Type().IsDir() {
+			return errInvalidRequest("A file exists at the parent of the key.")
+		}
+		return nil
+	}
+	if !err.IsNotFoundError(e) {
+		return e
+	}
+	if e := makeDirs(req, utils.PathParent(path)); e != nil {
+		return e
+	}
+	_, e = req.drive.MakeDir(req.ctx, path)
+	return e
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+func (g *Gateway) copyObject(req *request, copySource string) error {
+	source, e := url.PathUnescape(copySource)
+	if e != nil {
+		return errInvalidArgument("Copy Source must mention the source bucket and key: sourcebucket/sourcekey.")
+	}
+	source, _, _ = strings.Cut(source, "?versionId=")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if srcBucket == "" || srcKey == "" || strings.HasSuffix(srcKey, "/") {
+		return errInvalidArgument("Copy Source must mention the source bucket and key: sourcebucket/sourcekey.")
+	}
+	path, e := objectPath(req.bucket, req.key)
+	if e != nil {
+		return e
+	}
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	srcReq := *req
+	srcReq.bucket = srcBucket
+	from, e := getEntry(&srcReq, srcKey)
+	if e != nil {
+		return e
+	}
+	if from.Path() == path {
+		// copying an object to itself only replaces its metadata, which is not supported
+		return errInvalidRequest("This copy request is illegal because it is trying to copy an object to itself.")
+	}
+	if e := makeDirs(req, utils.PathParent(path)); e != nil {
+		return e
+	}
+	entry, e := req.drive.Copy(task.NewContextWrapper(req.ctx), from, path, true)
+	if err.IsUnsupportedError(e) {
+		entry, e = copyContent(req, from, path)
+	}
+	if e != nil {
+		return e
+	}
+	writeXML(req.w, http.StatusOK, copyObjectResult{
+		Xmlns:        s3XMLNamespace,
+		LastModified: formatTime(entry.ModTime()),
+		ETag:         entryETag(entry),
+	})
+	return nil
+}
+
+// copyContent copies the file by its content, for the drives that can't copy by themselves
+func copyContent(req *request, from types.IEntry, path string) (types.IEntry, error) {
+	reader, e := driveutil.GetIContentReader(req.ctx, from, -1, -1)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = reader.Close() }()
+	return req.drive.Save(task.NewContextWrapper(req.ctx), path, from.Size(), true, reader)
+}
+
+func (g *Gateway) deleteObject(req *request) error {
+	if e := deleteKey(req, req.key); e != nil {
+		return e
+	}
+	req.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deleteKey deletes the object, deleting a missing object succeeds as S3 does.
+// Directories are deleted only when they are empty.
+func deleteKey(req *request, key string) error {
+	entry, e := getEntry(req, key)
+	if e != nil {
+		if errors.Is(e, errNoSuchKey) {
+			return nil
+		}
+		return e
+	}
+	if entry.Type().IsDir() {
+		children, e := req.drive.List(req.ctx, entry.Path())
+		if e != nil {
+			return e
+		}
+		if len(children) > 0 {
+			return nil
+		}
+	}
+	return req.drive.Delete(task.NewContextWrapper(req.ctx), entry.Path())
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+const maxDeleteObjects = 1000
+
+func (g *Gateway) deleteObjects(req *request) error {
+	reader, _, e := payloadReader(req.r, req.sig)
+	if e != nil {
+		return e
+	}
+	body := deleteRequest{}
+	if e := xml.NewDecoder(io.LimitReader(reader, 2<<20)).Decode(&body); e != nil {
+		var ae *apiError
+		if errors.As(e, &ae) {
+			return ae
+		}
+		return errMalformedXML
+	}
+	if len(body.Objects) == 0 || len(body.Objects) > maxDeleteObjects {
+		return errMalformedXML
+	}
+	if e := checkBucket(req); e != nil {
+		return e
+	}
+	result := deleteResult{Xmlns: s3XMLNamespace, Deleted: make([]deletedObject, 0), Errors: make([]deleteError, 0)}
+	for _, o := range body.Objects {
+		if e := deleteKey(req, o.Key); e != nil {
+			ae := toAPIError(e)
+			result.Errors = append(result.Errors, deleteError{Key: o.Key, Code: ae.Code, Message: ae.Message})
+			continue
+		}
+		if !body.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: o.Key})
+		}
+	}
+	writeXML(req.w, http.StatusOK, result)
+	return nil
+}
+
+func hexMD5(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,277 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxChunkHeaderSize = 4096
+
+// payloadReader returns the reader of the request body.
+// The aws-chunked encoding is decoded, and the signatures and hashes declared by
+// the request are verified, the reader fails at EOF if any of them mismatch.
+func payloadReader(r *http.Request, sig *signature) (io.Reader, int64, error) {
+	size := r.ContentLength
+	var reader io.Reader = r.Body
+	switch sig.payload {
+	case streamingSignedPayload, streamingSignedPayloadTrailer, streamingUnsignedPayloadTrailer:
+		decoded, e := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if e != nil || decoded < 0 {
+			return nil, 0, newError("MissingContentLength", http.StatusLengthRequired,
+				"You must provide the x-amz-decoded-content-length HTTP header.")
+		}
+		size = decoded
+		cr := &chunkedReader{
+			r:       bufio.NewReaderSize(r.Body, maxChunkHeaderSize),
+			trailer: sig.payload != streamingSignedPayload,
+		}
+		if sig.payload != streamingUnsignedPayloadTrailer {
+			cr.sig = sig
+			cr.prevSignature = sig.seed
+		}
+		reader = cr
+	case unsignedPayload:
+	default:
+		expected, e := hex.DecodeString(sig.payload)
+		if e != nil || len(expected) != sha256.Size {
+			return nil, 0, errContentSHA256Mismatch
+		}
+		reader = newVerifyingReader(reader, sha256.New(), expected, errContentSHA256Mismatch)
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		expected, e := base64.StdEncoding.DecodeString(contentMD5)
+		if e != nil || len(expected) != md5.Size {
+			return nil, 0, errInvalidDigest
+		}
+		reader = newVerifyingReader(reader, md5.New(), expected, errBadDigest)
+	}
+	if size >= 0 {
+		reader = &sizedReader{r: reader, remaining: size}
+	}
+	return reader, size, nil
+}
+
+// verifyingReader compares the hash of the content with the expected one at EOF
+type verifyingReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected []byte
+	mismatch error
+}
+
+func newVerifyingReader(r io.Reader, h hash.Hash, expected []byte, mismatch error) *verifyingReader {
+	return &verifyingReader{r: r, h: h, expected: expected, mismatch: mismatch}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, e := v.r.Read(p)
+	v.h.Write(p[:n])
+	if e == io.EOF && !bytes.Equal(v.h.Sum(nil), v.expected) {
+		return n, v.mismatch
+	}
+	return n, e
+}
+
+// sizedReader fails if the content is shorter or longer than the declared size
+type sizedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	n, e := s.r.Read(p)
+	s.remaining -= int64(n)
+	if s.remaining < 0 || (e == io.EOF && s.remaining > 0) {
+		return n, errIncompleteBody
+	}
+	return n, e
+}
+
+var errMalformedChunk = errInvalidRequest("The aws-chunked payload is malformed.")
+
+// chunkedReader decodes the aws-chunked payload.
+// When sig is not nil, the signature of every chunk and of the trailers is verified.
+type chunkedReader struct {
+	r       *bufio.Reader
+	sig     *signature
+	trailer bool
+
+	prevSignature string
+	chunkSig      string
+	chunkHash     hash.Hash
+	remaining     int64
+	done          bool
+	e             error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.e != nil {
+		return 0, c.e
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.chunkHash == nil {
+		if c.e = c.readChunkHeader(); c.e != nil {
+			return 0, c.e
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, e := c.r.Read(p)
+	c.chunkHash.Write(p[:n])
+	c.remaining -= int64(n)
+	if e != nil {
+		if e == io.EOF {
+			e = io.ErrUnexpectedEOF
+		}
+		c.e = e
+		return n, e
+	}
+	if c.remaining == 0 {
+		if e := c.expectCRLF(); e != nil {
+			c.e = e
+			return n, e
+		}
+		if e := c.verifyChunk(); e != nil {
+			c.e = e
+			return n, e
+		}
+		c.chunkHash = nil
+	}
+	return n, nil
+}
+
+// readChunkHeader reads the line of '<hex size>[;chunk-signature=<signature>]'
+func (c *chunkedReader) readChunkHeader() error {
+	line, e := c.readLine()
+	if e != nil {
+		return e
+	}
+	sizeStr, ext, _ := strings.Cut(line, ";")
+	size, e := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+	if e != nil || size < 0 {
+		return errMalformedChunk
+	}
+	c.chunkSig = ""
+	if k, v, ok := strings.Cut(ext, "="); ok && strings.TrimSpace(k) == "chunk-signature" {
+		c.chunkSig = strings.TrimSpace(v)
+	}
+	if c.sig != nil && c.chunkSig == "" {
+		return errMalformedChunk
+	}
+	c.chunkHash = sha256.New()
+	c.remaining = size
+	if size > 0 {
+		return nil
+	}
+
+	// the last chunk
+	if e := c.verifyChunk(); e != nil {
+		return e
+	}
+	if c.trailer {
+		if e := c.readTrailers(); e != nil {
+			return e
+		}
+	} else if e := c.expectCRLF(); e != nil {
+		return e
+	}
+	c.done = true
+	return nil
+}
+
+func (c *chunkedReader) verifyChunk() error {
+	if c.sig == nil {
+		return nil
+	}
+	stringToSign := "AWS4-HMAC-SHA256-PAYLOAD\n" + c.sig.date + "\n" + c.sig.scope + "\n" +
+		c.prevSignature + "\n" + emptySHA256 + "\n" + hex.EncodeToString(c.chunkHash.Sum(nil))
+	if !c.checkSignature(stringToSign, c.chunkSig) {
+		return errSignatureDoesNotMatch
+	}
+	c.prevSignature = c.chunkSig
+	return nil
+}
+
+// readTrailers reads the trailing headers that end with an empty line.
+// The trailing checksums are not verified, but the signature of signed trailers is.
+func (c *chunkedReader) readTrailers() error {
+	trailers := strings.Builder{}
+	trailerSig := ""
+	for {
+		line, e := c.readLine()
+		if errors.Is(e, io.EOF) || (e == nil && line == "") {
+			break
+		}
+		if e != nil {
+			return e
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return errMalformedChunk
+		}
+		if k == "x-amz-trailer-signature" {
+			trailerSig = strings.TrimSpace(v)
+			continue
+		}
+		trailers.WriteString(strings.TrimSpace(k) + ":" + strings.TrimSpace(v) + "\n")
+	}
+	if c.sig == nil {
+		return nil
+	}
+	stringToSign := "AWS4-HMAC-SHA256-TRAILER\n" + c.sig.date + "\n" + c.sig.scope + "\n" +
+		c.prevSignature + "\n" + hexSHA256([]byte(trailers.String()))
+	if !c.checkSignature(stringToSign, trailerSig) {
+		return errSignatureDoesNotMatch
+	}
+	return nil
+}
+
+func (c *chunkedReader) checkSignature(stringToSign, signature string) bool {
+	expected := hex.EncodeToString(hmacSHA256(c.sig.signingKey, stringToSign))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, e := c.r.ReadSlice('\n')
+	if e != nil {
+		if errors.Is(e, bufio.ErrBufferFull) {
+			return "", errMalformedChunk
+		}
+		if errors.Is(e, io.EOF) && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", e
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (c *chunkedReader) expectCRLF() error {
+	line, e := c.readLine()
+	if e != nil {
+		if errors.Is(e, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return e
+	}
+	if line != "" {
+		return errMalformedChunk
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// the example of the streaming upload in the AWS Signature Version 4 documentation
+const (
+	exampleSecret = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	exampleSeed   = "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9"
+)
+
+var exampleChunks = []struct {
+	size      int
+	signature string
+}{
+	{65536, "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"},
+	{1024, "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"},
+	{0, "b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9"},
+}
+
+func exampleStreamingRequest(t *testing.T, tamper bool) (*http.Request, *signature) {
+	t.Helper()
+	body := bytes.Buffer{}
+	for i, c := range exampleChunks {
+		body.WriteString(strconv.FormatInt(int64(c.size), 16) + ";chunk-signature=" + c.signature + "\r\n")
+		data := strings.Repeat("a", c.size)
+		if tamper && i == 1 {
+			data = strings.Repeat("b", c.size)
+		}
+		body.WriteString(data + "\r\n")
+	}
+	r, e := http.NewRequest(http.MethodPut, "/examplebucket/chunkObject.txt", &body)
+	if e != nil {
+		t.Fatal(e)
+	}
+	r.Header.Set("X-Amz-Decoded-Content-Length", "66560")
+	return r, &signature{
+		signingKey: deriveSigningKey(exampleSecret, "20130524", "us-east-1", "s3"),
+		date:       "20130524T000000Z",
+		scope:      "20130524/us-east-1/s3/aws4_request",
+		seed:       exampleSeed,
+		payload:    streamingSignedPayload,
+	}
+}
+
+func TestChunkedReaderVerifiesSignatures(t *testing.T) {
+	r, sig := exampleStreamingRequest(t, false)
+	reader, size, e := payloadReader(r, sig)
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, e := io.ReadAll(reader)
+	if e != nil {
+		t.Fatalf("reading the payload: %v", e)
+	}
+	if size != 66560 || len(data) != 66560 || strings.Trim(string(data), "a") != "" {
+		t.Fatalf("decoded %d bytes, size = %d", len(data), size)
+	}
+
+	r, sig = exampleStreamingRequest(t, true)
+	reader, _, e = payloadReader(r, sig)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := io.ReadAll(reader); e != errSignatureDoesNotMatch {
+		t.Fatalf("tampered chunk: %v", e)
+	}
+}
+
+func TestChunkedReaderUnsignedTrailer(t *testing.T) {
+	body := "5\r\nhello\r\n6\r\n world\r\n0\r\nx-amz-checksum-crc32:DUoRhQ==\r\n\r\n"
+	r, _ := http.NewRequest(http.MethodPut, "/b/k", strings.NewReader(body))
+	r.Header.Set("X-Amz-Decoded-Content-Length", "11")
+	reader, _, e := payloadReader(r, &signature{payload: streamingUnsignedPayloadTrailer})
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, e := io.ReadAll(reader)
+	if e != nil || string(data) != "hello world" {
+		t.Fatalf("decoded %q, %v", data, e)
+	}
+
+	r, _ = http.NewRequest(http.MethodPut, "/b/k", strings.NewReader(body))
+	r.Header.Set("X-Amz-Decoded-Content-Length", "12")
+	reader, _, _ = payloadReader(r, &signature{payload: streamingUnsignedPayloadTrailer})
+	if _, e := io.ReadAll(reader); e != errIncompleteBody {
+		t.Fatalf("short payload: %v", e)
+	}
+}
+
+func TestPayloadReaderVerifiesSHA256(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodPut, "/b/k", strings.NewReader("hello"))
+	reader, _, e := payloadReader(r, &signature{payload: hexSHA256([]byte("hellO"))})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := io.ReadAll(reader); e != errContentSHA256Mismatch {
+		t.Fatalf("mismatched payload: %v", e)
+	}
+}
@@ -0,0 +1,315 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm     = "AWS4-HMAC-SHA256"
+	amzDateFormat     = "20060102T150405Z"
+	maxClockSkew      = 15 * time.Minute
+	maxPresignExpires = 7 * 24 * time.Hour
+
+	unsignedPayload                 = "UNSIGNED-PAYLOAD"
+	streamingSignedPayload          = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingSignedPayloadTrailer   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signature is the verified signature of a request.
+// The signing key and the seed signature are kept to verify the chunks of streaming payloads.
+type signature struct {
+	user       types.User
+	signingKey []byte
+	date       string
+	scope      string
+	seed       string
+	// payload is the declared payload hash, the value of x-amz-content-sha256
+	payload string
+}
+
+type signedRequest struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	payload       string
+	presigned     bool
+}
+
+// authenticate verifies the AWS Signature Version 4 of the request,
+// the signature can be either in the Authorization header or in the query of a presigned URL.
+func (g *Gateway) authenticate(r *http.Request) (*signature, error) {
+	var (
+		sr *signedRequest
+		e  error
+	)
+	if r.URL.Query().Has("X-Amz-Algorithm") {
+		sr, e = parsePresigned(r, g.now())
+	} else {
+		sr, e = parseAuthorization(r, g.now())
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	key, e := g.keys.GetAccessKey(sr.accessKey)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return nil, errInvalidAccessKeyID
+		}
+		return nil, e
+	}
+	user, e := g.users.GetUser(key.Username)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return nil, errInvalidAccessKeyID
+		}
+		return nil, e
+	}
+
+	scope := sr.date[:8] + "/" + sr.region + "/" + sr.service + "/aws4_request"
+	signingKey := deriveSigningKey(key.Secret, sr.date[:8], sr.region, sr.service)
+	stringToSign := signAlgorithm + "\n" + sr.date + "\n" + scope + "\n" +
+		hexSHA256([]byte(canonicalRequest(r, sr)))
+	expected := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(sr.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+	return &signature{
+		user:       user,
+		signingKey: signingKey,
+		date:       sr.date,
+		scope:      scope,
+		seed:       sr.signature,
+		payload:    sr.payload,
+	}, nil
+}
+
+func parseAuthorization(r *http.Request, now time.Time) (*signedRequest, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, errAccessDenied
+	}
+	if !strings.HasPrefix(auth, signAlgorithm+" ") {
+		return nil, errInvalidRequest("Only the AWS Signature Version 4 is supported.")
+	}
+	sr := &signedRequest{}
+	var credential, signedHeaders string
+	for _, field := range strings.Split(strings.TrimPrefix(auth, signAlgorithm+" "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			signedHeaders = v
+		case "Signature":
+			sr.signature = v
+		}
+	}
+	if e := sr.parseCredential(credential, signedHeaders); e != nil {
+		return nil, e
+	}
+	if sr.signature == "" {
+		return nil, errInvalidRequest("The authorization header is malformed.")
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	t, e := time.Parse(amzDateFormat, date)
+	if e != nil {
+		t, e = http.ParseTime(r.Header.Get("Date"))
+		if e != nil {
+			return nil, errAccessDenied
+		}
+		date = t.UTC().Format(amzDateFormat)
+	}
+	if e := sr.checkDate(date); e != nil {
+		return nil, e
+	}
+	if d := now.Sub(t); d > maxClockSkew || d < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	sr.payload = r.Header.Get("X-Amz-Content-Sha256")
+	if sr.payload == "" {
+		return nil, errInvalidRequest("Missing required header for this request: x-amz-content-sha256")
+	}
+	return sr, nil
+}
+
+func parsePresigned(r *http.Request, now time.Time) (*signedRequest, error) {
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") != signAlgorithm {
+		return nil, errInvalidRequest("Only the AWS Signature Version 4 is supported.")
+	}
+	sr := &signedRequest{presigned: true, signature: q.Get("X-Amz-Signature")}
+	if e := sr.parseCredential(q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders")); e != nil {
+		return nil, e
+	}
+	date := q.Get("X-Amz-Date")
+	if e := sr.checkDate(date); e != nil {
+		return nil, e
+	}
+	t, e := time.Parse(amzDateFormat, date)
+	if e != nil {
+		return nil, errAccessDenied
+	}
+	expires, e := strconv.ParseInt(q.Get("X-Amz-Expires"), 10, 64)
+	if e != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpires {
+		return nil, errInvalidArgument("X-Amz-Expires must be a number between 0 and 604800.")
+	}
+	if now.Before(t.Add(-maxClockSkew)) {
+		return nil, errAccessDenied
+	}
+	if now.After(t.Add(time.Duration(expires) * time.Second)) {
+		return nil, errExpiredRequest
+	}
+	sr.payload = q.Get("X-Amz-Content-Sha256")
+	if sr.payload == "" {
+		sr.payload = unsignedPayload
+	}
+	return sr, nil
+}
+
+// parseCredential parses the credential in the form of <access key>/<date>/<region>/<service>/aws4_request
+func (sr *signedRequest) parseCredential(credential, signedHeaders string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || parts[3] != "s3" || len(parts[1]) != 8 {
+		return errInvalidRequest("The credential is malformed.")
+	}
+	sr.accessKey, sr.date, sr.region, sr.service = parts[0], parts[1], parts[2], parts[3]
+	if signedHeaders == "" {
+		return errInvalidRequest("The signed headers are missing.")
+	}
+	sr.signedHeaders = strings.Split(signedHeaders, ";")
+	hasHost := false
+	for _, h := range sr.signedHeaders {
+		if h == "host" {
+			hasHost = true
+		}
+	}
+	if !hasHost {
+		return errAccessDenied
+	}
+	return nil
+}
+
+// checkDate checks the request date against the date of the credential scope,
+// the full request date replaces the date of the credential.
+func (sr *signedRequest) checkDate(date string) error {
+	if len(date) != len(amzDateFormat) || date[:8] != sr.date {
+		return errSignatureDoesNotMatch
+	}
+	sr.date = date
+	return nil
+}
+
+func canonicalRequest(r *http.Request, sr *signedRequest) string {
+	b := strings.Builder{}
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	uri := uriEncode(r.URL.Path, false)
+	if uri == "" {
+		uri = "/"
+	}
+	b.WriteString(uri)
+	b.WriteByte('\n')
+	b.WriteString(canonicalQuery(r, sr.presigned))
+	b.WriteByte('\n')
+	for _, name := range sr.signedHeaders {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(canonicalHeaderValue(r, name))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(sr.signedHeaders, ";"))
+	b.WriteByte('\n')
+	b.WriteString(sr.payload)
+	return b.String()
+}
+
+func canonicalQuery(r *http.Request, presigned bool) string {
+	pairs := make([]string, 0)
+	for k, values := range r.URL.Query() {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "transfer-encoding":
+		values = r.TransferEncoding
+	case "content-length":
+		if r.Header.Get("Content-Length") == "" && r.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		} else {
+			values = r.Header.Values(name)
+		}
+	default:
+		values = r.Header.Values(name)
+	}
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// uriEncode encodes the string as described in the AWS Signature Version 4,
+// all characters except the unreserved ones are percent-encoded.
+func uriEncode(s string, encodeSlash bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte("0123456789ABCDEF"[c>>4])
+		b.WriteByte("0123456789ABCDEF"[c&15])
+	}
+	return b.String()
+}
+
+func deriveSigningKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
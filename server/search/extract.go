@@ -0,0 +1,170 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// TextExtractor extracts the plain text from the file content.
+// maxSize is the budget of the text, the extractors stop decompressing and appending once it's used up.
+type TextExtractor func(data []byte, maxSize int) (string, error)
+
+// textExtractors is a registry for TextExtractor, map[extension]TextExtractor
+var textExtractors = make(map[string]TextExtractor)
+
+func RegisterTextExtractor(extensions []string, extractor TextExtractor) {
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if _, ok := textExtractors[ext]; ok {
+			panic("TextExtractor already registered: " + ext)
+		}
+		textExtractors[ext] = extractor
+	}
+}
+
+func init() {
+	RegisterTextExtractor([]string{
+		"txt", "text", "log", "csv", "tsv", "md", "markdown", "rst", "adoc",
+		"json", "yml", "yaml", "toml", "ini", "conf", "xml",
+	}, extractPlainText)
+	RegisterTextExtractor([]string{"html", "htm", "xhtml"}, extractHTMLText)
+	RegisterTextExtractor([]string{"pdf"}, extractPDFText)
+	RegisterTextExtractor([]string{"docx", "xlsx", "pptx"}, extractOOXMLText)
+}
+
+// contentExtractor extracts the text of the files for indexing
+type contentExtractor struct {
+	maxFileSize int64
+	maxTextSize int
+	extractors  map[string]TextExtractor
+}
+
+// newContentExtractor creates the contentExtractor, it returns nil if the extraction is disabled
+func newContentExtractor(c common.SearchContentConfig) *contentExtractor {
+	if !c.Enabled {
+		return nil
+	}
+	extractors := textExtractors
+	if c.FileTypes != "" {
+		extractors = make(map[string]TextExtractor)
+		for _, ext := range strings.Split(c.FileTypes, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if extractor, ok := textExtractors[ext]; ok {
+				extractors[ext] = extractor
+			} else if ext != "" {
+				log.Printf("[SearchService] no text extractor for file type: %s", ext)
+			}
+		}
+	}
+	return &contentExtractor{
+		maxFileSize: types.SV(c.MaxFileSize).DataSize(types.SV(common.DefaultSearchMaxFileSize).DataSize(0)),
+		maxTextSize: int(types.SV(c.MaxTextSize).DataSize(types.SV(common.DefaultSearchMaxTextSize).DataSize(0))),
+		extractors:  extractors,
+	}
+}
+
+// extract returns the text of the file, or empty if the file type is not supported or the file is too large
+func (ce *contentExtractor) extract(ctx context.Context, entry types.IEntry) string {
+	if ce == nil || entry.Type() != types.TypeFile || entry.Size() > ce.maxFileSize {
+		return ""
+	}
+	extractor, ok := ce.extractors[utils.PathExt(entry.Path())]
+	if !ok {
+		return ""
+	}
+	reader, e := driveutil.GetIContentReader(ctx, entry, -1, -1)
+	if e != nil {
+		log.Printf("[SearchService] failed to read %s: %s", utils.LogSanitize(entry.Path()), e)
+		return ""
+	}
+	defer func() { _ = reader.Close() }()
+	data, e := io.ReadAll(io.LimitReader(reader, ce.maxFileSize))
+	if e != nil {
+		log.Printf("[SearchService] failed to read %s: %s", utils.LogSanitize(entry.Path()), e)
+		return ""
+	}
+	text, e := extractor(data, ce.maxTextSize)
+	if e != nil {
+		log.Printf("[SearchService] failed to extract the text of %s: %s", utils.LogSanitize(entry.Path()), e)
+		return ""
+	}
+	return normalizeText(text, ce.maxTextSize)
+}
+
+func extractPlainText(data []byte, _ int) (string, error) {
+	// UTF-8 BOM
+	data = bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+	return string(data), nil
+}
+
+func extractHTMLText(data []byte, maxSize int) (string, error) {
+	sb := strings.Builder{}
+	z := html.NewTokenizer(bytes.NewReader(data))
+	skip := 0
+	for sb.Len() < maxSize {
+		switch z.Next() {
+		case html.ErrorToken:
+			// io.EOF or the broken document, keep what has been extracted
+			return sb.String(), nil
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isHTMLRawTag(name) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isHTMLRawTag(name) && skip > 0 {
+				skip--
+			}
+			sb.WriteByte(' ')
+		case html.TextToken:
+			if skip == 0 {
+				sb.Write(z.Text())
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+func isHTMLRawTag(name []byte) bool {
+	switch string(name) {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
+
+// normalizeText removes the invalid and control characters, collapses the spaces,
+// and truncates the text to maxSize bytes
+func normalizeText(s string, maxSize int) string {
+	sb := strings.Builder{}
+	space := false
+	for _, r := range s {
+		if r == utf8.RuneError || unicode.IsSpace(r) || unicode.IsControl(r) {
+			space = sb.Len() > 0
+			continue
+		}
+		n := utf8.RuneLen(r)
+		if space {
+			n++
+		}
+		if sb.Len()+n > maxSize {
+			break
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ooxmlTextParts are the parts of the Office Open XML documents containing the text
+var ooxmlTextParts = []string{
+	// docx
+	"word/document.xml", "word/header*.xml", "word/footer*.xml", "word/footnotes.xml",
+	// pptx
+	"ppt/slides/slide*.xml", "ppt/notesSlides/notesSlide*.xml",
+	// xlsx
+	"xl/sharedStrings.xml", "xl/worksheets/sheet*.xml",
+}
+
+// ooxmlTextElements are the elements of the text runs,
+// w:t of WordprocessingML, a:t of DrawingML, t of SpreadsheetML's shared and inline strings
+var ooxmlTextElements = map[string]bool{"t": true}
+
+// ooxmlBreakElements are the paragraphs, cells and other elements separating the text
+var ooxmlBreakElements = map[string]bool{
+	"p": true, "br": true, "tab": true, "tc": true, "si": true, "c": true,
+}
+
+// maxOOXMLDecodedSize limits the total size of the decompressed parts of a document
+const maxOOXMLDecodedSize = 16 * 1024 * 1024
+
+// errOOXMLBudget stops the extraction when the budget of the text or the decompressed size is used up
+var errOOXMLBudget = errors.New("budget used up")
+
+func extractOOXMLText(data []byte, maxSize int) (string, error) {
+	zr, e := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if e != nil {
+		return "", e
+	}
+	files := make([]*zip.File, 0)
+	for _, f := range zr.File {
+		for _, p := range ooxmlTextParts {
+			if ok, _ := path.Match(p, f.Name); ok {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	// slide10 follows slide9
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i].Name, files[j].Name
+		if len(a) != len(b) && path.Dir(a) == path.Dir(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	sb := strings.Builder{}
+	remaining := int64(maxOOXMLDecodedSize)
+	for _, f := range files {
+		e := extractOOXMLPart(f, &sb, maxSize, &remaining)
+		if e == errOOXMLBudget {
+			break
+		}
+		if e != nil {
+			return "", e
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// extractOOXMLPart writes the text of the part to sb,
+// and returns errOOXMLBudget when sb reaches maxSize or remaining bytes have been decompressed
+func extractOOXMLPart(f *zip.File, sb *strings.Builder, maxSize int, remaining *int64) error {
+	r, e := f.Open()
+	if e != nil {
+		return e
+	}
+	defer func() { _ = r.Close() }()
+
+	lr := &io.LimitedReader{R: r, N: *remaining}
+	defer func() { *remaining = lr.N }()
+	d := xml.NewDecoder(lr)
+	inText := 0
+	for sb.Len() < maxSize {
+		t, e := d.Token()
+		if lr.N <= 0 {
+			return errOOXMLBudget
+		}
+		if e == io.EOF {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if ooxmlTextElements[t.Name.Local] {
+				inText++
+			}
+		case xml.EndElement:
+			if ooxmlTextElements[t.Name.Local] && inText > 0 {
+				inText--
+			}
+			// the empty cells and paragraphs don't use up the budget
+			if ooxmlBreakElements[t.Name.Local] && sb.Len() > 0 && sb.String()[sb.Len()-1] != ' ' {
+				sb.WriteByte(' ')
+			}
+		case xml.CharData:
+			if inText > 0 {
+				sb.Write(t[:min(len(t), maxSize-sb.Len())])
+			}
+		}
+	}
+	return errOOXMLBudget
+}
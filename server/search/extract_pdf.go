@@ -0,0 +1,269 @@
+package search
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// extractPDFText extracts the text shown by the content streams of the PDF.
+// It's a best-effort extractor: only the uncompressed and FlateDecode streams are read,
+// and the strings are decoded as UTF-16 with BOM or Latin-1,
+// so the text of the fonts with custom encodings (such as most CJK fonts) is not extracted.
+func extractPDFText(data []byte, maxSize int) (string, error) {
+	sb := strings.Builder{}
+	pdfStreams(data, maxPDFDecodedSize, func(stream []byte) bool {
+		extractPDFContentText(stream, &sb)
+		return sb.Len() < maxSize
+	})
+	return sb.String(), nil
+}
+
+// maxPDFDecodedSize limits the total size of the decompressed streams of a PDF
+const maxPDFDecodedSize = 16 * 1024 * 1024
+
+var (
+	pdfStreamPattern = regexp.MustCompile(`stream\r?\n`)
+	// the filters other than FlateDecode can't be decoded here
+	pdfUnsupportedFilterPattern = regexp.MustCompile(
+		`/(ASCIIHexDecode|ASCII85Decode|LZWDecode|RunLengthDecode|CCITTFaxDecode|JBIG2Decode|DCTDecode|JPXDecode|Crypt)\b`)
+	// images, fonts and cross-reference streams
+	pdfNonContentPattern = regexp.MustCompile(`/Subtype\s*/Image|/Length[123]\b|/Type\s*/(XRef|Metadata)`)
+)
+
+// pdfStreams calls fn with the decoded streams which may be the content streams until fn returns false,
+// it stops when maxDecodedSize bytes have been decompressed
+func pdfStreams(data []byte, maxDecodedSize int64, fn func(stream []byte) bool) {
+	offset := 0
+	for {
+		loc := pdfStreamPattern.FindIndex(data[offset:])
+		if loc == nil {
+			break
+		}
+		start, bodyStart := offset+loc[0], offset+loc[1]
+		end := bytes.Index(data[bodyStart:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		end += bodyStart
+		offset = end + len("endstream")
+
+		// the dictionary is between the object header and the stream keyword
+		dict := data[:start]
+		if i := bytes.LastIndex(dict, []byte("obj")); i >= 0 {
+			dict = dict[i:]
+		}
+		if bytes.HasSuffix(dict, []byte("end")) ||
+			pdfUnsupportedFilterPattern.Match(dict) || pdfNonContentPattern.Match(dict) {
+			continue
+		}
+		body := data[bodyStart:end]
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			r, e := zlib.NewReader(bytes.NewReader(body))
+			if e != nil {
+				continue
+			}
+			// the stream may be truncated, keep the decoded part
+			body, _ = io.ReadAll(io.LimitReader(r, maxDecodedSize))
+			_ = r.Close()
+			maxDecodedSize -= int64(len(body))
+		}
+		if !fn(body) || maxDecodedSize <= 0 {
+			return
+		}
+	}
+}
+
+// extractPDFContentText writes the strings of the text-showing operators to sb
+func extractPDFContentText(data []byte, sb *strings.Builder) {
+	pending := make([]string, 0)
+	i := 0
+	for i < len(data) {
+		c := data[i]
+		switch {
+		case isPDFSpace(c):
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := readPDFLiteralString(data[i:])
+			pending = append(pending, decodePDFString(s))
+			i += n
+		case c == '<' && i+1 < len(data) && data[i+1] == '<', c == '>' && i+1 < len(data) && data[i+1] == '>':
+			i += 2
+		case c == '<':
+			s, n := readPDFHexString(data[i:])
+			pending = append(pending, decodePDFString(s))
+			i += n
+		case c == '[' || c == ']' || c == '{' || c == '}' || c == '>' || c == ')':
+			i++
+		case c == '/':
+			i++
+			for i < len(data) && !isPDFSpace(data[i]) && !isPDFDelimiter(data[i]) {
+				i++
+			}
+		default:
+			start := i
+			for i < len(data) && !isPDFSpace(data[i]) && !isPDFDelimiter(data[i]) {
+				i++
+			}
+			if i == start {
+				i++
+				continue
+			}
+			token := string(data[start:i])
+			if c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9' {
+				// a large negative adjustment in TJ arrays is a word space
+				if v, e := strconv.ParseFloat(token, 64); e == nil && v < -180 && len(pending) > 0 {
+					pending = append(pending, " ")
+				}
+				continue
+			}
+			switch token {
+			case "Tj", "TJ":
+				writePDFText(sb, pending)
+			case "'", "\"":
+				sb.WriteByte('\n')
+				writePDFText(sb, pending)
+			case "T*", "Td", "TD", "Tm", "ET":
+				sb.WriteByte(' ')
+			case "BI":
+				// skip the inline image data
+				if end := bytes.Index(data[i:], []byte("EI")); end >= 0 {
+					i += end + 2
+				} else {
+					i = len(data)
+				}
+			}
+			pending = pending[:0]
+		}
+	}
+}
+
+func writePDFText(sb *strings.Builder, strs []string) {
+	for _, s := range strs {
+		sb.WriteString(s)
+	}
+}
+
+func readPDFLiteralString(data []byte) ([]byte, int) {
+	buf := make([]byte, 0)
+	depth := 0
+	i := 1
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+			buf = append(buf, c)
+		case ')':
+			if depth == 0 {
+				return buf, i + 1
+			}
+			depth--
+			buf = append(buf, c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				return buf, i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case '\r':
+				// line continuation
+				if i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+						v = v*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					buf = append(buf, byte(v))
+				} else {
+					buf = append(buf, e)
+				}
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf, i
+}
+
+func readPDFHexString(data []byte) ([]byte, int) {
+	buf := make([]byte, 0)
+	hi, odd := byte(0), false
+	i := 1
+	for ; i < len(data) && data[i] != '>'; i++ {
+		v, ok := hexValue(data[i])
+		if !ok {
+			continue
+		}
+		if odd {
+			buf = append(buf, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		buf = append(buf, hi<<4)
+	}
+	return buf, i + 1
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// decodePDFString decodes the string as UTF-16BE if it starts with the BOM, otherwise as Latin-1
+func decodePDFString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		u := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExtractHTMLText(t *testing.T) {
+	text, e := extractHTMLText([]byte(`<html><head><title>Title</title><style>p{}</style></head>`+
+		`<body><p>Hello <b>world</b></p><script>var a = 1</script><p>&amp; more</p></body></html>`), 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := normalizeText(text, 1024); got != "Title Hello world & more" {
+		t.Errorf("unexpected text: %q", got)
+	}
+}
+
+func TestExtractOOXMLText(t *testing.T) {
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"word/document.xml": `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Quarterly</w:t></w:r>` +
+			`<w:r><w:t xml:space="preserve"> report</w:t></w:r></w:p><w:p><w:r><w:t>Summary</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:instrText>IGNORED</w:instrText></w:r></w:p></w:body></w:document>`,
+		"word/styles.xml": `<w:styles xmlns:w="w"><w:t>Style</w:t></w:styles>`,
+	} {
+		w, e := zw.Create(name)
+		if e != nil {
+			t.Fatal(e)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	if e := zw.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	text, e := extractOOXMLText(buf.Bytes(), 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := normalizeText(text, 1024); got != "Quarterly report Summary" {
+		t.Errorf("unexpected text: %q", got)
+	}
+	if _, e := extractOOXMLText([]byte("not a zip"), 1024); e == nil {
+		t.Error("expected error of invalid document")
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj T* [(Wor) -20 (ld) -300 (again)] TJ ET"
+	compressed := bytes.Buffer{}
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write([]byte("BT <FEFF0055006E00690063006F00640065> Tj ET"))
+	_ = zw.Close()
+
+	pdf := bytes.Buffer{}
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	_, _ = fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+	_, _ = fmt.Fprintf(&pdf, "5 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("6 0 obj\n<< /Subtype /Image /Length 10 >>\nstream\n(Image) Tj\nendstream\nendobj\n%%EOF")
+
+	text, e := extractPDFText(pdf.Bytes(), 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := normalizeText(text, 1024); got != "Hello (PDF) World again Unicode" {
+		t.Errorf("unexpected text: %q", got)
+	}
+}
+
+func TestExtract_DecompressionBudget(t *testing.T) {
+	// 64MB of the content operators are compressed to a few hundred KB
+	bomb := func(w io.Writer) {
+		chunk := []byte(strings.Repeat("(a) Tj ", 1024))
+		for i := 0; i < 64*1024*1024/len(chunk); i++ {
+			_, _ = w.Write(chunk)
+		}
+	}
+
+	compressed := bytes.Buffer{}
+	zw := zlib.NewWriter(&compressed)
+	bomb(zw)
+	_ = zw.Close()
+	pdf := bytes.Buffer{}
+	for i := 0; i < 3; i++ {
+		_, _ = fmt.Fprintf(&pdf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", i+1, compressed.Len())
+		pdf.Write(compressed.Bytes())
+		pdf.WriteString("\nendstream\nendobj\n")
+	}
+	// the text budget is not used up by a single stream, but the decompressed size is limited
+	text, e := extractPDFText(pdf.Bytes(), 64*1024*1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(text) > maxPDFDecodedSize/7+1 {
+		t.Errorf("the decompression of the PDF is not limited, %d bytes of text", len(text))
+	}
+
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"word/document.xml", "word/footer1.xml"} {
+		f, e := w.Create(name)
+		if e != nil {
+			t.Fatal(e)
+		}
+		_, _ = f.Write([]byte("<w:document><w:t>"))
+		bomb(f)
+		_, _ = f.Write([]byte("</w:t></w:document>"))
+	}
+	_ = w.Close()
+	text, e = extractOOXMLText(buf.Bytes(), 1024)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(text) > 64*1024 {
+		t.Errorf("the text of the document is not limited, %d bytes", len(text))
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	if got := normalizeText(" a\n\n b\x00c\t", 100); got != "a b c" {
+		t.Errorf("unexpected text: %q", got)
+	}
+	if got := normalizeText("你好 世界", 8); got != "你好" {
+		t.Errorf("unexpected truncated text: %q", got)
+	}
+	if got := normalizeText(strings.Repeat("a", 10), 4); got != "aaaa" {
+		t.Errorf("unexpected truncated text: %q", got)
+	}
+}
@@ -11,16 +11,24 @@ import (
 	"go-drive/common/types"
 	"go-drive/common/utils"
 	"go-drive/drive"
+	"go-drive/server/metadata"
 	"go-drive/storage"
 	"log"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-co-op/gocron/v2"
 )
 
 type IndexFilter = func(entry types.IEntry) bool
 
+// SearchFilter returns whether the search hit of the path is visible
+type SearchFilter = func(path string) (bool, error)
+
 const (
 	indexBatchSize  = 1000
 	filterOptionKey = "search.filter"
@@ -28,21 +36,34 @@ const (
 	initialPageSize = 10
 	pageSizeStep    = 10
 	maxPageSize     = 100
+	// maxScanSize is the maximum number of the hits scanned for a page
+	maxScanSize = 1000
+
+	// indexBatchTextSize limits the size of the extracted text in a batch
+	indexBatchTextSize = 16 * 1024 * 1024
 )
 
 type Service struct {
-	s     Searcher
-	drive *drive.RootDrive
+	s       Searcher
+	drive   *drive.RootDrive
+	content *contentExtractor
+	media   *metadata.Service
 
 	runner  task.Runner
 	options *storage.OptionsDAO
 
 	bus         event.Bus
 	unsubscribe []event.Unsubscribe
+
+	// indexing are the paths being indexed
+	indexing    sync.Map
+	scheduler   gocron.Scheduler
+	scheduleMux sync.Mutex
+	statusMux   sync.Mutex
 }
 
 func NewService(ch *registry.ComponentsHolder, config common.Config, od *storage.OptionsDAO,
-	rootDrive *drive.RootDrive, runner task.Runner, bus event.Bus) (*Service, error) {
+	rootDrive *drive.RootDrive, runner task.Runner, bus event.Bus, media *metadata.Service) (*Service, error) {
 
 	var s *Service = nil
 
@@ -60,6 +81,8 @@ func NewService(ch *registry.ComponentsHolder, config common.Config, od *storage
 		s = &Service{
 			s:       searcher,
 			drive:   rootDrive,
+			content: newContentExtractor(sConfig.Content),
+			media:   media,
 			runner:  runner,
 			options: od,
 			bus:     bus,
@@ -83,8 +106,12 @@ func (s *Service) checkEnabled() error {
 	return nil
 }
 
+// Search searches the entries in the path, the hits not accepted by the filter are skipped.
+// next is the number of the hits scanned in the previous pages, -1 is returned if there are no more hits.
+// A page may have fewer items than minimumPageSize, even none, if too many hits are skipped,
+// the client should request the next page until Next is -1.
 func (s *Service) Search(ctx context.Context, path string, query string,
-	next int, perms utils.PermMap) (types.EntrySearchResult, error) {
+	next int, filter SearchFilter) (types.EntrySearchResult, error) {
 	if e := s.checkEnabled(); e != nil {
 		return types.EntrySearchResult{}, e
 	}
@@ -93,30 +120,36 @@ func (s *Service) Search(ctx context.Context, path string, query string,
 	}
 	from := next
 	size := initialPageSize
-	var more bool
-	result := make([]types.EntrySearchResultItem, 0, size)
-	for {
+	more := true
+	result := make([]types.EntrySearchResultItem, 0, minimumPageSize)
+	for len(result) < minimumPageSize && from-next < maxScanSize {
 		if e := ctx.Err(); e != nil {
 			return types.EntrySearchResult{}, e
 		}
-		items, hasMore, e := s.search(path, query, from, size, perms)
+		items, e := s.s.Search(path, query, from, size)
 		if e != nil {
 			return types.EntrySearchResult{}, e
 		}
-		more = hasMore
-		result = append(result, items...)
-		if len(result) >= minimumPageSize || !hasMore {
-			break
+		// the whole batch is consumed, so the next page starts right after it
+		from += len(items)
+		for _, item := range items {
+			visible, e := filter(item.Entry.Path)
+			if e != nil {
+				return types.EntrySearchResult{}, e
+			}
+			if visible {
+				result = append(result, item)
+			}
 		}
-		if size >= maxPageSize {
+		if len(items) < size {
+			more = false
 			break
 		}
-		from += size
-		size += pageSizeStep
+		size = min(size+pageSizeStep, maxPageSize)
 	}
 	nextNext := -1
 	if more {
-		nextNext = from + size
+		nextNext = from
 	}
 	return types.EntrySearchResult{
 		Items: result,
@@ -124,41 +157,61 @@ func (s *Service) Search(ctx context.Context, path string, query string,
 	}, nil
 }
 
-func (s *Service) TriggerIndexAll(path string, ignoreError bool) (task.Task, error) {
+// TriggerIndexAll updates the index of the path in the background.
+// Only the new and changed entries are indexed unless full is true, which rebuilds the index.
+func (s *Service) TriggerIndexAll(path string, ignoreError, full bool) (task.Task, error) {
+	return s.triggerIndexAll(path, ignoreError, full, true)
+}
+
+// triggerIndexAll updates the index of the path in the background,
+// the status is saved only if saveStatus is true
+func (s *Service) triggerIndexAll(path string, ignoreError, full, saveStatus bool) (task.Task, error) {
 	if e := s.checkEnabled(); e != nil {
 		return task.Task{}, e
 	}
 	return s.runner.Execute(func(ctx types.TaskCtx) (any, error) {
-		e := s.indexAll(ctx, path, ignoreError)
+		status, e := s.indexAll(ctx, path, ignoreError, full, saveStatus)
 		if e != nil {
 			log.Printf("Error indexing %s: %s", utils.LogSanitize(path), e)
 		}
-		return nil, e
+		return status, e
 	}, task.WithNameGroup(path, "search/index"))
 }
 
-func (s *Service) search(path, query string, from, size int,
-	perms utils.PermMap) ([]types.EntrySearchResultItem, bool, error) {
-	r, e := s.s.Search(path, query, from, size)
+// IndexAll updates the index of the path and waits for it to be done
+func (s *Service) IndexAll(ctx types.TaskCtx, path string, ignoreError, full bool) (IndexStatus, error) {
+	if e := s.checkEnabled(); e != nil {
+		return IndexStatus{}, e
+	}
+	return s.indexAll(ctx, path, ignoreError, full, true)
+}
+
+func (s *Service) indexAll(ctx types.TaskCtx, path string, ignoreError, full, saveStatus bool) (IndexStatus, error) {
+	s.indexing.Store(path, true)
+	defer s.indexing.Delete(path)
+
+	status := IndexStatus{LastRun: time.Now(), Full: full}
+	e := s.doIndexAll(ctx, path, ignoreError, full, &status)
+	status.Duration = time.Since(status.LastRun)
 	if e != nil {
-		return nil, false, e
+		status.Error = e.Error()
 	}
-	if len(r) == 0 {
-		// no more results
-		return r, false, nil
+	if !saveStatus {
+		return status, e
 	}
-	items := make([]types.EntrySearchResultItem, 0, len(r))
-	for _, item := range r {
-		p := perms.ResolvePath(item.Entry.Path)
-		if p.Readable() {
-			items = append(items, item)
-		}
+	if e := s.saveIndexStatus(path, status); e != nil {
+		log.Printf("[SearchService] failed to save the index status: %s", e)
 	}
-	return items, len(r) >= size, nil
+	return status, e
 }
 
-func (s *Service) indexAll(ctx types.TaskCtx, path string, ignoreError bool) error {
-	_ = s.s.Delete(ctx, path)
+// doIndexAll walks the path and indexes the entries that are not in the index or changed,
+// then removes the entries that no longer exist from the index
+func (s *Service) doIndexAll(ctx types.TaskCtx, path string, ignoreError, full bool, status *IndexStatus) error {
+	var indexed map[string]indexedEntry
+	if full {
+		_ = s.s.Delete(ctx, path)
+	}
 	ctx.Total(0, true)
 	ctx.Progress(0, true)
 	filters, e := s.loadFilters()
@@ -169,12 +222,21 @@ func (s *Service) indexAll(ctx types.TaskCtx, path string, ignoreError bool) err
 	if filters == nil {
 		return errors.New("no filters found")
 	}
+	if !full {
+		if indexed, e = s.loadIndexed(path); e != nil {
+			return e
+		}
+	}
 	items := make([]types.EntrySearchItem, 0, indexBatchSize)
+	textSize := 0
+	// failed are the paths that can't be read, their indexed entries are kept
+	failed := make([]string, 0)
 
 	doIndex := func(ctx types.TaskCtx) error {
 		if len(items) > 0 {
 			e := s.s.Index(ctx, items)
 			items = items[:0]
+			textSize = 0
 			return e
 		}
 		return nil
@@ -187,23 +249,102 @@ func (s *Service) indexAll(ctx types.TaskCtx, path string, ignoreError bool) err
 		if isEntryExcluded(entry, filters) {
 			return errSkip
 		}
-		items = append(items, s.mapEntry(entry))
-		if len(items) >= indexBatchSize {
+		status.Entries++
+		if old, ok := indexed[entry.Path()]; ok {
+			delete(indexed, entry.Path())
+			if old.size == entry.Size() && old.modTime == utils.Time(entry.ModTime()).Unix() {
+				return nil
+			}
+		}
+		status.Updated++
+		item := s.mapEntry(ctx, entry)
+		items = append(items, item)
+		textSize += len(item.Content)
+		if len(items) >= indexBatchSize || textSize >= indexBatchTextSize {
 			return doIndex(ctx)
 		}
 		return nil
+	}, func(path string, e error) {
+		if !err.IsNotFoundError(e) {
+			status.Errors++
+			failed = append(failed, path)
+		}
 	})
 	if e != nil {
 		return e
 	}
-	return doIndex(ctx)
+	if e := doIndex(ctx); e != nil {
+		return e
+	}
+	return s.removeVanished(ctx, indexed, failed, status)
+}
+
+// indexedEntry is the state of an indexed entry to detect the changes
+type indexedEntry struct {
+	size int64
+	// modTime is in seconds, which is the precision of the searchers
+	modTime int64
+}
+
+// loadIndexed returns the indexed entries in the path
+func (s *Service) loadIndexed(path string) (map[string]indexedEntry, error) {
+	indexed := make(map[string]indexedEntry)
+	after := ""
+	for {
+		items, e := s.s.List(path, after, indexBatchSize)
+		if e != nil {
+			return nil, e
+		}
+		for _, item := range items {
+			indexed[item.Path] = indexedEntry{size: item.Size, modTime: item.ModTime.Unix()}
+		}
+		if len(items) < indexBatchSize {
+			return indexed, nil
+		}
+		after = items[len(items)-1].Path
+	}
+}
+
+// removeVanished removes the indexed entries not found in the walk,
+// except the ones in the paths that failed to be read
+func (s *Service) removeVanished(ctx types.TaskCtx, indexed map[string]indexedEntry,
+	failed []string, status *IndexStatus) error {
+	paths := make([]string, 0, len(indexed))
+	for p := range indexed {
+		if !isInPaths(p, failed) {
+			paths = append(paths, p)
+		}
+	}
+	// the descendants follow their ancestors, and are deleted with them
+	sort.Strings(paths)
+	deleted := ""
+	for _, p := range paths {
+		status.Removed++
+		if deleted != "" && strings.HasPrefix(p, deleted+"/") {
+			continue
+		}
+		if e := s.s.Delete(ctx, p); e != nil {
+			return e
+		}
+		deleted = p
+	}
+	return nil
+}
+
+func isInPaths(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || utils.IsRootPath(dir) || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Service) Index(ctx types.TaskCtx, entry types.IEntry) error {
 	if e := s.checkEnabled(); e != nil {
 		return e
 	}
-	return s.s.Index(ctx, []types.EntrySearchItem{s.mapEntry(entry)})
+	return s.s.Index(ctx, []types.EntrySearchItem{s.mapEntry(ctx, entry)})
 }
 
 func isEntryExcluded(entry types.IEntry, filters []string) bool {
@@ -250,22 +391,35 @@ func (s *Service) loadFilters() ([]string, error) {
 	return filters, nil
 }
 
-func (s *Service) mapEntry(e types.IEntry) types.EntrySearchItem {
-	name := filepath.Base(e.Path())
-	return types.EntrySearchItem{
-		Path:    e.Path(),
+func (s *Service) mapEntry(ctx context.Context, entry types.IEntry) types.EntrySearchItem {
+	name := filepath.Base(entry.Path())
+	item := types.EntrySearchItem{
+		Path:    entry.Path(),
 		Name:    name,
 		Ext:     utils.PathExt(name),
-		Type:    e.Type(),
-		Size:    e.Size(),
-		ModTime: utils.Time(e.ModTime()),
+		Type:    entry.Type(),
+		Size:    entry.Size(),
+		ModTime: utils.Time(entry.ModTime()),
+		Content: s.content.extract(ctx, entry),
 	}
+	if s.media != nil {
+		meta, e := s.media.Get(ctx, entry)
+		if e != nil {
+			log.Printf("[SearchService] failed to get the metadata of %s: %s", utils.LogSanitize(entry.Path()), e)
+		}
+		if meta != nil {
+			item.Camera, item.Artist, item.Album = meta.Camera(), meta.Artist, meta.Album
+		}
+	}
+	return item
 }
 
 var errSkip = errors.New("skip")
 
+// walk visits the entries in the rootPath recursively,
+// onError is called with the errors ignored when ignoreError is true
 func (s *Service) walk(ctx types.TaskCtx, d types.IDrive, rootPath string,
-	ignoreError bool, visit func(entry types.IEntry) error) error {
+	ignoreError bool, visit func(entry types.IEntry) error, onError func(path string, e error)) error {
 	if e := ctx.Err(); e != nil {
 		return e
 	}
@@ -273,6 +427,7 @@ func (s *Service) walk(ctx types.TaskCtx, d types.IDrive, rootPath string,
 	if e != nil {
 		if ignoreError {
 			log.Printf("failed to index %s: %s", utils.LogSanitize(rootPath), e)
+			onError(rootPath, e)
 			return nil
 		}
 		return e
@@ -285,6 +440,7 @@ func (s *Service) walk(ctx types.TaskCtx, d types.IDrive, rootPath string,
 		if !ignoreError {
 			return e
 		}
+		onError(rootPath, e)
 	}
 	ctx.Total(1, false)
 	if e == nil {
@@ -295,12 +451,13 @@ func (s *Service) walk(ctx types.TaskCtx, d types.IDrive, rootPath string,
 		if e != nil {
 			if ignoreError {
 				log.Printf("failed to index %s: %s", utils.LogSanitize(rootPath), e)
+				onError(rootPath, e)
 				return nil
 			}
 			return e
 		}
 		for _, entry := range entries {
-			e = s.walk(ctx, d, entry.Path(), ignoreError, visit)
+			e = s.walk(ctx, d, entry.Path(), ignoreError, visit, onError)
 			if e != nil {
 				return e
 			}
@@ -314,7 +471,8 @@ func (s *Service) onUpdated(dc types.DriveListenerContext, path string, includeD
 		return
 	}
 	if includeDescendants {
-		_, _ = s.TriggerIndexAll(path, true)
+		// the status is kept for the manual and scheduled indexing only, so it doesn't grow with the changed paths
+		_, _ = s.triggerIndexAll(path, true, false, false)
 	} else {
 		_, _ = s.runner.Execute(func(ctx types.TaskCtx) (any, error) {
 			entry, e := dc.Drive.Get(ctx, path)
@@ -351,6 +509,13 @@ func (s *Service) Status() (string, types.SM, error) {
 	if e != nil {
 		return "", nil, e
 	}
+	status, e := s.loadIndexStatus()
+	if e != nil {
+		return "", nil, e
+	}
+	for p, st := range status {
+		stats["Index /"+p] = st.String()
+	}
 	return "Search", stats, nil
 }
 
@@ -361,6 +526,9 @@ func (s *Service) Dispose() error {
 	for _, unsubscribe := range s.unsubscribe {
 		unsubscribe()
 	}
+	if e := s.stopSchedules(); e != nil {
+		log.Printf("[SearchService] failed to stop the schedules: %s", e)
+	}
 	return s.s.Dispose()
 }
 
@@ -0,0 +1,129 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsInPaths(t *testing.T) {
+	dirs := []string{"a/b", "c"}
+	for path, want := range map[string]bool{
+		"a/b": true, "a/b/c": true, "c/d": true,
+		"a": false, "a/bc": false, "cd": false,
+	} {
+		if got := isInPaths(path, dirs); got != want {
+			t.Errorf("%q: got %v, want %v", path, got, want)
+		}
+	}
+	if !isInPaths("a", []string{""}) {
+		t.Error("all paths are in the root")
+	}
+}
+
+func TestService_Search(t *testing.T) {
+	searcher, e := NewSQLiteSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+	items := make([]types.EntrySearchItem, 0)
+	for i := 0; i < 1500; i++ {
+		p := fmt.Sprintf("d/file%04d", i)
+		items = append(items, types.EntrySearchItem{Path: p, Name: utils.PathBase(p), Type: types.TypeFile})
+	}
+	if e := searcher.Index(task.DummyContext(), items); e != nil {
+		t.Fatal(e)
+	}
+	s := &Service{s: searcher}
+
+	// collect pages until the end, the visible hits must not be lost between pages
+	collect := func(filter SearchFilter) ([]string, int) {
+		paths := make([]string, 0)
+		pages := 0
+		for next := 0; next != -1; pages++ {
+			r, e := s.Search(context.Background(), "", "file", next, filter)
+			if e != nil {
+				t.Fatal(e)
+			}
+			if r.Next != -1 && r.Next <= next {
+				t.Fatalf("the cursor %d does not advance from %d", r.Next, next)
+			}
+			for _, item := range r.Items {
+				paths = append(paths, item.Entry.Path)
+			}
+			next = r.Next
+		}
+		return paths, pages
+	}
+
+	paths, _ := collect(func(path string) (bool, error) { return true, nil })
+	if len(paths) != 1500 || paths[0] != "d/file0000" || paths[1499] != "d/file1499" {
+		t.Errorf("unexpected hits: %d", len(paths))
+	}
+	// only the hits in the 1st, 1100th and the last are visible
+	want := []string{"d/file0000", "d/file1100", "d/file1499"}
+	paths, pages := collect(func(path string) (bool, error) {
+		return path == want[0] || path == want[1] || path == want[2], nil
+	})
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+	if pages < 2 {
+		t.Errorf("expected the scanning stops at %d hits, got %d pages", maxScanSize, pages)
+	}
+}
+
+// testSearcherList checks the listing of the indexed entries used by the incremental indexing
+func testSearcherList(t *testing.T, searcher Searcher) {
+	t.Helper()
+	modTime := time.Unix(1700000000, 0)
+	items := make([]types.EntrySearchItem, 0)
+	for _, p := range []string{"a", "a/x", "a/y", "a_b", "a%", "b", "b/z"} {
+		items = append(items, types.EntrySearchItem{Path: p, Name: utils.PathBase(p), Type: types.TypeFile,
+			Size: int64(len(p)), ModTime: modTime, Content: "content of " + p})
+	}
+	if e := searcher.Index(task.DummyContext(), items); e != nil {
+		t.Fatal(e)
+	}
+
+	list := func(dir, after string, size int) []string {
+		items, e := searcher.List(dir, after, size)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return utils.ArrayMap(items, func(t *types.EntrySearchItem) string { return t.Path })
+	}
+	cases := []struct {
+		dir, after string
+		size       int
+		want       []string
+	}{
+		{"", "", 100, []string{"a", "a%", "a/x", "a/y", "a_b", "b", "b/z"}},
+		{"", "", 3, []string{"a", "a%", "a/x"}},
+		{"", "a/x", 3, []string{"a/y", "a_b", "b"}},
+		{"a", "", 100, []string{"a", "a/x", "a/y"}},
+		{"a", "a", 100, []string{"a/x", "a/y"}},
+		{"a%", "", 100, []string{"a%"}},
+		{"c", "", 100, []string{}},
+	}
+	for _, c := range cases {
+		if got := list(c.dir, c.after, c.size); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q after %q: got %v, want %v", c.dir, c.after, got, c.want)
+		}
+	}
+
+	got, e := searcher.List("b/z", "", 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 1 || got[0].Size != 3 || !got[0].ModTime.Equal(modTime) || got[0].Content != "" {
+		t.Errorf("unexpected item: %+v", got)
+	}
+}
@@ -0,0 +1,413 @@
+package search
+
+import (
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryField is the field that a query term matches
+type QueryField string
+
+const (
+	// FieldText matches the names, and the contents for the terms without wildcards
+	FieldText    QueryField = ""
+	FieldPath    QueryField = "path"
+	FieldContent QueryField = "content"
+	FieldType    QueryField = "type"
+	FieldExt     QueryField = "ext"
+	FieldDrive   QueryField = "drive"
+	FieldSize    QueryField = "size"
+	FieldModTime QueryField = "mtime"
+	FieldCamera  QueryField = "camera"
+	FieldArtist  QueryField = "artist"
+	FieldAlbum   QueryField = "album"
+)
+
+// QueryNode is a node of the parsed query, one of *AndNode, *OrNode, *NotNode and *TermNode
+type QueryNode interface {
+	queryNode()
+}
+
+// AndNode matches the entries matching all the children
+type AndNode struct {
+	Children []QueryNode
+}
+
+// OrNode matches the entries matching any of the children
+type OrNode struct {
+	Children []QueryNode
+}
+
+// NotNode matches the entries not matching the child
+type NotNode struct {
+	Child QueryNode
+}
+
+// TermNode is a single condition
+type TermNode struct {
+	Field QueryField
+	// Value is the text to match for the fields other than FieldSize and FieldModTime.
+	// FieldType, FieldExt and FieldDrive match the whole value, others match a part of the field.
+	Value string
+	// Phrase is true if the value is quoted, the value is matched as a whole without wildcards
+	Phrase bool
+
+	// Op is the comparison operator of FieldSize and FieldModTime: =, >, >=, < or <=
+	Op   string
+	Size int64
+	Time time.Time
+}
+
+// Wildcard reports whether the value contains wildcards
+func (t *TermNode) Wildcard() bool {
+	return !t.Phrase && strings.Contains(t.Value, "*")
+}
+
+func (*AndNode) queryNode()  {}
+func (*OrNode) queryNode()   {}
+func (*NotNode) queryNode()  {}
+func (*TermNode) queryNode() {}
+
+// QuerySort is the order of the results, the zero value means the searcher's default order
+type QuerySort struct {
+	// Field is FieldSize, FieldModTime or empty
+	Field QueryField
+	Desc  bool
+}
+
+// Query is the parsed search query
+type Query struct {
+	// Root is nil if the query matches all the entries
+	Root QueryNode
+	Sort QuerySort
+}
+
+var (
+	sizeQueryPattern = regexp.MustCompile(`^(=|[><]=?)([0-9]+[bkmgtBKMGT]?)$`)
+
+	queryDateFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+	querySortFields = map[string]QueryField{"size": FieldSize, "mtime": FieldModTime}
+)
+
+// ParseQuery parses the search query.
+//
+// The terms separated by spaces must all match. A term is one of:
+//   - a word or a "quoted phrase" matching the names and contents, words with * match the names only
+//   - path:, content:, type:, ext: and drive: followed by a word or a quoted phrase
+//   - camera:, artist: and album: matching the media metadata
+//   - in:<duration>, before:<date> and after:<date> matching the modification time
+//   - >10m, <=1g and other comparisons of the size
+//   - sort:size or sort:mtime, from the largest or the newest, append :asc to reverse
+//
+// Terms can be grouped by parentheses, joined by OR (or |), and negated by a leading -.
+func ParseQuery(query string) (Query, error) {
+	tokens, e := tokenizeQuery(query)
+	if e != nil {
+		return Query{}, e
+	}
+	p := queryParser{tokens: tokens}
+	nodes := make([]QueryNode, 0)
+	for !p.end() {
+		if t := p.peek(); t.kind == queryTokenWord && t.prefix == "sort" {
+			p.pos++
+			if e := p.parseSort(t); e != nil {
+				return Query{}, e
+			}
+			continue
+		}
+		node, e := p.parseOr()
+		if e != nil {
+			return Query{}, e
+		}
+		nodes = append(nodes, node)
+	}
+	return Query{Root: andOf(nodes), Sort: p.sort}, nil
+}
+
+func invalidQueryValue(field, value string) error {
+	return err.NewBadRequestError(i18n.T("api.search.invalid_value", field, value))
+}
+
+type queryTokenKind int
+
+const (
+	queryTokenWord queryTokenKind = iota
+	queryTokenOpen
+	queryTokenClose
+	queryTokenOr
+	queryTokenNot
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	// prefix is the field name before the colon of the word
+	prefix string
+	value  string
+	quoted bool
+}
+
+// queryPrefixes are the recognized field names, the words with other prefixes are plain words
+var queryPrefixes = map[string]bool{
+	"path": true, "content": true, "type": true, "ext": true, "drive": true,
+	"camera": true, "artist": true, "album": true,
+	"in": true, "before": true, "after": true, "sort": true,
+}
+
+// tokenizeQuery splits the query into tokens.
+// An opening parenthesis starts a group only at the start of a word,
+// a closing parenthesis ends a group only when a group is open,
+// otherwise they are parts of the words.
+func tokenizeQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := make([]queryToken, 0)
+	depth := 0
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryTokenOpen})
+			depth++
+			i++
+			continue
+		case c == ')':
+			if depth == 0 {
+				return nil, err.NewBadRequestError(i18n.T("api.search.unbalanced_parenthesis"))
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenClose})
+			depth--
+			i++
+			continue
+		case c == '|':
+			tokens = append(tokens, queryToken{kind: queryTokenOr})
+			i++
+			continue
+		case c == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, queryToken{kind: queryTokenNot})
+			i++
+			continue
+		}
+
+		t := queryToken{kind: queryTokenWord}
+		start := i
+		for i < len(runes) && !isQueryWordEnd(runes[i], depth) && runes[i] != '"' {
+			i++
+		}
+		word := string(runes[start:i])
+		if i < len(runes) && runes[i] == '"' {
+			prefix, ok := strings.CutSuffix(word, ":")
+			if word != "" && (!ok || !queryPrefixes[prefix]) {
+				// the quote is a part of the word
+				for i < len(runes) && !isQueryWordEnd(runes[i], depth) {
+					i++
+				}
+				t.value = string(runes[start:i])
+				tokens = append(tokens, t)
+				continue
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, err.NewBadRequestError(i18n.T("api.search.unclosed_quote"))
+			}
+			t.prefix, t.value, t.quoted = prefix, string(runes[i+1:end]), true
+			i = end + 1
+			tokens = append(tokens, t)
+			continue
+		}
+		if word == "OR" {
+			tokens = append(tokens, queryToken{kind: queryTokenOr})
+			continue
+		}
+		if prefix, value, ok := strings.Cut(word, ":"); ok && queryPrefixes[prefix] {
+			t.prefix, t.value = prefix, value
+		} else {
+			t.value = word
+		}
+		tokens = append(tokens, t)
+	}
+	if depth != 0 {
+		return nil, err.NewBadRequestError(i18n.T("api.search.unbalanced_parenthesis"))
+	}
+	return tokens, nil
+}
+
+func isQueryWordEnd(c rune, depth int) bool {
+	return unicode.IsSpace(c) || c == '|' || (c == ')' && depth > 0)
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	sort   QuerySort
+	sorted bool
+}
+
+func (p *queryParser) end() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+// parseOr parses the terms joined by OR
+func (p *queryParser) parseOr() (QueryNode, error) {
+	node, e := p.parseUnary()
+	if e != nil {
+		return nil, e
+	}
+	nodes := []QueryNode{node}
+	for !p.end() && p.peek().kind == queryTokenOr {
+		p.pos++
+		if node, e = p.parseUnary(); e != nil {
+			return nil, e
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return &OrNode{Children: nodes}, nil
+}
+
+func (p *queryParser) parseUnary() (QueryNode, error) {
+	if p.end() {
+		return nil, p.missingTerm()
+	}
+	t := p.peek()
+	switch t.kind {
+	case queryTokenNot:
+		p.pos++
+		node, e := p.parseUnary()
+		if e != nil {
+			return nil, e
+		}
+		return &NotNode{Child: node}, nil
+	case queryTokenOpen:
+		p.pos++
+		nodes := make([]QueryNode, 0)
+		for !p.end() && p.peek().kind != queryTokenClose {
+			node, e := p.parseOr()
+			if e != nil {
+				return nil, e
+			}
+			nodes = append(nodes, node)
+		}
+		// the parentheses are balanced, so the closing one exists
+		p.pos++
+		if len(nodes) == 0 {
+			return nil, err.NewBadRequestError(i18n.T("api.search.empty_group"))
+		}
+		return andOf(nodes), nil
+	case queryTokenWord:
+		p.pos++
+		if t.prefix == "sort" {
+			return nil, err.NewBadRequestError(i18n.T("api.search.sort_not_allowed"))
+		}
+		return parseQueryTerm(t)
+	}
+	return nil, p.missingTerm()
+}
+
+func (p *queryParser) missingTerm() error {
+	near := "OR"
+	if p.pos > 0 && p.tokens[p.pos-1].kind == queryTokenNot {
+		near = "-"
+	}
+	return err.NewBadRequestError(i18n.T("api.search.missing_term", near))
+}
+
+func (p *queryParser) parseSort(t queryToken) error {
+	if p.sorted {
+		return err.NewBadRequestError(i18n.T("api.search.sort_not_allowed"))
+	}
+	name, order, _ := strings.Cut(strings.ToLower(t.value), ":")
+	field, ok := querySortFields[name]
+	if !ok || (order != "" && order != "asc" && order != "desc") {
+		return invalidQueryValue(t.prefix, t.value)
+	}
+	p.sort = QuerySort{Field: field, Desc: order != "asc"}
+	p.sorted = true
+	return nil
+}
+
+func parseQueryTerm(t queryToken) (QueryNode, error) {
+	if t.value == "" && (t.quoted || t.prefix != "") {
+		return nil, err.NewBadRequestError(i18n.T("api.search.missing_value", t.prefix))
+	}
+	switch t.prefix {
+	case "":
+		if m := sizeQueryPattern.FindStringSubmatch(t.value); m != nil && !t.quoted {
+			size := types.SV(m[2]).DataSize(-1)
+			if size < 0 {
+				return nil, invalidQueryValue("size", t.value)
+			}
+			return &TermNode{Field: FieldSize, Op: m[1], Size: size}, nil
+		}
+		return &TermNode{Field: FieldText, Value: queryWildcards(t), Phrase: t.quoted}, nil
+	case "path", "content", "camera", "artist", "album":
+		return &TermNode{Field: QueryField(t.prefix), Value: queryWildcards(t), Phrase: t.quoted}, nil
+	case "type":
+		if t.value != string(types.TypeFile) && t.value != string(types.TypeDir) {
+			return nil, invalidQueryValue(t.prefix, t.value)
+		}
+		return &TermNode{Field: FieldType, Value: t.value}, nil
+	case "ext":
+		return &TermNode{Field: FieldExt, Value: strings.ToLower(strings.TrimPrefix(t.value, "."))}, nil
+	case "drive":
+		return &TermNode{Field: FieldDrive, Value: t.value}, nil
+	case "in":
+		duration := types.SV(t.value).Duration(-1)
+		if duration <= 0 {
+			return nil, invalidQueryValue(t.prefix, t.value)
+		}
+		return &TermNode{Field: FieldModTime, Op: ">", Time: time.Now().Add(-duration)}, nil
+	case "before", "after":
+		var date time.Time
+		var e error
+		for _, layout := range queryDateFormats {
+			if date, e = time.ParseInLocation(layout, t.value, time.Local); e == nil {
+				break
+			}
+		}
+		if e != nil {
+			return nil, invalidQueryValue(t.prefix, t.value)
+		}
+		op := "<"
+		if t.prefix == "after" {
+			op = ">="
+		}
+		return &TermNode{Field: FieldModTime, Op: op, Time: date}, nil
+	}
+	return nil, invalidQueryValue(t.prefix, t.value)
+}
+
+// queryWildcards collapses the repeated asterisks of the unquoted values
+func queryWildcards(t queryToken) string {
+	if t.quoted {
+		return t.value
+	}
+	return multipleAsterisksPattern.ReplaceAllString(t.value, "*")
+}
+
+func andOf(nodes []QueryNode) QueryNode {
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return &AndNode{Children: nodes}
+}
@@ -0,0 +1,199 @@
+package search
+
+import (
+	"go-drive/common/i18n"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		query string
+		want  Query
+	}{
+		{"", Query{}},
+		{"  ", Query{}},
+		{"hello", Query{Root: &TermNode{Value: "hello"}}},
+		{"a**b", Query{Root: &TermNode{Value: "a*b"}}},
+		{"a b", Query{Root: &AndNode{Children: []QueryNode{&TermNode{Value: "a"}, &TermNode{Value: "b"}}}}},
+		{`"annual report" -draft`, Query{Root: &AndNode{Children: []QueryNode{
+			&TermNode{Value: "annual report", Phrase: true},
+			&NotNode{Child: &TermNode{Value: "draft"}},
+		}}}},
+		{`path:"my docs"`, Query{Root: &TermNode{Field: FieldPath, Value: "my docs", Phrase: true}}},
+		{`artist:"daft punk" camera:x100*`, Query{Root: &AndNode{Children: []QueryNode{
+			&TermNode{Field: FieldArtist, Value: "daft punk", Phrase: true},
+			&TermNode{Field: FieldCamera, Value: "x100*"},
+		}}}},
+		{`it"s`, Query{Root: &TermNode{Value: `it"s`}}},
+		{"ext:.MP3 OR ext:flac | drive:Music", Query{Root: &OrNode{Children: []QueryNode{
+			&TermNode{Field: FieldExt, Value: "mp3"},
+			&TermNode{Field: FieldExt, Value: "flac"},
+			&TermNode{Field: FieldDrive, Value: "Music"},
+		}}}},
+		{"(a OR b) c", Query{Root: &AndNode{Children: []QueryNode{
+			&OrNode{Children: []QueryNode{&TermNode{Value: "a"}, &TermNode{Value: "b"}}},
+			&TermNode{Value: "c"},
+		}}}},
+		{"-(a b)", Query{Root: &NotNode{Child: &AndNode{Children: []QueryNode{
+			&TermNode{Value: "a"}, &TermNode{Value: "b"},
+		}}}}},
+		// parentheses in the middle of the words
+		{"photo(1).jpg", Query{Root: &TermNode{Value: "photo(1).jpg"}}},
+		{`("photo(1)" OR x)`, Query{Root: &OrNode{Children: []QueryNode{
+			&TermNode{Value: "photo(1)", Phrase: true}, &TermNode{Value: "x"},
+		}}}},
+		{">10k", Query{Root: &TermNode{Field: FieldSize, Op: ">", Size: 10 * 1024}}},
+		{`">10k"`, Query{Root: &TermNode{Value: ">10k", Phrase: true}}},
+		{"after:2024-01-02", Query{Root: &TermNode{Field: FieldModTime, Op: ">=", Time: date}}},
+		{"before:2024-01-02", Query{Root: &TermNode{Field: FieldModTime, Op: "<", Time: date}}},
+		{"type:dir", Query{Root: &TermNode{Field: FieldType, Value: "dir"}}},
+		{"foo:bar", Query{Root: &TermNode{Value: "foo:bar"}}},
+		{"a sort:size", Query{Root: &TermNode{Value: "a"}, Sort: QuerySort{Field: FieldSize, Desc: true}}},
+		{"sort:mtime:asc", Query{Sort: QuerySort{Field: FieldModTime}}},
+	}
+	for _, c := range cases {
+		got, e := ParseQuery(c.query)
+		if e != nil {
+			t.Errorf("%q: unexpected error: %v", c.query, e)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %#v, want %#v", c.query, got, c.want)
+		}
+	}
+
+	if q, e := ParseQuery("in:1h"); e != nil {
+		t.Error(e)
+	} else if n, ok := q.Root.(*TermNode); !ok || n.Field != FieldModTime || n.Op != ">" ||
+		time.Since(n.Time) < time.Hour || time.Since(n.Time) > time.Hour+time.Minute {
+		t.Errorf("unexpected query of in: %#v", q.Root)
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	cases := map[string]string{
+		`"abc`:                "api.search.unclosed_quote",
+		`path:"abc`:           "api.search.unclosed_quote",
+		"(a":                  "api.search.unbalanced_parenthesis",
+		")a":                  "api.search.unbalanced_parenthesis",
+		"()":                  "api.search.empty_group",
+		"a OR":                "api.search.missing_term",
+		"OR a":                "api.search.missing_term",
+		"(a -)":               "api.search.missing_term",
+		"ext:":                "api.search.missing_value",
+		`content:""`:          "api.search.missing_value",
+		"in:abc":              "api.search.invalid_value",
+		"after:yesterday":     "api.search.invalid_value",
+		"type:image":          "api.search.invalid_value",
+		">10x":                "",
+		"sort:name":           "api.search.invalid_value",
+		"sort:size:up":        "api.search.invalid_value",
+		"sort:size sort:size": "api.search.sort_not_allowed",
+		"a OR sort:size":      "api.search.sort_not_allowed",
+		"-sort:size":          "api.search.sort_not_allowed",
+	}
+	for query, key := range cases {
+		_, e := ParseQuery(query)
+		if key == "" {
+			if e != nil {
+				t.Errorf("%q: unexpected error: %v", query, e)
+			}
+			continue
+		}
+		if e == nil {
+			t.Errorf("%q: expected error %s", query, key)
+			continue
+		}
+		if items, e2 := i18n.UnmarshalT(e.Error()); e2 != nil || items[0] != key {
+			t.Errorf("%q: expected error %s, got %v", query, key, e)
+		}
+	}
+}
+
+// testSearcherQueries checks the translation of the query language by the searcher
+func testSearcherQueries(t *testing.T, searcher Searcher) {
+	t.Helper()
+	now := time.Now()
+	e := searcher.Index(task.DummyContext(), []types.EntrySearchItem{
+		{Path: "music/a.mp3", Name: "a.mp3", Ext: "mp3", Type: types.TypeFile, Size: 3000,
+			ModTime: now.Add(-48 * time.Hour), Artist: "Daft Punk", Album: "Discovery"},
+		{Path: "music/b.flac", Name: "b.flac", Ext: "flac", Type: types.TypeFile, Size: 1000, ModTime: now,
+			Artist: "Various Artists", Album: "Discovery Live"},
+		{Path: "music/annual report.txt", Name: "annual report.txt", Ext: "txt", Type: types.TypeFile, Size: 2000,
+			ModTime: now, Content: "draft of the annual report"},
+		{Path: "docs/report_100%.txt", Name: "report_100%.txt", Ext: "txt", Type: types.TypeFile, Size: 10,
+			ModTime: now},
+		{Path: "docs/report_final.txt", Name: "report_final.txt", Ext: "txt", Type: types.TypeFile, Size: 20,
+			ModTime: now},
+		{Path: "photos/x.jpg", Name: "x.jpg", Ext: "jpg", Type: types.TypeFile, Size: 5000, ModTime: now,
+			Camera: "FUJIFILM X100V"},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	search := func(query string) []string {
+		items, e := searcher.Search("", query, 0, 10)
+		if e != nil {
+			t.Fatalf("%q: %v", query, e)
+		}
+		return utils.ArrayMap(items, func(t *types.EntrySearchResultItem) string { return t.Entry.Path })
+	}
+	sorted := func(paths []string) []string {
+		sort.Strings(paths)
+		return paths
+	}
+
+	cases := map[string][]string{
+		"ext:mp3 OR ext:flac":                {"music/a.mp3", "music/b.flac"},
+		"drive:music -ext:mp3":               {"music/annual report.txt", "music/b.flac"},
+		"drive:MUSIC (a OR b) -b":            {"music/a.mp3", "music/annual report.txt"},
+		`"annual report"`:                    {"music/annual report.txt"},
+		`"100%"`:                             {"docs/report_100%.txt"},
+		`path:"report_1"`:                    {"docs/report_100%.txt"},
+		"report_*.txt -final":                {"docs/report_100%.txt"},
+		"ext:txt >15 <=2000":                 {"docs/report_final.txt", "music/annual report.txt"},
+		"type:file -(drive:docs OR ext:txt)": {"music/a.mp3", "music/b.flac", "photos/x.jpg"},
+		"camera:X100V":                       {"photos/x.jpg"},
+		`camera:"fujifilm x1"`:               {"photos/x.jpg"},
+		"artist:daft*punk":                   {"music/a.mp3"},
+		"album:discovery -artist:daft":       {"music/b.flac"},
+		"drive:music after:" + now.Add(-24*time.Hour).Format("2006-01-02T15:04"): {
+			"music/annual report.txt", "music/b.flac"},
+		"before:" + now.Add(-24*time.Hour).Format("2006-01-02T15:04"): {"music/a.mp3"},
+	}
+	for query, want := range cases {
+		if got := sorted(search(query)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %v, want %v", query, got, want)
+		}
+	}
+
+	if got := search("drive:music sort:size"); !reflect.DeepEqual(got,
+		[]string{"music/a.mp3", "music/annual report.txt", "music/b.flac"}) {
+		t.Errorf("unexpected order of sort:size: %v", got)
+	}
+	if got := search("drive:music sort:mtime:asc"); len(got) != 3 || got[0] != "music/a.mp3" {
+		t.Errorf("unexpected order of sort:mtime:asc: %v", got)
+	}
+	// negated terms are not highlighted
+	items, e := searcher.Search("", "annual -content:draft OR content:report", 0, 10)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(items) != 1 || len(items[0].Highlights[highlightContent]) != 1 ||
+		strings.Contains(items[0].Highlights[highlightContent][0], "<mark>draft</mark>") {
+		t.Errorf("unexpected highlights: %+v", items)
+	}
+
+	if _, e := searcher.Search("", "(a", 0, 10); e == nil {
+		t.Error("expected error of malformed query")
+	}
+}
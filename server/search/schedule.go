@@ -0,0 +1,215 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/utils"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	scheduleOptionKey    = "search.schedule"
+	indexStatusOptionKey = "search.index_status"
+	scheduledIndexTag    = "search/index"
+)
+
+// IndexStatus is the result of the last indexing of a path
+type IndexStatus struct {
+	LastRun  time.Time     `json:"lastRun"`
+	Duration time.Duration `json:"duration"`
+	Full     bool          `json:"full"`
+	// Entries is the number of the entries walked
+	Entries int64 `json:"entries"`
+	// Updated is the number of the new and changed entries
+	Updated int64 `json:"updated"`
+	// Removed is the number of the entries removed from the index since they no longer exist
+	Removed int64 `json:"removed"`
+	// Errors is the number of the entries that can't be read
+	Errors int64 `json:"errors"`
+	// Error is the error that stopped the indexing
+	Error string `json:"error,omitempty"`
+}
+
+func (is IndexStatus) String() string {
+	s := fmt.Sprintf("%s, %s, %d entries, %d updated, %d removed, %d errors",
+		is.LastRun.Format(time.DateTime), is.Duration.Round(time.Millisecond),
+		is.Entries, is.Updated, is.Removed, is.Errors)
+	if is.Full {
+		s += ", full"
+	}
+	if is.Error != "" {
+		s += ", failed: " + is.Error
+	}
+	return s
+}
+
+// IndexSchedule is a scheduled indexing of a path
+type IndexSchedule struct {
+	// Schedule is a cron expression or a descriptor like @daily and @every 6h
+	Schedule string
+	Path     string
+}
+
+// ParseIndexSchedules parses the schedules, one per line.
+// Each line is a schedule followed by the path, the root if the path is empty, e.g.
+//
+//	0 3 * * * Photos
+//	@every 6h Documents/Work
+//
+// Empty lines and lines starting with # are ignored.
+func ParseIndexSchedules(s string) ([]IndexSchedule, error) {
+	schedules := make([]IndexSchedule, 0)
+	for i, line := range utils.SplitLines(s) {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		n := 5
+		if strings.HasPrefix(line, "@every") {
+			n = 2
+		} else if line[0] == '@' {
+			n = 1
+		}
+		fields, path := cutFields(line, n)
+		schedule := strings.Join(fields, " ")
+		if _, e := cron.ParseStandard(schedule); len(fields) < n || e != nil {
+			return nil, err.NewBadRequestError(i18n.T("api.search.invalid_schedule", strconv.Itoa(i+1)))
+		}
+		schedules = append(schedules, IndexSchedule{Schedule: schedule, Path: utils.CleanPath(path)})
+	}
+	return schedules, nil
+}
+
+// cutFields returns the first n fields separated by spaces, and the rest of s
+func cutFields(s string, n int) ([]string, string) {
+	fields := make([]string, 0, n)
+	for len(fields) < n {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			i = len(s)
+		}
+		fields = append(fields, s[:i])
+		s = s[i:]
+	}
+	return fields, strings.TrimSpace(s)
+}
+
+// GetSchedules returns the schedules of the indexing
+func (s *Service) GetSchedules() (string, error) {
+	if e := s.checkEnabled(); e != nil {
+		return "", e
+	}
+	return s.options.Get(scheduleOptionKey)
+}
+
+// SetSchedules saves and applies the schedules of the indexing
+func (s *Service) SetSchedules(schedules string) error {
+	if e := s.checkEnabled(); e != nil {
+		return e
+	}
+	if _, e := ParseIndexSchedules(schedules); e != nil {
+		return e
+	}
+	if e := s.options.Set(scheduleOptionKey, schedules); e != nil {
+		return e
+	}
+	return s.StartSchedules()
+}
+
+// StartSchedules (re)starts the scheduled indexing
+func (s *Service) StartSchedules() error {
+	if s.checkEnabled() != nil {
+		return nil
+	}
+	v, e := s.options.Get(scheduleOptionKey)
+	if e != nil {
+		return e
+	}
+	schedules, e := ParseIndexSchedules(v)
+	if e != nil {
+		return e
+	}
+
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+	if s.scheduler == nil {
+		scheduler, e := gocron.NewScheduler(gocron.WithLocation(time.Local))
+		if e != nil {
+			return e
+		}
+		scheduler.Start()
+		s.scheduler = scheduler
+	}
+	s.scheduler.RemoveByTags(scheduledIndexTag)
+	for _, schedule := range schedules {
+		if _, e := s.scheduler.NewJob(
+			gocron.CronJob(schedule.Schedule, false),
+			gocron.NewTask(s.scheduledIndex, schedule.Path),
+			gocron.WithTags(scheduledIndexTag),
+		); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Service) scheduledIndex(path string) {
+	if _, ok := s.indexing.Load(path); ok {
+		log.Printf("[SearchService] skip the scheduled indexing of %s, it's running", utils.LogSanitize(path))
+		return
+	}
+	if _, e := s.TriggerIndexAll(path, true, false); e != nil {
+		log.Printf("[SearchService] failed to start the scheduled indexing of %s: %s", utils.LogSanitize(path), e)
+	}
+}
+
+func (s *Service) stopSchedules() error {
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+	if s.scheduler == nil {
+		return nil
+	}
+	return s.scheduler.Shutdown()
+}
+
+func (s *Service) loadIndexStatus() (map[string]IndexStatus, error) {
+	v, e := s.options.Get(indexStatusOptionKey)
+	if e != nil {
+		return nil, e
+	}
+	status := make(map[string]IndexStatus)
+	if v == "" {
+		return status, nil
+	}
+	if e := json.Unmarshal([]byte(v), &status); e != nil {
+		log.Printf("[SearchService] invalid index status: %s", e)
+	}
+	return status, nil
+}
+
+func (s *Service) saveIndexStatus(path string, status IndexStatus) error {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	all, e := s.loadIndexStatus()
+	if e != nil {
+		return e
+	}
+	all[path] = status
+	data, e := json.Marshal(all)
+	if e != nil {
+		return e
+	}
+	return s.options.Set(indexStatusOptionKey, string(data))
+}
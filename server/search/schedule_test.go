@@ -0,0 +1,33 @@
+package search
+
+import (
+	"go-drive/common/i18n"
+	"reflect"
+	"testing"
+)
+
+func TestParseIndexSchedules(t *testing.T) {
+	got, e := ParseIndexSchedules("# nightly\n0 3 * * * Photos/2024\n\n  @every 6h  My Documents/ \n@daily\n")
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := []IndexSchedule{
+		{Schedule: "0 3 * * *", Path: "Photos/2024"},
+		{Schedule: "@every 6h", Path: "My Documents"},
+		{Schedule: "@daily", Path: ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, s := range []string{"0 3 * *", "@daily\n61 * * * * a", "@sometimes a", "@every", "@every 6x a"} {
+		_, e := ParseIndexSchedules(s)
+		if e == nil {
+			t.Errorf("%q: expected error", s)
+			continue
+		}
+		if items, e2 := i18n.UnmarshalT(e.Error()); e2 != nil || items[0] != "api.search.invalid_schedule" {
+			t.Errorf("%q: unexpected error %v", s, e)
+		}
+	}
+}
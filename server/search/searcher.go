@@ -38,6 +38,9 @@ type Searcher interface {
 	Index(ctx types.TaskCtx, entries []types.EntrySearchItem) error
 	// Delete remove all entries in the dir(or single file) from the index
 	Delete(ctx types.TaskCtx, dirPath string) error
+	// List returns the indexed entries in the dir(or single file) ordered by path,
+	// starting after the path `after`. The contents are not returned.
+	List(dirPath string, after string, size int) ([]types.EntrySearchItem, error)
 
 	// Examples returns a list of example search queries
 	Examples() []string
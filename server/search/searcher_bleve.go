@@ -0,0 +1,584 @@
+package search
+
+import (
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	regexpCharFilter "github.com/blevesearch/bleve/v2/analysis/char/regexp"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+	unicodeTokenizer "github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+	bleveSearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	simpleFragmenter "github.com/blevesearch/bleve/v2/search/highlight/fragmenter/simple"
+	simpleHighlighter "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	bleveIndexDirname = "index.bleve"
+
+	// filenameAnalyzer splits the names by the separators and the CJK characters into bigrams
+	filenameAnalyzer = "filename"
+	// lowerKeywordAnalyzer indexes the whole value in lower case
+	lowerKeywordAnalyzer = "keyword_lower"
+	// markHighlighter highlights the terms with <mark></mark> without escaping the text,
+	// like the snippets of SQLiteSearcher
+	markHighlighter = "go-drive-mark"
+
+	bleveDeleteBatchSize = 1000
+	bleveFacetSize       = 10
+
+	// bleveMappingVersion is stored in the index, the index is recreated if the mapping changes
+	bleveMappingVersion    = "2"
+	bleveMappingVersionKey = "mappingVersion"
+)
+
+func init() {
+	RegisterSearcher("bleve", NewBleveSearcher)
+
+	if e := registry.RegisterFragmentFormatter(markHighlighter,
+		func(map[string]any, *registry.Cache) (highlight.FragmentFormatter, error) {
+			return markFragmentFormatter{}, nil
+		}); e != nil {
+		panic(e)
+	}
+	if e := registry.RegisterHighlighter(markHighlighter,
+		func(config map[string]any, cache *registry.Cache) (highlight.Highlighter, error) {
+			fragmenter, e := cache.FragmenterNamed(simpleFragmenter.Name)
+			if e != nil {
+				return nil, e
+			}
+			formatter, e := cache.FragmentFormatterNamed(markHighlighter)
+			if e != nil {
+				return nil, e
+			}
+			return simpleHighlighter.NewHighlighter(fragmenter, formatter, simpleHighlighter.DefaultSeparator), nil
+		}); e != nil {
+		panic(e)
+	}
+}
+
+// BleveSearcher is the embedded full-text searcher with relevance ranking, fuzzy matching and CJK tokenization
+type BleveSearcher struct {
+	index bleve.Index
+}
+
+func NewBleveSearcher(config common.Config, searcherConfig types.SM) (Searcher, error) {
+	dbName := searcherConfig["name"]
+	if dbName == "" {
+		dbName = "files.bleve.index"
+	}
+	dir, e := config.GetDir(dbName, true)
+	if e != nil {
+		return nil, e
+	}
+	indexPath := filepath.Join(dir, bleveIndexDirname)
+
+	var index bleve.Index
+	if _, e = os.Stat(indexPath); e == nil {
+		if index, e = bleve.Open(indexPath); e == nil {
+			index, e = checkBleveMapping(index, indexPath)
+		}
+	} else if os.IsNotExist(e) {
+		index, e = newBleveIndex(indexPath)
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &BleveSearcher{index: index}, nil
+}
+
+func newBleveIndex(indexPath string) (bleve.Index, error) {
+	m, e := newBleveMapping()
+	if e != nil {
+		return nil, e
+	}
+	index, e := bleve.New(indexPath, m)
+	if e != nil {
+		return nil, e
+	}
+	if e := index.SetInternal([]byte(bleveMappingVersionKey), []byte(bleveMappingVersion)); e != nil {
+		_ = index.Close()
+		return nil, e
+	}
+	return index, nil
+}
+
+// checkBleveMapping recreates the index if it was created with another version of the mapping,
+// since the new fields are not indexed by the mapping stored in the index
+func checkBleveMapping(index bleve.Index, indexPath string) (bleve.Index, error) {
+	version, e := index.GetInternal([]byte(bleveMappingVersionKey))
+	if e != nil {
+		_ = index.Close()
+		return nil, e
+	}
+	if string(version) == bleveMappingVersion {
+		return index, nil
+	}
+	if e := index.Close(); e != nil {
+		return nil, e
+	}
+	if e := os.RemoveAll(indexPath); e != nil {
+		return nil, fmt.Errorf("the index was created with another mapping, delete the index and rebuild it: %w", e)
+	}
+	log.Printf("[BleveSearcher] the index is recreated with the new mapping, rebuild the index to fill it")
+	return newBleveIndex(indexPath)
+}
+
+func newBleveMapping() (mapping.IndexMapping, error) {
+	m := bleve.NewIndexMapping()
+	if e := m.AddCustomCharFilter("filename_separators", map[string]any{
+		"type":    regexpCharFilter.Name,
+		"regexp":  `[_\-.]`,
+		"replace": " ",
+	}); e != nil {
+		return nil, e
+	}
+	if e := m.AddCustomAnalyzer(filenameAnalyzer, map[string]any{
+		"type":          custom.Name,
+		"char_filters":  []string{"filename_separators"},
+		"tokenizer":     unicodeTokenizer.Name,
+		"token_filters": []string{cjk.WidthName, lowercase.Name, cjk.BigramName},
+	}); e != nil {
+		return nil, e
+	}
+	if e := m.AddCustomAnalyzer(lowerKeywordAnalyzer, map[string]any{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
+	}); e != nil {
+		return nil, e
+	}
+
+	keywordField := func(analyzer string, store bool) *mapping.FieldMapping {
+		f := bleve.NewKeywordFieldMapping()
+		f.Analyzer = analyzer
+		f.Store = store
+		f.IncludeInAll = false
+		return f
+	}
+	textField := func(analyzer string) *mapping.FieldMapping {
+		f := bleve.NewTextFieldMapping()
+		f.Analyzer = analyzer
+		f.IncludeTermVectors = true
+		f.IncludeInAll = false
+		return f
+	}
+	numericField := bleve.NewNumericFieldMapping()
+	numericField.IncludeInAll = false
+	dateField := bleve.NewDateTimeFieldMapping()
+	dateField.IncludeInAll = false
+
+	doc := bleve.NewDocumentStaticMapping()
+	doc.AddFieldMappingsAt("path", keywordField(keyword.Name, true))
+	doc.AddFieldMappingsAt("pathLower", keywordField(lowerKeywordAnalyzer, false))
+	doc.AddFieldMappingsAt("name", textField(filenameAnalyzer))
+	doc.AddFieldMappingsAt("nameLower", keywordField(lowerKeywordAnalyzer, false))
+	doc.AddFieldMappingsAt("ext", keywordField(lowerKeywordAnalyzer, true))
+	doc.AddFieldMappingsAt("type", keywordField(keyword.Name, true))
+	doc.AddFieldMappingsAt("drive", keywordField(lowerKeywordAnalyzer, true))
+	doc.AddFieldMappingsAt("size", numericField)
+	doc.AddFieldMappingsAt("modTime", dateField)
+	doc.AddFieldMappingsAt("content", textField(cjk.AnalyzerName))
+	doc.AddFieldMappingsAt("camera", keywordField(lowerKeywordAnalyzer, false))
+	doc.AddFieldMappingsAt("artist", keywordField(lowerKeywordAnalyzer, false))
+	doc.AddFieldMappingsAt("album", keywordField(lowerKeywordAnalyzer, false))
+
+	m.DefaultMapping = doc
+	m.DefaultAnalyzer = keyword.Name
+	return m, nil
+}
+
+type bleveDocument struct {
+	Path      string    `json:"path"`
+	PathLower string    `json:"pathLower"`
+	Name      string    `json:"name"`
+	NameLower string    `json:"nameLower"`
+	Ext       string    `json:"ext"`
+	Type      string    `json:"type"`
+	Drive     string    `json:"drive"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	Content   string    `json:"content,omitempty"`
+	Camera    string    `json:"camera,omitempty"`
+	Artist    string    `json:"artist,omitempty"`
+	Album     string    `json:"album,omitempty"`
+}
+
+func (s *BleveSearcher) Index(ctx types.TaskCtx, entries []types.EntrySearchItem) error {
+	batch := s.index.NewBatch()
+	for _, t := range entries {
+		drive, _, _ := strings.Cut(t.Path, "/")
+		if e := batch.Index(t.Path, bleveDocument{
+			Path: t.Path, PathLower: strings.ToLower(t.Path),
+			Name: t.Name, NameLower: strings.ToLower(t.Name),
+			Ext: t.Ext, Type: string(t.Type), Drive: drive,
+			Size: t.Size, ModTime: t.ModTime, Content: t.Content,
+			Camera: t.Camera, Artist: t.Artist, Album: t.Album,
+		}); e != nil {
+			return e
+		}
+	}
+	return s.index.Batch(batch)
+}
+
+func (s *BleveSearcher) Search(path string, queryString string, from int, size int) ([]types.EntrySearchResultItem, error) {
+	parsed, e := ParseQuery(queryString)
+	if e != nil {
+		return nil, e
+	}
+	var q query.Query = bleve.NewMatchAllQuery()
+	if parsed.Root != nil {
+		q = buildBleveQuery(parsed.Root)
+	}
+	if path != "" {
+		q = bleve.NewConjunctionQuery(q, fieldQuery(bleve.NewPrefixQuery(path+"/"), "path"))
+	}
+	req := bleve.NewSearchRequestOptions(q, size, from, false)
+	req.Fields = bleveStoredFields
+	req.Highlight = bleve.NewHighlightWithStyle(markHighlighter)
+	req.Highlight.AddField(highlightContent)
+	switch parsed.Sort.Field {
+	case FieldSize:
+		req.SortBy([]string{sortOrder("size", parsed.Sort.Desc), "-_score", "_id"})
+	case FieldModTime:
+		req.SortBy([]string{sortOrder("modTime", parsed.Sort.Desc), "-_score", "_id"})
+	}
+	r, e := s.index.Search(req)
+	if e != nil {
+		return nil, e
+	}
+
+	items := make([]types.EntrySearchResultItem, 0, len(r.Hits))
+	for _, hit := range r.Hits {
+		item := types.EntrySearchResultItem{Entry: bleveHitEntry(hit)}
+		if fragments := hit.Fragments[highlightContent]; len(fragments) > 0 {
+			item.Highlights = map[string][]string{highlightContent: fragments}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// bleveStoredFields are the stored fields to build the EntrySearchItem
+var bleveStoredFields = []string{"name", "ext", "type", "size", "modTime"}
+
+func bleveHitEntry(hit *bleveSearch.DocumentMatch) types.EntrySearchItem {
+	item := types.EntrySearchItem{Path: hit.ID}
+	item.Name, _ = hit.Fields["name"].(string)
+	item.Ext, _ = hit.Fields["ext"].(string)
+	if t, ok := hit.Fields["type"].(string); ok {
+		item.Type = types.EntryType(t)
+	}
+	if size, ok := hit.Fields["size"].(float64); ok {
+		item.Size = int64(size)
+	}
+	if modTime, ok := hit.Fields["modTime"].(string); ok {
+		item.ModTime, _ = time.Parse(time.RFC3339, modTime)
+	}
+	return item
+}
+
+func (s *BleveSearcher) Delete(ctx types.TaskCtx, dirPath string) error {
+	ctx.Total(1, false)
+	for {
+		if e := ctx.Err(); e != nil {
+			return e
+		}
+		req := bleve.NewSearchRequestOptions(
+			fieldQuery(bleve.NewPrefixQuery(dirPath+"/"), "path"), bleveDeleteBatchSize, 0, false)
+		r, e := s.index.Search(req)
+		if e != nil {
+			return e
+		}
+		if len(r.Hits) == 0 {
+			break
+		}
+		ctx.Total(int64(len(r.Hits)), false)
+		batch := s.index.NewBatch()
+		for _, hit := range r.Hits {
+			batch.Delete(hit.ID)
+		}
+		if e := s.index.Batch(batch); e != nil {
+			return e
+		}
+		ctx.Progress(int64(len(r.Hits)), false)
+	}
+	if e := s.index.Delete(dirPath); e != nil {
+		return e
+	}
+	ctx.Progress(1, false)
+	return nil
+}
+
+func (s *BleveSearcher) List(dirPath string, after string, size int) ([]types.EntrySearchItem, error) {
+	var q query.Query = bleve.NewMatchAllQuery()
+	if dirPath != "" {
+		q = bleve.NewDisjunctionQuery(
+			fieldQuery(bleve.NewTermQuery(dirPath), "path"),
+			fieldQuery(bleve.NewPrefixQuery(dirPath+"/"), "path"),
+		)
+	}
+	req := bleve.NewSearchRequestOptions(q, size, 0, false)
+	req.Fields = bleveStoredFields
+	req.SortBy([]string{"_id"})
+	if after != "" {
+		req.SearchAfter = []string{after}
+	}
+	r, e := s.index.Search(req)
+	if e != nil {
+		return nil, e
+	}
+	return utils.ArrayMap(r.Hits, func(t **bleveSearch.DocumentMatch) types.EntrySearchItem {
+		return bleveHitEntry(*t)
+	}), nil
+}
+
+// Stats returns the number of the entries and the top values of the types, extensions and drives
+func (s *BleveSearcher) Stats() (types.SM, error) {
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	facets := map[string]string{"type": "Types", "ext": "Extensions", "drive": "Drives"}
+	for field := range facets {
+		req.AddFacet(field, bleve.NewFacetRequest(field, bleveFacetSize))
+	}
+	r, e := s.index.Search(req)
+	if e != nil {
+		return nil, e
+	}
+	stats := types.SM{"Total": strconv.FormatUint(r.Total, 10)}
+	for field, name := range facets {
+		f := r.Facets[field]
+		if f == nil || f.Terms == nil {
+			continue
+		}
+		terms := f.Terms.Terms()
+		sort.SliceStable(terms, func(i, j int) bool { return terms[i].Count > terms[j].Count })
+		values := make([]string, 0, len(terms))
+		for _, t := range terms {
+			values = append(values, fmt.Sprintf("%s: %d", t.Term, t.Count))
+		}
+		stats[name] = strings.Join(values, ", ")
+	}
+	return stats, nil
+}
+
+// buildBleveQuery translates the query node
+func buildBleveQuery(node QueryNode) query.Query {
+	switch n := node.(type) {
+	case *AndNode:
+		return bleve.NewConjunctionQuery(utils.ArrayMap(n.Children,
+			func(t *QueryNode) query.Query { return buildBleveQuery(*t) })...)
+	case *OrNode:
+		return bleve.NewDisjunctionQuery(utils.ArrayMap(n.Children,
+			func(t *QueryNode) query.Query { return buildBleveQuery(*t) })...)
+	case *NotNode:
+		q := bleve.NewBooleanQuery()
+		q.AddMust(bleve.NewMatchAllQuery())
+		q.AddMustNot(buildBleveQuery(n.Child))
+		return q
+	case *TermNode:
+		switch n.Field {
+		case FieldText:
+			if n.Wildcard() {
+				return substringQuery(n.Value, "nameLower")
+			}
+			return nameOrContentQuery(n.Value, n.Phrase)
+		case FieldPath:
+			if n.Phrase {
+				return containsQuery(n.Value, "pathLower")
+			}
+			return substringQuery(n.Value, "pathLower")
+		case FieldCamera, FieldArtist, FieldAlbum:
+			if n.Phrase {
+				return containsQuery(n.Value, string(n.Field))
+			}
+			return substringQuery(n.Value, string(n.Field))
+		case FieldContent:
+			return contentQuery(n.Value, n.Phrase)
+		case FieldType:
+			return fieldQuery(bleve.NewTermQuery(n.Value), "type")
+		case FieldExt:
+			return fieldQuery(bleve.NewTermQuery(n.Value), "ext")
+		case FieldDrive:
+			return fieldQuery(bleve.NewTermQuery(strings.ToLower(n.Value)), "drive")
+		case FieldSize:
+			return sizeQuery(n.Op, float64(n.Size))
+		case FieldModTime:
+			return modTimeQuery(n.Op, n.Time)
+		}
+	}
+	panic(fmt.Sprintf("unknown query node: %#v", node))
+}
+
+// substringQuery matches the lower-cased keyword field containing the parts of the value separated by *
+func substringQuery(value, field string) query.Query {
+	parts := strings.Split(strings.ToLower(strings.Trim(value, "*")), "*")
+	return fieldQuery(bleve.NewRegexpQuery(
+		".*"+strings.Join(utils.ArrayMap(parts, func(t *string) string { return regexp.QuoteMeta(*t) }), ".*")+".*",
+	), field)
+}
+
+func sortOrder(field string, desc bool) string {
+	if desc {
+		return "-" + field
+	}
+	return field
+}
+
+// containsQuery matches the lower-cased keyword field containing the value
+func containsQuery(value, field string) *query.RegexpQuery {
+	q := bleve.NewRegexpQuery(".*" + regexp.QuoteMeta(strings.ToLower(value)) + ".*")
+	q.SetField(field)
+	return q
+}
+
+// nameOrContentQuery matches the term in the names, with typos tolerated and ranked lower,
+// or in the contents
+func nameOrContentQuery(term string, phrase bool) query.Query {
+	var exact query.Query
+	if phrase {
+		q := bleve.NewMatchPhraseQuery(term)
+		q.SetField("name")
+		q.SetBoost(3)
+		exact = q
+	} else {
+		q := bleve.NewMatchQuery(term)
+		q.SetField("name")
+		q.SetOperator(query.MatchQueryOperatorAnd)
+		q.SetBoost(3)
+		exact = q
+	}
+
+	substring := containsQuery(term, "nameLower")
+	substring.SetBoost(2)
+
+	queries := []query.Query{exact, substring, contentQuery(term, phrase)}
+	if !phrase && isFuzzyTerm(term) {
+		fuzzy := bleve.NewMatchQuery(term)
+		fuzzy.SetField("name")
+		fuzzy.SetFuzziness(1)
+		queries = append(queries, fuzzy)
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+func contentQuery(term string, phrase bool) query.Query {
+	if phrase {
+		q := bleve.NewMatchPhraseQuery(term)
+		q.SetField(highlightContent)
+		return q
+	}
+	q := bleve.NewMatchQuery(term)
+	q.SetField(highlightContent)
+	q.SetOperator(query.MatchQueryOperatorAnd)
+	return q
+}
+
+// isFuzzyTerm reports whether the term is long enough to match with typos,
+// the CJK terms are excluded since they are split into bigrams
+func isFuzzyTerm(term string) bool {
+	n := 0
+	for _, r := range term {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			return false
+		}
+		n++
+	}
+	return n >= 4
+}
+
+func sizeQuery(op string, size float64) query.Query {
+	var q *query.NumericRangeQuery
+	inclusive, exclusive := true, false
+	switch op {
+	case ">":
+		q = bleve.NewNumericRangeInclusiveQuery(&size, nil, &exclusive, nil)
+	case ">=":
+		q = bleve.NewNumericRangeInclusiveQuery(&size, nil, &inclusive, nil)
+	case "<":
+		zero := 0.0
+		q = bleve.NewNumericRangeInclusiveQuery(&zero, &size, &inclusive, &exclusive)
+	case "<=":
+		zero := 0.0
+		q = bleve.NewNumericRangeInclusiveQuery(&zero, &size, &inclusive, &inclusive)
+	default:
+		q = bleve.NewNumericRangeInclusiveQuery(&size, &size, &inclusive, &inclusive)
+	}
+	q.SetField("size")
+	return q
+}
+
+func modTimeQuery(op string, t time.Time) query.Query {
+	inclusive := op == ">=" || op == "<="
+	var q *query.DateRangeQuery
+	if op[0] == '>' {
+		q = bleve.NewDateRangeInclusiveQuery(t, time.Time{}, &inclusive, nil)
+	} else {
+		q = bleve.NewDateRangeInclusiveQuery(time.Time{}, t, nil, &inclusive)
+	}
+	q.SetField("modTime")
+	return q
+}
+
+type fieldQueryable interface {
+	query.Query
+	SetField(string)
+}
+
+func fieldQuery[T fieldQueryable](q T, field string) query.Query {
+	q.SetField(field)
+	return q
+}
+
+func (*BleveSearcher) Examples() []string {
+	return []string{"hello.txt", "报告", "path:a*dir", "*.mp3", "ext:mp3 in:1h", ">10m", "type:dir", "content:invoice",
+		"ext:mp3 OR ext:flac", "\"annual report\" -draft", "after:2024-01-01 sort:size", "camera:x100v"}
+}
+
+func (s *BleveSearcher) Dispose() error {
+	return s.index.Close()
+}
+
+// markFragmentFormatter wraps the terms with <mark></mark>
+type markFragmentFormatter struct{}
+
+func (markFragmentFormatter) Format(f *highlight.Fragment, locations highlight.TermLocations) string {
+	sb := strings.Builder{}
+	curr := f.Start
+	for _, l := range locations {
+		if l == nil || !l.ArrayPositions.Equals(f.ArrayPositions) || l.Start < curr {
+			continue
+		}
+		if l.End > f.End {
+			break
+		}
+		sb.Write(f.Orig[curr:l.Start])
+		sb.WriteString("<mark>")
+		sb.Write(f.Orig[l.Start:l.End])
+		sb.WriteString("</mark>")
+		curr = l.End
+	}
+	sb.Write(f.Orig[curr:f.End])
+	return sb.String()
+}
+
+var _ Searcher = (*BleveSearcher)(nil)
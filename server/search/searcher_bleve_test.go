@@ -0,0 +1,138 @@
+package search
+
+import (
+	"go-drive/common"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBleveSearcher(t *testing.T) {
+	searcher, e := NewBleveSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+
+	now := time.Now().Truncate(time.Second)
+	e = searcher.Index(task.DummyContext(), []types.EntrySearchItem{
+		{Path: "docs/年度报告2023.pdf", Name: "年度报告2023.pdf", Ext: "pdf", Type: types.TypeFile, Size: 2048, ModTime: now},
+		{Path: "docs/holiday_photos", Name: "holiday_photos", Type: types.TypeDir, ModTime: now},
+		{Path: "docs/a.txt", Name: "a.txt", Ext: "txt", Type: types.TypeFile, Size: 10, ModTime: now,
+			Content: "the quarterly invoice is attached"},
+		{Path: "music/song.mp3", Name: "song.mp3", Ext: "mp3", Type: types.TypeFile, Size: 4 << 20, ModTime: now},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	search := func(path, query string) map[string]types.EntrySearchResultItem {
+		items, e := searcher.Search(path, query, 0, 10)
+		if e != nil {
+			t.Fatal(e)
+		}
+		r := make(map[string]types.EntrySearchResultItem)
+		for _, item := range items {
+			r[item.Entry.Path] = item
+		}
+		return r
+	}
+
+	if r := search("", "报告"); len(r) != 1 {
+		t.Errorf("unexpected result of CJK query: %+v", r)
+	} else if item := r["docs/年度报告2023.pdf"]; item.Entry.Size != 2048 || item.Entry.Ext != "pdf" ||
+		item.Entry.Type != types.TypeFile || !item.Entry.ModTime.Equal(now) {
+		t.Errorf("unexpected entry: %+v", item.Entry)
+	}
+	if r := search("", "holliday"); len(r) != 1 {
+		t.Errorf("unexpected result of fuzzy query: %+v", r)
+	}
+	if r := search("", "photo"); len(r) != 1 {
+		t.Errorf("unexpected result of substring query: %+v", r)
+	}
+	if r := search("", "*.mp3"); len(r) != 1 {
+		t.Errorf("unexpected result of wildcard query: %+v", r)
+	}
+
+	r := search("", "invoice")
+	snippets := r["docs/a.txt"].Highlights[highlightContent]
+	if len(r) != 1 || len(snippets) != 1 || !strings.Contains(snippets[0], "<mark>invoice</mark>") {
+		t.Errorf("unexpected result of content query: %+v", r)
+	}
+
+	if r := search("", "ext:MP3 >1m"); len(r) != 1 {
+		t.Errorf("unexpected result of ext and size query: %+v", r)
+	}
+	if r := search("", "type:dir"); len(r) != 1 {
+		t.Errorf("unexpected result of type query: %+v", r)
+	}
+	if r := search("music", ""); len(r) != 1 {
+		t.Errorf("unexpected result of path prefix: %+v", r)
+	}
+	if r := search("", "drive:docs"); len(r) != 3 {
+		t.Errorf("unexpected result of drive query: %+v", r)
+	}
+
+	stats, e := searcher.Stats()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stats["Total"] != "4" || !strings.Contains(stats["Drives"], "docs: 3") {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if e := searcher.Delete(task.DummyContext(), "docs"); e != nil {
+		t.Fatal(e)
+	}
+	if r := search("", ""); len(r) != 1 {
+		t.Errorf("unexpected result after deleting: %+v", r)
+	}
+}
+
+func TestBleveSearcher_Query(t *testing.T) {
+	searcher, e := NewBleveSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+	testSearcherQueries(t, searcher)
+}
+
+func TestBleveSearcher_List(t *testing.T) {
+	searcher, e := NewBleveSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+	testSearcherList(t, searcher)
+}
+
+func TestBleveSearcher_MappingVersion(t *testing.T) {
+	config := common.Config{DataDir: t.TempDir()}
+	searcher, e := NewBleveSearcher(config, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = searcher.Index(task.DummyContext(), []types.EntrySearchItem{
+		{Path: "docs/a.txt", Name: "a.txt", Ext: "txt", Type: types.TypeFile, ModTime: time.Now()},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// the index created with the previous mapping
+	if e := searcher.(*BleveSearcher).index.SetInternal([]byte(bleveMappingVersionKey), []byte("1")); e != nil {
+		t.Fatal(e)
+	}
+	_ = searcher.Dispose()
+
+	searcher, e = NewBleveSearcher(config, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+	if stats, _ := searcher.Stats(); stats["Total"] != "0" {
+		t.Errorf("the index is not recreated: %+v", stats)
+	}
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"fmt"
 	"go-drive/common"
 	"go-drive/common/types"
 	"go-drive/common/utils"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -21,11 +23,37 @@ import (
 const (
 	sqliteDBFilename = "index.db"
 	timeFormat       = "2006-01-02 15:04:05Z07:00"
+
+	contentTable     = "entry_contents"
+	highlightContent = "content"
+)
+
+// ftsModule is the SQLite full-text search module of the content table.
+// FTS5 is used if SQLite is built with it (the sqlite_fts5 build tag), otherwise FTS4.
+type ftsModule struct {
+	name   string
+	create string
+	// snippet is the expression of the highlighted snippet of the content column
+	snippet string
+}
+
+var (
+	fts5Module = ftsModule{
+		name: "fts5",
+		create: "CREATE VIRTUAL TABLE IF NOT EXISTS " + contentTable +
+			" USING fts5(path UNINDEXED, content, tokenize = 'unicode61 remove_diacritics 2')",
+		snippet: "snippet(" + contentTable + ", 1, '<mark>', '</mark>', '…', 16)",
+	}
+	fts4Module = ftsModule{
+		name: "fts4",
+		create: "CREATE VIRTUAL TABLE IF NOT EXISTS " + contentTable +
+			" USING fts4(path, content, notindexed=path, tokenize=unicode61)",
+		snippet: "snippet(" + contentTable + ", '<mark>', '</mark>', '…', 1, 16)",
+	}
 )
 
 var (
 	multipleAsterisksPattern = regexp.MustCompile(`\*{2,}`)
-	spacesPattern            = regexp.MustCompile(`\s+`)
 )
 
 func init() {
@@ -33,7 +61,8 @@ func init() {
 }
 
 type SQLiteSearcher struct {
-	db *gorm.DB
+	db  *gorm.DB
+	fts ftsModule
 }
 
 func NewSQLiteSearcher(config common.Config, searcherConfig types.SM) (Searcher, error) {
@@ -66,24 +95,72 @@ func NewSQLiteSearcher(config common.Config, searcherConfig types.SM) (Searcher,
 	if e := db.AutoMigrate(&entry{}); e != nil {
 		return nil, e
 	}
+	fts, e := createContentTable(db)
+	if e != nil {
+		return nil, e
+	}
 
-	searcher := &SQLiteSearcher{db: db}
+	searcher := &SQLiteSearcher{db: db, fts: fts}
 	return searcher, nil
 }
 
+func createContentTable(db *gorm.DB) (ftsModule, error) {
+	fts := fts4Module
+	var fts5 int
+	if e := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; e != nil {
+		return fts, e
+	}
+	if fts5 == 1 {
+		fts = fts5Module
+	}
+
+	var ddl string
+	if e := db.Raw("SELECT `sql` FROM `sqlite_master` WHERE `name` = ?", contentTable).
+		Scan(&ddl).Error; e != nil {
+		return fts, e
+	}
+	if ddl != "" && !strings.Contains(strings.ToLower(ddl), "using "+fts.name) {
+		// the index was created by a build with another FTS module
+		if e := db.Exec("DROP TABLE " + contentTable).Error; e != nil {
+			return fts, fmt.Errorf("the content index was created with another FTS module, "+
+				"delete the index and rebuild it: %w", e)
+		}
+		log.Printf("[SQLiteSearcher] the content index is recreated with %s, rebuild the index to fill it", fts.name)
+	}
+	return fts, db.Exec(fts.create).Error
+}
+
 func (s *SQLiteSearcher) Index(ctx types.TaskCtx, entries []types.EntrySearchItem) error {
 	data := utils.ArrayMap(entries, func(t *types.EntrySearchItem) entry {
 		return entry{
 			Path: t.Path, Name: t.Name, Ext: &t.Ext,
 			Type: t.Type, Size: t.Size, ModTime: t.ModTime.Format(timeFormat),
+			Camera: t.Camera, Artist: t.Artist, Album: t.Album,
 		}
 	})
-	for i := 0; i < len(data); i += 500 {
-		end := int(math.Min(float64(i+500), float64(len(data))))
-		s.db.Where("`path` in ?",
-			utils.ArrayMap(data[i:end], func(t *entry) string { return t.Path })).Delete(&entry{})
+	contents := make([]entryContent, 0)
+	for _, t := range entries {
+		if t.Content != "" {
+			contents = append(contents, entryContent{Path: t.Path, Content: t.Content})
+		}
 	}
-	return s.db.CreateInBatches(data, 150).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < len(data); i += 500 {
+			end := int(math.Min(float64(i+500), float64(len(data))))
+			paths := utils.ArrayMap(data[i:end], func(t *entry) string { return t.Path })
+			tx.Where("`path` in ?", paths).Delete(&entry{})
+			if e := tx.Where("`path` in ?", paths).Delete(&entryContent{}).Error; e != nil {
+				return e
+			}
+		}
+		if e := tx.CreateInBatches(data, 150).Error; e != nil {
+			return e
+		}
+		if len(contents) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(contents, 50).Error
+	})
 }
 
 func (s *SQLiteSearcher) Search(path string, query string, from int, size int) ([]types.EntrySearchResultItem, error) {
@@ -92,23 +169,55 @@ func (s *SQLiteSearcher) Search(path string, query string, from int, size int) (
 		tx = tx.Where("`path` LIKE (? || '%')", path+"/")
 	}
 
-	tx = s.buildQuery(tx, query)
+	q, e := ParseQuery(query)
+	if e != nil {
+		return nil, e
+	}
+	tx, contentTerms := s.buildQuery(tx, q)
 
 	var entries []entry
 	if e := tx.Find(&entries).Error; e != nil {
 		return nil, e
 	}
+	snippets, e := s.getSnippets(entries, contentTerms)
+	if e != nil {
+		return nil, e
+	}
 	return utils.ArrayMap(entries, func(t *entry) types.EntrySearchResultItem {
 		parsedTime, _ := time.Parse(timeFormat, t.ModTime)
-		return types.EntrySearchResultItem{
+		item := types.EntrySearchResultItem{
 			Entry: types.EntrySearchItem{
 				Path: t.Path, Name: t.Name, Ext: *t.Ext,
 				Type: t.Type, Size: t.Size, ModTime: parsedTime,
 			},
 		}
+		if snippet, ok := snippets[t.Path]; ok {
+			item.Highlights = map[string][]string{highlightContent: {snippet}}
+		}
+		return item
 	}), nil
 }
 
+// getSnippets returns the highlighted snippets of the contents of the entries matching any of the terms
+func (s *SQLiteSearcher) getSnippets(entries []entry, terms []string) (map[string]string, error) {
+	snippets := make(map[string]string)
+	if len(entries) == 0 || len(terms) == 0 {
+		return snippets, nil
+	}
+	var rows []entryContent
+	e := s.db.Raw("SELECT `path`, "+s.fts.snippet+" AS `content` FROM "+contentTable+
+		" WHERE "+contentTable+" MATCH ? AND `path` IN ?",
+		strings.Join(terms, " OR "), utils.ArrayMap(entries, func(t *entry) string { return t.Path }),
+	).Scan(&rows).Error
+	if e != nil {
+		return nil, e
+	}
+	for _, r := range rows {
+		snippets[r.Path] = r.Content
+	}
+	return snippets, nil
+}
+
 func (s *SQLiteSearcher) Delete(ctx types.TaskCtx, dirPath string) error {
 	ctx.Total(1, false)
 	for {
@@ -131,71 +240,159 @@ func (s *SQLiteSearcher) Delete(ctx types.TaskCtx, dirPath string) error {
 	if e := s.db.Delete(&entry{}, "`path` = ?", dirPath).Error; e != nil {
 		return e
 	}
+	if e := s.db.Delete(&entryContent{}, "`path` = ? OR `path` LIKE (? || '%')", dirPath, dirPath+"/").
+		Error; e != nil {
+		return e
+	}
 	ctx.Progress(1, false)
 	return nil
 }
 
+func (s *SQLiteSearcher) List(dirPath string, after string, size int) ([]types.EntrySearchItem, error) {
+	tx := s.db.Model(&entry{}).Where("`path` > ?", after).Order("`path`").Limit(size)
+	if dirPath != "" {
+		tx = tx.Where("(`path` = ? OR `path` LIKE (? || '%') ESCAPE '\\')", dirPath, escapeLike(dirPath+"/"))
+	}
+	var entries []entry
+	if e := tx.Find(&entries).Error; e != nil {
+		return nil, e
+	}
+	return utils.ArrayMap(entries, func(t *entry) types.EntrySearchItem {
+		parsedTime, _ := time.Parse(timeFormat, t.ModTime)
+		return types.EntrySearchItem{
+			Path: t.Path, Name: t.Name, Ext: *t.Ext,
+			Type: t.Type, Size: t.Size, ModTime: parsedTime,
+		}
+	}), nil
+}
+
 func (s *SQLiteSearcher) Stats() (types.SM, error) {
-	var count int64
+	var count, contents int64
 	if e := s.db.Model(&entry{}).Count(&count).Error; e != nil {
 		return nil, e
 	}
+	if e := s.db.Model(&entryContent{}).Count(&contents).Error; e != nil {
+		return nil, e
+	}
 	return types.SM{
-		"Total": strconv.FormatInt(count, 10),
+		"Total":    strconv.FormatInt(count, 10),
+		"Contents": strconv.FormatInt(contents, 10),
 	}, nil
 }
 
-var sizeQueryPattern = regexp.MustCompile(`^(=|[><]=?)([0-9]+[bkmgtBKMGT]?)$`)
-
-func (s *SQLiteSearcher) buildQuery(tx *gorm.DB, query string) *gorm.DB {
-	query = strings.TrimSpace(query)
-	// replace multiple asterisks
-	query = multipleAsterisksPattern.ReplaceAllString(query, "*")
-
-	// split query by space
-	queries := spacesPattern.Split(query, -1)
-
-	where := make([]string, 0, len(queries))
-	values := make([]any, 0, len(queries))
+// buildQuery adds the conditions and the order of the query to tx,
+// and returns the FTS phrases of the terms that can match the contents
+func (s *SQLiteSearcher) buildQuery(tx *gorm.DB, q Query) (*gorm.DB, []string) {
+	contentTerms := make([]string, 0)
+	if q.Root != nil {
+		where, values := buildSQLiteCondition(q.Root, false, &contentTerms)
+		tx = tx.Where(where, values...)
+	}
+	order := ""
+	switch q.Sort.Field {
+	case FieldSize:
+		order = "`size`"
+	case FieldModTime:
+		order = "`mod_time`"
+	}
+	if order != "" {
+		if q.Sort.Desc {
+			order += " DESC"
+		}
+		order += ", "
+	}
+	// the order must be stable for the pagination by offsets
+	tx = tx.Order(order + "`path`")
+	return tx, contentTerms
+}
 
-	for _, query := range queries {
-		var where_ string
-		var values_ []any
-		if strings.HasPrefix(query, "path:") {
-			where_, values_ = buildWildcardQuery(query[5:], "path")
-		} else if strings.HasPrefix(query, "in:") {
-			duration := types.SV(query[3:]).Duration(-1)
-			if duration <= 0 {
-				continue
+// buildSQLiteCondition translates the query node to the SQL condition,
+// the FTS phrases of the terms not negated are added to contentTerms for highlighting
+func buildSQLiteCondition(node QueryNode, negated bool, contentTerms *[]string) (string, []any) {
+	contentQuery := "`path` IN (SELECT `path` FROM " + contentTable + " WHERE " + contentTable + " MATCH ?)"
+	switch n := node.(type) {
+	case *AndNode:
+		return joinSQLiteConditions(n.Children, " AND ", negated, contentTerms)
+	case *OrNode:
+		return joinSQLiteConditions(n.Children, " OR ", negated, contentTerms)
+	case *NotNode:
+		where, values := buildSQLiteCondition(n.Child, !negated, contentTerms)
+		return "NOT " + where, values
+	case *TermNode:
+		switch n.Field {
+		case FieldText:
+			var where string
+			var values []any
+			if n.Phrase {
+				where, values = "`name` LIKE ('%' || ? || '%') ESCAPE '\\'", []any{escapeLike(n.Value)}
+			} else {
+				where, values = buildWildcardQuery(n.Value, "`name`")
 			}
-			modTime := time.Now().Add(-duration)
-			where_ = "`mod_time` > ?"
-			values_ = []any{modTime}
-		} else if m := sizeQueryPattern.FindStringSubmatch(query); m != nil {
-			size := types.SV(m[2]).DataSize(-1)
-			if size < 0 {
-				continue
+			// the terms without wildcards match the contents too
+			if phrase := ftsPhrase(n.Value); phrase != "" && !n.Wildcard() {
+				where = "(" + where + " OR " + contentQuery + ")"
+				values = append(values, phrase)
+				if !negated {
+					*contentTerms = append(*contentTerms, phrase)
+				}
 			}
-			where_ = "`size` >= 0 AND `size` " + m[1] + " ?"
-			values_ = []any{size}
-		} else if strings.HasPrefix(query, "type:") {
-			where_ = "`type` = ?"
-			values_ = []any{query[5:]}
-		} else {
-			where_, values_ = buildWildcardQuery(query, "`name`")
+			return where, values
+		case FieldPath, FieldCamera, FieldArtist, FieldAlbum:
+			column := "`" + string(n.Field) + "`"
+			if n.Phrase {
+				return column + " LIKE ('%' || ? || '%') ESCAPE '\\'", []any{escapeLike(n.Value)}
+			}
+			return buildWildcardQuery(n.Value, column)
+		case FieldContent:
+			phrase := ftsPhrase(n.Value)
+			if phrase == "" {
+				return "0", nil
+			}
+			if !negated {
+				*contentTerms = append(*contentTerms, phrase)
+			}
+			return contentQuery, []any{phrase}
+		case FieldType:
+			return "`type` = ?", []any{n.Value}
+		case FieldExt:
+			return "`ext` = ?", []any{n.Value}
+		case FieldDrive:
+			return "`path` LIKE (? || '/%') ESCAPE '\\'", []any{escapeLike(n.Value)}
+		case FieldSize:
+			return "(`size` >= 0 AND `size` " + n.Op + " ?)", []any{n.Size}
+		case FieldModTime:
+			// the times are stored in the local time zone
+			return "`mod_time` " + n.Op + " ?", []any{n.Time.Local().Format(timeFormat)}
 		}
+	}
+	panic(fmt.Sprintf("unknown query node: %#v", node))
+}
+
+func joinSQLiteConditions(nodes []QueryNode, op string, negated bool, contentTerms *[]string) (string, []any) {
+	where := make([]string, 0, len(nodes))
+	values := make([]any, 0, len(nodes))
+	for _, node := range nodes {
+		where_, values_ := buildSQLiteCondition(node, negated, contentTerms)
 		where = append(where, where_)
 		values = append(values, values_...)
 	}
+	return "(" + strings.Join(where, op) + ")", values
+}
 
-	if len(where) > 0 {
-		tx = tx.Where("("+strings.Join(where, " AND ")+")", values...)
+// ftsPhrase quotes the term as an FTS phrase, it returns empty if there is nothing to match
+func ftsPhrase(term string) string {
+	term = strings.Join(strings.FieldsFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+	if term == "" {
+		return ""
 	}
-	return tx
+	return "\"" + term + "\""
 }
 
 func (*SQLiteSearcher) Examples() []string {
-	return []string{"hello.txt", "path:a*dir", "*.mp3", "*.mp3 in:1h", ">10m", "type:dir"}
+	return []string{"hello.txt", "path:a*dir", "*.mp3", "*.mp3 in:1h", ">10m", "type:dir", "content:invoice",
+		"ext:mp3 OR ext:flac", "\"annual report\" -draft", "after:2024-01-01 sort:size", "camera:x100v"}
 }
 
 func (s *SQLiteSearcher) Dispose() error {
@@ -208,12 +405,19 @@ func (s *SQLiteSearcher) Dispose() error {
 
 func buildWildcardQuery(query, column string) (string, []any) {
 	query = strings.Trim(query, "*")
-	values := utils.ArrayMap(strings.Split(query, "*"), func(t *string) any { return t })
+	values := utils.ArrayMap(strings.Split(query, "*"), func(t *string) any { return escapeLike(*t) })
 	where := column + " LIKE ('%' || " +
-		strings.TrimSuffix(strings.Repeat("? || '%' || ", len(values)), " || '%' || ") + " || '%' )"
+		strings.TrimSuffix(strings.Repeat("? || '%' || ", len(values)), " || '%' || ") + " || '%' ) ESCAPE '\\'"
 	return where, values
 }
 
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// escapeLike escapes the wildcards of LIKE, the escape character is the backslash
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
 type entry struct {
 	Path    string          `gorm:"column:path;primaryKey;not null;type:string;size:4096"`
 	Name    string          `gorm:"column:name;not null;type:string;size:255"`
@@ -221,10 +425,23 @@ type entry struct {
 	Type    types.EntryType `gorm:"column:type;not null;type:string;size:16"`
 	Size    int64           `gorm:"column:size;not null;type:int"`
 	ModTime string          `gorm:"column:mod_time;not null;type:time;index"`
+	Camera  string          `gorm:"column:camera;not null;default:'';type:string;size:255"`
+	Artist  string          `gorm:"column:artist;not null;default:'';type:string;size:255"`
+	Album   string          `gorm:"column:album;not null;default:'';type:string;size:255"`
 }
 
 func (entry) TableName() string {
 	return "entries"
 }
 
+// entryContent is the row of the FTS table, which is not created by AutoMigrate
+type entryContent struct {
+	Path    string `gorm:"column:path"`
+	Content string `gorm:"column:content"`
+}
+
+func (entryContent) TableName() string {
+	return contentTable
+}
+
 var _ Searcher = (*SQLiteSearcher)(nil)
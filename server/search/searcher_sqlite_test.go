@@ -0,0 +1,104 @@
+package search
+
+import (
+	"go-drive/common"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteSearcher_Content(t *testing.T) {
+	searcher, e := NewSQLiteSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+
+	now := time.Now()
+	e = searcher.Index(task.DummyContext(), []types.EntrySearchItem{
+		{Path: "docs/a.txt", Name: "a.txt", Ext: "txt", Type: types.TypeFile, ModTime: now,
+			Content: "the quarterly invoice is attached"},
+		{Path: "docs/invoice.md", Name: "invoice.md", Ext: "md", Type: types.TypeFile, ModTime: now},
+		{Path: "docs/b.txt", Name: "b.txt", Ext: "txt", Type: types.TypeFile, ModTime: now, Content: "nothing"},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	search := func(query string) map[string]types.EntrySearchResultItem {
+		items, e := searcher.Search("", query, 0, 10)
+		if e != nil {
+			t.Fatal(e)
+		}
+		r := make(map[string]types.EntrySearchResultItem)
+		for _, item := range items {
+			r[item.Entry.Path] = item
+		}
+		return r
+	}
+
+	r := search("invoice")
+	if len(r) != 2 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	snippets := r["docs/a.txt"].Highlights[highlightContent]
+	if len(snippets) != 1 || !strings.Contains(snippets[0], "<mark>invoice</mark>") {
+		t.Errorf("unexpected highlights: %+v", r["docs/a.txt"].Highlights)
+	}
+	if r["docs/invoice.md"].Highlights != nil {
+		t.Errorf("unexpected highlights of name matching: %+v", r["docs/invoice.md"].Highlights)
+	}
+
+	if r := search("content:invoice"); len(r) != 1 || r["docs/a.txt"].Entry.Name != "a.txt" {
+		t.Errorf("unexpected result of content query: %+v", r)
+	}
+	if r := search("quarterly invoice"); len(r) != 1 {
+		t.Errorf("unexpected result of multiple terms: %+v", r)
+	}
+	// the wildcard terms only match the names
+	if r := search("invoice*"); len(r) != 1 {
+		t.Errorf("unexpected result of wildcard query: %+v", r)
+	}
+
+	// the content is replaced on re-indexing
+	e = searcher.Index(task.DummyContext(), []types.EntrySearchItem{
+		{Path: "docs/a.txt", Name: "a.txt", Ext: "txt", Type: types.TypeFile, ModTime: now, Content: "receipt"},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if r := search("content:invoice"); len(r) != 0 {
+		t.Errorf("expected the old content is removed, got %+v", r)
+	}
+
+	if e := searcher.Delete(task.DummyContext(), "docs"); e != nil {
+		t.Fatal(e)
+	}
+	stats, e := searcher.Stats()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stats["Total"] != "0" || stats["Contents"] != "0" {
+		t.Errorf("unexpected stats after deleting: %+v", stats)
+	}
+}
+
+func TestSQLiteSearcher_Query(t *testing.T) {
+	searcher, e := NewSQLiteSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+	testSearcherQueries(t, searcher)
+}
+
+func TestSQLiteSearcher_List(t *testing.T) {
+	searcher, e := NewSQLiteSearcher(common.Config{DataDir: t.TempDir()}, types.SM{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = searcher.Dispose() }()
+	testSearcherList(t, searcher)
+}
@@ -12,14 +12,20 @@ import (
 	"go-drive/common/utils"
 	"go-drive/drive"
 	"go-drive/server/auth"
+	"go-drive/server/ftp"
 	"go-drive/server/job"
+	"go-drive/server/metadata"
+	"go-drive/server/photo"
+	"go-drive/server/s3"
 	"go-drive/server/search"
+	"go-drive/server/sftp"
 	"go-drive/server/thumbnail"
 	"go-drive/storage"
 	"io/fs"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -33,6 +39,8 @@ func InitServer(config common.Config,
 	searcher *search.Service,
 	tokenStore types.TokenStore,
 	thumbnail *thumbnail.Maker,
+	media *metadata.Service,
+	photos *photo.Service,
 	signer *utils.Signer,
 	chunkUploader *ChunkUploader,
 	runner task.Runner,
@@ -46,6 +54,8 @@ func InitServer(config common.Config,
 	pathMetaDAO *storage.PathMetaDAO,
 	jobDAO *storage.JobDAO,
 	fileBucketDAO *storage.FileBucketDAO,
+	accessKeyDAO *storage.AccessKeyDAO,
+	settingsDAO *storage.SettingsDAO,
 	jobExecutor *job.JobExecutor,
 	messageSource i18n.MessageSource,
 	webFS fs.FS) (*gin.Engine, error) {
@@ -92,25 +102,61 @@ func InitServer(config common.Config,
 		return nil, e
 	}
 	if e := InitAdminRoutes(router, ch, config, bus, runner, jobExecutor, driveAccess, rootDrive, searcher, tokenStore, optionsDAO,
-		userDAO, groupDAO, driveDAO, driveDataDAO, permissionDAO, pathMountDAO, pathMetaDAO, jobDAO, fileBucketDAO); e != nil {
+		userDAO, groupDAO, driveDAO, driveDataDAO, permissionDAO, pathMountDAO, pathMetaDAO, jobDAO, fileBucketDAO, accessKeyDAO,
+		settingsDAO); e != nil {
 		return nil, e
 	}
 
-	if e := InitDriveRoutes(router, driveAccess, searcher, config, thumbnail,
+	if e := InitDriveRoutes(router, driveAccess, searcher, config, thumbnail, media,
 		signer, chunkUploader, runner, tokenStore, userDAO, optionsDAO, pathMetaDAO); e != nil {
 		return nil, e
 	}
 
+	if e := InitPhotoRoutes(router, driveAccess, photos, tokenStore); e != nil {
+		return nil, e
+	}
+
 	if e := InitFileBucketRoutes(router, config, driveAccess, fileBucketDAO, messageSource); e != nil {
 		return nil, e
 	}
 
+	if e := InitJobWebhookRoutes(router, jobExecutor, failBanGroup); e != nil {
+		return nil, e
+	}
+
 	if config.WebDav.Enabled {
 		if e := InitWebdavAccess(engine, config, driveAccess, userAuth); e != nil {
 			return nil, e
 		}
 	}
 
+	if config.SFTP.Enabled {
+		sftpServer, e := sftp.NewServer(config, driveAccess, userAuth)
+		if e != nil {
+			return nil, e
+		}
+		ch.Add(registry.KeySFTPServer, sftpServer)
+	}
+
+	if config.FTP.Enabled {
+		ftpServer, e := ftp.NewServer(config, driveAccess, userAuth)
+		if e != nil {
+			return nil, e
+		}
+		ch.Add(registry.KeyFTPServer, ftpServer)
+	}
+
+	if config.S3.Enabled {
+		gateway, e := s3.NewGateway(config, driveAccess, accessKeyDAO, userDAO)
+		if e != nil {
+			return nil, e
+		}
+		ch.Add(registry.KeyS3Gateway, gateway)
+		handler := gin.WrapH(gateway)
+		engine.Any(config.S3.Prefix, handler)
+		engine.Any(strings.TrimSuffix(config.S3.Prefix, "/")+"/*path", handler)
+	}
+
 	if webFS != nil {
 		webFiles := newWebFiles(http.FS(webFS), config, optionsDAO)
 		s := http.StripPrefix(config.WebPath, webFiles)
@@ -0,0 +1,671 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/server/job"
+	"go-drive/storage"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// SettingsVersion is the version of the settings document
+const SettingsVersion = 1
+
+const (
+	SettingsChangeCreate = "create"
+	SettingsChangeUpdate = "update"
+	SettingsChangeDelete = "delete"
+)
+
+// SettingsDocument is the YAML document of the settings stored in the database.
+// When importing, the absent sections are left untouched, and the options are merged.
+type SettingsDocument struct {
+	Version         int                      `yaml:"version"`
+	Drives          []SettingsDrive          `yaml:"drives"`
+	PathPermissions []SettingsPathPermission `yaml:"pathPermissions"`
+	PathMounts      []SettingsPathMount      `yaml:"pathMounts"`
+	PathMeta        []SettingsPathMeta       `yaml:"pathMeta"`
+	FileBuckets     []SettingsFileBucket     `yaml:"fileBuckets"`
+	Jobs            []SettingsJob            `yaml:"jobs"`
+	Groups          []SettingsGroup          `yaml:"groups"`
+	Options         map[string]string        `yaml:"options"`
+}
+
+type SettingsDrive struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Enabled bool     `yaml:"enabled"`
+	Config  types.SM `yaml:"config"`
+}
+
+type SettingsPathPermission struct {
+	Path    string `yaml:"path"`
+	Subject string `yaml:"subject"`
+	// Permission is the permission bits, 1: read, 2: write
+	Permission types.Permission `yaml:"permission"`
+	// Policy is 0: reject, 1: accept
+	Policy uint8 `yaml:"policy"`
+}
+
+type SettingsPathMount struct {
+	Path    string `yaml:"path"`
+	Name    string `yaml:"name"`
+	MountAt string `yaml:"mountAt"`
+}
+
+type SettingsPathMeta struct {
+	Path          string `yaml:"path"`
+	Password      string `yaml:"password,omitempty"`
+	DefaultSort   string `yaml:"defaultSort,omitempty"`
+	DefaultMode   string `yaml:"defaultMode,omitempty"`
+	HiddenPattern string `yaml:"hiddenPattern,omitempty"`
+	Recursive     uint32 `yaml:"recursive,omitempty"`
+}
+
+type SettingsFileBucket struct {
+	Name             string `yaml:"name"`
+	TargetPath       string `yaml:"targetPath"`
+	KeyTemplate      string `yaml:"keyTemplate,omitempty"`
+	CustomKey        bool   `yaml:"customKey,omitempty"`
+	SecretToken      string `yaml:"secretToken"`
+	URLTemplate      string `yaml:"urlTemplate,omitempty"`
+	AllowedTypes     string `yaml:"allowedTypes,omitempty"`
+	MaxSize          string `yaml:"maxSize,omitempty"`
+	AllowedReferrers string `yaml:"allowedReferrers,omitempty"`
+	CacheMaxAge      string `yaml:"cacheMaxAge,omitempty"`
+}
+
+// SettingsJob is the job identified by the ID, as the chained jobs are referenced by the IDs
+type SettingsJob struct {
+	ID             uint                 `yaml:"id"`
+	Description    string               `yaml:"description"`
+	Enabled        bool                 `yaml:"enabled"`
+	Triggers       []SettingsJobTrigger `yaml:"triggers"`
+	Action         string               `yaml:"action"`
+	ActionParams   types.SM             `yaml:"actionParams"`
+	MaxRetries     int                  `yaml:"maxRetries,omitempty"`
+	RetryDelay     int                  `yaml:"retryDelay,omitempty"`
+	Timeout        int                  `yaml:"timeout,omitempty"`
+	Concurrency    string               `yaml:"concurrency,omitempty"`
+	OnSuccess      uint                 `yaml:"onSuccess,omitempty"`
+	OnFailure      uint                 `yaml:"onFailure,omitempty"`
+	MaxLogLines    int                  `yaml:"maxLogLines,omitempty"`
+	KeepExecutions int                  `yaml:"keepExecutions,omitempty"`
+}
+
+type SettingsJobTrigger struct {
+	Type   string   `yaml:"type"`
+	Config types.SM `yaml:"config"`
+}
+
+type SettingsGroup struct {
+	Name     string   `yaml:"name"`
+	RootPath string   `yaml:"rootPath,omitempty"`
+	Users    []string `yaml:"users"`
+}
+
+// SettingsChange is a created, updated or deleted item of a section
+type SettingsChange struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Action  string `json:"action"`
+}
+
+// SettingsDiff is the result of importing a settings document
+type SettingsDiff struct {
+	Changes  []SettingsChange `json:"changes"`
+	Warnings []string         `json:"warnings"`
+	// Applied is false for dry runs, or if there are no changes
+	Applied bool `json:"applied"`
+}
+
+// ParseSettingsDocument parses the YAML document, unknown fields are rejected to catch typos
+func ParseSettingsDocument(r io.Reader) (*SettingsDocument, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	doc := &SettingsDocument{}
+	if e := decoder.Decode(doc); e != nil {
+		if errors.Is(e, io.EOF) {
+			return nil, err.NewBadRequestError("the settings document is empty")
+		}
+		return nil, err.NewBadRequestError("invalid settings document: " + e.Error())
+	}
+	if doc.Version != SettingsVersion {
+		return nil, err.NewBadRequestError(fmt.Sprintf(
+			"unsupported settings document version %d, expected %d", doc.Version, SettingsVersion))
+	}
+	return doc, nil
+}
+
+// MarshalSettingsDocument encodes the document as YAML
+func MarshalSettingsDocument(doc *SettingsDocument) ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if e := encoder.Encode(doc); e != nil {
+		return nil, e
+	}
+	if e := encoder.Close(); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+// SettingsIO exports and imports the settings document
+type SettingsIO struct {
+	settingsDAO   *storage.SettingsDAO
+	userDAO       *storage.UserDAO
+	driveRegistry *driveutil.DriveRegistry
+}
+
+func NewSettingsIO(settingsDAO *storage.SettingsDAO, userDAO *storage.UserDAO,
+	driveRegistry *driveutil.DriveRegistry) *SettingsIO {
+	return &SettingsIO{settingsDAO: settingsDAO, userDAO: userDAO, driveRegistry: driveRegistry}
+}
+
+// Export exports all the settings, the secrets are replaced with placeholders if redactSecrets is true.
+// The placeholders are restored from the existing settings when importing.
+func (s *SettingsIO) Export(redactSecrets bool) (*SettingsDocument, error) {
+	current, e := s.settingsDAO.Load()
+	if e != nil {
+		return nil, e
+	}
+	doc := newSettingsDocument(current)
+	if redactSecrets {
+		s.redactSecrets(doc)
+	}
+	return doc, nil
+}
+
+// Import validates the document and replaces the settings in a transaction if dryRun is false.
+// The running components are not reloaded.
+func (s *SettingsIO) Import(doc *SettingsDocument, dryRun bool) (*SettingsDiff, error) {
+	current, e := s.settingsDAO.Load()
+	if e != nil {
+		return nil, e
+	}
+	diff := &SettingsDiff{Changes: make([]SettingsChange, 0), Warnings: make([]string, 0)}
+	settings, e := s.toSettings(doc, current, diff)
+	if e != nil {
+		return nil, e
+	}
+	diff.Changes = diffSettings(newSettingsDocument(current), doc)
+	if dryRun || len(diff.Changes) == 0 {
+		return diff, nil
+	}
+	if e := s.settingsDAO.Replace(settings); e != nil {
+		return nil, e
+	}
+	diff.Applied = true
+	return diff, nil
+}
+
+func newSettingsDocument(s storage.Settings) *SettingsDocument {
+	doc := &SettingsDocument{
+		Version: SettingsVersion,
+		Drives: utils.ArrayMap(s.Drives, func(d *types.Drive) SettingsDrive {
+			config := types.SM{}
+			_ = json.Unmarshal([]byte(d.Config), &config)
+			return SettingsDrive{Name: d.Name, Type: d.Type, Enabled: d.Enabled, Config: config}
+		}),
+		PathPermissions: utils.ArrayMap(s.PathPermissions, func(p *types.PathPermission) SettingsPathPermission {
+			return SettingsPathPermission{Path: *p.Path, Subject: p.Subject, Permission: p.Permission, Policy: p.Policy}
+		}),
+		PathMounts: utils.ArrayMap(s.PathMounts, func(m *types.PathMount) SettingsPathMount {
+			return SettingsPathMount{Path: *m.Path, Name: m.Name, MountAt: m.MountAt}
+		}),
+		PathMeta: utils.ArrayMap(s.PathMeta, func(m *types.PathMeta) SettingsPathMeta {
+			return SettingsPathMeta{
+				Path: *m.Path, Password: m.Password, DefaultSort: m.DefaultSort,
+				DefaultMode: m.DefaultMode, HiddenPattern: m.HiddenPattern, Recursive: m.Recursive,
+			}
+		}),
+		FileBuckets: utils.ArrayMap(s.FileBuckets, func(b *types.FileBucket) SettingsFileBucket {
+			r := SettingsFileBucket{
+				Name: b.Name, TargetPath: b.TargetPath, KeyTemplate: b.KeyTemplate, CustomKey: b.CustomKey,
+				SecretToken: b.SecretToken, URLTemplate: b.URLTemplate, AllowedTypes: b.AllowedTypes,
+				MaxSize: b.MaxSize, AllowedReferrers: b.AllowedReferrers, CacheMaxAge: b.CacheMaxAge,
+			}
+			// 0 is unlimited, which is the default
+			if r.MaxSize == "0" {
+				r.MaxSize = ""
+			}
+			return r
+		}),
+		Jobs: utils.ArrayMap(s.Jobs, func(j *types.Job) SettingsJob {
+			triggers := make([]job.ParsedJobTrigger, 0)
+			_ = json.Unmarshal([]byte(j.Triggers), &triggers)
+			params := types.SM{}
+			_ = json.Unmarshal([]byte(j.ActionParams), &params)
+			return SettingsJob{
+				ID: j.ID, Description: j.Description, Enabled: j.Enabled,
+				Triggers: utils.ArrayMap(triggers, func(t *job.ParsedJobTrigger) SettingsJobTrigger {
+					return SettingsJobTrigger{Type: string(t.Type), Config: t.Config}
+				}),
+				Action: j.Action, ActionParams: params, MaxRetries: j.MaxRetries, RetryDelay: j.RetryDelay,
+				Timeout: j.Timeout, Concurrency: j.Concurrency, OnSuccess: j.OnSuccess, OnFailure: j.OnFailure,
+				MaxLogLines: j.MaxLogLines, KeepExecutions: j.KeepExecutions,
+			}
+		}),
+		Groups: utils.ArrayMap(s.Groups, func(g *storage.GroupWithUsers) SettingsGroup {
+			return SettingsGroup{
+				Name: g.Name, RootPath: g.RootPath,
+				Users: utils.ArrayMap(g.Users, func(u *types.User) string { return u.Username }),
+			}
+		}),
+		Options: s.Options,
+	}
+	if doc.Options == nil {
+		doc.Options = make(map[string]string)
+	}
+	return doc
+}
+
+func (s *SettingsIO) redactSecrets(doc *SettingsDocument) {
+	for i, d := range doc.Drives {
+		f := s.driveRegistry.GetDrive(d.Type)
+		if f == nil {
+			continue
+		}
+		for _, item := range f.ConfigForm {
+			if isSecretFormItem(item) && d.Config[item.Field] != "" {
+				doc.Drives[i].Config[item.Field] = secretPlaceholder
+			}
+		}
+	}
+	for i, m := range doc.PathMeta {
+		if m.Password != "" {
+			doc.PathMeta[i].Password = secretPlaceholder
+		}
+	}
+	for i, b := range doc.FileBuckets {
+		if b.SecretToken != "" {
+			doc.FileBuckets[i].SecretToken = secretPlaceholder
+		}
+	}
+	for _, j := range doc.Jobs {
+		for _, t := range j.Triggers {
+			if t.Type == string(job.JobTriggerTypeWebhook) && t.Config["secret"] != "" {
+				t.Config["secret"] = secretPlaceholder
+			}
+		}
+	}
+}
+
+func isSecretFormItem(item types.FormItem) bool {
+	return item.Type == "password" || item.Secret != ""
+}
+
+// toSettings validates the document and restores the redacted secrets from the current settings
+func (s *SettingsIO) toSettings(doc *SettingsDocument, current storage.Settings, diff *SettingsDiff) (storage.Settings, error) {
+	r := storage.Settings{Options: doc.Options}
+	invalid := func(section string, i int, format string, a ...any) error {
+		return err.NewBadRequestError(fmt.Sprintf("%s[%d]: ", section, i) + fmt.Sprintf(format, a...))
+	}
+
+	if doc.Drives != nil {
+		savedDrives := make(map[string]types.Drive, len(current.Drives))
+		for _, d := range current.Drives {
+			savedDrives[d.Name] = d
+		}
+		names := make(map[string]bool, len(doc.Drives))
+		r.Drives = make([]types.Drive, 0, len(doc.Drives))
+		for i := range doc.Drives {
+			d := &doc.Drives[i]
+			if e := CheckPathSegment(d.Name, "api.admin.invalid_drive_name"); e != nil {
+				return r, invalid("drives", i, "%s", e.Error())
+			}
+			if names[d.Name] {
+				return r, invalid("drives", i, "duplicate drive '%s'", d.Name)
+			}
+			names[d.Name] = true
+			f := s.driveRegistry.GetDrive(d.Type)
+			if f == nil {
+				return r, invalid("drives", i, "unknown drive type '%s'", d.Type)
+			}
+			if d.Config == nil {
+				d.Config = types.SM{}
+			}
+			saved, exists := savedDrives[d.Name]
+			savedConfig := types.SM{}
+			_ = json.Unmarshal([]byte(saved.Config), &savedConfig)
+			for _, item := range f.ConfigForm {
+				v := d.Config[item.Field]
+				if !isSecretFormItem(item) || (!isSecretPlaceholder(v) && (item.Secret == "" || v != item.Secret)) {
+					continue
+				}
+				if !exists || saved.Type != d.Type {
+					return r, invalid("drives", i, "the redacted secret '%s' of drive '%s' doesn't exist", item.Field, d.Name)
+				}
+				d.Config[item.Field] = savedConfig[item.Field]
+			}
+			config, _ := json.Marshal(d.Config)
+			r.Drives = append(r.Drives, types.Drive{Name: d.Name, Type: d.Type, Enabled: d.Enabled, Config: string(config)})
+		}
+	}
+
+	if doc.PathPermissions != nil {
+		keys := make(map[string]bool, len(doc.PathPermissions))
+		r.PathPermissions = make([]types.PathPermission, 0, len(doc.PathPermissions))
+		for i := range doc.PathPermissions {
+			p := &doc.PathPermissions[i]
+			p.Path = utils.CleanPath(p.Path)
+			if !isValidSubject(p.Subject) {
+				return r, invalid("pathPermissions", i, "invalid subject '%s'", p.Subject)
+			}
+			if p.Permission > types.PermissionReadWrite {
+				return r, invalid("pathPermissions", i, "invalid permission %d", p.Permission)
+			}
+			if p.Policy != types.PolicyReject && p.Policy != types.PolicyAccept {
+				return r, invalid("pathPermissions", i, "invalid policy %d", p.Policy)
+			}
+			key := permissionKey(*p)
+			if keys[key] {
+				return r, invalid("pathPermissions", i, "duplicate permission of '%s'", key)
+			}
+			keys[key] = true
+			path := p.Path
+			r.PathPermissions = append(r.PathPermissions, types.PathPermission{
+				Path: &path, Subject: p.Subject, Permission: p.Permission, Policy: p.Policy,
+			})
+		}
+	}
+
+	if doc.PathMounts != nil {
+		keys := make(map[string]bool, len(doc.PathMounts))
+		r.PathMounts = make([]types.PathMount, 0, len(doc.PathMounts))
+		for i := range doc.PathMounts {
+			m := &doc.PathMounts[i]
+			m.Path = utils.CleanPath(m.Path)
+			m.MountAt = utils.CleanPath(m.MountAt)
+			if m.Name == "" || utils.CleanPath(m.Name) != m.Name || utils.PathBase(m.Name) != m.Name || m.MountAt == "" {
+				return r, invalid("pathMounts", i, "invalid mount '%s' at '%s'", m.Name, m.Path)
+			}
+			key := mountKey(*m)
+			if keys[key] {
+				return r, invalid("pathMounts", i, "duplicate mount '%s'", key)
+			}
+			keys[key] = true
+			path := m.Path
+			r.PathMounts = append(r.PathMounts, types.PathMount{Path: &path, Name: m.Name, MountAt: m.MountAt})
+		}
+	}
+
+	if doc.PathMeta != nil {
+		saved := make(map[string]types.PathMeta, len(current.PathMeta))
+		for _, m := range current.PathMeta {
+			saved[*m.Path] = m
+		}
+		keys := make(map[string]bool, len(doc.PathMeta))
+		r.PathMeta = make([]types.PathMeta, 0, len(doc.PathMeta))
+		for i := range doc.PathMeta {
+			m := &doc.PathMeta[i]
+			m.Path = utils.CleanPath(m.Path)
+			if keys[m.Path] {
+				return r, invalid("pathMeta", i, "duplicate path '%s'", m.Path)
+			}
+			keys[m.Path] = true
+			if isSecretPlaceholder(m.Password) {
+				savedMeta, ok := saved[m.Path]
+				if !ok || savedMeta.Password == "" {
+					return r, invalid("pathMeta", i, "the redacted password of '%s' doesn't exist", m.Path)
+				}
+				m.Password = savedMeta.Password
+			}
+			path := m.Path
+			r.PathMeta = append(r.PathMeta, types.PathMeta{
+				Path: &path, Password: m.Password, DefaultSort: m.DefaultSort, DefaultMode: m.DefaultMode,
+				HiddenPattern: m.HiddenPattern, Recursive: m.Recursive,
+			})
+		}
+	}
+
+	if doc.FileBuckets != nil {
+		saved := make(map[string]types.FileBucket, len(current.FileBuckets))
+		for _, b := range current.FileBuckets {
+			saved[b.Name] = b
+		}
+		names := make(map[string]bool, len(doc.FileBuckets))
+		r.FileBuckets = make([]types.FileBucket, 0, len(doc.FileBuckets))
+		for i := range doc.FileBuckets {
+			b := &doc.FileBuckets[i]
+			if e := CheckPathSegment(b.Name, "api.admin.invalid_file_bucket_name"); e != nil {
+				return r, invalid("fileBuckets", i, "%s", e.Error())
+			}
+			if names[b.Name] {
+				return r, invalid("fileBuckets", i, "duplicate file bucket '%s'", b.Name)
+			}
+			names[b.Name] = true
+			if b.TargetPath == "" || b.SecretToken == "" {
+				return r, invalid("fileBuckets", i, "targetPath and secretToken are required")
+			}
+			if isSecretPlaceholder(b.SecretToken) {
+				savedBucket, ok := saved[b.Name]
+				if !ok {
+					return r, invalid("fileBuckets", i, "the redacted secretToken of '%s' doesn't exist", b.Name)
+				}
+				b.SecretToken = savedBucket.SecretToken
+			}
+			if b.MaxSize == "0" {
+				b.MaxSize = ""
+			}
+			maxSize := b.MaxSize
+			if maxSize == "" {
+				maxSize = "0"
+			}
+			r.FileBuckets = append(r.FileBuckets, types.FileBucket{
+				Name: b.Name, TargetPath: b.TargetPath, KeyTemplate: b.KeyTemplate, CustomKey: b.CustomKey,
+				SecretToken: b.SecretToken, URLTemplate: b.URLTemplate, AllowedTypes: b.AllowedTypes,
+				MaxSize: maxSize, AllowedReferrers: b.AllowedReferrers, CacheMaxAge: b.CacheMaxAge,
+			})
+		}
+	}
+
+	if doc.Jobs != nil {
+		savedJobs := make(map[uint]types.Job, len(current.Jobs))
+		for _, j := range current.Jobs {
+			savedJobs[j.ID] = j
+		}
+		ids := make(map[uint]bool, len(doc.Jobs))
+		for i, j := range doc.Jobs {
+			if j.ID == 0 {
+				return r, invalid("jobs", i, "id is required")
+			}
+			if ids[j.ID] {
+				return r, invalid("jobs", i, "duplicate job %d", j.ID)
+			}
+			ids[j.ID] = true
+		}
+		r.Jobs = make([]types.Job, 0, len(doc.Jobs))
+		for i := range doc.Jobs {
+			j := &doc.Jobs[i]
+			if job.GetActionDef(j.Action) == nil {
+				return r, invalid("jobs", i, "unknown action '%s'", j.Action)
+			}
+			for _, id := range []uint{j.OnSuccess, j.OnFailure} {
+				if id != 0 && !ids[id] {
+					return r, invalid("jobs", i, "chained job %d not found", id)
+				}
+			}
+			savedTriggers := make([]job.ParsedJobTrigger, 0)
+			_ = json.Unmarshal([]byte(savedJobs[j.ID].Triggers), &savedTriggers)
+			triggers := make([]job.ParsedJobTrigger, 0, len(j.Triggers))
+			for ti := range j.Triggers {
+				t := &j.Triggers[ti]
+				if t.Config == nil {
+					t.Config = types.SM{}
+				}
+				if t.Type == string(job.JobTriggerTypeWebhook) && isSecretPlaceholder(t.Config["secret"]) {
+					if ti >= len(savedTriggers) || string(savedTriggers[ti].Type) != t.Type {
+						return r, invalid("jobs", i, "the redacted secret of trigger %d doesn't exist", ti)
+					}
+					t.Config["secret"] = savedTriggers[ti].Config["secret"]
+				}
+				triggers = append(triggers, job.ParsedJobTrigger{Type: job.JobTriggerType(t.Type), Config: t.Config})
+			}
+			if j.ActionParams == nil {
+				j.ActionParams = types.SM{}
+			}
+			triggersJSON, _ := json.Marshal(triggers)
+			paramsJSON, _ := json.Marshal(j.ActionParams)
+			item := types.Job{
+				ID: j.ID, Description: j.Description, Triggers: string(triggersJSON), Action: j.Action,
+				ActionParams: string(paramsJSON), Enabled: j.Enabled, MaxRetries: j.MaxRetries,
+				RetryDelay: j.RetryDelay, Timeout: j.Timeout, Concurrency: j.Concurrency,
+				OnSuccess: j.OnSuccess, OnFailure: j.OnFailure, MaxLogLines: j.MaxLogLines,
+				KeepExecutions: j.KeepExecutions,
+			}
+			if e := job.ValidateJobConfig(item); e != nil {
+				return r, invalid("jobs", i, "%s", e.Error())
+			}
+			r.Jobs = append(r.Jobs, item)
+		}
+	}
+
+	if doc.Groups != nil {
+		users, e := s.userDAO.ListUser()
+		if e != nil {
+			return r, e
+		}
+		usernames := make(map[string]bool, len(users))
+		for _, u := range users {
+			usernames[u.Username] = true
+		}
+		names := make(map[string]bool, len(doc.Groups))
+		r.Groups = make([]storage.GroupWithUsers, 0, len(doc.Groups))
+		for i := range doc.Groups {
+			g := &doc.Groups[i]
+			if g.Name == "" {
+				return r, invalid("groups", i, "name is required")
+			}
+			if names[g.Name] {
+				return r, invalid("groups", i, "duplicate group '%s'", g.Name)
+			}
+			names[g.Name] = true
+			if g.RootPath != "" {
+				g.RootPath = utils.CleanPath(g.RootPath)
+			}
+			members := make([]string, 0, len(g.Users))
+			for _, u := range g.Users {
+				if !usernames[u] {
+					diff.Warnings = append(diff.Warnings, fmt.Sprintf("user '%s' of group '%s' doesn't exist", u, g.Name))
+					continue
+				}
+				members = append(members, u)
+			}
+			// the members are loaded in the order of the usernames
+			sort.Strings(members)
+			g.Users = members
+			r.Groups = append(r.Groups, storage.GroupWithUsers{
+				Group: types.Group{Name: g.Name, RootPath: g.RootPath},
+				Users: utils.ArrayMap(members, func(u *string) types.User { return types.User{Username: *u} }),
+			})
+		}
+	}
+
+	for key := range doc.Options {
+		if key == "" {
+			return r, err.NewBadRequestError("options: empty key")
+		}
+	}
+	return r, nil
+}
+
+func isValidSubject(subject string) bool {
+	if subject == types.AnySubject {
+		return true
+	}
+	return (strings.HasPrefix(subject, "u:") || strings.HasPrefix(subject, "g:")) && len(subject) > 2
+}
+
+func permissionKey(p SettingsPathPermission) string {
+	return "/" + p.Path + " " + p.Subject
+}
+
+func mountKey(m SettingsPathMount) string {
+	return "/" + utils.CleanPath(m.Path+"/"+m.Name)
+}
+
+// diffSettings compares the present sections of the document with the current settings,
+// the document must have been normalized by toSettings
+func diffSettings(current, doc *SettingsDocument) []SettingsChange {
+	changes := make([]SettingsChange, 0)
+	if doc.Drives != nil {
+		changes = diffSection(changes, "drives", current.Drives, doc.Drives,
+			func(d SettingsDrive) string { return d.Name })
+	}
+	if doc.PathPermissions != nil {
+		changes = diffSection(changes, "pathPermissions", current.PathPermissions, doc.PathPermissions, permissionKey)
+	}
+	if doc.PathMounts != nil {
+		changes = diffSection(changes, "pathMounts", current.PathMounts, doc.PathMounts, mountKey)
+	}
+	if doc.PathMeta != nil {
+		changes = diffSection(changes, "pathMeta", current.PathMeta, doc.PathMeta,
+			func(m SettingsPathMeta) string { return "/" + m.Path })
+	}
+	if doc.FileBuckets != nil {
+		changes = diffSection(changes, "fileBuckets", current.FileBuckets, doc.FileBuckets,
+			func(b SettingsFileBucket) string { return b.Name })
+	}
+	if doc.Jobs != nil {
+		changes = diffSection(changes, "jobs", current.Jobs, doc.Jobs,
+			func(j SettingsJob) string { return strconv.FormatUint(uint64(j.ID), 10) })
+	}
+	if doc.Groups != nil {
+		changes = diffSection(changes, "groups", current.Groups, doc.Groups,
+			func(g SettingsGroup) string { return g.Name })
+	}
+	optionKeys := make([]string, 0, len(doc.Options))
+	for key := range doc.Options {
+		optionKeys = append(optionKeys, key)
+	}
+	sort.Strings(optionKeys)
+	for _, key := range optionKeys {
+		old, ok := current.Options[key]
+		if !ok {
+			changes = append(changes, SettingsChange{Section: "options", Key: key, Action: SettingsChangeCreate})
+		} else if old != doc.Options[key] {
+			changes = append(changes, SettingsChange{Section: "options", Key: key, Action: SettingsChangeUpdate})
+		}
+	}
+	return changes
+}
+
+func diffSection[T any](changes []SettingsChange, section string, current, items []T, key func(T) string) []SettingsChange {
+	encode := func(v T) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	old := make(map[string]string, len(current))
+	for _, item := range current {
+		old[key(item)] = encode(item)
+	}
+	keys := make(map[string]bool, len(items))
+	for _, item := range items {
+		k := key(item)
+		keys[k] = true
+		if o, ok := old[k]; !ok {
+			changes = append(changes, SettingsChange{Section: section, Key: k, Action: SettingsChangeCreate})
+		} else if o != encode(item) {
+			changes = append(changes, SettingsChange{Section: section, Key: k, Action: SettingsChangeUpdate})
+		}
+	}
+	for _, item := range current {
+		if k := key(item); !keys[k] {
+			changes = append(changes, SettingsChange{Section: section, Key: k, Action: SettingsChangeDelete})
+		}
+	}
+	return changes
+}
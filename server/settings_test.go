@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"go-drive/common/driveutil"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"strings"
+	"testing"
+)
+
+func newTestSettingsIO(t *testing.T) (*SettingsIO, *storage.SettingsDAO, func()) {
+	t.Helper()
+	config, _ := testutil.GetSharedTestConfig()
+	ch := registry.NewComponentHolder()
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatalf("NewDB: %v", e)
+	}
+	userDAO := storage.NewUserDAO(db, ch)
+	settingsDAO := storage.NewSettingsDAO(db, storage.NewOptionsDAO(db, ch), storage.NewPathMetaDAO(db, ch),
+		storage.NewFileBucketDAO(db, ch), userDAO, ch)
+	driveRegistry := driveutil.NewDriveRegistry(ch)
+	driveRegistry.RegisterDrive(driveutil.DriveFactoryConfig{
+		Type: "settings-test",
+		ConfigForm: []types.FormItem{
+			{Field: "user", Type: "text"},
+			{Field: "password", Type: "password"},
+		},
+	})
+	return NewSettingsIO(settingsDAO, userDAO, driveRegistry), settingsDAO, func() {
+		_ = db.Dispose()
+		_ = ch.Dispose()
+	}
+}
+
+func TestSettingsIO_ExportAndImport(t *testing.T) {
+	sio, settingsDAO, cleanup := newTestSettingsIO(t)
+	defer cleanup()
+
+	doc, e := ParseSettingsDocument(strings.NewReader(`
+version: 1
+drives:
+  - name: d1
+    type: settings-test
+    enabled: true
+    config: {user: u, password: p}
+pathPermissions:
+  - {path: /d1/, subject: ANY, permission: 1, policy: 1}
+fileBuckets:
+  - {name: b1, targetPath: d1/b1, secretToken: token}
+jobs:
+  - id: 1
+    description: clean
+    enabled: true
+    triggers:
+      - {type: webhook, config: {secret: 0123456789abcdef}}
+    action: cleanup
+    actionParams: {folder: d1, olderThan: 30d}
+groups:
+  - {name: g1, users: [settings-nobody]}
+options:
+  settings.key: value
+`))
+	if e != nil {
+		t.Fatal(e)
+	}
+	diff, e := sio.Import(doc, true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if diff.Applied || len(diff.Changes) == 0 || len(diff.Warnings) != 1 {
+		t.Fatalf("unexpected diff of dry run: %+v", diff)
+	}
+	if s, _ := settingsDAO.Load(); len(s.Drives) != 0 {
+		t.Fatalf("the settings are changed in dry run: %+v", s.Drives)
+	}
+	if diff, e = sio.Import(doc, false); e != nil || !diff.Applied {
+		t.Fatalf("unexpected diff: %+v, %v", diff, e)
+	}
+
+	exported, e := sio.Export(true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, e := MarshalSettingsDocument(exported)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, secret := range []string{": p\n", "token", "0123456789abcdef"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("the secret %q is exported:\n%s", secret, data)
+		}
+	}
+	if exported.PathPermissions[0].Path != "d1" || len(exported.Groups[0].Users) != 0 {
+		t.Errorf("unexpected exported settings:\n%s", data)
+	}
+
+	// the redacted secrets are restored, and the unchanged settings have no changes
+	reimported, e := ParseSettingsDocument(bytes.NewReader(data))
+	if e != nil {
+		t.Fatal(e)
+	}
+	reimported.Drives[0].Config["user"] = "u2"
+	reimported.FileBuckets = reimported.FileBuckets[:0]
+	diff, e = sio.Import(reimported, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(diff.Changes) != 2 ||
+		diff.Changes[0] != (SettingsChange{Section: "drives", Key: "d1", Action: SettingsChangeUpdate}) ||
+		diff.Changes[1] != (SettingsChange{Section: "fileBuckets", Key: "b1", Action: SettingsChangeDelete}) {
+		t.Errorf("unexpected changes: %+v", diff.Changes)
+	}
+	s, _ := settingsDAO.Load()
+	if !strings.Contains(s.Drives[0].Config, `"password":"p"`) || !strings.Contains(s.Jobs[0].Triggers, "0123456789abcdef") {
+		t.Errorf("the secrets are not restored: %+v, %+v", s.Drives, s.Jobs)
+	}
+
+	for _, invalid := range []string{
+		"version: 2",
+		"version: 1\nunknown: 1",
+		"version: 1\ndrives: [{name: d2, type: unknown}]",
+		"version: 1\ndrives: [{name: d2, type: settings-test, config: {password: " + secretPlaceholder + "}}]",
+		"version: 1\npathPermissions: [{path: a, subject: x, permission: 1, policy: 1}]",
+		"version: 1\njobs: [{id: 2, action: cleanup, triggers: [{type: cron, config: {schedule: '* * * * *'}}], onSuccess: 3}]",
+		"version: 1\ngroups: [{name: g1}, {name: g1}]",
+	} {
+		doc, e := ParseSettingsDocument(strings.NewReader(invalid))
+		if e == nil {
+			_, e = sio.Import(doc, true)
+		}
+		if e == nil {
+			t.Errorf("expected error of %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+var errDirNotEmpty = errors.New("directory not empty")
+
+func newHandlers(s *Server, principal types.Principal) sftp.Handlers {
+	h := &handler{s: s, principal: principal}
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+var (
+	_ sftp.PosixRenameFileCmder = (*handler)(nil)
+	_ sftp.LstatFileLister      = (*handler)(nil)
+)
+
+type handler struct {
+	s         *Server
+	principal types.Principal
+}
+
+// drive returns the drive of the user. It's got for every request,
+// so that changes of the permissions take effect in open sessions.
+func (h *handler) drive() (types.IDrive, error) {
+	return h.s.drives.GetDrive(h.principal)
+}
+
+func (h *handler) driveFS(ctx context.Context) (*driveutil.DriveFS, error) {
+	d, e := h.drive()
+	if e != nil {
+		return nil, e
+	}
+	return driveutil.NewDriveFS(ctx, d, h.s.tempDir, h.s.cfp)
+}
+
+func (h *handler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	dfs, e := h.driveFS(r.Context())
+	if e != nil {
+		return nil, mapError(e)
+	}
+	f, e := dfs.OpenFile(r.Context(), r.Filepath, os.O_RDONLY, 0)
+	if e != nil {
+		return nil, mapError(e)
+	}
+	if stat, _ := f.Stat(); stat.IsDir() {
+		_ = f.Close()
+		return nil, sftp.ErrSSHFxFailure
+	}
+	return &fileAt{f: f}, nil
+}
+
+func (h *handler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	ctx := r.Context()
+	dfs, e := h.driveFS(ctx)
+	if e != nil {
+		return nil, mapError(e)
+	}
+	pflags := r.Pflags()
+	stat, e := dfs.Stat(ctx, r.Filepath)
+	if e != nil && !errors.Is(e, os.ErrNotExist) {
+		return nil, mapError(e)
+	}
+	exists := e == nil
+	if exists && stat.IsDir() {
+		return nil, sftp.ErrSSHFxFailure
+	}
+	if exists && pflags.Excl {
+		return nil, os.ErrExist
+	}
+
+	// the existing content is kept only when the file is not truncated
+	flag := os.O_RDWR
+	if !exists || pflags.Trunc {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, e := dfs.OpenFile(ctx, r.Filepath, flag, 0)
+	if e != nil {
+		return nil, mapError(e)
+	}
+	if flag&os.O_TRUNC != 0 {
+		// an empty write marks the file as modified,
+		// so that an empty or truncated file is saved even if nothing is written
+		if _, e := f.Write(nil); e != nil {
+			_ = f.Close()
+			return nil, mapError(e)
+		}
+	}
+	return &fileAt{f: f}, nil
+}
+
+func (h *handler) Filecmd(r *sftp.Request) error {
+	ctx := r.Context()
+	d, e := h.drive()
+	if e != nil {
+		return mapError(e)
+	}
+	path := utils.CleanPath(r.Filepath)
+	switch r.Method {
+	case "Setstat":
+		// modes, owners and times are not supported, they are ignored so that clients preserving them still work
+		return nil
+	case "Rename":
+		return h.rename(ctx, d, path, utils.CleanPath(r.Target), false)
+	case "Rmdir", "Remove":
+		entry, e := d.Get(ctx, path)
+		if e != nil {
+			return mapError(e)
+		}
+		if r.Method == "Rmdir" {
+			if !entry.Type().IsDir() {
+				return sftp.ErrSSHFxFailure
+			}
+			children, e := d.List(ctx, path)
+			if e != nil {
+				return mapError(e)
+			}
+			if len(children) > 0 {
+				return errDirNotEmpty
+			}
+		} else if entry.Type().IsDir() {
+			return sftp.ErrSSHFxFailure
+		}
+		return mapError(d.Delete(task.NewContextWrapper(ctx), path))
+	case "Mkdir":
+		_, e := d.MakeDir(ctx, path)
+		return mapError(e)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handler) PosixRename(r *sftp.Request) error {
+	d, e := h.drive()
+	if e != nil {
+		return mapError(e)
+	}
+	return h.rename(r.Context(), d, utils.CleanPath(r.Filepath), utils.CleanPath(r.Target), true)
+}
+
+func (h *handler) rename(ctx context.Context, d types.IDrive, from, to string, override bool) error {
+	entry, e := d.Get(ctx, from)
+	if e != nil {
+		return mapError(e)
+	}
+	if !override {
+		// drives rename the target if it exists, but SFTP rename fails
+		if _, e := d.Get(ctx, to); e == nil {
+			return os.ErrExist
+		} else if !err.IsNotFoundError(e) {
+			return mapError(e)
+		}
+	}
+	_, e = d.Move(task.NewContextWrapper(ctx), entry, to, override)
+	return mapError(e)
+}
+
+func (h *handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	dfs, e := h.driveFS(r.Context())
+	if e != nil {
+		return nil, mapError(e)
+	}
+	switch r.Method {
+	case "List":
+		f, e := dfs.OpenFile(r.Context(), r.Filepath, os.O_RDONLY, 0)
+		if e != nil {
+			return nil, mapError(e)
+		}
+		defer func() { _ = f.Close() }()
+		infos, e := f.Readdir(-1)
+		if e != nil {
+			return nil, mapError(e)
+		}
+		return listerAt(utils.ArrayMap(infos, func(t *fs.FileInfo) fs.FileInfo { return fileInfo{*t} })), nil
+	case "Stat":
+		stat, e := dfs.Stat(r.Context(), r.Filepath)
+		if e != nil {
+			return nil, mapError(e)
+		}
+		return listerAt{fileInfo{stat}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handler) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	r.Method = "Stat"
+	return h.Filelist(r)
+}
+
+type listerAt []fs.FileInfo
+
+func (l listerAt) ListAt(ls []fs.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fileInfo applies the permission bits of the entry to user, group and others.
+type fileInfo struct {
+	fs.FileInfo
+}
+
+func (f fileInfo) Mode() fs.FileMode {
+	mode := f.FileInfo.Mode()
+	perm := mode.Perm() & 07
+	return mode&^fs.ModePerm | perm<<6 | perm<<3 | perm
+}
+
+// fileAt adapts the sequential file of DriveFS to the random access of SFTP.
+type fileAt struct {
+	f  driveutil.DriveFSFile
+	mu sync.Mutex
+}
+
+func (f *fileAt) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, e := f.f.Seek(off, io.SeekStart); e != nil {
+		return 0, e
+	}
+	n, e := io.ReadFull(f.f, p)
+	if errors.Is(e, io.ErrUnexpectedEOF) {
+		e = io.EOF
+	}
+	return n, e
+}
+
+func (f *fileAt) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, e := f.f.Seek(off, io.SeekStart); e != nil {
+		return 0, e
+	}
+	n, e := f.f.Write(p)
+	return n, mapError(e)
+}
+
+func (f *fileAt) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return mapError(f.f.Close())
+}
+
+func mapError(e error) error {
+	if e == nil {
+		return nil
+	}
+	if err.IsNotFoundError(e) {
+		return os.ErrNotExist
+	}
+	var permissionDenied err.PermissionDeniedError
+	if err.IsNotAllowedError(e) || errors.As(e, &permissionDenied) || errors.Is(e, os.ErrPermission) {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if err.IsUnsupportedError(e) {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	return e
+}
@@ -0,0 +1,273 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	handshakeTimeout = 30 * time.Second
+
+	maxAuthFailures   = 10
+	authFailureWindow = 10 * time.Minute
+
+	authTokenExtension = "go-drive-auth"
+)
+
+// Authenticator authenticates the SSH users, it's implemented by auth.UserAuth
+type Authenticator interface {
+	AuthByUsernamePassword(username, password string) (types.User, error)
+	AuthByPublicKey(username string, key ssh.PublicKey) (types.User, error)
+}
+
+// DriveGetter returns the drive view of the principal, it's implemented by drive.Access
+type DriveGetter interface {
+	GetDrive(session types.Principal) (types.IDrive, error)
+}
+
+// Server serves the virtual tree over SFTP, the requests of a session are handled by the drive of the signed-in user.
+type Server struct {
+	drives  DriveGetter
+	users   Authenticator
+	tempDir string
+	cfp     *driveutil.CacheFilePool
+
+	hostKey  ssh.Signer
+	listener net.Listener
+	// failures counts the password failures by remote IP
+	failures *utils.KVCache[int]
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewServer(config common.Config, drives DriveGetter, users Authenticator) (*Server, error) {
+	hostKeyFile := config.SFTP.HostKey
+	if !filepath.IsAbs(hostKeyFile) {
+		hostKeyFile = filepath.Join(config.DataDir, hostKeyFile)
+	}
+	hostKey, e := loadOrCreateHostKey(hostKeyFile)
+	if e != nil {
+		return nil, fmt.Errorf("sftp host key: %w", e)
+	}
+	cfp, e := driveutil.NewCacheFillPool(config.SFTP.MaxCacheItems, config.TempDir)
+	if e != nil {
+		return nil, e
+	}
+	listener, e := net.Listen("tcp", config.SFTP.Listen)
+	if e != nil {
+		return nil, e
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		drives:   drives,
+		users:    users,
+		tempDir:  config.TempDir,
+		cfp:      cfp,
+		hostKey:  hostKey,
+		listener: listener,
+		failures: utils.NewKVCache[int](0, authFailureWindow),
+		conns:    make(map[net.Conn]struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	log.Printf("SFTP server is listening on %s", listener.Addr())
+	return s, nil
+}
+
+// Addr returns the listening address
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, e := s.listener.Accept()
+		if e != nil {
+			if s.ctx.Err() == nil {
+				log.Printf("[sftp] accept error: %v", e)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	// The config is created for every connection, so the users authenticated by
+	// the callbacks are scoped to the connection. The authenticated one is found
+	// by the token in the permissions returned by the successful callback.
+	users := make(map[string]types.User)
+	config := s.newSSHConfig(users)
+
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sshConn, channels, requests, e := ssh.NewServerConn(conn, config)
+	if e != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	defer func() { _ = sshConn.Close() }()
+
+	user, ok := users[sshConn.Permissions.Extensions[authTokenExtension]]
+	if !ok {
+		return
+	}
+	principal := types.Principal{User: user, AuthType: types.AuthTypeSSH}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, channelRequests, e := newChannel.Accept()
+		if e != nil {
+			continue
+		}
+		go s.handleSession(principal, channel, channelRequests)
+	}
+}
+
+func (s *Server) handleSession(principal types.Principal, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() { _ = channel.Close() }()
+	for req := range requests {
+		// only the sftp subsystem is supported, shell and exec are rejected
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		_ = req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		server := sftp.NewRequestServer(channel, newHandlers(s, principal))
+		if e := server.Serve(); e != nil && !errors.Is(e, io.EOF) {
+			log.Printf("[sftp] session of '%s' closed: %v", utils.LogSanitize(principal.User.Username), e)
+		}
+		_ = server.Close()
+		return
+	}
+}
+
+func (s *Server) newSSHConfig(users map[string]types.User) *ssh.ServerConfig {
+	authenticated := func(user types.User) (*ssh.Permissions, error) {
+		token := strconv.Itoa(len(users))
+		users[token] = user
+		return &ssh.Permissions{Extensions: map[string]string{authTokenExtension: token}}, nil
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			ip := remoteIP(conn.RemoteAddr())
+			if n, _ := s.failures.Get(ip); n >= maxAuthFailures {
+				return nil, errors.New("too many authentication failures")
+			}
+			user, e := s.users.AuthByUsernamePassword(conn.User(), string(password))
+			if e != nil {
+				if err.IsNotAllowedError(e) {
+					n, _ := s.failures.Get(ip)
+					s.failures.Set(ip, n+1, authFailureWindow)
+				}
+				return nil, e
+			}
+			s.failures.Remove(ip)
+			return authenticated(user)
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if n, _ := s.failures.Get(remoteIP(conn.RemoteAddr())); n >= maxAuthFailures {
+				return nil, errors.New("too many authentication failures")
+			}
+			user, e := s.users.AuthByPublicKey(conn.User(), key)
+			if e != nil {
+				return nil, e
+			}
+			return authenticated(user)
+		},
+	}
+	config.AddHostKey(s.hostKey)
+	return config
+}
+
+func remoteIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	return addr.String()
+}
+
+// loadOrCreateHostKey loads the private key from file, a new ed25519 key is generated if the file does not exist
+func loadOrCreateHostKey(file string) (ssh.Signer, error) {
+	data, e := os.ReadFile(file)
+	if e != nil && !os.IsNotExist(e) {
+		return nil, e
+	}
+	if e != nil {
+		_, key, e := ed25519.GenerateKey(rand.Reader)
+		if e != nil {
+			return nil, e
+		}
+		block, e := ssh.MarshalPrivateKey(key, "go-drive sftp host key")
+		if e != nil {
+			return nil, e
+		}
+		data = pem.EncodeToMemory(block)
+		if e := os.WriteFile(file, data, 0600); e != nil {
+			return nil, e
+		}
+		log.Printf("SFTP host key is generated at %s", file)
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// Dispose stops the server and closes all connections
+func (s *Server) Dispose() error {
+	s.cancel()
+	e := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	_ = s.failures.Dispose()
+	return e
+}
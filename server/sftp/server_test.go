@@ -0,0 +1,223 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/drive/fs"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+type testUsers struct {
+	key ssh.PublicKey
+}
+
+func (u *testUsers) AuthByUsernamePassword(username, password string) (types.User, error) {
+	if username == "alice" && password == "secret" {
+		return types.User{Username: username}, nil
+	}
+	return types.User{}, err.NewNotAllowedMessageError(i18n.T("api.auth.invalid_username_or_password"))
+}
+
+func (u *testUsers) AuthByPublicKey(username string, key ssh.PublicKey) (types.User, error) {
+	if username == "alice" && string(key.Marshal()) == string(u.key.Marshal()) {
+		return types.User{Username: username}, nil
+	}
+	return types.User{}, err.NewNotAllowedMessageError(i18n.T("api.auth.invalid_username_or_password"))
+}
+
+type testDrives struct {
+	drive     types.IDrive
+	principal types.Principal
+}
+
+func (d *testDrives) GetDrive(session types.Principal) (types.IDrive, error) {
+	d.principal = session
+	return d.drive, nil
+}
+
+func newTestServer(t *testing.T) (*Server, *testDrives, ssh.Signer, string) {
+	t.Helper()
+	root := t.TempDir()
+	config := common.Config{DataDir: t.TempDir(), TempDir: t.TempDir(), FreeFs: true}
+	config.SFTP = common.SFTPConfig{Listen: "127.0.0.1:0", HostKey: "host_key", MaxCacheItems: 10}
+
+	fsDrive, e := fs.NewDrive(context.Background(), types.SM{"path": root}, driveutil.DriveUtils{Config: config})
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, e := ssh.NewSignerFromKey(clientKey)
+	if e != nil {
+		t.Fatal(e)
+	}
+	drives := &testDrives{drive: fsDrive}
+	s, e := NewServer(config, drives, &testUsers{key: signer.PublicKey()})
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { _ = s.Dispose() })
+	return s, drives, signer, root
+}
+
+func dial(t *testing.T, s *Server, auth ssh.AuthMethod) (*sftp.Client, error) {
+	t.Helper()
+	conn, e := ssh.Dial("tcp", s.Addr().String(), &ssh.ClientConfig{
+		User:            "alice",
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if e != nil {
+		return nil, e
+	}
+	client, e := sftp.NewClient(conn)
+	if e != nil {
+		_ = conn.Close()
+		return nil, e
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = conn.Close()
+	})
+	return client, nil
+}
+
+func writeRemote(t *testing.T, client *sftp.Client, path, content string) {
+	t.Helper()
+	f, e := client.Create(path)
+	if e != nil {
+		t.Fatalf("Create %s: %v", path, e)
+	}
+	if _, e := f.Write([]byte(content)); e != nil {
+		t.Fatalf("Write %s: %v", path, e)
+	}
+	if e := f.Close(); e != nil {
+		t.Fatalf("Close %s: %v", path, e)
+	}
+}
+
+func readRemote(t *testing.T, client *sftp.Client, path string) string {
+	t.Helper()
+	f, e := client.Open(path)
+	if e != nil {
+		t.Fatalf("Open %s: %v", path, e)
+	}
+	defer func() { _ = f.Close() }()
+	b, e := io.ReadAll(f)
+	if e != nil {
+		t.Fatalf("Read %s: %v", path, e)
+	}
+	return string(b)
+}
+
+func TestSFTPAuthentication(t *testing.T) {
+	s, drives, signer, _ := newTestServer(t)
+
+	if _, e := dial(t, s, ssh.Password("wrong")); e == nil {
+		t.Fatal("login with a wrong password should fail")
+	}
+	if _, e := dial(t, s, ssh.Password("secret")); e != nil {
+		t.Fatalf("password login: %v", e)
+	}
+	client, e := dial(t, s, ssh.PublicKeys(signer))
+	if e != nil {
+		t.Fatalf("public key login: %v", e)
+	}
+	if _, e := client.ReadDir("/"); e != nil {
+		t.Fatalf("ReadDir: %v", e)
+	}
+	if drives.principal.User.Username != "alice" || drives.principal.AuthType != types.AuthTypeSSH {
+		t.Fatalf("unexpected principal: %+v", drives.principal)
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	if _, e := dial(t, s, ssh.PublicKeys(otherSigner)); e == nil {
+		t.Fatal("login with an unknown key should fail")
+	}
+}
+
+func TestSFTPFileOperations(t *testing.T) {
+	s, _, _, root := newTestServer(t)
+	client, e := dial(t, s, ssh.Password("secret"))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if e := client.Mkdir("/docs"); e != nil {
+		t.Fatalf("Mkdir: %v", e)
+	}
+	writeRemote(t, client, "/docs/a.txt", "hello sftp")
+	writeRemote(t, client, "/docs/empty.txt", "")
+	if b, e := os.ReadFile(filepath.Join(root, "docs", "a.txt")); e != nil || string(b) != "hello sftp" {
+		t.Fatalf("uploaded content = %q, %v", b, e)
+	}
+	if _, e := os.Stat(filepath.Join(root, "docs", "empty.txt")); e != nil {
+		t.Fatalf("empty file was not created: %v", e)
+	}
+	if got := readRemote(t, client, "/docs/a.txt"); got != "hello sftp" {
+		t.Fatalf("downloaded content = %q", got)
+	}
+
+	f, e := client.Open("/docs/a.txt")
+	if e != nil {
+		t.Fatal(e)
+	}
+	buf := make([]byte, 4)
+	if _, e := f.ReadAt(buf, 6); e != nil || string(buf) != "sftp" {
+		t.Fatalf("ReadAt = %q, %v", buf, e)
+	}
+	_ = f.Close()
+
+	infos, e := client.ReadDir("/docs")
+	if e != nil {
+		t.Fatal(e)
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a.txt,empty.txt" {
+		t.Fatalf("ReadDir = %v", names)
+	}
+
+	if e := client.Rename("/docs/a.txt", "/docs/empty.txt"); e == nil {
+		t.Fatal("rename to an existing file should fail")
+	}
+	if e := client.Rename("/docs/a.txt", "/docs/b.txt"); e != nil {
+		t.Fatalf("Rename: %v", e)
+	}
+	if e := client.PosixRename("/docs/b.txt", "/docs/empty.txt"); e != nil {
+		t.Fatalf("PosixRename: %v", e)
+	}
+	if got := readRemote(t, client, "/docs/empty.txt"); got != "hello sftp" {
+		t.Fatalf("content after PosixRename = %q", got)
+	}
+
+	if e := client.RemoveDirectory("/docs"); e == nil {
+		t.Fatal("removing a non-empty directory should fail")
+	}
+	if e := client.Remove("/docs/empty.txt"); e != nil {
+		t.Fatalf("Remove: %v", e)
+	}
+	if e := client.RemoveDirectory("/docs"); e != nil {
+		t.Fatalf("RemoveDirectory: %v", e)
+	}
+	if _, e := client.Stat("/docs"); !os.IsNotExist(e) {
+		t.Fatalf("Stat removed directory: %v", e)
+	}
+}
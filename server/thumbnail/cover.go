@@ -0,0 +1,57 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/server/metadata"
+	"io"
+	"time"
+)
+
+func init() {
+	RegisterTypeHandler("cover", newCoverTypeHandler)
+}
+
+// coverTypeHandler creates thumbnails from the cover art embedded in the audio and video files,
+// including MP4/M4A, MP3, FLAC and Ogg.
+// Only the headers and the cover are read by range requests,
+// so it works for the formats whose metadata is at the end of the file.
+//
+// The other handlers of the file type are tried if there is no cover.
+type coverTypeHandler struct {
+	image *imageTypeHandler
+}
+
+func newCoverTypeHandler(c types.SM) (TypeHandler, error) {
+	return &coverTypeHandler{image: newImageHandler(c)}, nil
+}
+
+func (h *coverTypeHandler) CreateThumbnail(ctx context.Context, entry ThumbnailEntry, dest io.Writer) error {
+	o := entry.Options()
+	// there is no WebP encoder, the shell handlers can be used instead
+	if o.Format == FormatWebP {
+		return err.NewUnsupportedError()
+	}
+	data, e := metadata.ReadCover(ctx, entry)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return err.NewUnsupportedError()
+		}
+		return e
+	}
+	return h.image.writeThumbnail(bytes.NewReader(data), o, dest)
+}
+
+func (h *coverTypeHandler) MimeType() string {
+	return "image/jpeg"
+}
+
+func (h *coverTypeHandler) SupportsFormat() bool {
+	return true
+}
+
+func (h *coverTypeHandler) Timeout() time.Duration {
+	return 30 * time.Second
+}
@@ -0,0 +1,53 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	err "go-drive/common/errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestCoverTypeHandler(t *testing.T) {
+	cover := &bytes.Buffer{}
+	if e := png.Encode(cover, image.NewRGBA(image.Rect(0, 0, 400, 200))); e != nil {
+		t.Fatal(e)
+	}
+	// FLAC with the STREAMINFO and PICTURE blocks
+	picture := binary.BigEndian.AppendUint32(nil, 3)
+	picture = binary.BigEndian.AppendUint32(picture, 9)
+	picture = append(picture, "image/png"...)
+	picture = binary.BigEndian.AppendUint32(picture, 0)
+	picture = append(picture, make([]byte, 16)...)
+	picture = binary.BigEndian.AppendUint32(picture, uint32(cover.Len()))
+	picture = append(picture, cover.Bytes()...)
+	data := append([]byte("fLaC\x00\x00\x00\x22"), make([]byte, 34)...)
+	data = append(data, 0x86, byte(len(picture)>>16), byte(len(picture)>>8), byte(len(picture)))
+	data = append(data, picture...)
+
+	h, _ := newCoverTypeHandler(nil)
+	newEntry := func(data string) ThumbnailEntry {
+		entry := &testEntry{path: "a/b.flac", data: data}
+		return &thumbnailEntry{IEntry: entry, IDispatcherEntry: entry}
+	}
+
+	dest := &bytes.Buffer{}
+	if e := h.CreateThumbnail(context.Background(), newEntry(string(data)), dest); e != nil {
+		t.Fatal(e)
+	}
+	img, e := jpeg.Decode(dest)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if img.Bounds().Dx() != 220 || img.Bounds().Dy() != 110 {
+		t.Errorf("unexpected size: %v", img.Bounds())
+	}
+
+	// the other handlers are tried if there is no cover
+	if e := h.CreateThumbnail(context.Background(), newEntry("fLaC\x80\x00\x00\x22"+string(make([]byte, 34))), dest); !err.IsUnsupportedError(e) {
+		t.Errorf("expected unsupported error, got %v", e)
+	}
+}
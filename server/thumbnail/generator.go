@@ -0,0 +1,188 @@
+package thumbnail
+
+import (
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/event"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"log"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// GenerateResult is the result of generating the thumbnails of a folder
+type GenerateResult struct {
+	// Generated is the number of the thumbnails generated or already cached
+	Generated int `json:"generated"`
+	Failed    int `json:"failed"`
+}
+
+func (r GenerateResult) String() string {
+	return fmt.Sprintf("%d generated, %d failed", r.Generated, r.Failed)
+}
+
+// Generator generates the thumbnails ahead of the requests,
+// for the folders on demand and for the updated entries matching the configured path patterns
+type Generator struct {
+	maker  *Maker
+	drive  *drive.RootDrive
+	runner task.Runner
+	// patterns are the path patterns whose thumbnails are generated when updated
+	patterns []string
+	// bases are the literal directories of the patterns
+	bases []string
+
+	unsubscribe event.Unsubscribe
+}
+
+func NewGenerator(config common.Config, maker *Maker, rootDrive *drive.RootDrive, runner task.Runner,
+	bus event.Bus, ch *registry.ComponentsHolder) (*Generator, error) {
+	for _, p := range config.Thumbnail.Pregenerate {
+		if !doublestar.ValidatePattern(p) {
+			return nil, fmt.Errorf("invalid thumbnail pregenerate pattern: %s", p)
+		}
+	}
+	g := &Generator{
+		maker:    maker,
+		drive:    rootDrive,
+		runner:   runner,
+		patterns: config.Thumbnail.Pregenerate,
+		bases:    patternBases(config.Thumbnail.Pregenerate),
+	}
+	if len(g.patterns) > 0 {
+		g.unsubscribe = bus.SubscribeEntryUpdated(g.onUpdated)
+	}
+	ch.Add(registry.KeyThumbnailGenerator, g)
+	return g, nil
+}
+
+// TriggerGenerate generates the thumbnails in the path recursively in the background
+func (g *Generator) TriggerGenerate(path string) (task.Task, error) {
+	return g.runner.Execute(func(ctx types.TaskCtx) (any, error) {
+		r, e := g.Generate(ctx, path, nil)
+		if e != nil {
+			log.Printf("Error generating thumbnails of %s: %s", utils.LogSanitize(path), e)
+		}
+		return r, e
+	}, task.WithNameGroup(path, "thumbnail/generate"))
+}
+
+// Generate generates the thumbnails in the path recursively and waits for it to be done.
+// Only the entries matching filter are visited if it is not nil.
+func (g *Generator) Generate(ctx types.TaskCtx, path string, filter func(path string) bool) (GenerateResult, error) {
+	r := GenerateResult{}
+	e := g.walk(ctx, g.drive.Get(), path, filter, &r)
+	return r, e
+}
+
+// walk generates the thumbnails of the entries in the path,
+// errors of the entries are logged and counted, only the cancellation stops walking
+func (g *Generator) walk(ctx types.TaskCtx, d types.IDrive, path string,
+	filter func(path string) bool, r *GenerateResult) error {
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+	entry, e := d.Get(ctx, path)
+	if e != nil {
+		log.Printf("failed to generate thumbnail of %s: %s", utils.LogSanitize(path), e)
+		r.Failed++
+		return nil
+	}
+	if (filter == nil || filter(path)) && g.maker.Supports(entry) {
+		ctx.Total(1, false)
+		if e := g.generate(ctx, entry); e != nil {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+			log.Printf("failed to generate thumbnail of %s: %s", utils.LogSanitize(path), e)
+			r.Failed++
+		} else {
+			r.Generated++
+		}
+		ctx.Progress(1, false)
+	}
+	if !entry.Type().IsDir() {
+		return nil
+	}
+	entries, e := d.List(ctx, path)
+	if e != nil {
+		log.Printf("failed to generate thumbnails in %s: %s", utils.LogSanitize(path), e)
+		r.Failed++
+		return nil
+	}
+	for _, entry := range entries {
+		if e := g.walk(ctx, d, entry.Path(), filter, r); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (g *Generator) generate(ctx types.TaskCtx, entry types.IEntry) error {
+	t, e := g.maker.Make(ctx, entry, Options{})
+	if e != nil {
+		return e
+	}
+	return t.Close()
+}
+
+func (g *Generator) matches(path string) bool {
+	for _, p := range g.patterns {
+		if ok, _ := doublestar.Match(p, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// patternBases returns the directories before the first meta character of the patterns, empty for the root
+func patternBases(patterns []string) []string {
+	bases := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		base, _ := doublestar.SplitPattern(p)
+		if base == "." {
+			base = ""
+		}
+		bases = append(bases, base)
+	}
+	return bases
+}
+
+// mayMatchIn reports whether the path or its descendants may match the patterns,
+// which is true if the path is in the base of a pattern, or contains the base
+func (g *Generator) mayMatchIn(path string) bool {
+	path = utils.CleanPath(path)
+	for _, base := range g.bases {
+		if base == path || utils.IsPathParent(path, base) || utils.IsPathParent(base, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) onUpdated(_ types.DriveListenerContext, path string, includeDescendants bool) {
+	if includeDescendants && !g.mayMatchIn(path) {
+		return
+	}
+	if !includeDescendants && !g.matches(path) {
+		return
+	}
+	_, _ = g.runner.Execute(func(ctx types.TaskCtx) (any, error) {
+		r, e := g.Generate(ctx, path, g.matches)
+		if e != nil {
+			log.Printf("Error generating thumbnails of %s: %s", utils.LogSanitize(path), e)
+		}
+		return r, e
+	}, task.WithNameGroup(path, "thumbnail/generate"))
+}
+
+func (g *Generator) Dispose() error {
+	if g.unsubscribe != nil {
+		g.unsubscribe()
+	}
+	return nil
+}
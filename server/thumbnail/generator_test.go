@@ -0,0 +1,27 @@
+package thumbnail
+
+import "testing"
+
+func TestGenerator_MayMatchIn(t *testing.T) {
+	g := &Generator{bases: patternBases([]string{"Photos/**/*.jpg", "Share/a/b.png"})}
+	for path, want := range map[string]bool{
+		"":               true,
+		"Photos":         true,
+		"Photos/2024/05": true,
+		"Share":          true,
+		"Share/a":        true,
+		"Share/b":        false,
+		"Music":          false,
+		"Photoshop":      false,
+	} {
+		if got := g.mayMatchIn(path); got != want {
+			t.Errorf("mayMatchIn(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// the base of a pattern starting with a meta character is the root
+	g = &Generator{bases: patternBases([]string{"*/Camera/*.jpg"})}
+	if !g.mayMatchIn("Music/Albums") {
+		t.Error("any path may match the pattern without a literal base")
+	}
+}
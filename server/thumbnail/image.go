@@ -11,8 +11,9 @@ import (
 	"image/draw"
 	_ "image/gif"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
+	"math"
 	"os"
 	"time"
 
@@ -32,15 +33,24 @@ type imageTypeHandler struct {
 }
 
 func newImageTypeHandler(c types.SM) (TypeHandler, error) {
+	return newImageHandler(c), nil
+}
+
+func newImageHandler(c types.SM) *imageTypeHandler {
 	return &imageTypeHandler{
 		maxSize:      c.GetInt64("max-size", 32*1024*1024), // 32MB
 		maxPixels:    c.GetInt("max-pixels", 6000*6000),
 		imageSize:    c.GetUint("size", 220),
 		imageQuality: c.GetInt("quality", 50),
-	}, nil
+	}
 }
 
 func (i *imageTypeHandler) CreateThumbnail(ctx context.Context, entry ThumbnailEntry, dest io.Writer) error {
+	o := entry.Options()
+	// there is no WebP encoder, the shell handlers can be used instead
+	if o.Format == FormatWebP {
+		return err.NewUnsupportedError()
+	}
 	if entry.Size() > i.maxSize {
 		return err.NewNotFoundMessageError(i18n.T("api.thumbnail.file_too_large"))
 	}
@@ -52,25 +62,79 @@ func (i *imageTypeHandler) CreateThumbnail(ctx context.Context, entry ThumbnailE
 		_ = tempFile.Close()
 		_ = os.Remove(tempFile.Name())
 	}()
-	imgConf, _, e := image.DecodeConfig(tempFile)
+	return i.writeThumbnail(tempFile, o, dest)
+}
+
+// writeThumbnail decodes the image, and writes the thumbnail of options to dest
+func (i *imageTypeHandler) writeThumbnail(src io.ReadSeeker, o Options, dest io.Writer) error {
+	imgConf, _, e := image.DecodeConfig(src)
 	if e != nil {
 		return e
 	}
 	if imgConf.Width*imgConf.Height > i.maxPixels {
 		return err.NewNotFoundMessageError(i18n.T("api.thumbnail.image_too_large"))
 	}
-	_, e = tempFile.Seek(0, 0)
+	_, e = src.Seek(0, 0)
 	if e != nil {
 		return e
 	}
-	img, _, e := image.Decode(tempFile)
+	img, _, e := image.Decode(src)
 	if e != nil {
 		return e
 	}
-	resizedImg := resizeThumbnail(img, int(i.imageSize), int(i.imageSize))
+	width, height := o.Width, o.Height
+	if width == 0 && height == 0 {
+		width, height = int(i.imageSize), int(i.imageSize)
+	}
+	resizedImg := resizeImage(img, width, height, o.Fit)
+	if o.Format == FormatPNG {
+		return png.Encode(dest, resizedImg)
+	}
 	return jpeg.Encode(dest, resizedImg, &jpeg.Options{Quality: i.imageQuality})
 }
 
+// resizeImage resizes src to the box of width and height, 0 for no limit of the dimension.
+// Images are not enlarged when fitting in the box, and cover and fill need both dimensions.
+func resizeImage(src image.Image, width, height int, fit string) image.Image {
+	if width == 0 || height == 0 || fit == "" || fit == FitContain {
+		if width == 0 {
+			width = math.MaxInt32
+		}
+		if height == 0 {
+			height = math.MaxInt32
+		}
+		return resizeThumbnail(src, width, height)
+	}
+	bounds := src.Bounds()
+	if fit == FitFill {
+		// the box is shrunk to fit in the image with the same aspect ratio, so the image is never enlarged
+		if width > bounds.Dx() {
+			height = max(1, height*bounds.Dx()/width)
+			width = bounds.Dx()
+		}
+		if height > bounds.Dy() {
+			width = max(1, width*bounds.Dy()/height)
+			height = bounds.Dy()
+		}
+		return scaleImage(src, bounds, width, height)
+	}
+	// cover: crops the center of the image to the aspect ratio of the box
+	crop := bounds
+	if bounds.Dx()*height > bounds.Dy()*width {
+		w := max(1, bounds.Dy()*width/height)
+		crop.Min.X += (bounds.Dx() - w) / 2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := max(1, bounds.Dx()*height/width)
+		crop.Min.Y += (bounds.Dy() - h) / 2
+		crop.Max.Y = crop.Min.Y + h
+	}
+	if crop.Dx() < width {
+		width, height = crop.Dx(), crop.Dy()
+	}
+	return scaleImage(src, crop, width, height)
+}
+
 func resizeThumbnail(src image.Image, maxWidth, maxHeight int) image.Image {
 	bounds := src.Bounds()
 	width, height := bounds.Dx(), bounds.Dy()
@@ -88,8 +152,12 @@ func resizeThumbnail(src image.Image, maxWidth, maxHeight int) image.Image {
 		newHeight = maxHeight
 	}
 
-	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-	xdraw.NearestNeighbor.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return scaleImage(src, bounds, newWidth, newHeight)
+}
+
+func scaleImage(src image.Image, r image.Rectangle, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, r, draw.Src, nil)
 	return dst
 }
 
@@ -97,6 +165,10 @@ func (i *imageTypeHandler) MimeType() string {
 	return "image/jpeg"
 }
 
+func (i *imageTypeHandler) SupportsFormat() bool {
+	return true
+}
+
 func (i *imageTypeHandler) Timeout() time.Duration {
 	return -1
 }
@@ -54,3 +54,32 @@ func TestResizeThumbnail(t *testing.T) {
 		})
 	}
 }
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		fit           string
+		wantWidth     int
+		wantHeight    int
+	}{
+		{name: "contain", width: 200, height: 200, fit: FitContain, wantWidth: 200, wantHeight: 100},
+		{name: "contain width only", width: 100, fit: FitContain, wantWidth: 100, wantHeight: 50},
+		{name: "contain height only", height: 100, fit: FitCover, wantWidth: 200, wantHeight: 100},
+		{name: "cover", width: 100, height: 100, fit: FitCover, wantWidth: 100, wantHeight: 100},
+		{name: "cover larger", width: 1000, height: 1000, fit: FitCover, wantWidth: 200, wantHeight: 200},
+		{name: "fill", width: 100, height: 150, fit: FitFill, wantWidth: 100, wantHeight: 150},
+		{name: "fill larger", width: 100, height: 300, fit: FitFill, wantWidth: 66, wantHeight: 200},
+		{name: "fill much larger", width: 1000, height: 500, fit: FitFill, wantWidth: 400, wantHeight: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+			got := resizeImage(src, tt.width, tt.height, tt.fit)
+			if got.Bounds().Dx() != tt.wantWidth || got.Bounds().Dy() != tt.wantHeight {
+				t.Fatalf("unexpected size: got %dx%d, want %dx%d", got.Bounds().Dx(), got.Bounds().Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
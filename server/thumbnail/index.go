@@ -49,6 +49,8 @@ type Maker struct {
 
 	pool    pond.Pool
 	options *storage.OptionsDAO
+	// store is nil if the thumbnails are only cached locally
+	store Store
 
 	validity    time.Duration
 	stopCleaner func()
@@ -66,9 +68,15 @@ func NewMaker(config common.Config, optionsDAO *storage.OptionsDAO,
 		return nil, e
 	}
 
+	store, e := createStore(config.Thumbnail.Store, ch)
+	if e != nil {
+		return nil, e
+	}
+
 	m := &Maker{
 		handlers: handlers,
 		options:  optionsDAO,
+		store:    store,
 		cacheDir: dir,
 		apiPath:  config.APIPath,
 		validity: config.Thumbnail.TTL,
@@ -131,8 +139,10 @@ func createHandlers(items []common.ThumbnailHandlerItem) (map[string]map[string]
 	return hs, nil
 }
 
-func (m *Maker) Make(ctx context.Context, entry types.IEntry) (Thumbnail, error) {
-	thumbnailEntry, e := m.createThumbnailEntry(entry)
+// Make returns the thumbnail of the entry in the size and the format of options,
+// thumbnails of different options are cached separately
+func (m *Maker) Make(ctx context.Context, entry types.IEntry, options Options) (Thumbnail, error) {
+	thumbnailEntry, e := m.createThumbnailEntry(entry, options)
 	if e != nil {
 		return nil, e
 	}
@@ -145,11 +155,30 @@ func (m *Maker) Make(ctx context.Context, entry types.IEntry) (Thumbnail, error)
 	if t != nil {
 		return t, nil
 	}
+	t, e = m.getFromStore(ctx, thumbnailEntry, itemPath)
+	if e != nil {
+		return nil, e
+	}
+	if t != nil {
+		return t, nil
+	}
 
 	return m.doMake(ctx, thumbnailEntry, itemPath)
 }
 
-func (m *Maker) createThumbnailEntry(entry types.IEntry) (ThumbnailEntry, error) {
+// Supports returns whether there are handlers to create the thumbnail of the entry
+func (m *Maker) Supports(entry types.IEntry) bool {
+	fType := FolderType
+	if !entry.Type().IsDir() {
+		fType = utils.PathExt(entry.Path())
+	}
+	if _, ok := m.handlers[fType]; ok {
+		return true
+	}
+	return GetWrappedThumbnailEntry(entry) != nil
+}
+
+func (m *Maker) createThumbnailEntry(entry types.IEntry, options Options) (ThumbnailEntry, error) {
 	// we need to use the absolute path of this entry to generate thumbnail cache key
 	// so we get the wrapped IDispatcherEntry here
 	dispatcherEntry := driveutil.GetIEntry(entry, func(e types.IEntry) bool {
@@ -185,6 +214,7 @@ func (m *Maker) createThumbnailEntry(entry types.IEntry) (ThumbnailEntry, error)
 		IEntry:           entry,
 		IDispatcherEntry: dispatcherEntry.(types.IDispatcherEntry),
 		externalURL:      externalURL,
+		options:          options,
 	}, nil
 }
 
@@ -197,6 +227,10 @@ func (m *Maker) resolveHandler(entry ThumbnailEntry) ([]TypeHandler, error) {
 	}
 
 	te := GetWrappedThumbnailEntry(entry)
+	// the thumbnails provided by the drives are not converted to the requested format
+	if entry.Options().Format != "" {
+		te = nil
+	}
 
 	hs, ok := m.handlers[fType]
 	if !ok {
@@ -282,6 +316,59 @@ func (m *Maker) tryToGetFromCache(entry ThumbnailEntry, path string) (Thumbnail,
 	return m.openFile("", f, meta, headerSize)
 }
 
+// getFromStore copies the thumbnail from the store to the local cache.
+// Returns nil if the store is not configured, or the thumbnail is not in the store or expired
+func (m *Maker) getFromStore(ctx context.Context, entry ThumbnailEntry, path string) (Thumbnail, error) {
+	if m.store == nil {
+		return nil, nil
+	}
+	key := filepath.Base(path)
+	// the lock suffix lets the leftover be removed on startup
+	f, e := os.CreateTemp(m.cacheDir, key+".*"+lockSuffix)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	e = m.store.Get(ctx, key, f)
+	if closeErr := f.Close(); e == nil {
+		e = closeErr
+	}
+	if e != nil {
+		if !err.IsNotFoundError(e) {
+			log.Printf("failed to get thumbnail %s from the store: %s", key, e)
+		}
+		return nil, nil
+	}
+	// an empty file is the failure marker, which is not expected from the store
+	if stat, e := os.Stat(f.Name()); e != nil || stat.Size() == 0 {
+		return nil, e
+	}
+	if e := os.Rename(f.Name(), path); e != nil {
+		return nil, e
+	}
+	return m.tryToGetFromCache(entry, path)
+}
+
+// putToStore saves the generated thumbnail to the store, errors are logged
+func (m *Maker) putToStore(path string) {
+	if m.store == nil {
+		return
+	}
+	f, e := os.Open(path)
+	if e != nil {
+		log.Printf("failed to save thumbnail to the store: %s", e)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	stat, e := f.Stat()
+	if e == nil {
+		e = m.store.Put(context.Background(), filepath.Base(path), stat.Size(), f)
+	}
+	if e != nil {
+		log.Printf("failed to save thumbnail %s to the store: %s", filepath.Base(path), e)
+	}
+}
+
 func (m *Maker) doMake(ctx context.Context, entry ThumbnailEntry, path string) (Thumbnail, error) {
 	h, e := m.resolveHandler(entry)
 	if e != nil {
@@ -324,6 +411,17 @@ func (m *Maker) doMake(ctx context.Context, entry ThumbnailEntry, path string) (
 	return t, nil
 }
 
+// thumbnailMimeType returns the mime-type of the thumbnail created by h,
+// the requested format is used only if h encodes the thumbnails in it
+func thumbnailMimeType(h TypeHandler, o Options) string {
+	if fh, ok := h.(FormatTypeHandler); ok && fh.SupportsFormat() {
+		if f := o.MimeType(); f != "" {
+			return f
+		}
+	}
+	return h.MimeType()
+}
+
 func (m *Maker) executeTask(task *taskWrapper) error {
 	exists, e := utils.FileExists(task.dest)
 	if e != nil {
@@ -343,7 +441,7 @@ func (m *Maker) executeTask(task *taskWrapper) error {
 	}
 	var lastErr error
 	for _, h := range task.h {
-		item, e := m.createItem(task.entry, lockFile, h.MimeType())
+		item, e := m.createItem(task.entry, lockFile, thumbnailMimeType(h, task.entry.Options()))
 		if e != nil {
 			return e
 		}
@@ -370,6 +468,7 @@ func (m *Maker) executeTask(task *taskWrapper) error {
 				_ = os.Remove(task.dest)
 				return e
 			}
+			m.putToStore(task.dest)
 			return nil
 		}
 
@@ -528,7 +627,12 @@ func (m *Maker) remove(path string) error {
 }
 
 func (m *Maker) getItem(entry ThumbnailEntry) string {
-	key := md5.Sum([]byte(entry.GetRealPath()))
+	name := entry.GetRealPath()
+	// the default thumbnail keeps the key without the options
+	if o := entry.Options(); !o.IsDefault() {
+		name += "\x00" + o.key()
+	}
+	key := md5.Sum([]byte(name))
 	return filepath.Join(m.cacheDir, fmt.Sprintf("%x", key))
 }
 
@@ -555,6 +659,30 @@ func (m *Maker) clean() {
 	}
 }
 
+// RemoveAll deletes all the generated thumbnails and returns the number of deleted files.
+// It must not be called while a Maker is running.
+func RemoveAll(config common.Config) (int, error) {
+	dir, e := config.GetTempDir("thumbnails", false)
+	if e != nil {
+		return 0, e
+	}
+	n := 0
+	e = filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
+		if os.IsNotExist(e) {
+			return nil
+		}
+		if e != nil || info.IsDir() {
+			return e
+		}
+		if e := os.Remove(path); e != nil {
+			return e
+		}
+		n++
+		return nil
+	})
+	return n, e
+}
+
 func (m *Maker) Dispose() error {
 	m.stopCleaner()
 	m.pool.StopAndWait()
@@ -0,0 +1,53 @@
+package thumbnail
+
+import (
+	"go-drive/common"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveAll(t *testing.T) {
+	config := common.Config{TempDir: t.TempDir()}
+	if n, e := RemoveAll(config); e != nil || n != 0 {
+		t.Fatalf("unexpected result of missing dir: %d, %v", n, e)
+	}
+
+	dir, e := config.GetTempDir("thumbnails", true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, name := range []string{"a", "b" + lockSuffix} {
+		if e := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if n, e := RemoveAll(config); e != nil || n != 2 {
+		t.Fatalf("unexpected result: %d, %v", n, e)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the thumbnails are deleted, got %d files", len(entries))
+	}
+}
+
+func TestThumbnailMimeType(t *testing.T) {
+	image := &imageTypeHandler{}
+	shell := &shellThumbnailTypeHandler{mimeType: "image/jpeg"}
+	formatShell := &shellThumbnailTypeHandler{mimeType: "image/webp", supportsFormat: true}
+	for _, c := range []struct {
+		h    TypeHandler
+		o    Options
+		want string
+	}{
+		{image, Options{}, "image/jpeg"},
+		{image, Options{Format: FormatPNG}, "image/png"},
+		{shell, Options{}, "image/jpeg"},
+		{shell, Options{Format: FormatWebP}, "image/jpeg"},
+		{formatShell, Options{}, "image/webp"},
+		{formatShell, Options{Format: FormatPNG}, "image/png"},
+	} {
+		if got := thumbnailMimeType(c.h, c.o); got != c.want {
+			t.Errorf("thumbnailMimeType(%T, %q) = %q, want %q", c.h, c.o.Format, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package thumbnail
+
+import (
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"slices"
+	"strconv"
+)
+
+const (
+	FitContain = "contain"
+	FitCover   = "cover"
+	FitFill    = "fill"
+
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+
+	// maxThumbnailSize is the maximum width of the thumbnails of explicit sizes
+	maxThumbnailSize = 2048
+	// maxResizeSize is the maximum width and height of the resized images
+	maxResizeSize = 8192
+)
+
+// allowedSizes are the sizes in pixels that the requested sizes are rounded up to,
+// so that the number of the cached variants of a file is limited
+var allowedSizes = []int{64, 128, 256, 320, 480, 640, 800, 1024, 1280, 1600, 1920, 2048, 2560, 3840, 5120, 8192}
+
+// snapSize returns the smallest allowed size not less than n, false if n is out of range
+func snapSize(n, maxSize int) (int, bool) {
+	if n <= 0 || n > maxSize {
+		return 0, false
+	}
+	i, _ := slices.BinarySearch(allowedSizes, n)
+	return allowedSizes[i], true
+}
+
+// namedSizes are the widths of the named thumbnail sizes, 0 for the size configured by the handler
+var namedSizes = map[string]int{
+	"":       0,
+	"small":  0,
+	"medium": 480,
+	"large":  1280,
+}
+
+var formatMimeTypes = map[string]string{
+	FormatJPEG: "image/jpeg",
+	FormatPNG:  "image/png",
+	FormatWebP: "image/webp",
+}
+
+// Options is the size and the format of the thumbnail, the zero value is the default thumbnail of the handler
+type Options struct {
+	// Width and Height are the bounding box of the thumbnail, 0 for no limit of the dimension
+	Width  int
+	Height int
+	// Fit is how the image fits the box: contain (default), cover or fill
+	Fit string
+	// Format is the output format: jpeg, png or webp, the handler's format if empty
+	Format string
+}
+
+// IsDefault reports whether the options are the default thumbnail
+func (o Options) IsDefault() bool {
+	return o == Options{}
+}
+
+// key is used to separate the cache of the thumbnails with different options
+func (o Options) key() string {
+	return fmt.Sprintf("%dx%d,%s,%s", o.Width, o.Height, o.Fit, o.Format)
+}
+
+// MimeType returns the mime-type of Format, empty if Format is empty
+func (o Options) MimeType() string {
+	return formatMimeTypes[o.Format]
+}
+
+// ParseSize parses the thumbnail size, which is small, medium, large or the width in pixels,
+// the width is rounded up to the allowed sizes
+func ParseSize(size string) (Options, error) {
+	if w, ok := namedSizes[size]; ok {
+		return Options{Width: w, Height: w}, nil
+	}
+	w, e := strconv.Atoi(size)
+	w, ok := snapSize(w, maxThumbnailSize)
+	if e != nil || !ok {
+		return Options{}, err.NewBadRequestError(i18n.T("api.thumbnail.invalid_size", size))
+	}
+	return Options{Width: w, Height: w}, nil
+}
+
+// ParseResizeOptions parses the options of resizing images, at least one of width and height is required.
+// The width and height are rounded up to the allowed sizes.
+func ParseResizeOptions(width, height, fit, format string) (Options, error) {
+	o := Options{Fit: fit, Format: format}
+	for _, v := range []struct {
+		s    string
+		dest *int
+	}{{width, &o.Width}, {height, &o.Height}} {
+		if v.s == "" {
+			continue
+		}
+		n, e := strconv.Atoi(v.s)
+		n, ok := snapSize(n, maxResizeSize)
+		if e != nil || !ok {
+			return Options{}, err.NewBadRequestError(i18n.T("api.thumbnail.invalid_size", v.s))
+		}
+		*v.dest = n
+	}
+	if o.Width == 0 && o.Height == 0 {
+		return Options{}, err.NewBadRequestError(i18n.T("api.thumbnail.invalid_size", ""))
+	}
+	switch o.Fit {
+	case "":
+		o.Fit = FitContain
+	case FitContain, FitCover, FitFill:
+	default:
+		return Options{}, err.NewBadRequestError(i18n.T("api.thumbnail.invalid_fit", fit))
+	}
+	switch o.Format {
+	case "", "jpg":
+		o.Format = FormatJPEG
+	case FormatJPEG, FormatPNG, FormatWebP:
+	default:
+		return Options{}, err.NewBadRequestError(i18n.T("api.thumbnail.invalid_format", format))
+	}
+	return o, nil
+}
@@ -0,0 +1,63 @@
+package thumbnail
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    Options
+		wantErr bool
+	}{
+		{size: "", want: Options{}},
+		{size: "small", want: Options{}},
+		{size: "medium", want: Options{Width: 480, Height: 480}},
+		{size: "large", want: Options{Width: 1280, Height: 1280}},
+		{size: "300", want: Options{Width: 320, Height: 320}},
+		{size: "2048", want: Options{Width: 2048, Height: 2048}},
+		{size: "0", wantErr: true},
+		{size: "4096", wantErr: true},
+		{size: "huge", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, e := ParseSize(tt.size)
+		if (e != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.size, e, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %+v, want %+v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestParseResizeOptions(t *testing.T) {
+	tests := []struct {
+		width, height, fit, format string
+
+		want    Options
+		wantErr bool
+	}{
+		{width: "100", want: Options{Width: 128, Fit: FitContain, Format: FormatJPEG}},
+		{width: "8192", want: Options{Width: 8192, Fit: FitContain, Format: FormatJPEG}},
+		{height: "50", fit: "cover", format: "png", want: Options{Height: 64, Fit: FitCover, Format: FormatPNG}},
+		{width: "1000", height: "64", format: "jpg", want: Options{Width: 1024, Height: 64, Fit: FitContain, Format: FormatJPEG}},
+		{width: "100", format: "webp", want: Options{Width: 128, Fit: FitContain, Format: FormatWebP}},
+		{wantErr: true},
+		{width: "-1", wantErr: true},
+		{width: "10000", wantErr: true},
+		{width: "100", fit: "stretch", wantErr: true},
+		{width: "100", format: "gif", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, e := ParseResizeOptions(tt.width, tt.height, tt.fit, tt.format)
+		if (e != nil) != tt.wantErr {
+			t.Errorf("ParseResizeOptions(%q, %q, %q, %q) error = %v, wantErr %v",
+				tt.width, tt.height, tt.fit, tt.format, e, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseResizeOptions(%q, %q, %q, %q) = %+v, want %+v",
+				tt.width, tt.height, tt.fit, tt.format, got, tt.want)
+		}
+	}
+}
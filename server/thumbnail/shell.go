@@ -3,12 +3,20 @@ package thumbnail
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"errors"
+	"go-drive/common/driveutil"
 	err "go-drive/common/errors"
 	"go-drive/common/i18n"
+	"go-drive/common/task"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
 	"runtime"
 	"strconv"
@@ -20,6 +28,14 @@ func init() {
 	RegisterTypeHandler("shell", newShellThumbnailTypeHandler)
 }
 
+const (
+	shellInputURL  = "url"
+	shellInputFile = "file"
+
+	// shellInputMaxCacheItems limits the cached files of the concurrent commands
+	shellInputMaxCacheItems = 64
+)
+
 // shellThumbnailTypeHandler generating thumbnails by executing external command.
 //
 // The file content(if the entry is readable) will be written to stdin.
@@ -44,17 +60,34 @@ func init() {
 //
 // GO_DRIVE_ENTRY_URL: URL of the file content or folder children
 // (e.g. /download?path=a/a.txt or /list?path=a)
+//
+// GO_DRIVE_THUMBNAIL_WIDTH, GO_DRIVE_THUMBNAIL_HEIGHT: the requested bounding box,
+// empty for the default size or no limit of the dimension
+//
+// GO_DRIVE_THUMBNAIL_FIT: contain|cover|fill, empty for the default thumbnail
+//
+// GO_DRIVE_THUMBNAIL_FORMAT: jpeg|png|webp, empty for the configured mime-type.
+// The output is served as the configured mime-type unless supports-format is set
+//
+// GO_DRIVE_ENTRY_INPUT: the local URL or the temp file of the file content if input is configured,
+// which are seekable unlike stdin
 type shellThumbnailTypeHandler struct {
 	command string
 	args    []string
 
 	// writeContent indicates whether the file content will be supplied to stdin
 	writeContent bool
+	// input is how the file content is supplied in GO_DRIVE_ENTRY_INPUT: url, file or empty for none
+	input string
+	// cfp caches the content read through the local URLs
+	cfp *driveutil.CacheFilePool
 	// maxSize is the maximum supported file size
 	maxSize int64
 
 	mimeType string
-	timeout  time.Duration
+	// supportsFormat indicates whether the command writes GO_DRIVE_THUMBNAIL_FORMAT instead of mimeType
+	supportsFormat bool
+	timeout        time.Duration
 }
 
 func newShellThumbnailTypeHandler(c types.SM) (TypeHandler, error) {
@@ -67,15 +100,31 @@ func newShellThumbnailTypeHandler(c types.SM) (TypeHandler, error) {
 	if mimeType == "" {
 		return nil, errors.New("mime-type must be specified")
 	}
+	input := c["input"]
+	var cfp *driveutil.CacheFilePool
+	switch input {
+	case "", shellInputFile:
+	case shellInputURL:
+		pool, e := driveutil.NewCacheFillPool(shellInputMaxCacheItems, "")
+		if e != nil {
+			return nil, e
+		}
+		cfp = pool
+	default:
+		return nil, errors.New("invalid input, available values are url and file")
+	}
 	command, args := platformShellCommand(runtime.GOOS, shell)
 
 	return &shellThumbnailTypeHandler{
-		command:      command,
-		args:         args,
-		writeContent: writeContent,
-		maxSize:      c.GetInt64("max-size", -1),
-		mimeType:     mimeType,
-		timeout:      c.GetDuration("timeout", -1),
+		command:        command,
+		args:           args,
+		writeContent:   writeContent,
+		input:          input,
+		cfp:            cfp,
+		maxSize:        c.GetInt64("max-size", -1),
+		mimeType:       mimeType,
+		supportsFormat: c.GetBool("supports-format"),
+		timeout:        c.GetDuration("timeout", -1),
 	}, nil
 }
 
@@ -100,6 +149,21 @@ func (s *shellThumbnailTypeHandler) CreateThumbnail(ctx context.Context, entry T
 		"GO_DRIVE_ENTRY_SIZE="+strconv.FormatInt(entry.Size(), 10),
 		"GO_DRIVE_ENTRY_MOD_TIME="+strconv.FormatInt(entry.ModTime(), 10),
 		"GO_DRIVE_ENTRY_URL="+entry.GetExternalURL())
+	o := entry.Options()
+	cmd.Env = append(cmd.Env,
+		"GO_DRIVE_THUMBNAIL_WIDTH="+formatDimension(o.Width),
+		"GO_DRIVE_THUMBNAIL_HEIGHT="+formatDimension(o.Height),
+		"GO_DRIVE_THUMBNAIL_FIT="+o.Fit,
+		"GO_DRIVE_THUMBNAIL_FORMAT="+o.Format)
+
+	if entry.Type().IsFile() && s.input != "" {
+		input, closeInput, e := s.openInput(ctx, entry)
+		if e != nil {
+			return e
+		}
+		defer closeInput()
+		cmd.Env = append(cmd.Env, "GO_DRIVE_ENTRY_INPUT="+input)
+	}
 
 	if entry.Type().IsFile() && s.writeContent {
 		reader, e := entry.GetReader(ctx, -1, -1)
@@ -141,10 +205,72 @@ func (s *shellThumbnailTypeHandler) CreateThumbnail(ctx context.Context, entry T
 	return nil
 }
 
+// openInput supplies the file content as a local URL or a temp file, the returned func releases it
+func (s *shellThumbnailTypeHandler) openInput(ctx context.Context, entry types.IEntry) (string, func(), error) {
+	if s.input == shellInputURL {
+		return serveContent(ctx, entry, s.cfp)
+	}
+	file, e := driveutil.CopyIContentToTempFile(task.NewContextWrapper(ctx), entry, "")
+	if e != nil {
+		return "", nil, e
+	}
+	_ = file.Close()
+	return file.Name(), func() { _ = os.Remove(file.Name()) }, nil
+}
+
+// serveContent serves the file content on a local address with the range requests supported.
+// The content is read by ranges and cached in cfp, so the commands like ffmpeg can seek in the large remote files
+// without downloading the whole file.
+func serveContent(ctx context.Context, entry types.IEntry, cfp *driveutil.CacheFilePool) (string, func(), error) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		return "", nil, e
+	}
+	// the random key prevents the other local processes from reading the content
+	key := hex.EncodeToString(utils.RandSecret(16))
+	prefix := "/" + key + "/"
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, prefix) {
+				http.NotFound(w, r)
+				return
+			}
+			reader, e := cfp.GetReader(key, entry.Size(), func(start, size int64) (io.ReadCloser, error) {
+				return driveutil.GetIContentReader(ctx, entry, start, size)
+			})
+			if e != nil {
+				http.Error(w, e.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer func() { _ = reader.Close() }()
+			http.ServeContent(w, r, entry.Name(), utils.Time(entry.ModTime()), reader)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() { _ = server.Serve(listener) }()
+
+	u := "http://" + listener.Addr().String() + prefix + url.PathEscape(entry.Name())
+	return u, func() {
+		_ = server.Close()
+		cfp.Remove(key)
+	}, nil
+}
+
+func formatDimension(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
 func (s *shellThumbnailTypeHandler) MimeType() string {
 	return s.mimeType
 }
 
+func (s *shellThumbnailTypeHandler) SupportsFormat() bool {
+	return s.supportsFormat
+}
+
 func (s *shellThumbnailTypeHandler) Timeout() time.Duration {
 	return s.timeout
 }
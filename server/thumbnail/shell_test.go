@@ -1,8 +1,15 @@
 package thumbnail
 
 import (
+	"bytes"
+	"context"
+	"go-drive/common/driveutil"
 	"go-drive/common/types"
+	"io"
+	"net/http"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -43,3 +50,67 @@ func TestPlatformShellCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestShellThumbnailInputFile(t *testing.T) {
+	script := `cat "$GO_DRIVE_ENTRY_INPUT"`
+	if command, _ := platformShellCommand(runtime.GOOS, script); command != "/bin/sh" {
+		t.Skip("test assertions target the Unix test environment")
+	}
+	handler, e := newShellThumbnailTypeHandler(types.SM{
+		"shell":     script,
+		"mime-type": "image/jpeg",
+		"input":     "file",
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	entry := &testEntry{path: "a/b.mp4", data: "content"}
+	buf := &bytes.Buffer{}
+	e = handler.CreateThumbnail(context.Background(), &thumbnailEntry{IEntry: entry, IDispatcherEntry: entry}, buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if buf.String() != "content" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	if _, e := newShellThumbnailTypeHandler(types.SM{
+		"shell": script, "mime-type": "image/jpeg", "input": "stdin",
+	}); e == nil {
+		t.Error("expected error of the invalid input")
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	cfp, e := driveutil.NewCacheFillPool(4, t.TempDir())
+	if e != nil {
+		t.Fatal(e)
+	}
+	entry := &testEntry{path: "a/b.mp4", modTime: 1, data: "0123456789"}
+	u, closeInput, e := serveContent(context.Background(), entry, cfp)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer closeInput()
+
+	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req.Header.Set("Range", "bytes=3-5")
+	resp, e := http.DefaultClient.Do(req)
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(data) != "345" {
+		t.Errorf("unexpected response: %d %q", resp.StatusCode, data)
+	}
+
+	resp, e = http.Get(u[:strings.LastIndex(u, "/")-1] + "/b.mp4")
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("the content is served without the key: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,127 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/driveutil"
+	err "go-drive/common/errors"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"io"
+	"path"
+	"sync"
+)
+
+var storeFactories = make(map[string]StoreFactory)
+
+func RegisterStore(name string, factory StoreFactory) {
+	if _, ok := storeFactories[name]; ok {
+		panic("StoreFactory " + name + " already registered")
+	}
+	storeFactories[name] = factory
+}
+
+type StoreFactory = func(config types.SM, ch *registry.ComponentsHolder) (Store, error)
+
+// Store keeps the generated thumbnails to share them with other instances.
+// Thumbnails are always cached locally, the store is read only when the local cache misses.
+type Store interface {
+	// Get writes the thumbnail of the key to dest.
+	// Returns err.NotFoundError if the thumbnail does not exist
+	Get(ctx context.Context, key string, dest io.Writer) error
+	// Put saves the thumbnail of the key, the existing one is replaced
+	Put(ctx context.Context, key string, size int64, src io.Reader) error
+}
+
+func createStore(c common.ThumbnailStoreConfig, ch *registry.ComponentsHolder) (Store, error) {
+	if c.Type == "" {
+		return nil, nil
+	}
+	factory, ok := storeFactories[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown thumbnail store type: %s. Available types are %v",
+			c.Type, utils.MapKeys(storeFactories))
+	}
+	s, e := factory(c.Config, ch)
+	if e != nil {
+		return nil, errors.New("failed to create thumbnail store " + c.Type + ": " + e.Error())
+	}
+	return s, nil
+}
+
+func init() {
+	RegisterStore("drive", newDriveStore)
+}
+
+// driveStore saves the thumbnails in a folder of the drives, such as a folder of an S3 drive
+type driveStore struct {
+	ch   *registry.ComponentsHolder
+	root string
+	// dirs is the folders known to exist
+	dirs sync.Map
+}
+
+func newDriveStore(c types.SM, ch *registry.ComponentsHolder) (Store, error) {
+	root := utils.CleanPath(c["path"])
+	if root == "" {
+		return nil, errors.New("path must be specified")
+	}
+	return &driveStore{ch: ch, root: root}, nil
+}
+
+// drive returns the root drive, which is resolved lazily since it may be created after the Maker
+func (s *driveStore) drive() types.IDrive {
+	return s.ch.Get(registry.KeyRootDrive).(*drive.RootDrive).Get()
+}
+
+// path returns the path of the key, thumbnails are grouped by the first two characters of the key
+func (s *driveStore) path(key string) string {
+	return path.Join(s.root, key[:2], key)
+}
+
+func (s *driveStore) Get(ctx context.Context, key string, dest io.Writer) error {
+	entry, e := s.drive().Get(ctx, s.path(key))
+	if e != nil {
+		return e
+	}
+	if !entry.Type().IsFile() {
+		return err.NewNotFoundError()
+	}
+	return driveutil.CopyIContent(task.NewContextWrapper(ctx), entry, dest)
+}
+
+func (s *driveStore) Put(ctx context.Context, key string, size int64, src io.Reader) error {
+	d := s.drive()
+	p := s.path(key)
+	if e := s.makeDirs(ctx, d, utils.PathParent(p)); e != nil {
+		return e
+	}
+	_, e := d.Save(task.NewContextWrapper(ctx), p, size, true, src)
+	return e
+}
+
+func (s *driveStore) makeDirs(ctx context.Context, d types.IDrive, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, ok := s.dirs.Load(dir); ok {
+		return nil
+	}
+	_, e := d.Get(ctx, dir)
+	if err.IsNotFoundError(e) {
+		if e := s.makeDirs(ctx, d, utils.PathParent(dir)); e != nil {
+			return e
+		}
+		_, e = d.MakeDir(ctx, dir)
+	}
+	if e != nil {
+		return e
+	}
+	s.dirs.Store(dir, true)
+	return nil
+}
@@ -0,0 +1,215 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"go-drive/common"
+	err "go-drive/common/errors"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"go-drive/testutil"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memoryStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	puts  int
+}
+
+func (s *memoryStore) Get(_ context.Context, key string, dest io.Writer) error {
+	s.mu.Lock()
+	data, ok := s.items[key]
+	s.mu.Unlock()
+	if !ok {
+		return err.NewNotFoundError()
+	}
+	_, e := dest.Write(data)
+	return e
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, size int64, src io.Reader) error {
+	data, e := io.ReadAll(src)
+	if e != nil {
+		return e
+	}
+	if int64(len(data)) != size {
+		return io.ErrUnexpectedEOF
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = data
+	s.puts++
+	return nil
+}
+
+type testEntry struct {
+	types.IEntry
+	path    string
+	dir     bool
+	modTime int64
+	data    string
+}
+
+func (e *testEntry) Path() string { return e.path }
+func (e *testEntry) Name() string { return e.path[strings.LastIndex(e.path, "/")+1:] }
+func (e *testEntry) Type() types.EntryType {
+	if e.dir {
+		return types.TypeDir
+	}
+	return types.TypeFile
+}
+func (e *testEntry) Size() int64                                { return int64(len(e.data)) }
+func (e *testEntry) ModTime() int64                             { return e.modTime }
+func (e *testEntry) Meta() types.EntryMeta                      { return types.EntryMeta{} }
+func (e *testEntry) GetDispatchedDrive() (string, types.IDrive) { return "", nil }
+func (e *testEntry) GetRealPath() string                        { return e.path }
+
+func (e *testEntry) GetURL(context.Context) (*types.ContentURL, error) {
+	return nil, err.NewUnsupportedError()
+}
+
+func (e *testEntry) GetReader(_ context.Context, start, size int64) (io.ReadCloser, error) {
+	if start < 0 {
+		return io.NopCloser(strings.NewReader(e.data)), nil
+	}
+	if size < 0 {
+		size = int64(len(e.data)) - start
+	}
+	return io.NopCloser(io.NewSectionReader(strings.NewReader(e.data), start, size)), nil
+}
+
+func newTestMaker(t *testing.T, store Store) *Maker {
+	t.Helper()
+	config := testutil.DefaultTestConfig()
+	config.DataDir = t.TempDir()
+	config.TempDir = t.TempDir()
+	config.Thumbnail.Handlers = []common.ThumbnailHandlerItem{{Type: "text", FileTypes: "txt"}}
+	ch := registry.NewComponentHolder()
+	t.Cleanup(func() { _ = ch.Dispose() })
+	db, e := storage.NewDB(config, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	m, e := NewMaker(config, storage.NewOptionsDAO(db, ch), ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+	m.store = store
+	return m
+}
+
+func readThumbnail(t *testing.T, m *Maker, entry types.IEntry) []byte {
+	t.Helper()
+	return readThumbnailOf(t, m, entry, Options{})
+}
+
+func readThumbnailOf(t *testing.T, m *Maker, entry types.IEntry, options Options) []byte {
+	t.Helper()
+	th, e := m.Make(context.Background(), entry, options)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = th.Close() }()
+	data, e := io.ReadAll(th)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return data
+}
+
+func TestMaker_Store(t *testing.T) {
+	store := &memoryStore{items: make(map[string][]byte)}
+	entry := &testEntry{path: "a/b.txt", modTime: 1, data: "hello\n"}
+
+	generated := readThumbnail(t, newTestMaker(t, store), entry)
+	if len(generated) == 0 || store.puts != 1 {
+		t.Fatalf("the thumbnail is not saved to the store, %d puts", store.puts)
+	}
+
+	// another instance gets the thumbnail from the store
+	if got := readThumbnail(t, newTestMaker(t, store), entry); !bytes.Equal(got, generated) || store.puts != 1 {
+		t.Errorf("the thumbnail is not read from the store, %d puts", store.puts)
+	}
+
+	// the thumbnail in the store is expired
+	entry.modTime = 2
+	entry.data = "changed\n"
+	if got := readThumbnail(t, newTestMaker(t, store), entry); bytes.Equal(got, generated) || store.puts != 2 {
+		t.Errorf("the expired thumbnail is used, %d puts", store.puts)
+	}
+}
+
+func TestMaker_Options(t *testing.T) {
+	store := &memoryStore{items: make(map[string][]byte)}
+	m := newTestMaker(t, store)
+	entry := &testEntry{path: "a/b.txt", modTime: 1, data: "hello\n"}
+
+	readThumbnail(t, m, entry)
+	readThumbnailOf(t, m, entry, Options{Width: 480, Height: 480})
+	readThumbnailOf(t, m, entry, Options{Width: 480, Height: 480})
+	if store.puts != 2 || len(store.items) != 2 {
+		t.Errorf("the thumbnails of different sizes are not cached separately, %d puts, %d items",
+			store.puts, len(store.items))
+	}
+}
+
+type testDrive struct {
+	types.IDrive
+	entries map[string]*testEntry
+}
+
+func (d *testDrive) Get(_ context.Context, path string) (types.IEntry, error) {
+	if e, ok := d.entries[path]; ok {
+		return e, nil
+	}
+	return nil, err.NewNotFoundError()
+}
+
+func (d *testDrive) List(_ context.Context, path string) ([]types.IEntry, error) {
+	result := make([]types.IEntry, 0)
+	for p, e := range d.entries {
+		if p != path && strings.HasPrefix(p, path+"/") && !strings.Contains(p[len(path)+1:], "/") {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func TestGenerator(t *testing.T) {
+	d := &testDrive{entries: map[string]*testEntry{
+		"a":         {path: "a", dir: true},
+		"a/1.txt":   {path: "a/1.txt", data: "1"},
+		"a/2.bin":   {path: "a/2.bin", data: "2"},
+		"a/b":       {path: "a/b", dir: true},
+		"a/b/3.txt": {path: "a/b/3.txt", data: "3"},
+	}}
+	g := &Generator{maker: newTestMaker(t, nil), patterns: []string{"a/b/**"}}
+
+	r := GenerateResult{}
+	if e := g.walk(task.DummyContext(), d, "a", nil, &r); e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(r, GenerateResult{Generated: 2}) {
+		t.Errorf("unexpected result: %s", r)
+	}
+
+	r = GenerateResult{}
+	if e := g.walk(task.DummyContext(), d, "a", g.matches, &r); e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(r, GenerateResult{Generated: 1}) {
+		t.Errorf("unexpected result of the patterns: %s", r)
+	}
+
+	r = GenerateResult{}
+	if e := g.walk(task.DummyContext(), d, "a/missing.txt", nil, &r); e != nil || r.Failed != 1 {
+		t.Errorf("unexpected result of the missing entry: %s, %v", r, e)
+	}
+}
@@ -32,6 +32,14 @@ type TypeHandler interface {
 	Timeout() time.Duration
 }
 
+// FormatTypeHandler is the extension of TypeHandler.
+// TypeHandlers implement this interface if the thumbnails are encoded in the requested Options.Format.
+type FormatTypeHandler interface {
+	TypeHandler
+	// SupportsFormat returns true if the thumbnails are encoded in Options.Format when it's set
+	SupportsFormat() bool
+}
+
 type Thumbnail interface {
 	io.ReadSeeker
 	io.Closer
@@ -91,6 +99,8 @@ type ThumbnailEntry interface {
 	types.IEntry
 	types.IDispatcherEntry
 	GetExternalURL() string
+	// Options returns the requested size and format, handlers may ignore them if not supported
+	Options() Options
 }
 
 var _ types.IEntryWrapper = (*thumbnailEntry)(nil)
@@ -99,12 +109,17 @@ type thumbnailEntry struct {
 	types.IEntry
 	types.IDispatcherEntry
 	externalURL string
+	options     Options
 }
 
 func (te *thumbnailEntry) GetExternalURL() string {
 	return te.externalURL
 }
 
+func (te *thumbnailEntry) Options() Options {
+	return te.options
+}
+
 func (te *thumbnailEntry) GetIEntry() types.IEntry {
 	return te.IEntry
 }
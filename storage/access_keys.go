@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	err "go-drive/common/errors"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"strings"
+	"time"
+)
+
+const accessKeyIDPrefix = "GD"
+
+type AccessKeyDAO struct {
+	db    *DB
+	cache *utils.KVCache[types.AccessKey]
+}
+
+func NewAccessKeyDAO(db *DB, ch *registry.ComponentsHolder) *AccessKeyDAO {
+	dao := &AccessKeyDAO{db: db, cache: utils.NewKVCache[types.AccessKey](0, 1*time.Hour)}
+	ch.Add(registry.KeyAccessKeyDAO, dao)
+	return dao
+}
+
+// GetAccessKey returns the access key by id, including the secret
+func (a *AccessKeyDAO) GetAccessKey(id string) (types.AccessKey, error) {
+	if cached, ok := a.cache.Get(id); ok {
+		return cached, nil
+	}
+	keys := make([]types.AccessKey, 0, 1)
+	if e := a.db.C().Where("`id` = ?", id).Limit(1).Find(&keys).Error; e != nil {
+		return types.AccessKey{}, e
+	}
+	if len(keys) == 0 {
+		return types.AccessKey{}, err.NewNotFoundError()
+	}
+	a.cache.Set(id, keys[0], 10*time.Minute)
+	return keys[0], nil
+}
+
+// ListAccessKeys returns the access keys of the user, secrets are not included
+func (a *AccessKeyDAO) ListAccessKeys(username string) ([]types.AccessKey, error) {
+	keys := make([]types.AccessKey, 0)
+	e := a.db.C().Where("`username` = ?", username).Order("`created_at`").Find(&keys).Error
+	for i := range keys {
+		keys[i].Secret = ""
+	}
+	return keys, e
+}
+
+// AddAccessKey creates a new access key for the user,
+// the returned key is the only place where the secret can be seen.
+func (a *AccessKeyDAO) AddAccessKey(username string) (types.AccessKey, error) {
+	key := types.AccessKey{
+		ID:        accessKeyIDPrefix + strings.ToUpper(hex.EncodeToString(utils.RandSecret(9))),
+		Secret:    base64.RawURLEncoding.EncodeToString(utils.RandSecret(30)),
+		Username:  username,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	e := a.db.C().Create(&key).Error
+	return key, e
+}
+
+func (a *AccessKeyDAO) DeleteAccessKey(username, id string) error {
+	defer a.cache.Remove(id)
+	s := a.db.C().Where("`username` = ? AND `id` = ?", username, id).Delete(&types.AccessKey{})
+	if s.Error != nil {
+		return s.Error
+	}
+	if s.RowsAffected != 1 {
+		return err.NewNotFoundError()
+	}
+	return nil
+}
+
+// EvictCache drops all the cached keys, the keys of a user are deleted with the user
+func (a *AccessKeyDAO) EvictCache() {
+	a.cache.Clear()
+}
+
+func (a *AccessKeyDAO) Dispose() error {
+	return a.cache.Dispose()
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"strings"
+	"testing"
+)
+
+func TestAccessKeyDAO_AddListDelete(t *testing.T) {
+	db, ch, cleanup := newTestDB(t)
+	defer cleanup()
+	dao := NewAccessKeyDAO(db, ch)
+
+	key, e := dao.AddAccessKey("u1")
+	if e != nil {
+		t.Fatalf("AddAccessKey: %v", e)
+	}
+	if !strings.HasPrefix(key.ID, accessKeyIDPrefix) || len(key.Secret) != 40 {
+		t.Fatalf("unexpected key: %+v", key)
+	}
+
+	got, e := dao.GetAccessKey(key.ID)
+	if e != nil || got.Secret != key.Secret || got.Username != "u1" {
+		t.Fatalf("GetAccessKey = %+v, %v", got, e)
+	}
+
+	keys, e := dao.ListAccessKeys("u1")
+	if e != nil || len(keys) != 1 || keys[0].ID != key.ID {
+		t.Fatalf("ListAccessKeys = %+v, %v", keys, e)
+	}
+	if keys[0].Secret != "" {
+		t.Error("ListAccessKeys must not return the secret")
+	}
+
+	if e := dao.DeleteAccessKey("u2", key.ID); !err.IsNotFoundError(e) {
+		t.Fatalf("deleting the key of another user: %v", e)
+	}
+	if e := dao.DeleteAccessKey("u1", key.ID); e != nil {
+		t.Fatalf("DeleteAccessKey: %v", e)
+	}
+	if _, e := dao.GetAccessKey(key.ID); !err.IsNotFoundError(e) {
+		t.Fatalf("GetAccessKey after delete: %v", e)
+	}
+}
+
+func TestUserDAO_DeleteUser_deletesAccessKeys(t *testing.T) {
+	db, ch, cleanup := newTestDB(t)
+	defer cleanup()
+	users := NewUserDAO(db, ch)
+	dao := NewAccessKeyDAO(db, ch)
+	users.OnUsersDeleted(dao.EvictCache)
+	if _, e := users.AddUser(types.User{Username: "u1", Password: "p"}); e != nil {
+		t.Fatal(e)
+	}
+	key, e := dao.AddAccessKey("u1")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := dao.GetAccessKey(key.ID); e != nil {
+		t.Fatal(e)
+	}
+	if e := users.DeleteUser("u1"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := dao.GetAccessKey(key.ID); !err.IsNotFoundError(e) {
+		t.Fatalf("GetAccessKey after DeleteUser: %v", e)
+	}
+	keys, e := dao.ListAccessKeys("u1")
+	if e != nil || len(keys) != 0 {
+		t.Fatalf("ListAccessKeys after DeleteUser = %+v, %v", keys, e)
+	}
+}
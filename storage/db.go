@@ -74,3 +74,12 @@ func closeDb(db *gorm.DB) {
 func (d *DB) C() *gorm.DB {
 	return d.db
 }
+
+// SchemaVersion returns the version of the last applied database migration
+func (d *DB) SchemaVersion() (int, error) {
+	sqlDB, e := d.db.DB()
+	if e != nil {
+		return 0, e
+	}
+	return currentMigrationVersion(sqlDB)
+}
@@ -30,6 +30,7 @@ var dbMigrations = []dbMigration{
 	{version: 2, name: "script_drive_configs", run: migrateScriptDriveConfigs},
 	{version: 3, name: "oauth_drive_data", run: migrateOAuthDriveData},
 	{version: 4, name: "drop_legacy_job_columns", run: migrateLegacyJobSchema},
+	{version: 5, name: "restore_rebuilt_job_columns", run: migrateRebuiltJobColumns},
 }
 
 func migrateAll(db *gorm.DB) error {
@@ -86,6 +87,9 @@ func autoMigrateModels(db *gorm.DB) error {
 		&types.PathMeta{},
 		&types.FileBucket{},
 		&types.Session{},
+		&types.AccessKey{},
+		&types.MediaMetadata{},
+		&types.PhotoIndex{},
 	)
 }
 
@@ -437,6 +441,12 @@ func rebuildSQLiteJobsTable(db *gorm.DB) error {
 	return e
 }
 
+// migrateRebuiltJobColumns adds back the job columns introduced after the legacy schema,
+// since rebuilding the SQLite jobs table in drop_legacy_job_columns keeps only the legacy-era columns
+func migrateRebuiltJobColumns(db *gorm.DB) error {
+	return db.AutoMigrate(&types.Job{})
+}
+
 var scriptDriveConfigFields = map[string][]string{
 	"dropbox": {"client_id", "client_secret", "cache_ttl"},
 	"qiniu":   {"bucket", "ak", "sk", "uploadURL", "downloadBaseURL", "cache_ttl"},
@@ -294,6 +294,9 @@ CREATE TABLE jobs (
 	if e := migrateLegacyJobSchema(db); e != nil {
 		t.Fatal(e)
 	}
+	if e := migrateRebuiltJobColumns(db); e != nil {
+		t.Fatal(e)
+	}
 
 	columns, e := listTableColumns(sqlDB, "sqlite", "jobs")
 	if e != nil {
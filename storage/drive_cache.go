@@ -56,6 +56,11 @@ func (d *DriveCacheDAO) EvictCacheStore(ns string) error {
 	return d.db.C().Delete(&types.DriveCache{}, "`drive` = ?", ns).Error
 }
 
+// EvictAll deletes the caches of all drives
+func (d *DriveCacheDAO) EvictAll() error {
+	return d.db.C().Where("1 = 1").Delete(&types.DriveCache{}).Error
+}
+
 type dbDriveNamespacedCacheStore struct {
 	ns          string
 	db          *DB
@@ -5,10 +5,15 @@ import (
 	err "go-drive/common/errors"
 	"go-drive/common/registry"
 	"go-drive/common/types"
+	"strings"
 
 	"gorm.io/gorm"
 )
 
+var completedJobExecutionStatus = []string{
+	types.JobExecutionSuccess, types.JobExecutionFailed, types.JobExecutionSkipped,
+}
+
 type JobDAO struct {
 	db *DB
 }
@@ -52,21 +57,62 @@ func (s *JobDAO) DeleteJob(id uint) error {
 			return e
 		}
 		return tx.Delete(&types.JobExecution{},
-			"`job_id` = ? and ( `status` = ? or `status` = ? )",
-			id, types.JobExecutionSuccess, types.JobExecutionFailed,
+			"`job_id` = ? and `status` in ?", id, completedJobExecutionStatus,
 		).Error
 	})
 }
 
+// JobExecutionQuery filters the job executions, zero values are ignored
+type JobExecutionQuery struct {
+	JobID  uint
+	Status []string
+	// From and To are the range of the start time in milliseconds, both inclusive
+	From uint64
+	To   uint64
+	// Keyword is searched in the logs and the error message
+	Keyword string
+	Limit   int
+}
+
 func (s *JobDAO) GetJobExecutions(jobId uint) ([]types.JobExecution, error) {
+	return s.QueryJobExecutions(JobExecutionQuery{JobID: jobId})
+}
+
+// QueryJobExecutions returns the matched executions, the latest first
+func (s *JobDAO) QueryJobExecutions(q JobExecutionQuery) ([]types.JobExecution, error) {
 	jes := make([]types.JobExecution, 0)
 	tx := s.db.C().Order("`started_at` DESC")
-	if jobId != 0 {
-		tx = tx.Where("`job_id` = ?", jobId)
+	if q.JobID != 0 {
+		tx = tx.Where("`job_id` = ?", q.JobID)
+	}
+	if len(q.Status) > 0 {
+		tx = tx.Where("`status` in ?", q.Status)
+	}
+	if q.From > 0 {
+		tx = tx.Where("`started_at` >= ?", q.From)
+	}
+	if q.To > 0 {
+		tx = tx.Where("`started_at` <= ?", q.To)
+	}
+	if q.Keyword != "" {
+		keyword := "%" + escapeLike(q.Keyword) + "%"
+		tx = tx.Where("(`logs` LIKE ? ESCAPE '!' OR `error_msg` LIKE ? ESCAPE '!')", keyword, keyword)
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
 	}
 	return jes, tx.Find(&jes).Error
 }
 
+func (s *JobDAO) GetJobExecution(id uint) (types.JobExecution, error) {
+	je := types.JobExecution{}
+	e := s.db.C().Where("`id` = ?", id).First(&je).Error
+	if errors.Is(e, gorm.ErrRecordNotFound) {
+		return je, err.NewNotFoundError()
+	}
+	return je, e
+}
+
 func (s *JobDAO) AddJobExecution(je *types.JobExecution) error {
 	return s.db.C().Create(je).Error
 }
@@ -78,19 +124,45 @@ func (s *JobDAO) UpdateJobExecution(je *types.JobExecution) error {
 	return s.db.C().Save(je).Error
 }
 
+// UpdateJobExecutionSteps updates only the steps of the execution, so the logs and the status are not overwritten
+func (s *JobDAO) UpdateJobExecutionSteps(id uint, steps string) error {
+	return s.db.C().Model(&types.JobExecution{}).Where("`id` = ?", id).UpdateColumn("steps", steps).Error
+}
+
 func (s *JobDAO) DeleteJobExecution(id uint) error {
 	return s.db.C().Delete(&types.JobExecution{}, "`id` = ?", id).Error
 }
 
 func (s *JobDAO) DeleteJobExecutions(jobId uint) error {
 	return s.db.C().Delete(&types.JobExecution{},
-		"`job_id` = ? and ( `status` = ? or `status` = ? )",
-		jobId, types.JobExecutionSuccess, types.JobExecutionFailed,
+		"`job_id` = ? and `status` in ?", jobId, completedJobExecutionStatus,
 	).Error
 }
 
+// PruneJobExecutions deletes the completed executions of the job beyond the latest keep ones
+func (s *JobDAO) PruneJobExecutions(jobId uint, keep int) error {
+	ids := make([]uint, 0)
+	e := s.db.C().Model(&types.JobExecution{}).
+		Where("`job_id` = ? and `status` in ?", jobId, completedJobExecutionStatus).
+		Order("`started_at` DESC").Order("`id` DESC").
+		Pluck("id", &ids).Error
+	if e != nil || len(ids) <= keep {
+		return e
+	}
+	return s.db.C().Delete(&types.JobExecution{}, "`id` in ?", ids[keep:]).Error
+}
+
+// UpdateAllRunningJobExecutionsToFailed marks the running and queued executions
+// left by the last run of the server as failed
 func (s *JobDAO) UpdateAllRunningJobExecutionsToFailed() error {
 	return s.db.C().Model(&types.JobExecution{}).
-		Where("`status` = ?", types.JobExecutionRunning).
+		Where("`status` in ?", []string{types.JobExecutionRunning, types.JobExecutionQueued}).
 		Update("status", types.JobExecutionFailed).Error
 }
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// escapeLike escapes the wildcards of LIKE, the escape character is '!'
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"strconv"
 	"testing"
 )
 
@@ -19,3 +23,71 @@ func TestJobDAO_GetJob_notFoundReturnsNotFound(t *testing.T) {
 		t.Errorf("expected NotFoundError, got %T: %v", e, e)
 	}
 }
+
+func TestJobDAO_QueryAndPruneJobExecutions(t *testing.T) {
+	db, ch, cleanup := newTestDB(t)
+	defer cleanup()
+	dao := NewJobDAO(db, ch)
+	for i, status := range []string{
+		types.JobExecutionSuccess, types.JobExecutionFailed, types.JobExecutionSuccess, types.JobExecutionRunning,
+	} {
+		e := dao.AddJobExecution(&types.JobExecution{
+			JobId: 1, StartedAt: uint64(i + 1), Status: status, ErrorMsg: "error 100%_" + strconv.Itoa(i),
+		})
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := dao.AddJobExecution(&types.JobExecution{JobId: 2, StartedAt: 1, Status: types.JobExecutionSuccess}); e != nil {
+		t.Fatal(e)
+	}
+
+	startedAt := func(q JobExecutionQuery) []uint64 {
+		t.Helper()
+		jes, e := dao.QueryJobExecutions(q)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return utils.ArrayMap(jes, func(je *types.JobExecution) uint64 { return je.StartedAt })
+	}
+	for _, c := range []struct {
+		q    JobExecutionQuery
+		want string
+	}{
+		{JobExecutionQuery{JobID: 1}, "[4 3 2 1]"},
+		{JobExecutionQuery{JobID: 1, Status: []string{types.JobExecutionSuccess}}, "[3 1]"},
+		{JobExecutionQuery{JobID: 1, From: 2, To: 3}, "[3 2]"},
+		{JobExecutionQuery{JobID: 1, Keyword: "100%_2"}, "[3]"},
+		{JobExecutionQuery{JobID: 1, Keyword: "1000"}, "[]"},
+		{JobExecutionQuery{JobID: 1, Limit: 1}, "[4]"},
+		{JobExecutionQuery{Status: []string{types.JobExecutionSuccess}}, "[3 1 1]"},
+	} {
+		if got := fmt.Sprint(startedAt(c.q)); got != c.want {
+			t.Errorf("query %+v = %s, want %s", c.q, got, c.want)
+		}
+	}
+
+	// only the steps are updated, the other columns are kept
+	je := types.JobExecution{JobId: 3, Status: types.JobExecutionRunning, Logs: "log 1"}
+	if e := dao.AddJobExecution(&je); e != nil {
+		t.Fatal(e)
+	}
+	if e := dao.UpdateJobExecutionSteps(je.ID, `[{"action":"a"}]`); e != nil {
+		t.Fatal(e)
+	}
+	if got, e := dao.GetJobExecution(je.ID); e != nil || got.Steps != `[{"action":"a"}]` ||
+		got.Logs != "log 1" || got.Status != types.JobExecutionRunning {
+		t.Errorf("unexpected execution: %+v, %v", got, e)
+	}
+
+	// running executions are kept
+	if e := dao.PruneJobExecutions(1, 1); e != nil {
+		t.Fatal(e)
+	}
+	if got := fmt.Sprint(startedAt(JobExecutionQuery{JobID: 1})); got != "[4 3]" {
+		t.Errorf("executions after pruning = %s, want [4 3]", got)
+	}
+	if got := fmt.Sprint(startedAt(JobExecutionQuery{JobID: 2})); got != "[1]" {
+		t.Errorf("executions of other jobs = %s, want [1]", got)
+	}
+}
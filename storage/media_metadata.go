@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MediaMetadataDAO struct {
+	db *DB
+}
+
+func NewMediaMetadataDAO(db *DB, ch *registry.ComponentsHolder) *MediaMetadataDAO {
+	dao := &MediaMetadataDAO{db: db}
+	ch.Add(registry.KeyMediaMetadataDAO, dao)
+	return dao
+}
+
+// Get returns the cached metadata of the path, or nil if it's not cached
+func (d *MediaMetadataDAO) Get(path string) (*types.MediaMetadata, error) {
+	m := types.MediaMetadata{}
+	e := d.db.C().Where("`path` = ?", path).Take(&m).Error
+	if errors.Is(e, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &m, nil
+}
+
+func (d *MediaMetadataDAO) Set(m types.MediaMetadata) error {
+	return d.db.C().Clauses(clause.OnConflict{UpdateAll: true}).Create(&m).Error
+}
+
+// Delete deletes the metadata of the path and its descendants
+func (d *MediaMetadataDAO) Delete(path string) error {
+	if path == "" {
+		return d.db.C().Where("1 = 1").Delete(&types.MediaMetadata{}).Error
+	}
+	// the descendants are between "path/" and "path0", '0' is the next character of '/'
+	return d.db.C().Delete(&types.MediaMetadata{},
+		"`path` = ? OR (`path` > ? AND `path` < ?)", path, path+"/", path+"0").Error
+}
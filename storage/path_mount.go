@@ -4,6 +4,7 @@ import (
 	"errors"
 	"go-drive/common/registry"
 	"go-drive/common/types"
+	"path"
 
 	"gorm.io/gorm"
 )
@@ -29,7 +30,11 @@ func saveMount(db *gorm.DB, mount types.PathMount, override bool) error {
 	e := db.Where("`path` = ? AND `name` = ?", mount.Path, mount.Name).Take(&existing).Error
 	if e == nil {
 		if override {
+			if existing.Managed {
+				return NewManagedError(path.Join(*existing.Path, existing.Name))
+			}
 			mount.ID = existing.ID
+			mount.Managed = false
 			return db.Save(&mount).Error
 		}
 		return nil
@@ -37,6 +42,7 @@ func saveMount(db *gorm.DB, mount types.PathMount, override bool) error {
 	if !errors.Is(e, gorm.ErrRecordNotFound) {
 		return e
 	}
+	mount.Managed = false
 	return db.Create(&mount).Error
 }
 
@@ -52,7 +58,11 @@ func saveMounts(db *gorm.DB, mounts []types.PathMount, override bool) error {
 
 func deleteMounts(db *gorm.DB, mounts []types.PathMount) error {
 	for _, m := range mounts {
-		e := db.Delete(&types.PathMount{}, "`path` = ? AND `name` = ?", m.Path, m.Name).Error
+		e := checkNotManaged(db, &types.PathMount{}, path.Join(*m.Path, m.Name), "`path` = ? AND `name` = ?", m.Path, m.Name)
+		if e != nil {
+			return e
+		}
+		e = db.Delete(&types.PathMount{}, "`path` = ? AND `name` = ?", m.Path, m.Name).Error
 		if e != nil {
 			return e
 		}
@@ -73,7 +83,7 @@ func (p *PathMountDAO) DeleteMounts(mounts []types.PathMount) error {
 }
 
 func (p *PathMountDAO) DeleteByMountAt(path string) error {
-	return p.db.C().Delete(&types.PathMount{}, "`mount_at` = ?", path).Error
+	return p.db.C().Delete(&types.PathMount{}, "`mount_at` = ? AND `managed` = ?", path, false).Error
 }
 
 func (p *PathMountDAO) DeleteAndSaveMounts(deletes []types.PathMount, newMounts []types.PathMount, override bool) error {
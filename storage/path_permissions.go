@@ -33,13 +33,37 @@ func (p *PathPermissionDAO) GetByPath(path string) ([]types.PathPermission, erro
 	return r, nil
 }
 
+// SavePathPermissions replaces the permissions of the path.
+// The permissions managed by the provisioning file must be submitted unchanged.
 func (p *PathPermissionDAO) SavePathPermissions(path string, permissions []types.PathPermission) error {
 	return p.db.C().Transaction(func(tx *gorm.DB) error {
-		if e := tx.Delete(&types.PathPermission{}, "`path` = ?", path).Error; e != nil {
+		managed := make([]types.PathPermission, 0)
+		if e := tx.Find(&managed, "`path` = ? AND `managed` = ?", path, true).Error; e != nil {
+			return e
+		}
+		managedSubjects := make(map[string]bool, len(managed))
+		for _, m := range managed {
+			managedSubjects[m.Subject] = true
+			found := false
+			for _, p := range permissions {
+				if p.Subject == m.Subject && p.Permission == m.Permission && p.Policy == m.Policy {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return NewManagedError(m.Subject)
+			}
+		}
+		if e := tx.Delete(&types.PathPermission{}, "`path` = ? AND `managed` = ?", path, false).Error; e != nil {
 			return e
 		}
 		for _, p := range permissions {
+			if managedSubjects[p.Subject] {
+				continue
+			}
 			p.Path = &path
+			p.Managed = false
 			if e := tx.Create(&p).Error; e != nil {
 				return e
 			}
@@ -49,5 +73,5 @@ func (p *PathPermissionDAO) SavePathPermissions(path string, permissions []types
 }
 
 func (p *PathPermissionDAO) DeleteByPath(path string) error {
-	return p.db.C().Delete(&types.PathPermission{}, "`path` = ?", path).Error
+	return p.db.C().Delete(&types.PathPermission{}, "`path` = ? AND `managed` = ?", path, false).Error
 }
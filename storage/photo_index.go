@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"go-drive/common/registry"
+	"go-drive/common/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PhotoIndexDAO struct {
+	db *DB
+}
+
+func NewPhotoIndexDAO(db *DB, ch *registry.ComponentsHolder) *PhotoIndexDAO {
+	dao := &PhotoIndexDAO{db: db}
+	ch.Add(registry.KeyPhotoIndexDAO, dao)
+	return dao
+}
+
+// GeoBox is the bounding box of the locations in degrees,
+// it crosses the antimeridian if MinLongitude is greater than MaxLongitude
+type GeoBox struct {
+	MinLatitude  float64
+	MaxLatitude  float64
+	MinLongitude float64
+	MaxLongitude float64
+}
+
+type PhotoIndexQuery struct {
+	// Root is the folder to query in, all the photos if empty
+	Root string
+	// FromDate and ToDate are the inclusive range of the dates like 20230501, ignored if 0
+	FromDate int
+	ToDate   int
+	// Box limits the photos to the geotagged ones in it
+	Box    *GeoBox
+	Offset int
+	Limit  int
+}
+
+func (d *PhotoIndexDAO) Set(p types.PhotoIndex) error {
+	return d.db.C().Clauses(clause.OnConflict{UpdateAll: true}).Create(&p).Error
+}
+
+// Delete deletes the photos of the path and its descendants
+func (d *PhotoIndexDAO) Delete(path string) error {
+	if path == "" {
+		return d.db.C().Where("1 = 1").Delete(&types.PhotoIndex{}).Error
+	}
+	return d.db.C().Delete(&types.PhotoIndex{},
+		"`path` = ? OR (`path` > ? AND `path` < ?)", path, path+"/", path+"0").Error
+}
+
+// Query returns the matched photos, the latest taken first
+func (d *PhotoIndexDAO) Query(q PhotoIndexQuery) ([]types.PhotoIndex, error) {
+	photos := make([]types.PhotoIndex, 0)
+	tx := inPhotoRoot(d.db.C(), q.Root).Order("`taken_at` DESC, `path`")
+	if q.FromDate > 0 {
+		tx = tx.Where("`date` >= ?", q.FromDate)
+	}
+	if q.ToDate > 0 {
+		tx = tx.Where("`date` > 0 AND `date` <= ?", q.ToDate)
+	}
+	if b := q.Box; b != nil {
+		tx = tx.Where("`latitude` >= ? AND `latitude` <= ?", b.MinLatitude, b.MaxLatitude)
+		if b.MinLongitude <= b.MaxLongitude {
+			tx = tx.Where("`longitude` >= ? AND `longitude` <= ?", b.MinLongitude, b.MaxLongitude)
+		} else {
+			tx = tx.Where("(`longitude` >= ? OR `longitude` <= ?)", b.MinLongitude, b.MaxLongitude)
+		}
+	}
+	if q.Offset > 0 {
+		tx = tx.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	return photos, tx.Find(&photos).Error
+}
+
+// ListDates returns the paths and the dates of the photos with the date taken in the root
+func (d *PhotoIndexDAO) ListDates(root string) ([]types.PhotoIndex, error) {
+	photos := make([]types.PhotoIndex, 0)
+	return photos, inPhotoRoot(d.db.C(), root).Select("`path`", "`date`").
+		Where("`date` > 0").Find(&photos).Error
+}
+
+// Count returns the number of all the photos and the geotagged ones
+func (d *PhotoIndexDAO) Count() (int64, int64, error) {
+	var total, geotagged int64
+	if e := d.db.C().Model(&types.PhotoIndex{}).Count(&total).Error; e != nil {
+		return 0, 0, e
+	}
+	if e := d.db.C().Model(&types.PhotoIndex{}).Where("`latitude` IS NOT NULL").Count(&geotagged).Error; e != nil {
+		return 0, 0, e
+	}
+	return total, geotagged, nil
+}
+
+func inPhotoRoot(tx *gorm.DB, root string) *gorm.DB {
+	if root == "" {
+		return tx
+	}
+	return tx.Where("`path` > ? AND `path` < ?", root+"/", root+"0")
+}
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	err "go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	ProvisioningChangeCreate = "create"
+	ProvisioningChangeUpdate = "update"
+	ProvisioningChangeDelete = "delete"
+)
+
+// Provisioning is the resources declared in the provisioning file.
+// They are marked as managed, and the managed resources which are no longer declared are deleted.
+type Provisioning struct {
+	Groups []types.Group
+	// Users are with the names of their groups.
+	// The password is a bcrypt hash or the plain password, empty to keep the existing password.
+	Users           []types.User
+	Drives          []types.Drive
+	PathPermissions []types.PathPermission
+	PathMounts      []types.PathMount
+}
+
+// ProvisioningChange is a created, updated or deleted resource
+type ProvisioningChange struct {
+	Kind   string
+	Key    string
+	Action string
+}
+
+type ProvisioningDAO struct {
+	db      *DB
+	userDAO *UserDAO
+}
+
+func NewProvisioningDAO(db *DB, userDAO *UserDAO, ch *registry.ComponentsHolder) *ProvisioningDAO {
+	dao := &ProvisioningDAO{db: db, userDAO: userDAO}
+	ch.Add(registry.KeyProvisioningDAO, dao)
+	return dao
+}
+
+// Reconcile applies the provisioning in a transaction, and returns the changes
+func (p *ProvisioningDAO) Reconcile(provisioning Provisioning) ([]ProvisioningChange, error) {
+	r := &provisioningReconciler{changes: make([]ProvisioningChange, 0)}
+	e := p.db.C().Transaction(func(tx *gorm.DB) error {
+		r.tx = tx
+		if e := r.groups(provisioning.Groups); e != nil {
+			return e
+		}
+		if e := r.users(provisioning.Users); e != nil {
+			return e
+		}
+		if e := r.drives(provisioning.Drives); e != nil {
+			return e
+		}
+		if e := r.pathPermissions(provisioning.PathPermissions); e != nil {
+			return e
+		}
+		return r.pathMounts(provisioning.PathMounts)
+	})
+	if e != nil {
+		return nil, e
+	}
+	if len(r.changes) > 0 {
+		p.userDAO.EvictCache("")
+	}
+	for _, c := range r.changes {
+		if c.Kind == "users" && c.Action == ProvisioningChangeDelete {
+			p.userDAO.usersDeleted()
+			break
+		}
+	}
+	return r.changes, nil
+}
+
+type provisioningReconciler struct {
+	tx      *gorm.DB
+	changes []ProvisioningChange
+}
+
+func (r *provisioningReconciler) changed(kind, key, action string) {
+	r.changes = append(r.changes, ProvisioningChange{Kind: kind, Key: key, Action: action})
+}
+
+func (r *provisioningReconciler) groups(groups []types.Group) error {
+	saved := make([]types.Group, 0)
+	if e := r.tx.Find(&saved).Error; e != nil {
+		return e
+	}
+	savedGroups := make(map[string]types.Group, len(saved))
+	for _, g := range saved {
+		savedGroups[g.Name] = g
+	}
+	declared := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		declared[g.Name] = true
+		g.Managed = true
+		old, ok := savedGroups[g.Name]
+		if ok && old == g {
+			continue
+		}
+		if e := r.tx.Save(&g).Error; e != nil {
+			return e
+		}
+		r.changed("groups", g.Name, createOrUpdate(ok))
+	}
+	for _, g := range saved {
+		if !g.Managed || declared[g.Name] {
+			continue
+		}
+		if e := r.tx.Delete(&types.Group{}, "`name` = ?", g.Name).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Where("`group_name` = ?", g.Name).Delete(&types.UserGroup{}).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Where("`subject` = ? AND `managed` = ?", types.GroupSubject(g.Name), false).
+			Delete(&types.PathPermission{}).Error; e != nil {
+			return e
+		}
+		r.changed("groups", g.Name, ProvisioningChangeDelete)
+	}
+	return nil
+}
+
+func (r *provisioningReconciler) users(users []types.User) error {
+	saved := make([]types.User, 0)
+	if e := r.tx.Find(&saved).Error; e != nil {
+		return e
+	}
+	savedUsers := make(map[string]types.User, len(saved))
+	for _, u := range saved {
+		savedUsers[u.Username] = u
+	}
+	ugs := make([]types.UserGroup, 0)
+	if e := r.tx.Find(&ugs).Error; e != nil {
+		return e
+	}
+	savedGroups := make(map[string][]string)
+	for _, ug := range ugs {
+		savedGroups[ug.Username] = append(savedGroups[ug.Username], ug.GroupName)
+	}
+
+	declared := make(map[string]bool, len(users))
+	for _, u := range users {
+		declared[u.Username] = true
+		old, ok := savedUsers[u.Username]
+		password, e := provisionPassword(u.Username, old.Password, u.Password)
+		if e != nil {
+			return e
+		}
+		groups := make([]string, 0, len(u.Groups))
+		for _, g := range u.Groups {
+			groups = append(groups, g.Name)
+		}
+		sort.Strings(groups)
+		oldGroups := savedGroups[u.Username]
+		sort.Strings(oldGroups)
+
+		item := types.User{
+			Username: u.Username, Password: password, RootPath: u.RootPath, SSHKeys: u.SSHKeys, Managed: true,
+		}
+		if ok && old.Managed && old.Source == "" && old.Password == item.Password && old.RootPath == item.RootPath &&
+			old.SSHKeys == item.SSHKeys && strings.Join(groups, "\n") == strings.Join(oldGroups, "\n") {
+			continue
+		}
+		if e := r.tx.Omit("Groups").Save(&item).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Where("`username` = ?", u.Username).Delete(&types.UserGroup{}).Error; e != nil {
+			return e
+		}
+		for _, g := range groups {
+			if e := r.tx.Create(&types.UserGroup{Username: u.Username, GroupName: g}).Error; e != nil {
+				return e
+			}
+		}
+		r.changed("users", u.Username, createOrUpdate(ok))
+	}
+	for _, u := range saved {
+		if !u.Managed || declared[u.Username] {
+			continue
+		}
+		if e := r.tx.Delete(&types.User{}, "`username` = ?", u.Username).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Where("`username` = ?", u.Username).Delete(&types.UserGroup{}).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Where("`username` = ?", u.Username).Delete(&types.AccessKey{}).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Where("`subject` = ? AND `managed` = ?", types.UserSubject(u.Username), false).
+			Delete(&types.PathPermission{}).Error; e != nil {
+			return e
+		}
+		r.changed("users", u.Username, ProvisioningChangeDelete)
+	}
+	return nil
+}
+
+// provisionPassword returns the bcrypt hash to save,
+// the saved hash is kept if the password is empty or matches it
+func provisionPassword(username, saved, password string) (string, error) {
+	if password == "" {
+		if saved == "" {
+			return "", fmt.Errorf("the password of user '%s' is required", username)
+		}
+		return saved, nil
+	}
+	if _, e := bcrypt.Cost([]byte(password)); e == nil {
+		return password, nil
+	}
+	if saved != "" && bcrypt.CompareHashAndPassword([]byte(saved), []byte(password)) == nil {
+		return saved, nil
+	}
+	encoded, e := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(encoded), e
+}
+
+func (r *provisioningReconciler) drives(drives []types.Drive) error {
+	saved := make([]types.Drive, 0)
+	if e := r.tx.Find(&saved).Error; e != nil {
+		return e
+	}
+	savedDrives := make(map[string]types.Drive, len(saved))
+	for _, d := range saved {
+		savedDrives[d.Name] = d
+	}
+	declared := make(map[string]bool, len(drives))
+	for _, d := range drives {
+		declared[d.Name] = true
+		d.Managed = true
+		old, ok := savedDrives[d.Name]
+		if ok {
+			old.Config = normalizeJSONConfig(old.Config)
+		}
+		if ok && old == d {
+			continue
+		}
+		if e := r.tx.Save(&d).Error; e != nil {
+			return e
+		}
+		r.changed("drives", d.Name, createOrUpdate(ok))
+	}
+	for _, d := range saved {
+		if !d.Managed || declared[d.Name] {
+			continue
+		}
+		if e := r.tx.Delete(&types.Drive{}, "`name` = ?", d.Name).Error; e != nil {
+			return e
+		}
+		if e := r.tx.Delete(&types.DriveData{}, "`drive` = ?", d.Name).Error; e != nil {
+			return e
+		}
+		r.changed("drives", d.Name, ProvisioningChangeDelete)
+	}
+	return nil
+}
+
+// normalizeJSONConfig encodes the config again to compare it with the declared config
+func normalizeJSONConfig(config string) string {
+	m := make(map[string]any)
+	if e := json.Unmarshal([]byte(config), &m); e != nil {
+		return config
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+func (r *provisioningReconciler) pathPermissions(permissions []types.PathPermission) error {
+	saved := make([]types.PathPermission, 0)
+	if e := r.tx.Find(&saved).Error; e != nil {
+		return e
+	}
+	key := func(p types.PathPermission) string { return *p.Path + "\n" + p.Subject }
+	savedPermissions := make(map[string]types.PathPermission, len(saved))
+	for _, p := range saved {
+		savedPermissions[key(p)] = p
+	}
+	declared := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		k := key(p)
+		declared[k] = true
+		old, ok := savedPermissions[k]
+		if ok && old.Managed && old.Permission == p.Permission && old.Policy == p.Policy {
+			continue
+		}
+		p.ID = old.ID
+		p.Managed = true
+		if e := r.tx.Save(&p).Error; e != nil {
+			return e
+		}
+		r.changed("pathPermissions", "/"+*p.Path+" "+p.Subject, createOrUpdate(ok))
+	}
+	for _, p := range saved {
+		if !p.Managed || declared[key(p)] {
+			continue
+		}
+		if e := r.tx.Delete(&types.PathPermission{}, "`id` = ?", p.ID).Error; e != nil {
+			return e
+		}
+		r.changed("pathPermissions", "/"+*p.Path+" "+p.Subject, ProvisioningChangeDelete)
+	}
+	return nil
+}
+
+func (r *provisioningReconciler) pathMounts(mounts []types.PathMount) error {
+	saved := make([]types.PathMount, 0)
+	if e := r.tx.Find(&saved).Error; e != nil {
+		return e
+	}
+	key := func(m types.PathMount) string { return *m.Path + "/" + m.Name }
+	savedMounts := make(map[string]types.PathMount, len(saved))
+	for _, m := range saved {
+		savedMounts[key(m)] = m
+	}
+	declared := make(map[string]bool, len(mounts))
+	for _, m := range mounts {
+		k := key(m)
+		declared[k] = true
+		old, ok := savedMounts[k]
+		if ok && old.Managed && old.MountAt == m.MountAt {
+			continue
+		}
+		m.ID = old.ID
+		m.Managed = true
+		if e := r.tx.Save(&m).Error; e != nil {
+			return e
+		}
+		r.changed("pathMounts", "/"+strings.TrimPrefix(k, "/"), createOrUpdate(ok))
+	}
+	for _, m := range saved {
+		if !m.Managed || declared[key(m)] {
+			continue
+		}
+		if e := r.tx.Delete(&types.PathMount{}, "`id` = ?", m.ID).Error; e != nil {
+			return e
+		}
+		r.changed("pathMounts", "/"+strings.TrimPrefix(key(m), "/"), ProvisioningChangeDelete)
+	}
+	return nil
+}
+
+func createOrUpdate(exists bool) string {
+	if exists {
+		return ProvisioningChangeUpdate
+	}
+	return ProvisioningChangeCreate
+}
+
+// NewManagedError is returned when changing a resource declared in the provisioning file
+func NewManagedError(name string) error {
+	return err.NewNotAllowedMessageError(i18n.T("storage.managed_by_provisioning", name))
+}
+
+// checkNotManaged returns NewManagedError if a managed row matches the query
+func checkNotManaged(tx *gorm.DB, model any, name string, query string, args ...any) error {
+	var n int64
+	if e := tx.Model(model).Where(query, args...).Where("`managed` = ?", true).Count(&n).Error; e != nil {
+		return e
+	}
+	if n > 0 {
+		return NewManagedError(name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	err "go-drive/common/errors"
+	"go-drive/common/types"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProvisioningDAO_Reconcile(t *testing.T) {
+	db, ch, cleanup := newTestDB(t)
+	defer cleanup()
+	userDAO := NewUserDAO(db, ch)
+	dao := NewProvisioningDAO(db, userDAO, ch)
+	mountDAO := NewPathMountDAO(db, ch)
+
+	root, drivePath := "", "prov-d1"
+	provisioning := Provisioning{
+		Groups: []types.Group{{Name: "prov-g1"}},
+		Users: []types.User{{
+			Username: "prov-u1", Password: "p1", Groups: []types.Group{{Name: "prov-g1"}},
+		}},
+		Drives: []types.Drive{{Name: drivePath, Type: "fs", Enabled: true, Config: `{"path":"/"}`}},
+		PathPermissions: []types.PathPermission{{
+			Path: &drivePath, Subject: types.GroupSubject("prov-g1"), Permission: types.PermissionRead,
+			Policy: types.PolicyAccept,
+		}},
+		PathMounts: []types.PathMount{{Path: &root, Name: "prov-m1", MountAt: drivePath}},
+	}
+	changes, e := dao.Reconcile(provisioning)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(changes) != 5 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	user, e := userDAO.GetUser("prov-u1")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !user.Managed || len(user.Groups) != 1 ||
+		bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("p1")) != nil {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	// nothing changed
+	if changes, e = dao.Reconcile(provisioning); e != nil || len(changes) != 0 {
+		t.Fatalf("unexpected changes: %+v, %v", changes, e)
+	}
+
+	// the managed resources can't be changed by others
+	if e := mountDAO.DeleteMounts(provisioning.PathMounts); !err.IsNotAllowedError(e) {
+		t.Errorf("expected not allowed error of deleting mounts, got %v", e)
+	}
+	if e := NewPathPermissionDAO(db, ch).SavePathPermissions(drivePath, nil); !err.IsNotAllowedError(e) {
+		t.Errorf("expected not allowed error of saving permissions, got %v", e)
+	}
+	settingsDAO := NewSettingsDAO(db, NewOptionsDAO(db, ch), NewPathMetaDAO(db, ch), NewFileBucketDAO(db, ch), userDAO, ch)
+	e = settingsDAO.Replace(Settings{Drives: []types.Drive{{Name: drivePath, Type: "fs", Config: "{}"}}})
+	if !err.IsNotAllowedError(e) {
+		t.Errorf("expected not allowed error of replacing settings, got %v", e)
+	}
+
+	// the resources removed from the provisioning are deleted
+	changes, e = dao.Reconcile(Provisioning{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, c := range changes {
+		if c.Action != ProvisioningChangeDelete {
+			t.Errorf("unexpected change: %+v", c)
+		}
+	}
+	if len(changes) != 5 {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if _, e := userDAO.GetUser("prov-u1"); !err.IsNotFoundError(e) {
+		t.Errorf("expected the user is deleted, got %v", e)
+	}
+	mounts, _ := mountDAO.GetMounts()
+	for _, m := range mounts {
+		if m.Name == "prov-m1" {
+			t.Errorf("expected the mount is deleted")
+		}
+	}
+}
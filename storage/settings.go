@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"path"
+
+	"gorm.io/gorm"
+)
+
+// Settings is the configuration stored in the database, which is managed by the admin endpoints.
+// A nil section is left untouched when replacing.
+// The resources managed by the provisioning file are neither loaded nor replaced.
+type Settings struct {
+	Drives          []types.Drive
+	PathPermissions []types.PathPermission
+	PathMounts      []types.PathMount
+	PathMeta        []types.PathMeta
+	FileBuckets     []types.FileBucket
+	Jobs            []types.Job
+	Groups          []GroupWithUsers
+	// Options are merged into the existing options
+	Options map[string]string
+}
+
+// SettingsDAO loads and replaces all the settings at once
+type SettingsDAO struct {
+	db            *DB
+	optionsDAO    *OptionsDAO
+	pathMetaDAO   *PathMetaDAO
+	fileBucketDAO *FileBucketDAO
+	userDAO       *UserDAO
+}
+
+func NewSettingsDAO(db *DB, optionsDAO *OptionsDAO, pathMetaDAO *PathMetaDAO,
+	fileBucketDAO *FileBucketDAO, userDAO *UserDAO, ch *registry.ComponentsHolder) *SettingsDAO {
+	dao := &SettingsDAO{
+		db:            db,
+		optionsDAO:    optionsDAO,
+		pathMetaDAO:   pathMetaDAO,
+		fileBucketDAO: fileBucketDAO,
+		userDAO:       userDAO,
+	}
+	ch.Add(registry.KeySettingsDAO, dao)
+	return dao
+}
+
+func (s *SettingsDAO) Load() (Settings, error) {
+	r := Settings{
+		Drives:          make([]types.Drive, 0),
+		PathPermissions: make([]types.PathPermission, 0),
+		PathMounts:      make([]types.PathMount, 0),
+		PathMeta:        make([]types.PathMeta, 0),
+		FileBuckets:     make([]types.FileBucket, 0),
+		Jobs:            make([]types.Job, 0),
+		Groups:          make([]GroupWithUsers, 0),
+		Options:         make(map[string]string),
+	}
+	db := s.db.C()
+	unmanaged := db.Where("`managed` = ?", false).Session(&gorm.Session{})
+	if e := unmanaged.Order("`name`").Find(&r.Drives).Error; e != nil {
+		return r, e
+	}
+	if e := unmanaged.Order("`path`, `subject`").Find(&r.PathPermissions).Error; e != nil {
+		return r, e
+	}
+	if e := unmanaged.Order("`path`, `name`").Find(&r.PathMounts).Error; e != nil {
+		return r, e
+	}
+	if e := db.Order("`path`").Find(&r.PathMeta).Error; e != nil {
+		return r, e
+	}
+	if e := db.Order("`name`").Find(&r.FileBuckets).Error; e != nil {
+		return r, e
+	}
+	if e := db.Order("`id`").Find(&r.Jobs).Error; e != nil {
+		return r, e
+	}
+
+	options := make([]types.Option, 0)
+	if e := db.Find(&options).Error; e != nil {
+		return r, e
+	}
+	for _, o := range options {
+		r.Options[o.Key] = o.Value
+	}
+
+	groups := make([]types.Group, 0)
+	if e := unmanaged.Order("`name`").Find(&groups).Error; e != nil {
+		return r, e
+	}
+	ugs := make([]types.UserGroup, 0)
+	if e := db.Order("`username`").Find(&ugs).Error; e != nil {
+		return r, e
+	}
+	members := make(map[string][]types.User)
+	for _, ug := range ugs {
+		members[ug.GroupName] = append(members[ug.GroupName], types.User{Username: ug.Username})
+	}
+	for _, g := range groups {
+		users := members[g.Name]
+		if users == nil {
+			users = make([]types.User, 0)
+		}
+		r.Groups = append(r.Groups, GroupWithUsers{Group: g, Users: users})
+	}
+	return r, nil
+}
+
+// Replace replaces the non-nil sections in a transaction.
+// The data of the removed drives and the completed executions of the removed jobs are deleted too.
+func (s *SettingsDAO) Replace(settings Settings) error {
+	e := s.db.C().Transaction(func(tx *gorm.DB) error {
+		if settings.Drives != nil {
+			if e := replaceDrives(tx, settings.Drives); e != nil {
+				return e
+			}
+		}
+		if settings.PathPermissions != nil {
+			if e := replaceUnmanaged(tx, &types.PathPermission{}, settings.PathPermissions,
+				func(p *types.PathPermission) error {
+					p.ID = 0
+					return checkNotManaged(tx, &types.PathPermission{}, "/"+*p.Path+" "+p.Subject,
+						"`path` = ? AND `subject` = ?", *p.Path, p.Subject)
+				}); e != nil {
+				return e
+			}
+		}
+		if settings.PathMounts != nil {
+			if e := replaceUnmanaged(tx, &types.PathMount{}, settings.PathMounts,
+				func(m *types.PathMount) error {
+					m.ID = 0
+					return checkNotManaged(tx, &types.PathMount{}, path.Join(*m.Path, m.Name),
+						"`path` = ? AND `name` = ?", *m.Path, m.Name)
+				}); e != nil {
+				return e
+			}
+		}
+		if settings.PathMeta != nil {
+			if e := replaceAll(tx, &types.PathMeta{}, settings.PathMeta, nil); e != nil {
+				return e
+			}
+		}
+		if settings.FileBuckets != nil {
+			if e := replaceAll(tx, &types.FileBucket{}, settings.FileBuckets, nil); e != nil {
+				return e
+			}
+		}
+		if settings.Jobs != nil {
+			if e := replaceJobs(tx, settings.Jobs); e != nil {
+				return e
+			}
+		}
+		if settings.Groups != nil {
+			if e := replaceGroups(tx, settings.Groups); e != nil {
+				return e
+			}
+		}
+		for key, value := range settings.Options {
+			if e := tx.Delete(&types.Option{}, "`key` = ?", key).Error; e != nil {
+				return e
+			}
+			if e := tx.Create(&types.Option{Key: key, Value: value}).Error; e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	// the caches are evicted even if the transaction failed, they are loaded again on demand
+	s.optionsDAO.cache.Clear()
+	s.pathMetaDAO.cache.Clear()
+	s.fileBucketDAO.cache.Clear()
+	s.fileBucketDAO.reloadBuckets()
+	s.userDAO.EvictCache("")
+	return e
+}
+
+func replaceAll[T any](tx *gorm.DB, model *T, items []T, reset func(*T)) error {
+	if e := tx.Where("1 = 1").Delete(model).Error; e != nil {
+		return e
+	}
+	for i := range items {
+		item := items[i]
+		if reset != nil {
+			reset(&item)
+		}
+		if e := tx.Create(&item).Error; e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// replaceUnmanaged replaces the rows which are not managed by the provisioning file,
+// check returns an error if the item conflicts with a managed row
+func replaceUnmanaged[T any](tx *gorm.DB, model *T, items []T, check func(*T) error) error {
+	if e := tx.Where("`managed` = ?", false).Delete(model).Error; e != nil {
+		return e
+	}
+	for i := range items {
+		item := items[i]
+		if e := check(&item); e != nil {
+			return e
+		}
+		if e := tx.Create(&item).Error; e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func replaceDrives(tx *gorm.DB, drives []types.Drive) error {
+	names := make([]string, 0, len(drives))
+	if e := tx.Model(&types.Drive{}).Where("`managed` = ?", true).Pluck("name", &names).Error; e != nil {
+		return e
+	}
+	for _, d := range drives {
+		names = append(names, d.Name)
+	}
+	removed := tx.Where("1 = 1")
+	if len(names) > 0 {
+		removed = tx.Where("`drive` NOT IN ?", names)
+	}
+	if e := removed.Delete(&types.DriveData{}).Error; e != nil {
+		return e
+	}
+	return replaceUnmanaged(tx, &types.Drive{}, drives, func(d *types.Drive) error {
+		return checkNotManaged(tx, &types.Drive{}, d.Name, "`name` = ?", d.Name)
+	})
+}
+
+func replaceJobs(tx *gorm.DB, jobs []types.Job) error {
+	ids := make([]uint, 0, len(jobs))
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	removed := tx.Where("`status` IN ?", completedJobExecutionStatus)
+	if len(ids) > 0 {
+		removed = removed.Where("`job_id` NOT IN ?", ids)
+	}
+	if e := removed.Delete(&types.JobExecution{}).Error; e != nil {
+		return e
+	}
+	return replaceAll(tx, &types.Job{}, jobs, nil)
+}
+
+func replaceGroups(tx *gorm.DB, groups []GroupWithUsers) error {
+	unmanaged := tx.Model(&types.Group{}).Select("name").Where("`managed` = ?", false)
+	if e := tx.Where("`group_name` IN (?)", unmanaged).Delete(&types.UserGroup{}).Error; e != nil {
+		return e
+	}
+	if e := tx.Where("`managed` = ?", false).Delete(&types.Group{}).Error; e != nil {
+		return e
+	}
+	for _, g := range groups {
+		if e := checkNotManaged(tx, &types.Group{}, g.Name, "`name` = ?", g.Name); e != nil {
+			return e
+		}
+		if e := tx.Create(&g.Group).Error; e != nil {
+			return e
+		}
+		if e := saveUserGroup(g.Users, g.Name, tx); e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"go-drive/common/types"
+	"testing"
+)
+
+func TestSettingsDAO_Replace(t *testing.T) {
+	db, ch, cleanup := newTestDB(t)
+	defer cleanup()
+	optionsDAO := NewOptionsDAO(db, ch)
+	userDAO := NewUserDAO(db, ch)
+	fileBucketDAO := NewFileBucketDAO(db, ch)
+	jobDAO := NewJobDAO(db, ch)
+	driveDataDAO := NewDriveDataDAO(db, ch)
+	dao := NewSettingsDAO(db, optionsDAO, NewPathMetaDAO(db, ch), fileBucketDAO, userDAO, ch)
+
+	if _, e := userDAO.AddUser(types.User{Username: "settings-u1", Password: "x"}); e != nil {
+		t.Fatal(e)
+	}
+	if e := optionsDAO.Set("settings.kept", "1"); e != nil {
+		t.Fatal(e)
+	}
+	if e := driveDataDAO.GetDataStore("settings-removed").Save(types.SM{"k": "v"}); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := NewDriveDAO(db, ch).AddDrive(types.Drive{Name: "settings-removed", Type: "fs", Config: "{}"}); e != nil {
+		t.Fatal(e)
+	}
+	removedJob, e := jobDAO.AddJob(types.Job{Description: "removed", Triggers: "[]", Action: "x", ActionParams: "{}"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := jobDAO.AddJobExecution(&types.JobExecution{JobId: removedJob.ID, Status: types.JobExecutionSuccess}); e != nil {
+		t.Fatal(e)
+	}
+
+	root := ""
+	e = dao.Replace(Settings{
+		Drives:          []types.Drive{{Name: "settings-d1", Type: "fs", Enabled: true, Config: `{"path":"/"}`}},
+		PathPermissions: []types.PathPermission{{ID: 100, Path: &root, Subject: types.AnySubject, Permission: types.PermissionRead, Policy: types.PolicyAccept}},
+		FileBuckets:     []types.FileBucket{{Name: "settings-b1", TargetPath: "d1/b", SecretToken: "t", MaxSize: "0"}},
+		Jobs:            []types.Job{{ID: 1000, Description: "kept", Triggers: "[]", Action: "x", ActionParams: "{}"}},
+		Groups:          []GroupWithUsers{{Group: types.Group{Name: "settings-g1"}, Users: []types.User{{Username: "settings-u1"}}}},
+		Options:         map[string]string{"settings.new": "2"},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	s, e := dao.Load()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(s.Drives) != 1 || s.Drives[0].Name != "settings-d1" || !s.Drives[0].Enabled {
+		t.Errorf("unexpected drives: %+v", s.Drives)
+	}
+	if len(s.PathPermissions) != 1 || s.PathPermissions[0].ID == 100 || *s.PathPermissions[0].Path != "" {
+		t.Errorf("unexpected path permissions: %+v", s.PathPermissions)
+	}
+	if len(s.Jobs) != 1 || s.Jobs[0].ID != 1000 {
+		t.Errorf("unexpected jobs: %+v", s.Jobs)
+	}
+	if len(s.Groups) != 1 || len(s.Groups[0].Users) != 1 || s.Groups[0].Users[0].Username != "settings-u1" {
+		t.Errorf("unexpected groups: %+v", s.Groups)
+	}
+	if s.Options["settings.kept"] != "1" || s.Options["settings.new"] != "2" {
+		t.Errorf("unexpected options: %v", s.Options)
+	}
+	if v, _ := optionsDAO.Get("settings.new"); v != "2" {
+		t.Errorf("the options cache is not evicted: %q", v)
+	}
+	if _, e := fileBucketDAO.GetBucket("settings-b1"); e != nil {
+		t.Errorf("the buckets cache is not reloaded: %v", e)
+	}
+	if data, _ := driveDataDAO.GetDataStore("settings-removed").Load("k"); data["k"] != "" {
+		t.Errorf("the data of the removed drive is kept: %v", data)
+	}
+	if jes, _ := jobDAO.QueryJobExecutions(JobExecutionQuery{
+		JobID: removedJob.ID, Status: []string{types.JobExecutionSuccess},
+	}); len(jes) != 0 {
+		t.Errorf("the executions of the removed job are kept: %v", jes)
+	}
+
+	// nil sections are left untouched
+	if e := dao.Replace(Settings{Drives: []types.Drive{}}); e != nil {
+		t.Fatal(e)
+	}
+	s, _ = dao.Load()
+	if len(s.Drives) != 0 || len(s.Jobs) != 1 || len(s.Groups) != 1 {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+}
@@ -15,6 +15,9 @@ import (
 type UserDAO struct {
 	db    *DB
 	cache *utils.KVCache[types.User]
+
+	// onDeleted are called after users are deleted
+	onDeleted []func()
 }
 
 func NewUserDAO(db *DB, ch *registry.ComponentsHolder) *UserDAO {
@@ -64,6 +67,7 @@ func (u *UserDAO) AddUser(user types.User) (types.User, error) {
 func (u *UserDAO) UpdateUser(username string, user types.User) error {
 	data := map[string]any{
 		"root_path": user.RootPath,
+		"ssh_keys":  user.SSHKeys,
 	}
 	if user.Password != "" {
 		encoded, e := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
@@ -99,6 +103,7 @@ func (u *UserDAO) UpdateUser(username string, user types.User) error {
 
 func (u *UserDAO) DeleteUser(username string) error {
 	u.cache.Remove(username)
+	defer u.usersDeleted()
 	return u.db.C().Transaction(func(tx *gorm.DB) error {
 		s := tx.Delete(types.User{}, "`username` = ?", username)
 		if s.Error != nil {
@@ -111,6 +116,9 @@ func (u *UserDAO) DeleteUser(username string) error {
 		if e := tx.Where("`username` = ?", username).Delete(&types.UserGroup{}).Error; e != nil {
 			return e
 		}
+		if e := tx.Where("`username` = ?", username).Delete(&types.AccessKey{}).Error; e != nil {
+			return e
+		}
 		return tx.Where("`subject` = ?", types.UserSubject(username)).Delete(&types.PathPermission{}).Error
 	})
 }
@@ -132,3 +140,15 @@ func (u *UserDAO) EvictCache(username string) {
 func (u *UserDAO) Dispose() error {
 	return u.cache.Dispose()
 }
+
+// OnUsersDeleted registers fn to be called after users are deleted,
+// it must be called before the DAO is in use.
+func (u *UserDAO) OnUsersDeleted(fn func()) {
+	u.onDeleted = append(u.onDeleted, fn)
+}
+
+func (u *UserDAO) usersDeleted() {
+	for _, fn := range u.onDeleted {
+		fn()
+	}
+}
@@ -66,6 +66,20 @@ func defaultTestConfigWithDirs(dataDir, tempDir string) common.Config {
 			Prefix:        common.DefaultWebDavPrefix,
 			MaxCacheItems: common.DefaultWebDavMaxCacheItems,
 		},
+		SFTP: common.SFTPConfig{
+			Enabled:       false,
+			Listen:        common.DefaultSFTPListen,
+			HostKey:       common.DefaultSFTPHostKey,
+			MaxCacheItems: common.DefaultSFTPMaxCacheItems,
+		},
+		S3: common.S3Config{
+			Enabled: false,
+			Prefix:  common.DefaultS3Prefix,
+		},
+		FTP: common.FTPConfig{
+			Enabled: false,
+			Listen:  common.DefaultFTPListen,
+		},
 		Search: common.SearchConfig{
 			Type: common.DefaultSearcher,
 		},
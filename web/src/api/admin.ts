@@ -1,4 +1,5 @@
 import {
+  AccessKey,
   Drive,
   DriveFactoryConfig,
   DriveInitConfig,
@@ -9,14 +10,17 @@ import {
   Job,
   JobDefinitions,
   JobExecution,
+  JobExecutionQuery,
+  JobStepResult,
   PathMeta,
   PathMountSource,
   PathPermission,
   ServiceStatsItem,
+  SettingsDiff,
   Task,
   User,
 } from '@/types'
-import http, { StreamHttpResponse, streamHttp } from './http'
+import http, { StreamHttpResponse, streamHttp, textHttp } from './http'
 
 export function getUsers() {
   return http.get<User[]>('/admin/users')
@@ -38,6 +42,18 @@ export function deleteUser(username: string) {
   return http.delete<void>(`/admin/users/${username}`)
 }
 
+export function getAccessKeys(username: string) {
+  return http.get<AccessKey[]>(`/admin/users/${username}/access-keys`)
+}
+
+export function createAccessKey(username: string) {
+  return http.post<AccessKey>(`/admin/users/${username}/access-keys`)
+}
+
+export function deleteAccessKey(username: string, id: string) {
+  return http.delete<void>(`/admin/users/${username}/access-keys/${id}`)
+}
+
 export function getGroups() {
   return http.get<Group[]>('/admin/groups')
 }
@@ -132,12 +148,20 @@ export function loadStats() {
   return http.get<ServiceStatsItem[]>('/admin/stats')
 }
 
-export function searchIndex(path: string) {
+export function searchIndex(path: string, full?: boolean) {
   return http.put<Task<void>>('/admin/search-indexes', null, {
-    params: { path },
+    params: { path, full: full ? '1' : undefined },
   })
 }
 
+export function getSearchIndexSchedules() {
+  return http.get<string>('/admin/search-indexes/schedules')
+}
+
+export function saveSearchIndexSchedules(schedules: string) {
+  return http.put<void>('/admin/search-indexes/schedules', { schedules })
+}
+
 export function setOptions(options: O<string>) {
   return http.put<void>('/admin/options', options)
 }
@@ -168,12 +192,22 @@ export function deleteJob(id: number) {
   return http.delete<void>(`/admin/jobs/${id}`)
 }
 
-export function getJobExecutions(jobId: number) {
+export function getJobExecutions(jobId: number, query?: JobExecutionQuery) {
   return http.get<JobExecution[]>('/admin/job-executions', {
-    params: { jobId },
+    params: { ...query, jobId },
   })
 }
 
+export function streamJobExecutionLogs(id: number) {
+  return streamHttp.get<StreamHttpResponse>(
+    `/admin/job-executions/${id}/logs/stream`
+  )
+}
+
+export function getJobExecutionSteps(id: number) {
+  return http.get<JobStepResult[]>(`/admin/job-executions/${id}/steps`)
+}
+
 export function executeJobSync(jobId: number) {
   return streamHttp.post<StreamHttpResponse<Task>>(
     '/admin/job-executions',
@@ -251,3 +285,16 @@ export function updateFileBucket(name: string, bucket: Partial<FileBucket>) {
 export function deleteFileBucket(name: string) {
   return http.delete<void>(`/admin/file-buckets/${name}`)
 }
+
+export function exportSettings(redact: boolean) {
+  return textHttp.get<string>('/admin/settings/export', {
+    params: { redact: redact ? '1' : '' },
+  })
+}
+
+export function importSettings(yaml: string, dryRun: boolean) {
+  return http.post<SettingsDiff>('/admin/settings/import', yaml, {
+    params: { dryRun: dryRun ? '1' : '' },
+    headers: { 'content-type': 'application/yaml' },
+  })
+}
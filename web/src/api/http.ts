@@ -11,6 +11,7 @@ import {
   transformErrorResponse,
   transformJSONRequest,
   transformJSONResponse,
+  transformTextResponse,
 } from '@/utils/http/transformers'
 
 export const AUTH_PARAM = 'token'
@@ -177,3 +178,18 @@ export default createHttp({
     },
   ],
 })
+
+// textHttp resolves the non-JSON responses as text
+export const textHttp = createHttp({
+  ...BASE_CONFIG,
+  transformRequest: [processConfig, transformJSONRequest],
+  transformResponse: [
+    transformTextResponse([]),
+    transformJSONResponse,
+    transformErrorResponse,
+    (error, resp) => {
+      if (error) return handlerError(error)
+      return resp.data
+    },
+  ],
+})
@@ -12,6 +12,7 @@ export interface Drive {
   enabled: boolean
   type: string
   config: string
+  managed?: boolean
 }
 
 export interface DriveInitOAuth {
@@ -47,6 +48,7 @@ export interface PathPermission {
   subject: string
   permission: PathPermissionPerm
   policy: PathPermissionPolicy
+  managed?: boolean
 }
 
 export interface PathMeta {
@@ -96,8 +98,20 @@ export interface Job {
   actionParams: string
 
   enabled: boolean
+
+  maxRetries: number
+  retryDelay: number
+  timeout: number
+  concurrency: JobConcurrency
+  onSuccess: number
+  onFailure: number
+  maxLogLines: number
+  keepExecutions: number
+
   triggersInfo: {
     cron?: { nextRun: string }[]
+    interval?: { nextRun: string }[]
+    webhook?: { url: string }[]
   }
 }
 
@@ -108,13 +122,36 @@ export type ParsedJobTrigger =
     }
   | {
       type: 'entry'
-      config: { pathPattern: string; eventTypes: string }
+      config: {
+        pathPattern: string
+        namePattern?: string
+        eventTypes: string
+        quietPeriod?: string
+        maxWait?: string
+        maxBatchSize?: string
+      }
+    }
+  | {
+      type: 'interval'
+      config: { interval: string; jitter?: string }
+    }
+  | {
+      type: 'startup'
+      config: Record<string, never>
+    }
+  | {
+      type: 'webhook'
+      config: { secret: string }
     }
 
+export type JobConcurrency = '' | 'allow' | 'skip' | 'queue'
+
 export enum JobExecutionStatus {
+  Queued = 'queued',
   Running = 'running',
   Success = 'success',
   Failed = 'failed',
+  Skipped = 'skipped',
 }
 
 export interface JobExecution {
@@ -125,6 +162,39 @@ export interface JobExecution {
   status: JobExecutionStatus
   logs?: string
   errorMsg?: string
+  triggerType?: string
+  attempts: number
+  parentId?: number
+}
+
+export type JobLogLevel = 'info' | 'warn' | 'error'
+
+export interface JobLogEntry {
+  /** unix timestamp in milliseconds, 0 for the logs before the logs were structured */
+  time: number
+  level: JobLogLevel
+  message: string
+}
+
+export interface JobExecutionQuery {
+  /** comma separated statuses */
+  status?: string
+  /** start time range in milliseconds */
+  from?: number
+  to?: number
+  /** keyword in the logs or the error message */
+  q?: string
+  limit?: number
+}
+
+export interface JobStepResult {
+  action: string
+  status: JobExecutionStatus
+  startedAt: number
+  completedAt?: number
+  logs: string
+  errorMsg: string
+  output: Record<string, string> | null
 }
 
 export interface DriveScript {
@@ -165,3 +235,26 @@ export interface FileBucket {
   allowedTypes?: string
   maxSize?: string
 }
+
+export interface AccessKey {
+  id: string
+  /** The secret is only returned when the key is created. */
+  secret?: string
+  username: string
+  createdAt: number
+}
+
+export type SettingsChangeAction = 'create' | 'update' | 'delete'
+
+export interface SettingsChange {
+  section: string
+  key: string
+  action: SettingsChangeAction
+}
+
+export interface SettingsDiff {
+  changes: SettingsChange[]
+  warnings: string[]
+  /** false for dry runs, or if there are no changes */
+  applied: boolean
+}
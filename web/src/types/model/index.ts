@@ -10,6 +10,8 @@ export interface Group {
   name: string
 
   rootPath?: string
+  /** Declared in the provisioning file, it can't be changed here */
+  managed?: boolean
 
   users?: User[]
 }
@@ -23,6 +25,8 @@ export interface User {
    * external users is managed by the provider, so it cannot be edited locally.
    */
   source?: string
+  /** Declared in the provisioning file, it can't be changed here */
+  managed?: boolean
 }
 
 /**
@@ -98,7 +102,8 @@ export interface SearchHitEntry {
 
 export interface SearchHitItem {
   entry: SearchHitEntry
-  highlights: Record<keyof SearchHitEntry, string[]>
+  /** the matched snippets, the matched terms are wrapped in <mark></mark> */
+  highlights: Partial<Record<keyof SearchHitEntry | 'content', string[]>> | null
 }
 
 export interface SearchResult {
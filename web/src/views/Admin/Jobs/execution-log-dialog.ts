@@ -15,6 +15,11 @@ const ExecutionLogDialog = createDialog(
 
 export interface ExecutionLogDialogOptions extends BaseDialogOptions {
   execute: () => RequestTask<StreamHttpResponse<Task>>
+  /**
+   * the response is server-sent events of the logs of an execution,
+   * which is watched but can't be aborted in the dialog
+   */
+  sse?: boolean
 }
 
 export const showExecutionDialog = (opts: ExecutionLogDialogOptions) => {
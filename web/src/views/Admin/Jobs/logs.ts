@@ -0,0 +1,52 @@
+import type { JobLogEntry } from '@/types'
+import { formatTime } from '@/utils'
+
+/**
+ * parses the stored logs, which are JSON lines.
+ * Plain text lines stored before the logs were structured are kept as info logs.
+ */
+export const parseJobLogs = (logs?: string): JobLogEntry[] =>
+  (logs || '')
+    .split('\n')
+    .filter((line) => line)
+    .map((line) => {
+      if (line.startsWith('{')) {
+        try {
+          const entry = JSON.parse(line)
+          if (entry.level) return entry as JobLogEntry
+        } catch {
+          // plain text
+        }
+      }
+      return { time: 0, level: 'info', message: line }
+    })
+
+export const formatJobLog = (entry: JobLogEntry) =>
+  (entry.time ? `${formatTime(entry.time)} ` : '') +
+  (entry.level === 'info' ? '' : `[${entry.level.toUpperCase()}] `) +
+  entry.message
+
+export const formatJobLogs = (logs?: string) =>
+  parseJobLogs(logs).map(formatJobLog).join('\n')
+
+/**
+ * parses the server-sent events, returns the parsed events and the remaining incomplete text
+ */
+export const parseServerSentEvents = (
+  text: string
+): [{ event: string; data: string }[], string] => {
+  const blocks = text.split('\n\n')
+  const rest = blocks.pop() || ''
+  const events = blocks
+    .map((block) => {
+      let event = 'message'
+      const data: string[] = []
+      block.split('\n').forEach((line) => {
+        if (line.startsWith('event:')) event = line.substring(6).trim()
+        else if (line.startsWith('data:')) data.push(line.substring(5).trim())
+      })
+      return { event, data: data.join('\n') }
+    })
+    .filter((e) => e.data)
+  return [events, rest]
+}